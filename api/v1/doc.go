@@ -0,0 +1,6 @@
+// Package nfcv1 holds the Go code generated from nfc.proto, the gRPC
+// control API of the daemon, and from fleet.proto, the API between the
+// daemons and the central controller.
+package nfcv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative nfc.proto fleet.proto
@@ -0,0 +1,726 @@
+// The gRPC control API of nvidia-fan-control. Enable it with grpc_listen;
+// when api_token is set, every call must carry "authorization: Bearer
+// <api_token>" metadata.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.28.3
+// source: nfc.proto
+
+package nfcv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_nfc_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{0}
+}
+
+type StreamTelemetryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Index or UUID of the GPU to include; empty for all.
+	Gpu           string `protobuf:"bytes,1,opt,name=gpu,proto3" json:"gpu,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamTelemetryRequest) Reset() {
+	*x = StreamTelemetryRequest{}
+	mi := &file_nfc_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamTelemetryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamTelemetryRequest) ProtoMessage() {}
+
+func (x *StreamTelemetryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamTelemetryRequest.ProtoReflect.Descriptor instead.
+func (*StreamTelemetryRequest) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamTelemetryRequest) GetGpu() string {
+	if x != nil {
+		return x.Gpu
+	}
+	return ""
+}
+
+type SetProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       string                 `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetProfileRequest) Reset() {
+	*x = SetProfileRequest{}
+	mi := &file_nfc_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetProfileRequest) ProtoMessage() {}
+
+func (x *SetProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetProfileRequest.ProtoReflect.Descriptor instead.
+func (*SetProfileRequest) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetProfileRequest) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+type SetProfileResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       string                 `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetProfileResponse) Reset() {
+	*x = SetProfileResponse{}
+	mi := &file_nfc_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetProfileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetProfileResponse) ProtoMessage() {}
+
+func (x *SetProfileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetProfileResponse.ProtoReflect.Descriptor instead.
+func (*SetProfileResponse) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SetProfileResponse) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+type OverrideFanRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Index or UUID of the GPU.
+	Gpu string `protobuf:"bytes,1,opt,name=gpu,proto3" json:"gpu,omitempty"`
+	// Speed in percent, 0-100. Required unless release is set.
+	Speed         *int32 `protobuf:"varint,2,opt,name=speed,proto3,oneof" json:"speed,omitempty"`
+	Release       bool   `protobuf:"varint,3,opt,name=release,proto3" json:"release,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OverrideFanRequest) Reset() {
+	*x = OverrideFanRequest{}
+	mi := &file_nfc_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OverrideFanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OverrideFanRequest) ProtoMessage() {}
+
+func (x *OverrideFanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OverrideFanRequest.ProtoReflect.Descriptor instead.
+func (*OverrideFanRequest) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *OverrideFanRequest) GetGpu() string {
+	if x != nil {
+		return x.Gpu
+	}
+	return ""
+}
+
+func (x *OverrideFanRequest) GetSpeed() int32 {
+	if x != nil && x.Speed != nil {
+		return *x.Speed
+	}
+	return 0
+}
+
+func (x *OverrideFanRequest) GetRelease() bool {
+	if x != nil {
+		return x.Release
+	}
+	return false
+}
+
+type Status struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	Profile       string                 `protobuf:"bytes,3,opt,name=profile,proto3" json:"profile,omitempty"`
+	Profiles      []string               `protobuf:"bytes,4,rep,name=profiles,proto3" json:"profiles,omitempty"`
+	Paused        bool                   `protobuf:"varint,5,opt,name=paused,proto3" json:"paused,omitempty"`
+	DryRun        bool                   `protobuf:"varint,6,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	NvmlDown      bool                   `protobuf:"varint,7,opt,name=nvml_down,json=nvmlDown,proto3" json:"nvml_down,omitempty"`
+	PowerSource   string                 `protobuf:"bytes,8,opt,name=power_source,json=powerSource,proto3" json:"power_source,omitempty"`
+	Gpus          []*GPU                 `protobuf:"bytes,9,rep,name=gpus,proto3" json:"gpus,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	mi := &file_nfc_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Status) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Status) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *Status) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *Status) GetProfiles() []string {
+	if x != nil {
+		return x.Profiles
+	}
+	return nil
+}
+
+func (x *Status) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+func (x *Status) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *Status) GetNvmlDown() bool {
+	if x != nil {
+		return x.NvmlDown
+	}
+	return false
+}
+
+func (x *Status) GetPowerSource() string {
+	if x != nil {
+		return x.PowerSource
+	}
+	return ""
+}
+
+func (x *Status) GetGpus() []*GPU {
+	if x != nil {
+		return x.Gpus
+	}
+	return nil
+}
+
+type GPU struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Index    int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Name     string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Uuid     string                 `protobuf:"bytes,3,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	PciBusId string                 `protobuf:"bytes,4,opt,name=pci_bus_id,json=pciBusId,proto3" json:"pci_bus_id,omitempty"`
+	// Control temperature in °C, after smoothing.
+	Temperature    int32 `protobuf:"varint,5,opt,name=temperature,proto3" json:"temperature,omitempty"`
+	RawTemperature int32 `protobuf:"varint,6,opt,name=raw_temperature,json=rawTemperature,proto3" json:"raw_temperature,omitempty"`
+	// -1 when not reported.
+	PowerWatts    int32  `protobuf:"varint,7,opt,name=power_watts,json=powerWatts,proto3" json:"power_watts,omitempty"`
+	Utilization   int32  `protobuf:"varint,8,opt,name=utilization,proto3" json:"utilization,omitempty"`
+	Fans          []*Fan `protobuf:"bytes,9,rep,name=fans,proto3" json:"fans,omitempty"`
+	FailSafe      bool   `protobuf:"varint,10,opt,name=fail_safe,json=failSafe,proto3" json:"fail_safe,omitempty"`
+	OverrideSpeed *int32 `protobuf:"varint,11,opt,name=override_speed,json=overrideSpeed,proto3,oneof" json:"override_speed,omitempty"`
+	// Schedule cap in percent; 0 for none.
+	SpeedCap       int32    `protobuf:"varint,12,opt,name=speed_cap,json=speedCap,proto3" json:"speed_cap,omitempty"`
+	Throttle       []string `protobuf:"bytes,13,rep,name=throttle,proto3" json:"throttle,omitempty"`
+	DriverControl  bool     `protobuf:"varint,14,opt,name=driver_control,json=driverControl,proto3" json:"driver_control,omitempty"`
+	ProcessProfile string   `protobuf:"bytes,15,opt,name=process_profile,json=processProfile,proto3" json:"process_profile,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GPU) Reset() {
+	*x = GPU{}
+	mi := &file_nfc_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GPU) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GPU) ProtoMessage() {}
+
+func (x *GPU) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GPU.ProtoReflect.Descriptor instead.
+func (*GPU) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GPU) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *GPU) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *GPU) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *GPU) GetPciBusId() string {
+	if x != nil {
+		return x.PciBusId
+	}
+	return ""
+}
+
+func (x *GPU) GetTemperature() int32 {
+	if x != nil {
+		return x.Temperature
+	}
+	return 0
+}
+
+func (x *GPU) GetRawTemperature() int32 {
+	if x != nil {
+		return x.RawTemperature
+	}
+	return 0
+}
+
+func (x *GPU) GetPowerWatts() int32 {
+	if x != nil {
+		return x.PowerWatts
+	}
+	return 0
+}
+
+func (x *GPU) GetUtilization() int32 {
+	if x != nil {
+		return x.Utilization
+	}
+	return 0
+}
+
+func (x *GPU) GetFans() []*Fan {
+	if x != nil {
+		return x.Fans
+	}
+	return nil
+}
+
+func (x *GPU) GetFailSafe() bool {
+	if x != nil {
+		return x.FailSafe
+	}
+	return false
+}
+
+func (x *GPU) GetOverrideSpeed() int32 {
+	if x != nil && x.OverrideSpeed != nil {
+		return *x.OverrideSpeed
+	}
+	return 0
+}
+
+func (x *GPU) GetSpeedCap() int32 {
+	if x != nil {
+		return x.SpeedCap
+	}
+	return 0
+}
+
+func (x *GPU) GetThrottle() []string {
+	if x != nil {
+		return x.Throttle
+	}
+	return nil
+}
+
+func (x *GPU) GetDriverControl() bool {
+	if x != nil {
+		return x.DriverControl
+	}
+	return false
+}
+
+func (x *GPU) GetProcessProfile() string {
+	if x != nil {
+		return x.ProcessProfile
+	}
+	return ""
+}
+
+type Fan struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Index int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	// -1 while the driver controls the fan.
+	SpeedPercent int32 `protobuf:"varint,2,opt,name=speed_percent,json=speedPercent,proto3" json:"speed_percent,omitempty"`
+	// -1 when the fan has no tachometer reading.
+	Rpm           int32 `protobuf:"varint,3,opt,name=rpm,proto3" json:"rpm,omitempty"`
+	Failed        bool  `protobuf:"varint,4,opt,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Fan) Reset() {
+	*x = Fan{}
+	mi := &file_nfc_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Fan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Fan) ProtoMessage() {}
+
+func (x *Fan) ProtoReflect() protoreflect.Message {
+	mi := &file_nfc_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Fan.ProtoReflect.Descriptor instead.
+func (*Fan) Descriptor() ([]byte, []int) {
+	return file_nfc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Fan) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Fan) GetSpeedPercent() int32 {
+	if x != nil {
+		return x.SpeedPercent
+	}
+	return 0
+}
+
+func (x *Fan) GetRpm() int32 {
+	if x != nil {
+		return x.Rpm
+	}
+	return 0
+}
+
+func (x *Fan) GetFailed() bool {
+	if x != nil {
+		return x.Failed
+	}
+	return false
+}
+
+var File_nfc_proto protoreflect.FileDescriptor
+
+const file_nfc_proto_rawDesc = "" +
+	"\n" +
+	"\tnfc.proto\x12\x06nfc.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x12\n" +
+	"\x10GetStatusRequest\"*\n" +
+	"\x16StreamTelemetryRequest\x12\x10\n" +
+	"\x03gpu\x18\x01 \x01(\tR\x03gpu\"-\n" +
+	"\x11SetProfileRequest\x12\x18\n" +
+	"\aprofile\x18\x01 \x01(\tR\aprofile\".\n" +
+	"\x12SetProfileResponse\x12\x18\n" +
+	"\aprofile\x18\x01 \x01(\tR\aprofile\"e\n" +
+	"\x12OverrideFanRequest\x12\x10\n" +
+	"\x03gpu\x18\x01 \x01(\tR\x03gpu\x12\x19\n" +
+	"\x05speed\x18\x02 \x01(\x05H\x00R\x05speed\x88\x01\x01\x12\x18\n" +
+	"\arelease\x18\x03 \x01(\bR\areleaseB\b\n" +
+	"\x06_speed\"\xbb\x02\n" +
+	"\x06Status\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x129\n" +
+	"\n" +
+	"start_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x12\x18\n" +
+	"\aprofile\x18\x03 \x01(\tR\aprofile\x12\x1a\n" +
+	"\bprofiles\x18\x04 \x03(\tR\bprofiles\x12\x16\n" +
+	"\x06paused\x18\x05 \x01(\bR\x06paused\x12\x17\n" +
+	"\adry_run\x18\x06 \x01(\bR\x06dryRun\x12\x1b\n" +
+	"\tnvml_down\x18\a \x01(\bR\bnvmlDown\x12!\n" +
+	"\fpower_source\x18\b \x01(\tR\vpowerSource\x12\x1f\n" +
+	"\x04gpus\x18\t \x03(\v2\v.nfc.v1.GPUR\x04gpus\"\xf5\x03\n" +
+	"\x03GPU\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04uuid\x18\x03 \x01(\tR\x04uuid\x12\x1c\n" +
+	"\n" +
+	"pci_bus_id\x18\x04 \x01(\tR\bpciBusId\x12 \n" +
+	"\vtemperature\x18\x05 \x01(\x05R\vtemperature\x12'\n" +
+	"\x0fraw_temperature\x18\x06 \x01(\x05R\x0erawTemperature\x12\x1f\n" +
+	"\vpower_watts\x18\a \x01(\x05R\n" +
+	"powerWatts\x12 \n" +
+	"\vutilization\x18\b \x01(\x05R\vutilization\x12\x1f\n" +
+	"\x04fans\x18\t \x03(\v2\v.nfc.v1.FanR\x04fans\x12\x1b\n" +
+	"\tfail_safe\x18\n" +
+	" \x01(\bR\bfailSafe\x12*\n" +
+	"\x0eoverride_speed\x18\v \x01(\x05H\x00R\roverrideSpeed\x88\x01\x01\x12\x1b\n" +
+	"\tspeed_cap\x18\f \x01(\x05R\bspeedCap\x12\x1a\n" +
+	"\bthrottle\x18\r \x03(\tR\bthrottle\x12%\n" +
+	"\x0edriver_control\x18\x0e \x01(\bR\rdriverControl\x12'\n" +
+	"\x0fprocess_profile\x18\x0f \x01(\tR\x0eprocessProfileB\x11\n" +
+	"\x0f_override_speed\"j\n" +
+	"\x03Fan\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12#\n" +
+	"\rspeed_percent\x18\x02 \x01(\x05R\fspeedPercent\x12\x10\n" +
+	"\x03rpm\x18\x03 \x01(\x05R\x03rpm\x12\x16\n" +
+	"\x06failed\x18\x04 \x01(\bR\x06failed2\x85\x02\n" +
+	"\n" +
+	"FanControl\x125\n" +
+	"\tGetStatus\x12\x18.nfc.v1.GetStatusRequest\x1a\x0e.nfc.v1.Status\x12C\n" +
+	"\x0fStreamTelemetry\x12\x1e.nfc.v1.StreamTelemetryRequest\x1a\x0e.nfc.v1.Status0\x01\x12C\n" +
+	"\n" +
+	"SetProfile\x12\x19.nfc.v1.SetProfileRequest\x1a\x1a.nfc.v1.SetProfileResponse\x126\n" +
+	"\vOverrideFan\x12\x1a.nfc.v1.OverrideFanRequest\x1a\v.nfc.v1.GPUB7Z5github.com/jumbled00r/nvidia-fan-control/api/v1;nfcv1b\x06proto3"
+
+var (
+	file_nfc_proto_rawDescOnce sync.Once
+	file_nfc_proto_rawDescData []byte
+)
+
+func file_nfc_proto_rawDescGZIP() []byte {
+	file_nfc_proto_rawDescOnce.Do(func() {
+		file_nfc_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_nfc_proto_rawDesc), len(file_nfc_proto_rawDesc)))
+	})
+	return file_nfc_proto_rawDescData
+}
+
+var file_nfc_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_nfc_proto_goTypes = []any{
+	(*GetStatusRequest)(nil),       // 0: nfc.v1.GetStatusRequest
+	(*StreamTelemetryRequest)(nil), // 1: nfc.v1.StreamTelemetryRequest
+	(*SetProfileRequest)(nil),      // 2: nfc.v1.SetProfileRequest
+	(*SetProfileResponse)(nil),     // 3: nfc.v1.SetProfileResponse
+	(*OverrideFanRequest)(nil),     // 4: nfc.v1.OverrideFanRequest
+	(*Status)(nil),                 // 5: nfc.v1.Status
+	(*GPU)(nil),                    // 6: nfc.v1.GPU
+	(*Fan)(nil),                    // 7: nfc.v1.Fan
+	(*timestamppb.Timestamp)(nil),  // 8: google.protobuf.Timestamp
+}
+var file_nfc_proto_depIdxs = []int32{
+	8, // 0: nfc.v1.Status.time:type_name -> google.protobuf.Timestamp
+	8, // 1: nfc.v1.Status.start_time:type_name -> google.protobuf.Timestamp
+	6, // 2: nfc.v1.Status.gpus:type_name -> nfc.v1.GPU
+	7, // 3: nfc.v1.GPU.fans:type_name -> nfc.v1.Fan
+	0, // 4: nfc.v1.FanControl.GetStatus:input_type -> nfc.v1.GetStatusRequest
+	1, // 5: nfc.v1.FanControl.StreamTelemetry:input_type -> nfc.v1.StreamTelemetryRequest
+	2, // 6: nfc.v1.FanControl.SetProfile:input_type -> nfc.v1.SetProfileRequest
+	4, // 7: nfc.v1.FanControl.OverrideFan:input_type -> nfc.v1.OverrideFanRequest
+	5, // 8: nfc.v1.FanControl.GetStatus:output_type -> nfc.v1.Status
+	5, // 9: nfc.v1.FanControl.StreamTelemetry:output_type -> nfc.v1.Status
+	3, // 10: nfc.v1.FanControl.SetProfile:output_type -> nfc.v1.SetProfileResponse
+	6, // 11: nfc.v1.FanControl.OverrideFan:output_type -> nfc.v1.GPU
+	8, // [8:12] is the sub-list for method output_type
+	4, // [4:8] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_nfc_proto_init() }
+func file_nfc_proto_init() {
+	if File_nfc_proto != nil {
+		return
+	}
+	file_nfc_proto_msgTypes[4].OneofWrappers = []any{}
+	file_nfc_proto_msgTypes[6].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_nfc_proto_rawDesc), len(file_nfc_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_nfc_proto_goTypes,
+		DependencyIndexes: file_nfc_proto_depIdxs,
+		MessageInfos:      file_nfc_proto_msgTypes,
+	}.Build()
+	File_nfc_proto = out.File
+	file_nfc_proto_goTypes = nil
+	file_nfc_proto_depIdxs = nil
+}
@@ -0,0 +1,255 @@
+// The gRPC control API of nvidia-fan-control. Enable it with grpc_listen;
+// when api_token is set, every call must carry "authorization: Bearer
+// <api_token>" metadata.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.28.3
+// source: nfc.proto
+
+package nfcv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FanControl_GetStatus_FullMethodName       = "/nfc.v1.FanControl/GetStatus"
+	FanControl_StreamTelemetry_FullMethodName = "/nfc.v1.FanControl/StreamTelemetry"
+	FanControl_SetProfile_FullMethodName      = "/nfc.v1.FanControl/SetProfile"
+	FanControl_OverrideFan_FullMethodName     = "/nfc.v1.FanControl/OverrideFan"
+)
+
+// FanControlClient is the client API for FanControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FanControlClient interface {
+	// GetStatus returns the state of the last update.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error)
+	// StreamTelemetry sends the state after every tick of the monitoring
+	// loop until the client cancels.
+	StreamTelemetry(ctx context.Context, in *StreamTelemetryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Status], error)
+	// SetProfile switches the active profile; an empty name selects the base
+	// configuration.
+	SetProfile(ctx context.Context, in *SetProfileRequest, opts ...grpc.CallOption) (*SetProfileResponse, error)
+	// OverrideFan pins the fans of a GPU to a speed, or releases the pin.
+	OverrideFan(ctx context.Context, in *OverrideFanRequest, opts ...grpc.CallOption) (*GPU, error)
+}
+
+type fanControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFanControlClient(cc grpc.ClientConnInterface) FanControlClient {
+	return &fanControlClient{cc}
+}
+
+func (c *fanControlClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Status)
+	err := c.cc.Invoke(ctx, FanControl_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fanControlClient) StreamTelemetry(ctx context.Context, in *StreamTelemetryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Status], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FanControl_ServiceDesc.Streams[0], FanControl_StreamTelemetry_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamTelemetryRequest, Status]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FanControl_StreamTelemetryClient = grpc.ServerStreamingClient[Status]
+
+func (c *fanControlClient) SetProfile(ctx context.Context, in *SetProfileRequest, opts ...grpc.CallOption) (*SetProfileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetProfileResponse)
+	err := c.cc.Invoke(ctx, FanControl_SetProfile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fanControlClient) OverrideFan(ctx context.Context, in *OverrideFanRequest, opts ...grpc.CallOption) (*GPU, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GPU)
+	err := c.cc.Invoke(ctx, FanControl_OverrideFan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FanControlServer is the server API for FanControl service.
+// All implementations must embed UnimplementedFanControlServer
+// for forward compatibility.
+type FanControlServer interface {
+	// GetStatus returns the state of the last update.
+	GetStatus(context.Context, *GetStatusRequest) (*Status, error)
+	// StreamTelemetry sends the state after every tick of the monitoring
+	// loop until the client cancels.
+	StreamTelemetry(*StreamTelemetryRequest, grpc.ServerStreamingServer[Status]) error
+	// SetProfile switches the active profile; an empty name selects the base
+	// configuration.
+	SetProfile(context.Context, *SetProfileRequest) (*SetProfileResponse, error)
+	// OverrideFan pins the fans of a GPU to a speed, or releases the pin.
+	OverrideFan(context.Context, *OverrideFanRequest) (*GPU, error)
+	mustEmbedUnimplementedFanControlServer()
+}
+
+// UnimplementedFanControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFanControlServer struct{}
+
+func (UnimplementedFanControlServer) GetStatus(context.Context, *GetStatusRequest) (*Status, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedFanControlServer) StreamTelemetry(*StreamTelemetryRequest, grpc.ServerStreamingServer[Status]) error {
+	return status.Error(codes.Unimplemented, "method StreamTelemetry not implemented")
+}
+func (UnimplementedFanControlServer) SetProfile(context.Context, *SetProfileRequest) (*SetProfileResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetProfile not implemented")
+}
+func (UnimplementedFanControlServer) OverrideFan(context.Context, *OverrideFanRequest) (*GPU, error) {
+	return nil, status.Error(codes.Unimplemented, "method OverrideFan not implemented")
+}
+func (UnimplementedFanControlServer) mustEmbedUnimplementedFanControlServer() {}
+func (UnimplementedFanControlServer) testEmbeddedByValue()                    {}
+
+// UnsafeFanControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FanControlServer will
+// result in compilation errors.
+type UnsafeFanControlServer interface {
+	mustEmbedUnimplementedFanControlServer()
+}
+
+func RegisterFanControlServer(s grpc.ServiceRegistrar, srv FanControlServer) {
+	// If the following call panics, it indicates UnimplementedFanControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FanControl_ServiceDesc, srv)
+}
+
+func _FanControl_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FanControlServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FanControl_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FanControlServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FanControl_StreamTelemetry_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTelemetryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FanControlServer).StreamTelemetry(m, &grpc.GenericServerStream[StreamTelemetryRequest, Status]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FanControl_StreamTelemetryServer = grpc.ServerStreamingServer[Status]
+
+func _FanControl_SetProfile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetProfileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FanControlServer).SetProfile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FanControl_SetProfile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FanControlServer).SetProfile(ctx, req.(*SetProfileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FanControl_OverrideFan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OverrideFanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FanControlServer).OverrideFan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FanControl_OverrideFan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FanControlServer).OverrideFan(ctx, req.(*OverrideFanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FanControl_ServiceDesc is the grpc.ServiceDesc for FanControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FanControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nfc.v1.FanControl",
+	HandlerType: (*FanControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _FanControl_GetStatus_Handler,
+		},
+		{
+			MethodName: "SetProfile",
+			Handler:    _FanControl_SetProfile_Handler,
+		},
+		{
+			MethodName: "OverrideFan",
+			Handler:    _FanControl_OverrideFan_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTelemetry",
+			Handler:       _FanControl_StreamTelemetry_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "nfc.proto",
+}
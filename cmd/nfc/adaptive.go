@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// AdaptiveIntervalConfig varies how often a GPU is polled: every
+// max_seconds while its temperature is steady and at or below
+// idle_temperature, every min_seconds while it rises at rise_rate °C/s or
+// more or is within boundary_degrees of a range boundary, and every
+// time_to_update otherwise.
+type AdaptiveIntervalConfig struct {
+	Enabled bool `json:"enabled"`
+	MinSeconds float64 `json:"min_seconds"`
+	MaxSeconds float64 `json:"max_seconds"`
+	RiseRate float64 `json:"rise_rate"`
+	BoundaryDegrees int `json:"boundary_degrees"`
+	IdleTemperature int `json:"idle_temperature"`
+}
+
+// steadyRate is the rate of change, in °C/s, below which a temperature
+// counts as steady.
+const steadyRate = 0.1
+
+func applyAdaptiveIntervalDefaults(config *AdaptiveIntervalConfig, interval float64) {
+	if !config.Enabled {
+		return
+	}
+	if config.MinSeconds == 0 {
+		config.MinSeconds = math.Min(0.5, interval)
+	}
+	if config.MaxSeconds == 0 {
+		config.MaxSeconds = math.Max(10, interval)
+	}
+	if config.RiseRate == 0 {
+		config.RiseRate = 0.5
+	}
+	if config.BoundaryDegrees == 0 {
+		config.BoundaryDegrees = 2
+	}
+	if config.IdleTemperature == 0 {
+		config.IdleTemperature = 50
+	}
+}
+
+func validateAdaptiveInterval(config AdaptiveIntervalConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if config.MinSeconds <= 0 {
+		return fmt.Errorf("adaptive_interval: min_seconds (%g) must be positive", config.MinSeconds)
+	}
+	if config.MaxSeconds < config.MinSeconds {
+		return fmt.Errorf("adaptive_interval: max_seconds (%g) is less than min_seconds (%g)", config.MaxSeconds, config.MinSeconds)
+	}
+	if config.RiseRate < 0 || config.BoundaryDegrees < 0 {
+		return fmt.Errorf("adaptive_interval: rise_rate and boundary_degrees must not be negative")
+	}
+	return nil
+}
+
+// nearBoundary reports whether the temperature is within degrees of a
+// stepped range boundary: the minimum of a range above, or the point at
+// which the current range is left downward.
+func nearBoundary(monitor *DeviceMonitor, degrees int) bool {
+	if monitor.Settings.CurveMode != "" && monitor.Settings.CurveMode != "stepped" {
+		return false
+	}
+	temp := monitor.Temperature
+	for _, r := range monitor.Settings.TemperatureRanges {
+		if r.MinTemperature > temp && r.MinTemperature-temp <= degrees {
+			return true
+		}
+	}
+	if current := monitor.CurrentTemperatureRange; current.MaxTemperature != 0 {
+		leave := current.MinTemperature - current.Hysteresis
+		if temp >= leave && temp-leave <= degrees {
+			return true
+		}
+	}
+	return false
+}
+
+// updateInterval is how long to wait before the monitor's next update.
+func updateInterval(monitor *DeviceMonitor) time.Duration {
+	seconds := monitor.Settings.TimeToUpdate
+	if config := monitor.Settings.AdaptiveInterval; config.Enabled && monitor.ConsecutiveFailures == 0 {
+		switch {
+		case monitor.TemperatureRate >= config.RiseRate || nearBoundary(monitor, config.BoundaryDegrees):
+			seconds = config.MinSeconds
+		case math.Abs(monitor.TemperatureRate) < steadyRate && monitor.Temperature <= config.IdleTemperature:
+			seconds = config.MaxSeconds
+		}
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
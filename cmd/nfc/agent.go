@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	nfcv1 "github.com/jumbled00r/nvidia-fan-control/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ControllerConfig connects the daemon to a central controller, nfc server:
+// the daemon reports its status every interval_seconds and applies the
+// profiles the controller assigns to its host.
+type ControllerConfig struct {
+	Address string `json:"address"`
+	Token string `json:"token"`
+	CAFile string `json:"ca_file"`
+	CertFile string `json:"cert_file"`
+	KeyFile string `json:"key_file"`
+	ServerName string `json:"server_name"`
+	Host string `json:"host"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+}
+
+func applyControllerDefaults(config *ControllerConfig) {
+	if config.Host == "" {
+		config.Host, _ = os.Hostname()
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 10
+	}
+}
+
+func validateController(config ControllerConfig) error {
+	if config.Address == "" {
+		return nil
+	}
+	if config.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return fmt.Errorf("set both cert_file and key_file, or neither")
+	}
+	return nil
+}
+
+// bearerToken sends the token with every call, and only over TLS.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return true
+}
+
+// controllerCredentials sets up TLS to the controller: the server is
+// verified against caFile, or the system roots if it is empty, and
+// certFile and keyFile are presented to controllers that require a client
+// certificate.
+func controllerCredentials(caFile, certFile, keyFile, serverName string) (credentials.TransportCredentials, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s holds no PEM certificate", caFile)
+		}
+	}
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// withRemoteProfiles adds the profiles of an assignment to config, which
+// holds the profiles of the config file. data is a JSON object of profiles
+// by name; profiles without a default section fall back to the top-level
+// settings, as in the file.
+func withRemoteProfiles(config Config, data []byte) (Config, error) {
+	profiles := map[string]ProfileConfig{}
+	for name, profile := range config.Profiles {
+		profiles[name] = profile
+	}
+	if len(data) > 0 {
+		var generic map[string]interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return config, fmt.Errorf("profiles: %w", err)
+		}
+		if err := checkConfigFields(map[string]interface{}{"profiles": generic}); err != nil {
+			return config, err
+		}
+		remote := map[string]ProfileConfig{}
+		if err := json.Unmarshal(data, &remote); err != nil {
+			return config, fmt.Errorf("profiles: %w", err)
+		}
+		for name, profile := range remote {
+			normalizeProfile(&profile, *config.Default)
+			profiles[name] = profile
+		}
+	}
+	config.Profiles = profiles
+	if err := validateConfig(config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// remoteAssignment is the last assignment applied from the controller. Its
+// profiles stay merged over the config file's across reloads.
+type remoteAssignment struct {
+	Profile string
+	Profiles []byte
+}
+
+// applyAssignment merges the assigned profiles over the config file's and
+// switches to the assigned profile, if any. Nothing changes when the
+// assignment does not validate.
+func (d *Daemon) applyAssignment(assignment remoteAssignment) error {
+	if d.remote == nil && assignment.Profile == "" && len(assignment.Profiles) == 0 {
+		return nil
+	}
+	file := d.Config
+	file.Profiles = d.fileProfiles
+	config, err := withRemoteProfiles(file, assignment.Profiles)
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Profiles[assignment.Profile]; assignment.Profile != "" && !ok {
+		return fmt.Errorf("unknown profile %q", assignment.Profile)
+	}
+	d.Config = config
+	d.remote = &assignment
+	switch _, exists := config.Profiles[d.Profile]; {
+	case assignment.Profile != "" && assignment.Profile != d.Profile:
+		logInfof("Controller: switching profile from %q to %q.", d.Profile, assignment.Profile)
+		d.Profile = assignment.Profile
+	case d.Profile != "" && !exists:
+		logInfof("Controller: profile %q was withdrawn, switching to %q.", d.Profile, config.ActiveProfile)
+		d.Profile = config.ActiveProfile
+	}
+	d.applyProfile()
+	d.updateAll()
+	return nil
+}
+
+// startAgent reports to the controller and applies its assignments until
+// the returned function is called, reconnecting whenever the connection is
+// lost.
+func startAgent(config ControllerConfig, d *Daemon) func() {
+	creds, err := controllerCredentials(config.CAFile, config.CertFile, config.KeyFile, config.ServerName)
+	if err != nil {
+		logErrorf("Controller: %v. Not connecting to %s.", err, config.Address)
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		backoff := time.Second
+		revision, applyErr := "", ""
+		for {
+			connected, err := runAgentSession(config, creds, d, &revision, &applyErr, stop)
+			if err == nil {
+				return
+			}
+			if connected {
+				backoff = time.Second
+			}
+			logWarnf("Controller: %v. Reconnecting in %s.", err, backoff)
+			select {
+			case <-stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+		}
+	}()
+	logInfof("Reporting to controller %s as %s.", config.Address, config.Host)
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// runAgentSession serves one connection. It returns nil once stopped, and
+// the connection error otherwise, along with whether an assignment got
+// through before it failed.
+func runAgentSession(config ControllerConfig, creds credentials.TransportCredentials, d *Daemon, revision, applyErr *string, stop <-chan struct{}) (bool, error) {
+	conn, err := grpc.NewClient(config.Address, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(bearerToken(config.Token)))
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := nfcv1.NewFleetClient(conn).Connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	assignments := make(chan *nfcv1.Assignment)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			assignment, err := stream.Recv()
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case assignments <- assignment:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	report := func() error {
+		return stream.Send(&nfcv1.AgentReport{
+			Host: config.Host,
+			Version: version,
+			Status: statusMessage(d.Status.Snapshot(), ""),
+			Revision: *revision,
+			Error: *applyErr,
+		})
+	}
+	if err := report(); err != nil {
+		return false, err
+	}
+	ticker := time.NewTicker(time.Duration(config.IntervalSeconds * float64(time.Second)))
+	defer ticker.Stop()
+	connected := false
+	for {
+		select {
+		case <-stop:
+			stream.CloseSend()
+			return connected, nil
+		case err := <-failed:
+			return connected, err
+		case assignment := <-assignments:
+			connected = true
+			if assignment.Revision == *revision {
+				continue
+			}
+			*revision, *applyErr = assignment.Revision, ""
+			err := d.Do(func(d *Daemon) error {
+				return d.applyAssignment(remoteAssignment{Profile: assignment.Profile, Profiles: assignment.Profiles})
+			})
+			if err != nil {
+				*applyErr = err.Error()
+				logErrorf("Controller: cannot apply assignment %s, keeping the current profiles: %v", assignment.Revision, err)
+			} else {
+				logInfof("Controller: applied assignment %s.", assignment.Revision)
+			}
+		case <-ticker.C:
+		}
+		if err := report(); err != nil {
+			return connected, err
+		}
+	}
+}
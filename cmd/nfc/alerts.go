@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Alert events.
+const (
+	eventOvertemp = "overtemp"
+	eventFanFailure = "fan_failure"
+	eventFanSetpoint = "fan_setpoint"
+	eventNVMLErrors = "nvml_errors"
+	eventFailSafe = "fail_safe"
+	eventPowerLimit = "power_limit"
+	eventPanic = "panic"
+)
+
+var alertEvents = []string{eventOvertemp, eventFanFailure, eventFanSetpoint, eventNVMLErrors, eventFailSafe, eventPowerLimit, eventPanic}
+
+type AlertsConfig struct {
+	OvertempTemperature int `json:"overtemp_temperature"`
+	OvertempHysteresis int `json:"overtemp_hysteresis"`
+	ErrorUpdates int `json:"error_updates"`
+	MinIntervalSeconds float64 `json:"min_interval_seconds"`
+	Webhooks []WebhookConfig `json:"webhooks"`
+	Desktop DesktopConfig `json:"desktop"`
+}
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+	Format string `json:"format"`
+	Events []string `json:"events"`
+}
+
+// Event is one alert about a GPU. Resolved events report that the condition
+// has cleared.
+type Event struct {
+	Kind string `json:"event"`
+	Resolved bool `json:"resolved"`
+	Host string `json:"host"`
+	GPUIndex int `json:"gpu_index"`
+	GPUName string `json:"gpu_name"`
+	GPUUUID string `json:"gpu_uuid"`
+	Temperature int `json:"temperature"`
+	Message string `json:"message"`
+	Time time.Time `json:"time"`
+	Suppressed int `json:"suppressed,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func applyAlertsDefaults(config *AlertsConfig) {
+	if config.OvertempHysteresis <= 0 {
+		config.OvertempHysteresis = 3
+	}
+	if config.ErrorUpdates <= 0 {
+		config.ErrorUpdates = 10
+	}
+	if config.MinIntervalSeconds == 0 {
+		config.MinIntervalSeconds = 300
+	}
+	for i := range config.Webhooks {
+		if config.Webhooks[i].Format == "" {
+			config.Webhooks[i].Format = "json"
+		}
+	}
+}
+
+func validateAlerts(config AlertsConfig) error {
+	if config.OvertempTemperature < 0 {
+		return fmt.Errorf("overtemp_temperature (%d) is negative", config.OvertempTemperature)
+	}
+	if config.MinIntervalSeconds < 0 {
+		return fmt.Errorf("min_interval_seconds (%g) is negative", config.MinIntervalSeconds)
+	}
+	for i, webhook := range config.Webhooks {
+		if webhook.URL == "" {
+			return fmt.Errorf("webhooks[%d]: url is empty", i)
+		}
+		switch webhook.Format {
+		case "json", "slack", "discord":
+		default:
+			return fmt.Errorf("webhooks[%d]: unknown format %q, expected json, slack or discord", i, webhook.Format)
+		}
+		for _, event := range webhook.Events {
+			if !slices.Contains(alertEvents, event) {
+				return fmt.Errorf("webhooks[%d]: unknown event %q", i, event)
+			}
+		}
+	}
+	for _, event := range config.Desktop.Events {
+		if !slices.Contains(alertEvents, event) {
+			return fmt.Errorf("desktop: unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// alertDispatcher delivers events to the webhooks and the desktop from a
+// goroutine of its own, so a slow endpoint never holds up the control loop.
+// Events for the same sink, kind, state and GPU are sent at most once per
+// min_interval_seconds; the ones in between are counted and reported with
+// the next one.
+type alertDispatcher struct {
+	mu sync.Mutex
+	config AlertsConfig
+	lastSent map[string]time.Time
+	suppressed map[string]int
+	queue chan func()
+	listeners map[int]func(Event)
+	nextListener int
+}
+
+var alerts = &alertDispatcher{}
+
+func (a *alertDispatcher) configure(config AlertsConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config = config
+	if a.queue == nil {
+		a.lastSent = map[string]time.Time{}
+		a.suppressed = map[string]int{}
+		a.queue = make(chan func(), 64)
+		go func() {
+			for send := range a.queue {
+				send()
+			}
+		}()
+	}
+}
+
+func (a *alertDispatcher) settings() AlertsConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.config
+}
+
+// emit raises an event for the monitor's GPU.
+func (a *alertDispatcher) emit(monitor *DeviceMonitor, kind string, resolved bool, format string, args ...interface{}) {
+	a.emitDetails(monitor, kind, resolved, nil, format, args...)
+}
+
+// emitDetails is emit with extra values for hooks. Events other than the
+// alert events only go to the listeners.
+func (a *alertDispatcher) emitDetails(monitor *DeviceMonitor, kind string, resolved bool, details map[string]string, format string, args ...interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.config.Webhooks) == 0 && !a.config.Desktop.Enabled && len(a.listeners) == 0 {
+		return
+	}
+	host, _ := os.Hostname()
+	event := Event{
+		Kind: kind,
+		Resolved: resolved,
+		Host: host,
+		GPUIndex: monitor.Index,
+		GPUName: monitor.Name,
+		GPUUUID: monitor.UUID,
+		Temperature: monitor.Temperature,
+		Message: fmt.Sprintf(format, args...),
+		Time: time.Now(),
+		Details: details,
+	}
+	alert := slices.Contains(alertEvents, kind)
+	for i, webhook := range a.config.Webhooks {
+		if !alert || len(webhook.Events) > 0 && !slices.Contains(webhook.Events, kind) {
+			continue
+		}
+		webhook := webhook
+		a.enqueue(fmt.Sprintf("%d", i), event, func(event Event) { sendWebhook(webhook, event) })
+	}
+	if desktop := a.config.Desktop; alert && desktop.Enabled && (len(desktop.Events) == 0 || slices.Contains(desktop.Events, kind)) {
+		a.enqueue("desktop", event, func(event Event) { sendDesktopNotification(desktop, event) })
+	}
+	// Listeners get every event, without the rate limit.
+	for _, listener := range a.listeners {
+		listener := listener
+		select {
+		case a.queue <- func() { listener(event) }:
+		default:
+			logWarnf("Alert queue is full, dropping %s alert for GPU %d.", event.Kind, event.GPUIndex)
+		}
+	}
+}
+
+// listen calls listener with every event until the returned function is
+// called.
+func (a *alertDispatcher) listen(listener func(Event)) func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listeners == nil {
+		a.listeners = map[int]func(Event){}
+	}
+	id := a.nextListener
+	a.nextListener++
+	a.listeners[id] = listener
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.listeners, id)
+	}
+}
+
+// enqueue hands the event to send unless the same sink sent it for the same
+// GPU less than min_interval_seconds ago.
+func (a *alertDispatcher) enqueue(sink string, event Event, send func(Event)) {
+	key := fmt.Sprintf("%s/%s/%t/%s", sink, event.Kind, event.Resolved, event.GPUUUID)
+	interval := time.Duration(a.config.MinIntervalSeconds * float64(time.Second))
+	if last, ok := a.lastSent[key]; ok && event.Time.Sub(last) < interval {
+		a.suppressed[key]++
+		return
+	}
+	a.lastSent[key] = event.Time
+	event.Suppressed = a.suppressed[key]
+	delete(a.suppressed, key)
+	select {
+	case a.queue <- func() { send(event) }:
+	default:
+		logWarnf("Alert queue is full, dropping %s alert for GPU %d.", event.Kind, event.GPUIndex)
+	}
+}
+
+func alertText(event Event) string {
+	text := fmt.Sprintf("[%s] GPU %d (%s): %s", event.Host, event.GPUIndex, event.GPUName, event.Message)
+	if event.Suppressed > 0 {
+		text += fmt.Sprintf(" (%d similar alert(s) suppressed)", event.Suppressed)
+	}
+	return text
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func sendWebhook(webhook WebhookConfig, event Event) {
+	var payload interface{} = event
+	switch webhook.Format {
+	case "slack":
+		payload = map[string]string{"text": alertText(event)}
+	case "discord":
+		payload = map[string]string{"content": alertText(event)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logErrorf("Failed to encode %s alert: %v", event.Kind, err)
+		return
+	}
+	response, err := webhookClient.Post(webhook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logFields{"gpu_index": event.GPUIndex, "event": event.Kind}.Errorf("Failed to send %s alert for GPU %d: %v", event.Kind, event.GPUIndex, err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		logFields{"gpu_index": event.GPUIndex, "event": event.Kind, "status": response.StatusCode}.Errorf("Webhook rejected %s alert for GPU %d: %s", event.Kind, event.GPUIndex, response.Status)
+	}
+}
+
+// checkOvertemp raises an overtemp event when the control temperature
+// reaches overtemp_temperature, and resolves it once it has dropped
+// overtemp_hysteresis degrees below.
+func checkOvertemp(monitor *DeviceMonitor) {
+	config := alerts.settings()
+	if config.OvertempTemperature <= 0 {
+		return
+	}
+	switch {
+	case !monitor.Overtemp && monitor.Temperature >= config.OvertempTemperature:
+		monitor.Overtemp = true
+		alerts.emit(monitor, eventOvertemp, false, "temperature %d°C reached the %d°C alert threshold", monitor.Temperature, config.OvertempTemperature)
+	case monitor.Overtemp && monitor.Temperature <= config.OvertempTemperature-config.OvertempHysteresis:
+		monitor.Overtemp = false
+		alerts.emit(monitor, eventOvertemp, true, "temperature back down to %d°C", monitor.Temperature)
+	}
+}
+
+// checkErrorAlert raises an nvml_errors event once error_updates updates in
+// a row have failed, and resolves it on the next successful one.
+func checkErrorAlert(monitor *DeviceMonitor) {
+	config := alerts.settings()
+	switch {
+	case !monitor.ErrorAlerted && monitor.ConsecutiveFailures >= config.ErrorUpdates && config.ErrorUpdates > 0:
+		monitor.ErrorAlerted = true
+		alerts.emit(monitor, eventNVMLErrors, false, "%d updates in a row failed, errors so far: %v", monitor.ConsecutiveFailures, monitor.ErrorCounts)
+	case monitor.ErrorAlerted && monitor.ConsecutiveFailures == 0:
+		monitor.ErrorAlerted = false
+		alerts.emit(monitor, eventNVMLErrors, true, "updates are succeeding again")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+const backendHWMon = "hwmon"
+
+const drmClassPath = "/sys/class/drm"
+
+// hwmonBackend drives an amdgpu fan through its hwmon directory: pwm1_enable
+// selects manual (1) or automatic (2) control and pwm1 takes a 0-255 duty.
+type hwmonBackend struct{}
+
+func (hwmonBackend) Name() string {
+	return backendHWMon
+}
+
+func (hwmonBackend) SetManual(monitor *DeviceMonitor, fanIdx int) nvml.Return {
+	return writeHWMon(monitor, "pwm1_enable", 1)
+}
+
+func (hwmonBackend) SetSpeed(monitor *DeviceMonitor, fanIdx int, speed int) nvml.Return {
+	return writeHWMon(monitor, "pwm1", int(math.Round(float64(speed)*255/100)))
+}
+
+func (hwmonBackend) RestoreAuto(monitor *DeviceMonitor, fanIdx int) nvml.Return {
+	return writeHWMon(monitor, "pwm1_enable", 2)
+}
+
+// hwmonReturn maps file errors onto NVML codes: a missing attribute means
+// the card does not offer it, anything else is not worth retrying.
+func hwmonReturn(err error) nvml.Return {
+	switch {
+	case err == nil:
+		return nvml.SUCCESS
+	case errors.Is(err, fs.ErrNotExist):
+		return nvml.ERROR_NOT_SUPPORTED
+	default:
+		return nvml.ERROR_OPERATING_SYSTEM
+	}
+}
+
+func writeHWMon(monitor *DeviceMonitor, name string, value int) nvml.Return {
+	err := os.WriteFile(filepath.Join(monitor.HWMon, name), []byte(strconv.Itoa(value)), 0644)
+	if err != nil {
+		logFields{"gpu_index": monitor.Index, "hwmon": monitor.HWMon}.Warnf("GPU %d: %v", monitor.Index, err)
+	}
+	return hwmonReturn(err)
+}
+
+func readSysfsInt(path string) (int, nvml.Return) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, hwmonReturn(err)
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, nvml.ERROR_OPERATING_SYSTEM
+	}
+	return value, nvml.SUCCESS
+}
+
+// hwmonTemperature reads the edge sensor for "gpu" and the memory sensor for
+// "memory", found by their labels since the numbering differs between
+// generations.
+func hwmonTemperature(monitor *DeviceMonitor, sensor string) (int, nvml.Return) {
+	label := "edge"
+	if sensor == device.SensorMemory {
+		label = "mem"
+	}
+	input := ""
+	labels, _ := filepath.Glob(filepath.Join(monitor.HWMon, "temp*_label"))
+	for _, path := range labels {
+		if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == label {
+			input = strings.TrimSuffix(path, "_label") + "_input"
+			break
+		}
+	}
+	if input == "" && sensor == device.SensorMemory {
+		return 0, nvml.ERROR_NOT_SUPPORTED
+	}
+	if input == "" {
+		input = filepath.Join(monitor.HWMon, "temp1_input")
+	}
+	millidegrees, ret := readSysfsInt(input)
+	return int(math.Round(float64(millidegrees) / 1000)), ret
+}
+
+func hwmonPowerUsage(monitor *DeviceMonitor) (uint32, nvml.Return) {
+	microwatts, ret := readSysfsInt(filepath.Join(monitor.HWMon, "power1_average"))
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		microwatts, ret = readSysfsInt(filepath.Join(monitor.HWMon, "power1_input"))
+	}
+	return uint32(microwatts / 1000), ret
+}
+
+func hwmonUtilization(monitor *DeviceMonitor) (int, nvml.Return) {
+	return readSysfsInt(filepath.Join(monitor.HWMon, "device", "gpu_busy_percent"))
+}
+
+func hwmonFanSpeed(hwmon string) int {
+	duty, ret := readSysfsInt(filepath.Join(hwmon, "pwm1"))
+	if ret != nvml.SUCCESS {
+		return 0
+	}
+	return int(math.Round(float64(duty) * 100 / 255))
+}
+
+// findAMDGPUs lists the hwmon directories of amdgpu cards that expose fan
+// control, in card order.
+func findAMDGPUs() []string {
+	cards, _ := filepath.Glob(filepath.Join(drmClassPath, "card[0-9]*"))
+	sort.Slice(cards, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(cards[i]), "card"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(cards[j]), "card"))
+		return a < b
+	})
+	hwmons := []string{}
+	for _, card := range cards {
+		if strings.Contains(filepath.Base(card), "-") {
+			continue
+		}
+		driver, err := os.Readlink(filepath.Join(card, "device", "driver"))
+		if err != nil || filepath.Base(driver) != "amdgpu" {
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(card, "device", "hwmon", "hwmon*", "pwm1"))
+		if len(matches) > 0 {
+			hwmons = append(hwmons, filepath.Dir(matches[0]))
+		}
+	}
+	return hwmons
+}
+
+// initAMDGPUs sets up the amdgpu cards, numbered from firstIndex so they
+// follow the NVIDIA GPUs.
+func initAMDGPUs(config Config, firstIndex int) []DeviceMonitor {
+	monitors := []DeviceMonitor{}
+	hwmons := findAMDGPUs()
+	for k, hwmon := range hwmons {
+		if monitor, ok := initAMDGPU(config, config.ActiveProfile, firstIndex+k, hwmon); ok {
+			monitors = append(monitors, monitor)
+		}
+	}
+	if len(hwmons) > 0 {
+		logInfof("Found %d AMD device(s).", len(hwmons))
+	}
+	return monitors
+}
+
+func initAMDGPU(config Config, profile string, i int, hwmon string) (DeviceMonitor, bool) {
+	monitor := newDeviceMonitor(config, i, []int{hwmonFanSpeed(hwmon)})
+	monitor.HWMon = hwmon
+	devicePath, _ := filepath.EvalSymlinks(filepath.Join(hwmon, "device"))
+	monitor.PCIBusID = filepath.Base(devicePath)
+	monitor.Name = "AMD " + monitor.PCIBusID
+	if data, err := os.ReadFile(filepath.Join(hwmon, "device", "product_name")); err == nil && strings.TrimSpace(string(data)) != "" {
+		monitor.Name = strings.TrimSpace(string(data))
+	}
+	// amdgpu has no UUID; unique_id is only reported by some generations.
+	monitor.UUID = "AMD-" + monitor.PCIBusID
+	if data, err := os.ReadFile(filepath.Join(hwmon, "device", "unique_id")); err == nil && strings.TrimSpace(string(data)) != "" {
+		monitor.UUID = "AMD-" + strings.TrimSpace(string(data))
+	}
+	if !managedDevice(config, &monitor) {
+		logFields{"gpu_index": i, "gpu_name": monitor.Name, "hwmon": hwmon}.Infof("Device %d (%s) is not selected by include/exclude. Skipping.", i, monitor.Name)
+		return DeviceMonitor{}, false
+	}
+	monitor.Temperature, _ = hwmonTemperature(&monitor, device.SensorGPU)
+	monitor.Backend = hwmonBackend{}
+	monitor.BackendMode = backendHWMon
+	applyCalibration(config, &monitor)
+	bindDeviceConfig(activeProfile(config, profile), &monitor)
+	logFields{"gpu_index": i, "gpu_name": monitor.Name, "gpu_uuid": monitor.UUID, "hwmon": hwmon, "temperature": monitor.Temperature, "fan_speeds": monitor.CurrentFanSpeeds}.Infof("Initialized GPU %d (%s): Temp=%d°C, FanSpeeds=%v%%", i, monitor.Name, monitor.Temperature, monitor.CurrentFanSpeeds)
+	return monitor, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type fanRequest struct {
+	Speed *int `json:"speed"`
+	Release bool `json:"release"`
+}
+
+type profileRequest struct {
+	Profile string `json:"profile"`
+}
+
+func registerAPI(mux *http.ServeMux, d *Daemon, token string) {
+	mux.Handle("GET /api/v1/gpus", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		snapshot := d.Status.Snapshot()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"profile": snapshot.Profile,
+			"profiles": snapshot.Profiles,
+			"paused": snapshot.Paused,
+			"time": snapshot.Time,
+			"gpus": snapshot.Devices,
+		})
+	}))
+	for _, command := range []string{"pause", "resume"} {
+		mux.Handle("POST /api/v1/"+command, requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+			if err := handleControlRequest(SocketRequest{Command: command}, d); err != nil {
+				writeError(w, http.StatusServiceUnavailable, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]bool{"paused": command == "pause"})
+		}))
+	}
+	mux.Handle("POST /api/v1/gpus/{id}/fan", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		var request fanRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if !request.Release && (request.Speed == nil || *request.Speed < 0 || *request.Speed > 100) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("speed must be between 0 and 100, or release must be true"))
+			return
+		}
+		id := r.PathValue("id")
+		status, err := overrideFan(d, id, request.Speed, request.Release)
+		if err == errNotFound {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no managed GPU %q", id))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	}))
+	mux.Handle("POST /api/v1/profile", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		var request profileRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if err := d.Do(func(d *Daemon) error { return d.SetProfile(request.Profile) }); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profileRequest{Profile: request.Profile})
+	}))
+	logInfof("REST API enabled under /api/v1/.")
+}
+
+var errNotFound = errors.New("not found")
+
+// overrideFan pins the fans of the GPU with the given index or UUID to
+// speed, or releases the pin, and applies it at once.
+func overrideFan(d *Daemon, id string, speed *int, release bool) (DeviceStatus, error) {
+	var status DeviceStatus
+	err := d.Do(func(d *Daemon) error {
+		monitor := findMonitor(d.Monitors, id)
+		if monitor == nil {
+			return errNotFound
+		}
+		if release {
+			monitor.OverrideSpeed = nil
+			logInfof("API released fan override for GPU %d.", monitor.Index)
+		} else {
+			pinned := *speed
+			monitor.OverrideSpeed = &pinned
+			logInfof("API set fan override for GPU %d to %d%%.", monitor.Index, pinned)
+		}
+		d.updateMonitor(monitor)
+		publishStatus(d, 0)
+		status = deviceStatus(monitor)
+		return nil
+	})
+	return status, err
+}
+
+// findMonitor accepts either the NVML index or the UUID of a GPU.
+func findMonitor(monitors []DeviceMonitor, id string) *DeviceMonitor {
+	index, err := strconv.Atoi(id)
+	for i := range monitors {
+		if (err == nil && monitors[i].Index == index) || strings.EqualFold(monitors[i].UUID, id) {
+			return &monitors[i]
+		}
+	}
+	return nil
+}
+
+func requireToken(token string, handler http.HandlerFunc) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+const (
+	backendNVML = "nvml"
+	backendNVControl = "nvcontrol"
+	backendAuto = "auto"
+)
+
+// fanBackend writes fan settings. Errors are reported as NVML return codes
+// so the retry and recovery logic treats every backend alike.
+type fanBackend interface {
+	Name() string
+	SetManual(monitor *DeviceMonitor, fanIdx int) nvml.Return
+	SetSpeed(monitor *DeviceMonitor, fanIdx int, speed int) nvml.Return
+	RestoreAuto(monitor *DeviceMonitor, fanIdx int) nvml.Return
+}
+
+type NVControlConfig struct {
+	Display string `json:"display"`
+}
+
+type nvmlBackend struct{}
+
+func (nvmlBackend) Name() string {
+	return backendNVML
+}
+
+func (nvmlBackend) SetManual(monitor *DeviceMonitor, fanIdx int) nvml.Return {
+	noPolicy := monitor.FanAPI.NoPolicy
+	ret := device.SetManualFanControl(gpuBackend, monitor.Handle, &monitor.FanAPI, fanIdx)
+	if !noPolicy && monitor.FanAPI.NoPolicy {
+		logFields{"gpu_index": monitor.Index}.Infof("GPU %d does not support fan control policies, setting the speed alone.", monitor.Index)
+	}
+	return ret
+}
+
+func (nvmlBackend) SetSpeed(monitor *DeviceMonitor, fanIdx int, speed int) nvml.Return {
+	return gpuBackend.DeviceSetFanSpeed_v2(monitor.Handle, fanIdx, speed)
+}
+
+func (nvmlBackend) RestoreAuto(monitor *DeviceMonitor, fanIdx int) nvml.Return {
+	return device.RestoreAutoFanSpeed(gpuBackend, monitor.Handle, monitor.FanAPI, fanIdx)
+}
+
+// nvcontrolBackend drives the fans through nvidia-settings, which needs a
+// running X server and Coolbits with bit 2 (value 4) set. nvidia-settings
+// numbers fans across all GPUs, so the GPU's first fan is at FanBase.
+type nvcontrolBackend struct {
+	display string
+}
+
+func (b nvcontrolBackend) Name() string {
+	return backendNVControl
+}
+
+func (b nvcontrolBackend) SetManual(monitor *DeviceMonitor, fanIdx int) nvml.Return {
+	return b.assign(fmt.Sprintf("[gpu:%d]/GPUFanControlState=1", monitor.Index))
+}
+
+func (b nvcontrolBackend) SetSpeed(monitor *DeviceMonitor, fanIdx int, speed int) nvml.Return {
+	return b.assign(fmt.Sprintf("[fan:%d]/GPUTargetFanSpeed=%d", monitor.FanBase+fanIdx, speed))
+}
+
+func (b nvcontrolBackend) RestoreAuto(monitor *DeviceMonitor, fanIdx int) nvml.Return {
+	return b.assign(fmt.Sprintf("[gpu:%d]/GPUFanControlState=0", monitor.Index))
+}
+
+func (b nvcontrolBackend) assign(assignment string) nvml.Return {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "nvidia-settings", "-c", b.display, "-a", assignment).CombinedOutput()
+	if err != nil || strings.Contains(string(output), "ERROR") {
+		logWarnf("nvidia-settings -a %s failed: %v: %s", assignment, err, strings.TrimSpace(string(output)))
+		return nvml.ERROR_OPERATING_SYSTEM
+	}
+	return nvml.SUCCESS
+}
+
+// describeFanAPI lists the legacy NVML calls a GPU is driven with.
+func describeFanAPI(api device.FanAPI) string {
+	calls := []string{}
+	if api.Legacy {
+		calls = append(calls, "speed read with DeviceGetFanSpeed")
+	}
+	if api.NoPolicy {
+		calls = append(calls, "no control policy, restored with DeviceSetDefaultFanSpeed_v2")
+	}
+	return strings.Join(calls, ", ")
+}
+
+func validateFanBackend(config Config) error {
+	switch config.FanBackend {
+	case backendNVML, backendNVControl, backendAuto:
+		return nil
+	default:
+		return fmt.Errorf("unknown fan_backend %q, expected \"nvml\", \"nvcontrol\" or \"auto\"", config.FanBackend)
+	}
+}
+
+func newFanBackend(config Config) fanBackend {
+	if config.FanBackend == backendNVControl {
+		return nvcontrolBackend{display: config.NVControl.Display}
+	}
+	return nvmlBackend{}
+}
+
+// nvcontrolFanBase counts the fans of the GPUs before index, which is where
+// nvidia-settings starts numbering the fans of this GPU.
+func nvcontrolFanBase(index int) int {
+	base := 0
+	for i := 0; i < index; i++ {
+		device, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		numFans, ret := gpuBackend.DeviceGetNumFans(device)
+		if ret != nvml.SUCCESS || numFans <= 0 {
+			numFans = 1
+		}
+		base += numFans
+	}
+	return base
+}
+
+// fallBackToNVControl switches a GPU to nvidia-settings when the driver
+// refuses NVML fan control and fan_backend is auto.
+func fallBackToNVControl(monitor *DeviceMonitor, ret nvml.Return) bool {
+	if monitor.BackendMode != backendAuto || ret != nvml.ERROR_NOT_SUPPORTED || monitor.Backend.Name() != backendNVML {
+		return false
+	}
+	logFields{"gpu_index": monitor.Index}.Warnf("GPU %d does not support NVML fan control, falling back to nvidia-settings.", monitor.Index)
+	monitor.Backend = nvcontrolBackend{display: monitor.NVControlDisplay}
+	return true
+}
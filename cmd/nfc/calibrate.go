@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+type CalibrationPoint struct {
+	Duty int `json:"duty"`
+	RPM int `json:"rpm"`
+}
+
+// FanCalibration is the measured duty/RPM curve of a GPU's fans, as written
+// by the calibrate command. Points are sorted by duty.
+type FanCalibration struct {
+	Name string `json:"name"`
+	Time time.Time `json:"time"`
+	MinSpinDuty int `json:"min_spin_duty"`
+	Points []CalibrationPoint `json:"points"`
+}
+
+// loadCalibrations reads the calibration file, keyed by GPU UUID. A missing
+// file means no GPU is calibrated.
+func loadCalibrations(file string) (map[string]FanCalibration, error) {
+	calibrations := map[string]FanCalibration{}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return calibrations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &calibrations); err != nil {
+		return nil, fmt.Errorf("failed to parse calibration file %s: %w", file, err)
+	}
+	return calibrations, nil
+}
+
+func saveCalibrations(file string, calibrations map[string]FanCalibration) error {
+	data, err := json.MarshalIndent(calibrations, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// RPM estimates the speed the fans reach at duty, interpolating between the
+// measured points.
+func (c *FanCalibration) RPM(duty int) int {
+	if len(c.Points) == 0 {
+		return -1
+	}
+	if duty <= c.Points[0].Duty {
+		return c.Points[0].RPM
+	}
+	for i := 1; i < len(c.Points); i++ {
+		lower, upper := c.Points[i-1], c.Points[i]
+		if duty <= upper.Duty {
+			return lower.RPM + (duty-lower.Duty)*(upper.RPM-lower.RPM)/(upper.Duty-lower.Duty)
+		}
+	}
+	return c.Points[len(c.Points)-1].RPM
+}
+
+// Duty is the lowest duty expected to reach rpm, or the highest measured
+// duty if the fans cannot spin that fast.
+func (c *FanCalibration) Duty(rpm int) int {
+	if len(c.Points) == 0 {
+		return -1
+	}
+	for i, p := range c.Points {
+		if p.RPM < rpm {
+			continue
+		}
+		if i == 0 || p.RPM == c.Points[i-1].RPM {
+			return p.Duty
+		}
+		lower := c.Points[i-1]
+		return lower.Duty + (rpm-lower.RPM)*(p.Duty-lower.Duty)/(p.RPM-lower.RPM)
+	}
+	return c.Points[len(c.Points)-1].Duty
+}
+
+// applyCalibration attaches the stored calibration of the monitor's GPU, if
+// there is one.
+func applyCalibration(config Config, monitor *DeviceMonitor) {
+	monitor.Calibration = nil
+	if calibration, ok := config.Calibrations[monitor.UUID]; ok && len(calibration.Points) > 0 {
+		monitor.Calibration = &calibration
+		logFields{"gpu_index": monitor.Index, "min_spin_duty": calibration.MinSpinDuty}.Infof("GPU %d is calibrated: fans spin from %d%%, %d RPM at full speed.", monitor.Index, calibration.MinSpinDuty, calibration.RPM(100))
+	}
+}
+
+// spinFloor raises a duty the fans were measured not to spin at to the
+// lowest one they do. 0% is left alone, as it deliberately stops them.
+func spinFloor(monitor *DeviceMonitor, speed int) int {
+	if monitor.Calibration != nil && speed > 0 && speed < monitor.Calibration.MinSpinDuty {
+		return monitor.Calibration.MinSpinDuty
+	}
+	return speed
+}
+
+func cmdCalibrate(args []string) {
+	flags := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file")
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	gpu := flags.Int("gpu", -1, "index of the GPU to calibrate (default all)")
+	step := flags.Int("step", 5, "duty step in percent")
+	settle := flags.Duration("settle", 4*time.Second, "time to let the fans settle at each step")
+	maxTemperature := flags.Int("max-temperature", 80, "abort a GPU's calibration at this temperature")
+	verbose := flags.Bool("verbose", false, "also print the daemon's log messages")
+	flags.Parse(args)
+	if *step < 1 || *step > 50 {
+		exitf("--step must be between 1 and 50")
+	}
+	if _, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"}); err == nil {
+		exitf("the daemon is running; stop it before calibrating")
+	}
+	if !*verbose {
+		setLogHandler(&sinkHandler{level: slog.LevelWarn, write: writerSink(os.Stderr)})
+	}
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		exitf("%s: %v", *configFile, err)
+	}
+	nvmlCleanup, err := initNVML()
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer nvmlCleanup()
+	monitors, err := initDevices(config)
+	if err != nil {
+		exitf("%v", err)
+	}
+	selected := []DeviceMonitor{}
+	for _, monitor := range monitors {
+		if *gpu < 0 || monitor.Index == *gpu {
+			// Measure the raw fan response, without a previous calibration
+			// raising the low duties.
+			monitor.Calibration = nil
+			selected = append(selected, monitor)
+		}
+	}
+	if len(selected) == 0 {
+		exitf("GPU %d was not found or has no controllable fans", *gpu)
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, syscall.SIGINT, syscall.SIGTERM)
+	defer restoreAutoFanPolicy(selected)
+
+	for i := range selected {
+		monitor := &selected[i]
+		fmt.Printf("GPU %d: %s: stepping %d fan(s) from %d%% to %d%%\n", monitor.Index, monitor.Name, monitor.NumFans, monitor.MinFanSpeed, monitor.MaxFanSpeed)
+		calibration := FanCalibration{Name: monitor.Name, Time: time.Now(), MinSpinDuty: -1}
+		duties := []int{}
+		for duty := monitor.MinFanSpeed; duty < monitor.MaxFanSpeed; duty += *step {
+			duties = append(duties, duty)
+		}
+		duties = append(duties, monitor.MaxFanSpeed)
+		aborted := false
+		for _, duty := range duties {
+			if _, _, ok := writeFanSpeeds(monitor, uniformFanSpeeds(monitor, duty)); !ok {
+				fmt.Printf("GPU %d: cannot set the fans to %d%%, skipping\n", monitor.Index, duty)
+				aborted = true
+				break
+			}
+			select {
+			case <-interrupted:
+				fmt.Println("Interrupted, restoring automatic fan control.")
+				return
+			case <-time.After(*settle):
+			}
+			if !readSensors(monitor) {
+				fmt.Printf("GPU %d: cannot read the temperature, skipping\n", monitor.Index)
+				aborted = true
+				break
+			}
+			rpm := monitor.FanRPMs[0]
+			if rpm < 0 {
+				fmt.Printf("GPU %d: the fans report no RPM, skipping\n", monitor.Index)
+				aborted = true
+				break
+			}
+			fmt.Printf("  %3d%%  %5d RPM  %d°C\n", duty, rpm, monitor.Temperature)
+			calibration.Points = append(calibration.Points, CalibrationPoint{Duty: duty, RPM: rpm})
+			if calibration.MinSpinDuty < 0 && rpm > config.FanFailure.MaxRPM {
+				calibration.MinSpinDuty = duty
+			}
+			if monitor.Temperature >= *maxTemperature {
+				fmt.Printf("GPU %d: reached %d°C, stopping early\n", monitor.Index, monitor.Temperature)
+				writeFanSpeeds(monitor, uniformFanSpeeds(monitor, monitor.MaxFanSpeed))
+				aborted = true
+				break
+			}
+		}
+		restoreAutoFanPolicy(selected[i : i+1])
+		if aborted {
+			continue
+		}
+		if calibration.MinSpinDuty < 0 {
+			fmt.Printf("GPU %d: the fans never spun up, not saving\n", monitor.Index)
+			continue
+		}
+		config.Calibrations[monitor.UUID] = calibration
+		fmt.Printf("GPU %d: fans spin from %d%%, %d RPM at %d%%\n", monitor.Index, calibration.MinSpinDuty, calibration.RPM(monitor.MaxFanSpeed), monitor.MaxFanSpeed)
+	}
+	if err := saveCalibrations(config.CalibrationFile, config.Calibrations); err != nil {
+		exitf("%v", err)
+	}
+	fmt.Printf("Saved %s\n", config.CalibrationFile)
+}
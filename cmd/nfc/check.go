@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// Exit codes of the monitoring plugin API.
+const (
+	checkOK = 0
+	checkWarning = 1
+	checkCritical = 2
+	checkUnknown = 3
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+func checkExit(state int, summary string, perfdata []string) {
+	line := fmt.Sprintf("NFC %s - %s", checkStates[state], summary)
+	if len(perfdata) > 0 {
+		line += " | " + strings.Join(perfdata, " ")
+	}
+	fmt.Println(line)
+	os.Exit(state)
+}
+
+// readDeviceStatuses reads the GPUs directly, for when the daemon is not
+// running: only the temperature, the fan duties and the first fan's RPM.
+func readDeviceStatuses() ([]DeviceStatus, error) {
+	nvmlCleanup, err := initNVML()
+	if err != nil {
+		return nil, err
+	}
+	defer nvmlCleanup()
+	count, ret := gpuBackend.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("unable to get NVIDIA device count: %v", nvml.ErrorString(ret))
+	}
+	devices := []DeviceStatus{}
+	for i := 0; i < count; i++ {
+		handle, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("GPU %d: %v", i, nvml.ErrorString(ret))
+		}
+		temp, ret := gpuBackend.DeviceGetTemperature(handle, nvml.TEMPERATURE_GPU)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("GPU %d: failed to read the temperature: %v", i, nvml.ErrorString(ret))
+		}
+		d := DeviceStatus{Index: i, Temperature: int(temp)}
+		d.Name, _ = gpuBackend.DeviceGetName(handle)
+		d.UUID, _ = gpuBackend.DeviceGetUUID(handle)
+		fanAPI, _ := device.ProbeFanAPI(gpuBackend, handle)
+		numFans := fanAPI.NumFans
+		for fanIdx := 0; fanIdx < numFans; fanIdx++ {
+			speed, _ := device.ReadFanSpeed(gpuBackend, handle, fanAPI, fanIdx)
+			d.FanSpeeds = append(d.FanSpeeds, speed)
+			d.FanRPMs = append(d.FanRPMs, -1)
+		}
+		if info, ret := gpuBackend.DeviceGetFanSpeedRPM(handle); ret == nvml.SUCCESS && numFans > 0 {
+			d.FanRPMs[0] = int(info.Speed)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// checkDevices rates the GPUs against the thresholds: a GPU at or above
+// critTemp, with a failed fan or in fail-safe is critical and one at or
+// above warnTemp a warning. It returns the state, the problems found and
+// the perfdata.
+func checkDevices(devices []DeviceStatus, warnTemp, critTemp int) (int, []string, []string) {
+	state := checkOK
+	problems := []string{}
+	perfdata := []string{}
+	raise := func(to int, format string, args ...interface{}) {
+		state = max(state, to)
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	for _, d := range devices {
+		switch {
+		case d.Temperature >= critTemp:
+			raise(checkCritical, "GPU %d at %dC (>= %dC)", d.Index, d.Temperature, critTemp)
+		case d.Temperature >= warnTemp:
+			raise(checkWarning, "GPU %d at %dC (>= %dC)", d.Index, d.Temperature, warnTemp)
+		}
+		for fanIdx, failed := range d.FanFailed {
+			if failed {
+				raise(checkCritical, "GPU %d fan %d failed", d.Index, fanIdx)
+			}
+		}
+		if d.FailSafe {
+			raise(checkCritical, "GPU %d in fail-safe", d.Index)
+		}
+		perfdata = append(perfdata, fmt.Sprintf("'gpu%d_temperature'=%d;%d;%d", d.Index, d.Temperature, warnTemp, critTemp))
+		for fanIdx, speed := range d.FanSpeeds {
+			perfdata = append(perfdata, fmt.Sprintf("'gpu%d_fan%d_duty'=%d%%;;;0;100", d.Index, fanIdx, speed))
+		}
+		for fanIdx, rpm := range d.FanRPMs {
+			if rpm >= 0 {
+				perfdata = append(perfdata, fmt.Sprintf("'gpu%d_fan%d_rpm'=%d;;;0", d.Index, fanIdx, rpm))
+			}
+		}
+	}
+	return state, problems, perfdata
+}
+
+func cmdCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	warnTemp := flags.Int("warn-temp", 80, "temperature in °C from which a GPU is a warning")
+	critTemp := flags.Int("crit-temp", 90, "temperature in °C from which a GPU is critical")
+	gpu := flags.String("gpu", "", "index or UUID of the GPU to check (default all)")
+	flags.Parse(args)
+	if *warnTemp > *critTemp {
+		checkExit(checkUnknown, fmt.Sprintf("--warn-temp (%d) is above --crit-temp (%d)", *warnTemp, *critTemp), nil)
+	}
+	var devices []DeviceStatus
+	note := ""
+	if response, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"}); err == nil {
+		devices = response.Status.Devices
+	} else if devices, err = readDeviceStatuses(); err != nil {
+		checkExit(checkUnknown, err.Error(), nil)
+	} else {
+		note = " (daemon not running)"
+	}
+	if *gpu != "" {
+		selected := []DeviceStatus{}
+		for _, d := range devices {
+			if fmt.Sprint(d.Index) == *gpu || strings.EqualFold(d.UUID, *gpu) {
+				selected = append(selected, d)
+			}
+		}
+		devices = selected
+	}
+	if len(devices) == 0 {
+		checkExit(checkUnknown, "no GPUs found", nil)
+	}
+	state, problems, perfdata := checkDevices(devices, *warnTemp, *critTemp)
+	if len(problems) > 0 {
+		checkExit(state, strings.Join(problems, ", ")+note, perfdata)
+	}
+	temps := []string{}
+	for _, d := range devices {
+		temps = append(temps, fmt.Sprintf("GPU %d at %dC", d.Index, d.Temperature))
+	}
+	checkExit(state, strings.Join(temps, ", ")+note, perfdata)
+}
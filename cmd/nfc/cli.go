@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+var version = "dev"
+
+const usage = `Usage: nvidia-fan-control [command] [flags]
+
+Commands:
+  run          run the fan control daemon (default)
+  init         write a starting configuration file
+  import       convert a fan curve from GreenWithEnvy, MSI Afterburner or fancontrol
+  install      install the daemon as a systemd unit (a service on Windows)
+  uninstall    stop and remove the unit
+  validate     check the configuration file and exit
+  schema       print the JSON Schema of the configuration file
+  status       print the state of the running daemon, or of the GPUs if it is not running
+  top          show a live view of the running daemon
+  pause        hand the fans back to the driver until resumed
+  resume       resume fan control after pause
+  profile      show or switch the active profile of the running daemon
+  set          set a fixed fan speed, or the automatic policy, once and exit
+  calibrate    measure the RPM of every fan across its duty range
+  simulate     replay a temperature trace through the configured curve
+  curve        preview the fan speed the configured curve commands at each temperature
+  history      print the recorded temperature and fan history
+  stats        print the temperature, range and fan speed statistics of the running daemon
+  healthcheck  exit non-zero unless the running daemon is healthy
+  check        check GPU temperatures as a Nagios/Icinga plugin
+  server       run the central controller that daemons with a controller section report to
+  agents       list the daemons reporting to a controller
+  version      print the version, the NVML and driver versions and what each GPU supports
+
+Run "nvidia-fan-control <command> -h" for the flags of a command.
+`
+
+func main() {
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "run":
+		cmdRun(args)
+	case "init":
+		cmdInit(args)
+	case "import":
+		cmdImport(args)
+	case "install":
+		cmdInstall(args)
+	case "uninstall":
+		cmdUninstall(args)
+	case "validate":
+		cmdValidate(args)
+	case "schema":
+		cmdSchema(args)
+	case "status":
+		cmdStatus(args)
+	case "top":
+		cmdTop(args)
+	case "pause", "resume":
+		cmdControl(command, args)
+	case "profile":
+		cmdProfile(args)
+	case "set":
+		cmdSet(args)
+	case "calibrate":
+		cmdCalibrate(args)
+	case "simulate":
+		cmdSimulate(args)
+	case "curve":
+		cmdCurve(args)
+	case "history":
+		cmdHistory(args)
+	case "stats":
+		cmdStats(args)
+	case "service":
+		cmdService(args)
+	case "healthcheck":
+		cmdHealthcheck(args)
+	case "check":
+		cmdCheck(args)
+	case "server":
+		cmdServer(args)
+	case "agents":
+		cmdAgents(args)
+	case "version":
+		cmdVersion(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+func exitf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func cmdRun(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	options := RunOptions{}
+	flags.StringVar(&options.ConfigFile, "config", findConfigFile(), "path to the config file (.json, .yaml, .yml or .toml), or NFC_CONFIG")
+	flags.StringVar(&options.LogFile, "log-file", "", "path to the log file, overriding log.file (default "+defaultLogFile+")")
+	flags.Float64Var(&options.Interval, "interval", envInterval(), "override time_to_update for all GPUs, in seconds (or NFC_INTERVAL)")
+	flags.BoolVar(&options.Foreground, "foreground", false, "log to stderr instead of the log file")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "run the control loop and log fan changes without writing them")
+	flags.BoolVar(&options.Force, "force", false, "start even if another instance holds the pid file")
+	flags.BoolVar(&options.Container, "container", inContainer(), "container mode: log to stdout, skip the pid file and wait for NVML (or NFC_CONTAINER; detected by default)")
+	flags.BoolVar(&options.Once, "once", false, "update every GPU once, print what was done and exit, leaving the fans set")
+	flags.Parse(args)
+	if options.Once {
+		if !runOnce(options) {
+			os.Exit(1)
+		}
+		return
+	}
+	if isService() {
+		runService(options)
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, platformSignals...)...)
+	runDaemon(options, signals)
+}
+
+func cmdValidate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file")
+	flags.Parse(args)
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		exitf("%s: %v", *configFile, err)
+	}
+	if warnings := configWarnings(config); len(warnings) > 0 {
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, warning)
+		}
+		exitf("%s: %d problem(s) found", *configFile, len(warnings))
+	}
+	fmt.Printf("%s: OK\n%s\n", *configFile, describeConfig(config))
+}
+
+func cmdStatus(args []string) {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	asJSON := flags.Bool("json", false, "print the daemon status as JSON")
+	flags.Parse(args)
+	response, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"})
+	if err == nil {
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(response.Status)
+			return
+		}
+		printStatus(*response.Status)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v\nDaemon not reachable, reading GPUs directly.\n", err)
+	nvmlCleanup, err := initNVML()
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer nvmlCleanup()
+	count, ret := gpuBackend.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		exitf("unable to get NVIDIA device count: %v", nvml.ErrorString(ret))
+	}
+	for i := 0; i < count; i++ {
+		handle, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			fmt.Printf("GPU %d: unavailable: %v\n", i, nvml.ErrorString(ret))
+			continue
+		}
+		name, _ := gpuBackend.DeviceGetName(handle)
+		temp, _ := gpuBackend.DeviceGetTemperature(handle, nvml.TEMPERATURE_GPU)
+		fanAPI, _ := device.ProbeFanAPI(gpuBackend, handle)
+		speeds := make([]int, fanAPI.NumFans)
+		for fanIdx := range speeds {
+			speeds[fanIdx], _ = device.ReadFanSpeed(gpuBackend, handle, fanAPI, fanIdx)
+		}
+		fmt.Printf("GPU %d: %s: Temp=%d°C, FanSpeeds=%v%%\n", i, name, int(temp), speeds)
+	}
+}
+
+func printStatus(status StatusSnapshot) {
+	state := "running"
+	if status.Paused {
+		state = "paused"
+	}
+	if status.DryRun {
+		state += " (dry run)"
+	}
+	if status.PowerSource != "" {
+		state += " on " + status.PowerSource
+	}
+	fmt.Printf("Daemon %s since %s, profile %q, last update %s\n", state, status.StartTime.Format(time.RFC3339), status.Profile, status.Time.Format(time.RFC3339))
+	for _, d := range status.Devices {
+		fmt.Printf("GPU %d: %s: Temp=%d°C", d.Index, d.Name, d.Temperature)
+		if d.Sensor != device.SensorGPU {
+			fmt.Printf(" (%s)", d.Sensor)
+		}
+		if len(d.SensorTemperatures) > 0 {
+			fmt.Printf(" %v", d.SensorTemperatures)
+		}
+		fmt.Printf(", FanSpeeds=%v%%", d.FanSpeeds)
+		for fanIdx, rpm := range d.FanRPMs {
+			if rpm >= 0 {
+				fmt.Printf(", Fan%d=%dRPM", fanIdx, rpm)
+			}
+			if fanIdx == 0 && d.ExpectedRPM > 0 {
+				fmt.Printf(" (expected %d)", d.ExpectedRPM)
+			}
+			if fanIdx == 0 && d.TargetRPM > 0 {
+				fmt.Printf(" (target %d)", d.TargetRPM)
+			}
+			if fanIdx < len(d.FanFailed) && d.FanFailed[fanIdx] {
+				fmt.Printf(", Fan%d FAILED", fanIdx)
+			}
+		}
+		if d.TemperatureRange != nil {
+			fmt.Printf(", Range=%d..%d°C", d.TemperatureRange.MinTemperature, d.TemperatureRange.MaxTemperature)
+		}
+		if d.Group != "" {
+			fmt.Printf(", Group %s at %d°C", d.Group, d.GroupTemperature)
+		}
+		if d.OverrideSpeed != nil {
+			fmt.Printf(", Override=%d%%", *d.OverrideSpeed)
+		}
+		if d.FailSafe {
+			fmt.Printf(", FAIL-SAFE")
+		}
+		if d.Panic {
+			fmt.Printf(", PANIC")
+		}
+		if d.DriverControl {
+			fmt.Printf(", driver control")
+		}
+		if d.ProcessProfile != "" {
+			fmt.Printf(", Profile=%q", d.ProcessProfile)
+		}
+		for _, class := range d.Throttle {
+			fmt.Printf(", THROTTLING (%s)", class)
+		}
+		if len(d.Errors) > 0 {
+			fmt.Printf(", Errors=%v", d.Errors)
+		}
+		if d.ErrorClasses[device.ErrorTransient] > 0 {
+			fmt.Printf(", TransientErrors=%d", d.ErrorClasses[device.ErrorTransient])
+		}
+		fmt.Println()
+	}
+}
+
+func cmdControl(command string, args []string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	flags.Parse(args)
+	if _, err := sendControlRequest(*socketPath, SocketRequest{Command: command}); err != nil {
+		exitf("%s: %v", command, err)
+	}
+	fmt.Printf("fan control %sd\n", command)
+}
+
+func cmdProfile(args []string) {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	clear := flags.Bool("clear", false, "return to the top-level settings")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: nvidia-fan-control profile [flags] [name]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 || (*clear && flags.NArg() > 0) {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if flags.NArg() == 0 && !*clear {
+		response, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"})
+		if err != nil {
+			exitf("profile: %v", err)
+		}
+		fmt.Printf("active profile: %q\navailable: %v\n", response.Status.Profile, response.Status.Profiles)
+		return
+	}
+	name := flags.Arg(0)
+	if _, err := sendControlRequest(*socketPath, SocketRequest{Command: "profile", Profile: name}); err != nil {
+		exitf("profile: %v", err)
+	}
+	if name == "" {
+		fmt.Println("switched to the top-level settings")
+		return
+	}
+	fmt.Printf("switched to profile %q\n", name)
+}
+
+// parseFans turns "all" or a comma-separated list of fan indices into the
+// indices to set.
+func parseFans(value string, numFans int) ([]int, error) {
+	fans := []int{}
+	if value == "all" {
+		for fanIdx := 0; fanIdx < numFans; fanIdx++ {
+			fans = append(fans, fanIdx)
+		}
+		return fans, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		fanIdx, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fan %q, expected all or a list of indices", part)
+		}
+		if fanIdx < 0 || fanIdx >= numFans {
+			return nil, fmt.Errorf("fan %d does not exist, the GPU has %d fan(s)", fanIdx, numFans)
+		}
+		fans = append(fans, fanIdx)
+	}
+	return fans, nil
+}
+
+func cmdSet(args []string) {
+	flags := flag.NewFlagSet("set", flag.ExitOnError)
+	gpu := flags.Int("gpu", 0, "index of the GPU")
+	fan := flags.String("fan", "all", `fans to set: "all" or a comma-separated list of indices`)
+	speed := flags.Int("speed", -1, "fan speed in percent (0-100)")
+	auto := flags.Bool("auto", false, "hand the fans back to the driver's automatic policy instead")
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket, to warn when it is running")
+	flags.Parse(args)
+	if *auto == (*speed >= 0) {
+		exitf("exactly one of --speed and --auto is required")
+	}
+	if !*auto && *speed > 100 {
+		exitf("--speed must be between 0 and 100")
+	}
+	if _, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"}); err == nil {
+		fmt.Fprintf(os.Stderr, "warning: the daemon is running and will override this on its next update; pause it first\n")
+	}
+	nvmlCleanup, err := initNVML()
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer nvmlCleanup()
+	handle, ret := gpuBackend.DeviceGetHandleByIndex(*gpu)
+	if ret != nvml.SUCCESS {
+		exitf("unable to get handle for device %d: %v", *gpu, nvml.ErrorString(ret))
+	}
+	fanAPI, ret := device.ProbeFanAPI(gpuBackend, handle)
+	if ret != nvml.SUCCESS || fanAPI.NumFans <= 0 {
+		exitf("device %d reports no controllable fans", *gpu)
+	}
+	fans, err := parseFans(*fan, fanAPI.NumFans)
+	if err != nil {
+		exitf("--fan: %v", err)
+	}
+	if *auto {
+		for _, fanIdx := range fans {
+			if ret := device.RestoreAutoFanSpeed(gpuBackend, handle, fanAPI, fanIdx); ret != nvml.SUCCESS {
+				exitf("failed to restore automatic policy for GPU %d Fan %d: %v", *gpu, fanIdx, nvml.ErrorString(ret))
+			}
+		}
+		fmt.Printf("GPU %d: restored automatic policy for fan(s) %v\n", *gpu, fans)
+		return
+	}
+	if minSpeed, maxSpeed := device.FanSpeedLimits(gpuBackend, handle); *speed < minSpeed || *speed > maxSpeed {
+		exitf("GPU %d only accepts fan speeds of %d-%d%%", *gpu, minSpeed, maxSpeed)
+	}
+	for _, fanIdx := range fans {
+		if ret := device.SetManualFanControl(gpuBackend, handle, &fanAPI, fanIdx); ret != nvml.SUCCESS {
+			exitf("failed to set manual policy for GPU %d Fan %d: %v", *gpu, fanIdx, nvml.ErrorString(ret))
+		}
+		if ret := gpuBackend.DeviceSetFanSpeed_v2(handle, fanIdx, *speed); ret != nvml.SUCCESS {
+			exitf("failed to set speed for GPU %d Fan %d to %d%%: %v", *gpu, fanIdx, *speed, nvml.ErrorString(ret))
+		}
+	}
+	fmt.Printf("GPU %d: set fan(s) %v to %d%%\n", *gpu, fans, *speed)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// inContainer reports whether the daemon runs in a container, which
+// NFC_CONTAINER forces either way. Docker, Podman and Kubernetes are
+// detected.
+func inContainer() bool {
+	if value := os.Getenv("NFC_CONTAINER"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			exitf("NFC_CONTAINER (%q) must be true or false", value)
+		}
+		return enabled
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// nvmlWaitTimeout is how long a container waits for NVML at startup.
+const nvmlWaitTimeout = time.Minute
+
+// waitForNVML initializes NVML, retrying until timeout. In a container the
+// library and device nodes are injected by the NVIDIA container toolkit,
+// and on a node that is still booting the driver may not be loaded yet.
+func waitForNVML(timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		cleanup, err := initNVML()
+		if err == nil || time.Now().After(deadline) {
+			return cleanup, err
+		}
+		logWarnf("%v. Is the NVIDIA container toolkit set up? Retrying.", err)
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+)
+
+type FanController interface {
+	FanSpeed(temp int, monitor *DeviceMonitor) int
+}
+
+type steppedController struct {
+	ranges []TemperatureRange
+}
+
+func (c *steppedController) FanSpeed(temp int, monitor *DeviceMonitor) int {
+	speed, current := curve.Step(temp, curveSpeed(monitor), monitor.CurrentTemperatureRange, c.ranges)
+	monitor.CurrentTemperatureRange = current
+	return speed
+}
+
+type interpolatedController struct {
+	points []CurvePoint
+	hysteresis int
+}
+
+func (c *interpolatedController) FanSpeed(temp int, monitor *DeviceMonitor) int {
+	return curve.InterpolateWithHysteresis(temp, curveSpeed(monitor), c.points, c.hysteresis)
+}
+
+type pidController struct {
+	pid curve.PID
+}
+
+func (c *pidController) FanSpeed(temp int, monitor *DeviceMonitor) int {
+	return c.pid.Speed(temp, clock())
+}
+
+func newFanController(config ControlConfig) FanController {
+	switch config.CurveMode {
+	case "interpolated":
+		return &interpolatedController{points: config.CurvePoints, hysteresis: config.CurveHysteresis}
+	case "pid":
+		return &pidController{pid: curve.PID{Config: config.PID}}
+	default:
+		return &steppedController{ranges: config.TemperatureRanges}
+	}
+}
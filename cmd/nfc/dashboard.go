@@ -0,0 +1,19 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardPage is a single page that polls the REST API, so it needs the
+// same token and has no state of its own on the server.
+//go:embed dashboard.html
+var dashboardPage []byte
+
+func registerDashboard(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardPage)
+	})
+	logInfof("Web dashboard enabled at /.")
+}
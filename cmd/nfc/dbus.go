@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	dbusName = "org.nfc.FanControl"
+	dbusPath = dbus.ObjectPath("/org/nfc/FanControl")
+	dbusGPUInterface = dbusName + ".GPU"
+)
+
+// DBusConfig publishes the daemon as org.nfc.FanControl on the system or
+// the session bus, for desktop applets.
+type DBusConfig struct {
+	Enabled bool `json:"enabled"`
+	Bus string `json:"bus"`
+}
+
+func applyDBusDefaults(config *DBusConfig) {
+	if config.Bus == "" {
+		config.Bus = "system"
+	}
+}
+
+func validateDBus(config DBusConfig) error {
+	if config.Bus != "system" && config.Bus != "session" {
+		return fmt.Errorf("unknown bus %q, expected system or session", config.Bus)
+	}
+	return nil
+}
+
+// dbusService is the object at /org/nfc/FanControl. Its methods run as
+// commands on the loop; its properties, and those of one child object per
+// GPU, follow the published status.
+type dbusService struct {
+	d *Daemon
+	conn *dbus.Conn
+	// mu guards props and gpus against the introspection of the bus.
+	mu sync.Mutex
+	props *prop.Properties
+	gpus map[dbus.ObjectPath]*prop.Properties
+}
+
+func (s *dbusService) SetProfile(name string) *dbus.Error {
+	if err := s.d.Do(func(d *Daemon) error { return d.SetProfile(name) }); err != nil {
+		return dbus.NewError(dbusName+".Error.InvalidProfile", []interface{}{err.Error()})
+	}
+	return nil
+}
+
+func (s *dbusService) Pause() *dbus.Error {
+	s.d.Do(func(d *Daemon) error { d.Pause(); return nil })
+	return nil
+}
+
+func (s *dbusService) Resume() *dbus.Error {
+	s.d.Do(func(d *Daemon) error { d.Resume(); return nil })
+	return nil
+}
+
+func gpuPath(index int) dbus.ObjectPath {
+	return dbusPath + dbus.ObjectPath("/gpu"+strconv.Itoa(index))
+}
+
+func serviceProperties(snapshot StatusSnapshot) map[string]interface{} {
+	paths := []dbus.ObjectPath{}
+	for _, d := range snapshot.Devices {
+		paths = append(paths, gpuPath(d.Index))
+	}
+	profiles := snapshot.Profiles
+	if profiles == nil {
+		profiles = []string{}
+	}
+	return map[string]interface{}{
+		"Profile": snapshot.Profile,
+		"Profiles": profiles,
+		"Paused": snapshot.Paused,
+		"DryRun": snapshot.DryRun,
+		"PowerSource": snapshot.PowerSource,
+		"GPUs": paths,
+	}
+}
+
+func gpuProperties(d DeviceStatus) map[string]interface{} {
+	fanSpeeds, fanRPMs, fanFailed := []int32{}, []int32{}, []bool{}
+	for _, speed := range d.FanSpeeds {
+		fanSpeeds = append(fanSpeeds, int32(speed))
+	}
+	for _, rpm := range d.FanRPMs {
+		fanRPMs = append(fanRPMs, int32(rpm))
+	}
+	fanFailed = append(fanFailed, d.FanFailed...)
+	override := int32(-1)
+	if d.OverrideSpeed != nil {
+		override = int32(*d.OverrideSpeed)
+	}
+	return map[string]interface{}{
+		"Index": int32(d.Index),
+		"Name": d.Name,
+		"UUID": d.UUID,
+		"Temperature": int32(d.Temperature),
+		"PowerWatts": int32(d.PowerWatts),
+		"Utilization": int32(d.Utilization),
+		"FanSpeeds": fanSpeeds,
+		"FanRPMs": fanRPMs,
+		"FanFailed": fanFailed,
+		"OverrideSpeed": override,
+		"FailSafe": d.FailSafe,
+		"DriverControl": d.DriverControl,
+	}
+}
+
+func propMap(iface string, values map[string]interface{}) prop.Map {
+	props := map[string]*prop.Prop{}
+	for name, value := range values {
+		props[name] = &prop.Prop{Value: value, Emit: prop.EmitTrue}
+	}
+	return prop.Map{iface: props}
+}
+
+// updateProps sets the properties that changed, which emits
+// PropertiesChanged for each of them.
+func updateProps(props *prop.Properties, iface string, values map[string]interface{}) {
+	for name, value := range values {
+		if !reflect.DeepEqual(props.GetMust(iface, name), value) {
+			props.SetMust(iface, name, value)
+		}
+	}
+}
+
+// update follows a published snapshot, exporting an object for every new
+// GPU and removing those of GPUs that are gone.
+func (s *dbusService) update(snapshot StatusSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updateProps(s.props, dbusName, serviceProperties(snapshot))
+	seen := map[dbus.ObjectPath]bool{}
+	for _, d := range snapshot.Devices {
+		path := gpuPath(d.Index)
+		seen[path] = true
+		if props, ok := s.gpus[path]; ok {
+			updateProps(props, dbusGPUInterface, gpuProperties(d))
+			continue
+		}
+		props, err := prop.Export(s.conn, path, propMap(dbusGPUInterface, gpuProperties(d)))
+		if err != nil {
+			logWarnf("D-Bus: failed to export %s: %v", path, err)
+			continue
+		}
+		s.conn.Export(introspectable(func() string { return s.introspectGPU(props) }), path, "org.freedesktop.DBus.Introspectable")
+		s.gpus[path] = props
+	}
+	for path := range s.gpus {
+		if !seen[path] {
+			s.conn.Export(nil, path, "org.freedesktop.DBus.Properties")
+			s.conn.Export(nil, path, "org.freedesktop.DBus.Introspectable")
+			delete(s.gpus, path)
+		}
+	}
+}
+
+// introspectable answers Introspect from the current state, since the GPU
+// objects come and go.
+type introspectable func() string
+
+func (i introspectable) Introspect() (string, *dbus.Error) {
+	return i(), nil
+}
+
+func (s *dbusService) introspectService() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node := &introspect.Node{
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name: dbusName,
+				Methods: []introspect.Method{
+					{Name: "SetProfile", Args: []introspect.Arg{{Name: "profile", Type: "s", Direction: "in"}}},
+					{Name: "Pause"},
+					{Name: "Resume"},
+				},
+				Signals: []introspect.Signal{{Name: "ThermalEvent", Args: []introspect.Arg{
+					{Name: "gpu_index", Type: "i"},
+					{Name: "gpu_uuid", Type: "s"},
+					{Name: "event", Type: "s"},
+					{Name: "resolved", Type: "b"},
+					{Name: "temperature", Type: "i"},
+					{Name: "message", Type: "s"},
+				}}},
+				Properties: s.props.Introspection(dbusName),
+			},
+		},
+	}
+	for path := range s.gpus {
+		node.Children = append(node.Children, introspect.Node{Name: strings.TrimPrefix(string(path), string(dbusPath)+"/")})
+	}
+	return introspectNode(node)
+}
+
+func (s *dbusService) introspectGPU(props *prop.Properties) string {
+	return introspectNode(&introspect.Node{
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: dbusGPUInterface, Properties: props.Introspection(dbusGPUInterface)},
+		},
+	})
+}
+
+func introspectNode(node *introspect.Node) string {
+	xml, _ := introspect.NewIntrospectable(node).Introspect()
+	return string(xml)
+}
+
+// emitEvent sends an alert event as the ThermalEvent signal.
+func (s *dbusService) emitEvent(event Event) {
+	if err := s.conn.Emit(dbusPath, dbusName+".ThermalEvent", int32(event.GPUIndex), event.GPUUUID, event.Kind, event.Resolved, int32(event.Temperature), event.Message); err != nil {
+		logWarnf("D-Bus: failed to emit %s event: %v", event.Kind, err)
+	}
+}
+
+func connectBus(bus string) (*dbus.Conn, error) {
+	if bus == "session" {
+		return dbus.ConnectSessionBus()
+	}
+	return dbus.ConnectSystemBus()
+}
+
+// startDBus claims org.nfc.FanControl and serves it until the returned
+// function is called. On the system bus the name needs the policy in
+// deploy/dbus.
+func startDBus(config DBusConfig, d *Daemon) (func(), error) {
+	conn, err := connectBus(config.Bus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the %s bus: %w", config.Bus, err)
+	}
+	s := &dbusService{d: d, conn: conn, gpus: map[dbus.ObjectPath]*prop.Properties{}}
+	if err := conn.ExportMethodTable(map[string]interface{}{
+		"SetProfile": s.SetProfile,
+		"Pause": s.Pause,
+		"Resume": s.Resume,
+	}, dbusPath, dbusName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export %s: %w", dbusPath, err)
+	}
+	s.props, err = prop.Export(conn, dbusPath, propMap(dbusName, serviceProperties(d.Status.Snapshot())))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export the properties of %s: %w", dbusPath, err)
+	}
+	conn.Export(introspectable(s.introspectService), dbusPath, "org.freedesktop.DBus.Introspectable")
+	reply, err := conn.RequestName(dbusName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		if err == nil {
+			err = fmt.Errorf("already owned")
+		}
+		return nil, fmt.Errorf("failed to claim %s on the %s bus: %w", dbusName, config.Bus, err)
+	}
+	snapshots, unsubscribe := d.Status.Subscribe()
+	stopEvents := alerts.listen(s.emitEvent)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.update(d.Status.Snapshot())
+		for {
+			select {
+			case <-stop:
+				return
+			case snapshot := <-snapshots:
+				s.update(snapshot)
+			}
+		}
+	}()
+	logInfof("Serving %s on the %s bus.", dbusName, config.Bus)
+	return func() {
+		stopEvents()
+		unsubscribe()
+		close(stop)
+		<-done
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DesktopConfig sends alerts as freedesktop notifications through gdbus.
+type DesktopConfig struct {
+	Enabled bool `json:"enabled"`
+	Events []string `json:"events"`
+	BusAddress string `json:"bus_address"`
+}
+
+// sessionBusAddress picks the session bus to notify: the configured one,
+// the daemon's own, or that of the first logged-in user, since a system
+// service has none of its own.
+func sessionBusAddress(config DesktopConfig) string {
+	if config.BusAddress != "" {
+		return config.BusAddress
+	}
+	if address := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); address != "" {
+		return address
+	}
+	buses, _ := filepath.Glob("/run/user/*/bus")
+	sort.Strings(buses)
+	for _, bus := range buses {
+		if filepath.Base(filepath.Dir(bus)) != "0" {
+			return "unix:path=" + bus
+		}
+	}
+	return ""
+}
+
+// gvariantString quotes s as a GVariant text string for gdbus.
+func gvariantString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func sendDesktopNotification(config DesktopConfig, event Event) {
+	address := sessionBusAddress(config)
+	if address == "" {
+		logWarnf("No session bus found for the %s desktop notification; set alerts.desktop.bus_address.", event.Kind)
+		return
+	}
+	summary := "GPU " + event.GPUName + ": " + strings.ReplaceAll(event.Kind, "_", " ")
+	icon, urgency := "dialog-warning", "2"
+	if event.Resolved {
+		summary += " cleared"
+		icon, urgency = "dialog-information", "1"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "gdbus", "call", "--session",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify",
+		gvariantString("nvidia-fan-control"), "uint32 0", gvariantString(icon),
+		gvariantString(summary), gvariantString(alertText(event)),
+		"@as []", "{'urgency': <byte "+urgency+">}", "int32 -1")
+	cmd.Env = append(os.Environ(), "DBUS_SESSION_BUS_ADDRESS="+address)
+	runAsBusOwner(cmd, address)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		logFields{"gpu_index": event.GPUIndex, "event": event.Kind}.Errorf("Failed to send %s desktop notification for GPU %d: %v: %s", event.Kind, event.GPUIndex, err, strings.TrimSpace(string(output)))
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// runAsBusOwner makes cmd run as the owner of a unix:path bus socket when
+// the daemon runs as root, as session buses only accept their own user.
+func runAsBusOwner(cmd *exec.Cmd, address string) {
+	path, ok := strings.CutPrefix(address, "unix:path=")
+	if !ok || os.Geteuid() != 0 {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: stat.Uid, Gid: stat.Gid}}
+	}
+}
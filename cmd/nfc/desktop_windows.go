@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// Windows has no session bus; gdbus will simply not be found.
+func runAsBusOwner(cmd *exec.Cmd, address string) {}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// rescanDevices picks up GPUs attached after startup and retires the ones
+// that disappeared. Devices are matched by UUID, since indices shift when a
+// GPU is added or removed.
+func (d *Daemon) rescanDevices() {
+	count, ret := gpuBackend.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		logWarnf("Device rescan failed: unable to get NVIDIA device count: %v", nvml.ErrorString(ret))
+		return
+	}
+	present := map[string]bool{}
+	added := false
+	for i := 0; i < count; i++ {
+		device, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		uuid, ret := gpuBackend.DeviceGetUUID(device)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		present[uuid] = true
+		if monitor := d.findMonitorByUUID(uuid); monitor != nil {
+			if monitor.Index != i {
+				logInfof("GPU %s moved from index %d to %d.", uuid, monitor.Index, i)
+			}
+			monitor.Index = i
+			monitor.Handle = device
+			continue
+		}
+		if d.knownUnmanaged[uuid] {
+			continue
+		}
+		monitor, ok := initDevice(d.Config, d.Profile, i, device)
+		if !ok {
+			d.knownUnmanaged[uuid] = true
+			continue
+		}
+		monitor.DryRun = d.Options.DryRun
+		enablePersistenceMode(d.Config.PersistenceMode, &monitor)
+		logInfof("GPU %d (%s) was attached, now controlling it.", i, uuid)
+		d.Monitors = append(d.Monitors, monitor)
+		added = true
+	}
+	for uuid := range d.knownUnmanaged {
+		if !present[uuid] {
+			delete(d.knownUnmanaged, uuid)
+		}
+	}
+	monitors := d.Monitors[:0]
+	removed := false
+	for _, monitor := range d.Monitors {
+		if present[monitor.UUID] || monitor.HWMon != "" {
+			monitors = append(monitors, monitor)
+			continue
+		}
+		logFields{"gpu_index": monitor.Index, "gpu_uuid": monitor.UUID}.Warnf("GPU %d (%s, %s) is gone, no longer controlling it.", monitor.Index, monitor.Name, monitor.UUID)
+		removed = true
+	}
+	d.Monitors = monitors
+	if added || removed {
+		d.resetTicker()
+		publishStatus(d, 0)
+	}
+}
+
+func (d *Daemon) findMonitorByUUID(uuid string) *DeviceMonitor {
+	for i := range d.Monitors {
+		if d.Monitors[i].UUID == uuid {
+			return &d.Monitors[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// reportedFanSpeeds reads back the speed the driver reports for every fan,
+// or -1 where it cannot be read, to compare with what was commanded.
+func reportedFanSpeeds(monitor *DeviceMonitor) []int {
+	speeds := make([]int, monitor.NumFans)
+	for fanIdx := range speeds {
+		speeds[fanIdx] = -1
+		if monitor.Lost {
+			continue
+		}
+		if monitor.HWMon != "" {
+			if fanIdx == 0 {
+				if pwm, ret := readSysfsInt(filepath.Join(monitor.HWMon, "pwm1")); ret == nvml.SUCCESS {
+					speeds[fanIdx] = int(math.Round(float64(pwm) * 100 / 255))
+				}
+			}
+			continue
+		}
+		if speed, ret := device.ReadFanSpeed(gpuBackend, monitor.Handle, monitor.FanAPI, fanIdx); ret == nvml.SUCCESS {
+			speeds[fanIdx] = speed
+		}
+	}
+	return speeds
+}
+
+// hysteresisState describes what holds the current speed: the stepped range
+// and the temperature that leaves it, or the curve hysteresis.
+func hysteresisState(monitor *DeviceMonitor) string {
+	state := fmt.Sprintf("base speed %d%%", monitor.BaseFanSpeed)
+	switch monitor.Settings.CurveMode {
+	case "interpolated":
+		state += fmt.Sprintf(", curve hysteresis %d°C", monitor.Settings.CurveHysteresis)
+	case "pid":
+		state += fmt.Sprintf(", PID target %d°C", monitor.Settings.PID.TargetTemperature)
+	default:
+		if r := monitor.CurrentTemperatureRange; r.MaxTemperature != 0 {
+			state += fmt.Sprintf(", range %d..%d°C at %d%%, steps down below %d°C", r.MinTemperature, r.MaxTemperature, r.FanSpeed, r.MinTemperature-r.Hysteresis)
+			if r.DownshiftDelaySeconds > 0 {
+				state += fmt.Sprintf(" after %gs", r.DownshiftDelaySeconds)
+			}
+		}
+		if !monitor.DownshiftSince.IsZero() {
+			state += fmt.Sprintf(", below it for %s", time.Since(monitor.DownshiftSince).Round(time.Second))
+		}
+	}
+	if !monitor.LastSpeedChange.IsZero() {
+		state += fmt.Sprintf(", last change %s ago", time.Since(monitor.LastSpeedChange).Round(time.Second))
+	}
+	return state
+}
+
+// dumpStatus logs the full state of the daemon, for SIGUSR1.
+func (d *Daemon) dumpStatus() {
+	state := "running"
+	if d.Paused {
+		state = "paused"
+	}
+	if d.nvmlDown {
+		state += ", waiting for the NVIDIA driver"
+	}
+	logInfof("Status dump: %s, up %s, profile %q, %d GPU(s).", state, time.Since(d.StartTime).Round(time.Second), d.Profile, len(d.Monitors))
+	for i := range d.Monitors {
+		monitor := &d.Monitors[i]
+		fields := logFields{"gpu_index": monitor.Index, "gpu_uuid": monitor.UUID}
+		fields.Infof("GPU %d (%s): Temp=%d°C (raw %d°C), Power=%dW, Utilization=%d%%, Backend=%s", monitor.Index, monitor.Name, monitor.Temperature, monitor.RawTemperature, monitor.PowerWatts, monitor.Utilization, monitor.Backend.Name())
+		reported := reportedFanSpeeds(monitor)
+		for fanIdx := 0; fanIdx < monitor.NumFans; fanIdx++ {
+			line := fmt.Sprintf("GPU %d Fan %d: commanded %d%%, reported %d%%", monitor.Index, fanIdx, monitor.CurrentFanSpeeds[fanIdx], reported[fanIdx])
+			if fanIdx < len(monitor.FanRPMs) && monitor.FanRPMs[fanIdx] >= 0 {
+				line += fmt.Sprintf(", %d RPM", monitor.FanRPMs[fanIdx])
+			}
+			if fanIdx < len(monitor.FanFailed) && monitor.FanFailed[fanIdx] {
+				line += ", FAILED"
+			}
+			fields.Infof("%s", line)
+		}
+		fields.Infof("GPU %d control: %s", monitor.Index, hysteresisState(monitor))
+		notes := ""
+		if monitor.OverrideSpeed != nil {
+			notes += fmt.Sprintf(", override %d%%", *monitor.OverrideSpeed)
+		}
+		if monitor.SpeedCap > 0 {
+			notes += fmt.Sprintf(", speed cap %d%%", monitor.SpeedCap)
+		}
+		if monitor.FailSafeActive {
+			notes += ", FAIL-SAFE"
+		}
+		if monitor.Lost {
+			notes += ", LOST"
+		}
+		fields.Infof("GPU %d errors: %v, classes %v, %d consecutive failure(s)%s", monitor.Index, monitor.ErrorCounts, monitor.ErrorClasses, monitor.ConsecutiveFailures, notes)
+	}
+}
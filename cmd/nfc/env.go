@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// envOverrides maps NFC_* environment variables onto settings, for systemd
+// units and containers that cannot easily edit the config file. They win
+// over the file; command-line flags win over them.
+var envOverrides = map[string]func(config *Config, value string){
+	"NFC_LOG_LEVEL": func(config *Config, value string) { config.Log.Level = value },
+	"NFC_LOG_OUTPUT": func(config *Config, value string) { config.Log.Output = value },
+	"NFC_LOG_FILE": func(config *Config, value string) { config.Log.File = value },
+	"NFC_HTTP_LISTEN": func(config *Config, value string) { config.HTTPListen = value },
+	"NFC_GRPC_LISTEN": func(config *Config, value string) { config.GRPCListen = value },
+	"NFC_API_TOKEN": func(config *Config, value string) { config.APIToken = value },
+	"NFC_CONTROL_SOCKET": func(config *Config, value string) { config.ControlSocket = value },
+}
+
+func applyEnvOverrides(config *Config) {
+	for name, apply := range envOverrides {
+		if value := os.Getenv(name); value != "" {
+			apply(config, value)
+		}
+	}
+}
+
+// nvmlLibrary is NFC_NVML_LIBRARY, the path of the NVML library, for
+// containers and installations that keep it outside the loader's path.
+func nvmlLibrary() string {
+	if path := os.Getenv("NFC_NVML_LIBRARY"); path != "" {
+		return path
+	}
+	return nvmlLibraryPath
+}
+
+// envInterval is NFC_INTERVAL, which overrides time_to_update like
+// --interval, or 0 when it is not set.
+func envInterval() float64 {
+	value := os.Getenv("NFC_INTERVAL")
+	if value == "" {
+		return 0
+	}
+	interval, err := strconv.ParseFloat(value, 64)
+	if err != nil || interval <= 0 {
+		exitf("NFC_INTERVAL (%q) must be a positive number of seconds", value)
+	}
+	return interval
+}
+
+// configSearchDirs are searched in order for a config file when neither
+// --config nor NFC_CONFIG is given.
+func configSearchDirs() []string {
+	dirs := []string{defaultConfigDir}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "nvidia-fan-control"))
+	}
+	return append(dirs, ".")
+}
+
+func findConfigFile() string {
+	if file := os.Getenv("NFC_CONFIG"); file != "" {
+		return file
+	}
+	for _, dir := range configSearchDirs() {
+		for _, name := range []string{"config.json", "config.yaml", "config.yml", "config.toml"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+	return "config.json"
+}
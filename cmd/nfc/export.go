@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exporterInfluxDB = "influxdb"
+	exporterGraphite = "graphite"
+	exporterOTLP = "otlp"
+)
+
+// ExporterConfig pushes samples to a time-series database. InfluxDB gets
+// line protocol POSTed to url, which is the full write endpoint
+// (/api/v2/write?org=...&bucket=... or /write?db=...); Graphite gets the
+// plaintext protocol with tags over TCP to address; OTLP gets JSON-encoded
+// gauges POSTed to url, the collector's /v1/metrics endpoint, with headers.
+type ExporterConfig struct {
+	Type string `json:"type"`
+	URL string `json:"url"`
+	Token string `json:"token"`
+	Headers map[string]string `json:"headers"`
+	Address string `json:"address"`
+	Prefix string `json:"prefix"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+	Tags map[string]string `json:"tags"`
+}
+
+func applyExporterDefaults(config *ExporterConfig) {
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 10
+	}
+	if config.Prefix == "" {
+		config.Prefix = "nfc"
+	}
+}
+
+func validateExporter(config ExporterConfig) error {
+	switch config.Type {
+	case exporterInfluxDB, exporterOTLP:
+		if config.URL == "" {
+			return fmt.Errorf("url is required for %s", config.Type)
+		}
+	case exporterGraphite:
+		if config.Address == "" {
+			return fmt.Errorf("address is required for graphite")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected influxdb, graphite or otlp", config.Type)
+	}
+	return nil
+}
+
+// sample is one measurement of one GPU or fan, before it is encoded for a
+// particular database.
+type sample struct {
+	Name string
+	Tags map[string]string
+	Fields map[string]float64
+}
+
+func snapshotSamples(snapshot StatusSnapshot, extraTags map[string]string) []sample {
+	host, _ := os.Hostname()
+	samples := []sample{}
+	for _, d := range snapshot.Devices {
+		tags := map[string]string{"host": host, "gpu": strconv.Itoa(d.Index), "uuid": d.UUID, "name": d.Name}
+		for key, value := range extraTags {
+			tags[key] = value
+		}
+		fields := map[string]float64{"temperature": float64(d.Temperature), "raw_temperature": float64(d.RawTemperature)}
+		if d.PowerWatts >= 0 {
+			fields["power_watts"] = float64(d.PowerWatts)
+		}
+		if d.Utilization >= 0 {
+			fields["utilization"] = float64(d.Utilization)
+		}
+		fields["fail_safe"] = boolValue(d.FailSafe)
+		for _, class := range throttleClasses {
+			fields[class+"_throttle"] = boolValue(slices.Contains(d.Throttle, class))
+			fields[class+"_throttle_seconds"] = d.ThrottleSeconds[class]
+		}
+		// What the controller decided, next to what it measured.
+		fields["min_fan_speed"] = float64(d.MinFanSpeed)
+		fields["max_fan_speed"] = float64(d.MaxFanSpeed)
+		fields["override"] = boolValue(d.OverrideSpeed != nil)
+		if d.SpeedCap > 0 {
+			fields["speed_cap"] = float64(d.SpeedCap)
+		}
+		if d.TemperatureRange != nil {
+			fields["range_min_temperature"] = float64(d.TemperatureRange.MinTemperature)
+			fields["range_max_temperature"] = float64(d.TemperatureRange.MaxTemperature)
+		}
+		samples = append(samples, sample{Name: "gpu", Tags: tags, Fields: fields})
+		for fanIdx, speed := range d.FanSpeeds {
+			fanTags := map[string]string{"fan": strconv.Itoa(fanIdx)}
+			for key, value := range tags {
+				fanTags[key] = value
+			}
+			fanFields := map[string]float64{"speed_percent": float64(speed)}
+			if fanIdx < len(d.FanRPMs) && d.FanRPMs[fanIdx] >= 0 {
+				fanFields["rpm"] = float64(d.FanRPMs[fanIdx])
+			}
+			if fanIdx < len(d.FanFailed) {
+				fanFields["failed"] = boolValue(d.FanFailed[fanIdx])
+			}
+			samples = append(samples, sample{Name: "fan", Tags: fanTags, Fields: fanFields})
+		}
+	}
+	return samples
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func influxLines(prefix string, samples []sample, at time.Time) []byte {
+	var lines bytes.Buffer
+	for _, s := range samples {
+		lines.WriteString(influxEscaper.Replace(prefix + "_" + s.Name))
+		for _, key := range sortedKeys(s.Tags) {
+			if s.Tags[key] != "" {
+				fmt.Fprintf(&lines, ",%s=%s", influxEscaper.Replace(key), influxEscaper.Replace(s.Tags[key]))
+			}
+		}
+		for i, key := range sortedKeys(s.Fields) {
+			separator := ","
+			if i == 0 {
+				separator = " "
+			}
+			fmt.Fprintf(&lines, "%s%s=%g", separator, influxEscaper.Replace(key), s.Fields[key])
+		}
+		fmt.Fprintf(&lines, " %d\n", at.UnixNano())
+	}
+	return lines.Bytes()
+}
+
+// graphiteEscaper keeps tag values free of the characters the tagged
+// plaintext format reserves.
+var graphiteEscaper = strings.NewReplacer(";", "_", "~", "_", " ", "_", "!", "_", "^", "_", "=", "_")
+
+func graphiteLines(prefix string, samples []sample, at time.Time) []byte {
+	var lines bytes.Buffer
+	for _, s := range samples {
+		tags := ""
+		for _, key := range sortedKeys(s.Tags) {
+			if s.Tags[key] != "" {
+				tags += ";" + graphiteEscaper.Replace(key) + "=" + graphiteEscaper.Replace(s.Tags[key])
+			}
+		}
+		for _, key := range sortedKeys(s.Fields) {
+			fmt.Fprintf(&lines, "%s.%s.%s%s %g %d\n", prefix, s.Name, key, tags, s.Fields[key], at.Unix())
+		}
+	}
+	return lines.Bytes()
+}
+
+// otlpUnits gives the UCUM unit of each field, as OTLP expects.
+var otlpUnits = map[string]string{
+	"temperature": "Cel",
+	"raw_temperature": "Cel",
+	"range_min_temperature": "Cel",
+	"range_max_temperature": "Cel",
+	"power_watts": "W",
+	"utilization": "%",
+	"speed_percent": "%",
+	"min_fan_speed": "%",
+	"max_fan_speed": "%",
+	"speed_cap": "%",
+	"rpm": "{rpm}",
+	"thermal_throttle_seconds": "s",
+	"power_throttle_seconds": "s",
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key string `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes []otlpAttribute `json:"attributes"`
+	TimeUnixNano string `json:"timeUnixNano"`
+	AsDouble float64 `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name string `json:"name"`
+	Unit string `json:"unit,omitempty"`
+	Gauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+func otlpAttributes(tags map[string]string) []otlpAttribute {
+	attributes := []otlpAttribute{}
+	for _, key := range sortedKeys(tags) {
+		if tags[key] != "" {
+			attributes = append(attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: tags[key]}})
+		}
+	}
+	return attributes
+}
+
+// otlpRequest encodes the samples as an OTLP/HTTP JSON export request with
+// one gauge per field. The host and the configured tags become resource
+// attributes; the GPU and fan tags are attributes of each data point.
+func otlpRequest(prefix string, samples []sample, extraTags map[string]string, at time.Time) ([]byte, error) {
+	host, _ := os.Hostname()
+	resource := map[string]string{"service.name": "nvidia-fan-control", "service.version": version, "host.name": host}
+	for key, value := range extraTags {
+		resource[key] = value
+	}
+	metrics := map[string]*otlpMetric{}
+	for _, s := range samples {
+		tags := map[string]string{}
+		for key, value := range s.Tags {
+			if key != "host" {
+				tags[key] = value
+			}
+		}
+		for _, key := range sortedKeys(s.Fields) {
+			name := prefix + "." + s.Name + "." + key
+			if metrics[name] == nil {
+				metrics[name] = &otlpMetric{Name: name, Unit: otlpUnits[key]}
+			}
+			metrics[name].Gauge.DataPoints = append(metrics[name].Gauge.DataPoints, otlpDataPoint{
+				Attributes: otlpAttributes(tags),
+				TimeUnixNano: strconv.FormatInt(at.UnixNano(), 10),
+				AsDouble: s.Fields[key],
+			})
+		}
+	}
+	list := []*otlpMetric{}
+	for _, name := range sortedKeys(metrics) {
+		list = append(list, metrics[name])
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(resource)},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "nvidia-fan-control", "version": version},
+				"metrics": list,
+			}},
+		}},
+	})
+}
+
+var exportClient = &http.Client{Timeout: 10 * time.Second}
+
+func pushSamples(config ExporterConfig, snapshot StatusSnapshot) error {
+	if config.Type == exporterOTLP {
+		samples := snapshotSamples(snapshot, nil)
+		if len(samples) == 0 {
+			return nil
+		}
+		body, err := otlpRequest(config.Prefix, samples, config.Tags, snapshot.Time)
+		if err != nil {
+			return err
+		}
+		return postSamples(config, "application/json", body)
+	}
+	samples := snapshotSamples(snapshot, config.Tags)
+	if len(samples) == 0 {
+		return nil
+	}
+	if config.Type == exporterGraphite {
+		conn, err := net.DialTimeout("tcp", config.Address, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		_, err = conn.Write(graphiteLines(config.Prefix, samples, snapshot.Time))
+		return err
+	}
+	return postSamples(config, "text/plain; charset=utf-8", influxLines(config.Prefix, samples, snapshot.Time))
+}
+
+func postSamples(config ExporterConfig, contentType string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if config.Token != "" {
+		request.Header.Set("Authorization", "Token "+config.Token)
+	}
+	for key, value := range config.Headers {
+		request.Header.Set(key, value)
+	}
+	response, err := exportClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("server replied %s", response.Status)
+	}
+	return nil
+}
+
+// startExporters pushes the latest status to every exporter on its own
+// interval until the returned function is called.
+func startExporters(configs []ExporterConfig, d *Daemon) func() {
+	stop := make(chan struct{})
+	for _, config := range configs {
+		go func(config ExporterConfig) {
+			ticker := time.NewTicker(time.Duration(config.IntervalSeconds * float64(time.Second)))
+			defer ticker.Stop()
+			failures := failureLogger{recovered: fmt.Sprintf("Exporting samples to %s again.", config.Type)}
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+				snapshot := d.Status.Snapshot()
+				if snapshot.Time.IsZero() {
+					continue
+				}
+				failures.observe(pushSamples(config, snapshot), "Failed to export samples to %s", config.Type)
+			}
+		}(config)
+		logInfof("Exporting samples to %s every %gs.", config.Type, config.IntervalSeconds)
+	}
+	return func() { close(stop) }
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	failSafeFullSpeed = "full_speed"
+	failSafeAuto = "auto"
+	failSafeNone = "none"
+)
+
+type FailSafeConfig struct {
+	Action string `json:"action"`
+	Cycles int `json:"cycles"`
+}
+
+func applyFailSafeDefaults(config *FailSafeConfig) {
+	if config.Action == "" {
+		config.Action = failSafeFullSpeed
+	}
+	if config.Cycles <= 0 {
+		config.Cycles = 3
+	}
+}
+
+func validateFailSafe(config FailSafeConfig) error {
+	switch config.Action {
+	case failSafeFullSpeed, failSafeAuto, failSafeNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q, expected \"full_speed\", \"auto\" or \"none\"", config.Action)
+	}
+}
+
+// recordFailure counts a cycle in which the temperature could not be read or
+// a fan write failed, and engages the fail-safe once there were too many in
+// a row.
+func recordFailure(monitor *DeviceMonitor) {
+	monitor.ConsecutiveFailures++
+	checkErrorAlert(monitor)
+	if monitor.FailSafeActive || monitor.FailSafe.Action == failSafeNone || monitor.ConsecutiveFailures < monitor.FailSafe.Cycles {
+		return
+	}
+	monitor.FailSafeActive = true
+	logFields{"gpu_index": monitor.Index, "failures": monitor.ConsecutiveFailures, "action": monitor.FailSafe.Action}.Errorf("GPU %d failed %d updates in a row, engaging fail-safe (%s)", monitor.Index, monitor.ConsecutiveFailures, monitor.FailSafe.Action)
+	alerts.emit(monitor, eventFailSafe, false, "fail-safe engaged (%s) after %d failed updates", monitor.FailSafe.Action, monitor.ConsecutiveFailures)
+	if monitor.FailSafe.Action == failSafeAuto {
+		restoreAutoFanPolicy([]DeviceMonitor{*monitor})
+		// Force every fan to be written again once the GPU recovers.
+		for fanIdx := range monitor.CurrentFanSpeeds {
+			monitor.CurrentFanSpeeds[fanIdx] = -1
+		}
+	}
+}
+
+func recordSuccess(monitor *DeviceMonitor) {
+	monitor.ConsecutiveFailures = 0
+	checkErrorAlert(monitor)
+	if !monitor.FailSafeActive {
+		return
+	}
+	monitor.FailSafeActive = false
+	logFields{"gpu_index": monitor.Index}.Infof("GPU %d recovered, leaving fail-safe", monitor.Index)
+	alerts.emit(monitor, eventFailSafe, true, "recovered, fail-safe released")
+}
+
+// failSafeSpeed reports whether the fail-safe currently pins the fans of the
+// monitor to full speed.
+func failSafeSpeed(monitor *DeviceMonitor) bool {
+	return monitor.FailSafeActive && monitor.FailSafe.Action == failSafeFullSpeed
+}
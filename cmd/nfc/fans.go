@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+)
+
+type FanConfig struct {
+	Index int `json:"index"`
+	Offset int `json:"offset"`
+	CurvePoints []CurvePoint `json:"curve_points"`
+	CurveHysteresis int `json:"curve_hysteresis"`
+}
+
+type ZeroRPMConfig struct {
+	Enabled bool `json:"enabled"`
+	ReengageTemperature int `json:"reengage_temperature"`
+	KickSpeed int `json:"kick_speed"`
+	KickSeconds float64 `json:"kick_seconds"`
+}
+
+type FanFailureConfig struct {
+	Enabled bool `json:"enabled"`
+	MinDuty int `json:"min_duty"`
+	MaxRPM int `json:"max_rpm"`
+	Cycles int `json:"cycles"`
+	FullSpeed bool `json:"full_speed"`
+}
+
+func applyFanFailureDefaults(config *FanFailureConfig) {
+	if config.MinDuty <= 0 {
+		config.MinDuty = 30
+	}
+	if config.MaxRPM <= 0 {
+		config.MaxRPM = 100
+	}
+	if config.Cycles <= 0 {
+		config.Cycles = 5
+	}
+}
+
+// checkFanFailure flags a fan whose tachometer stays near zero while it is
+// commanded to spin. Fans without an RPM reading are never flagged.
+func checkFanFailure(monitor *DeviceMonitor) {
+	config := monitor.FanFailure
+	if !config.Enabled || monitor.DryRun {
+		return
+	}
+	for fanIdx, rpm := range monitor.FanRPMs {
+		if rpm < 0 {
+			continue
+		}
+		duty := monitor.CurrentFanSpeeds[fanIdx]
+		if duty >= config.MinDuty && rpm <= config.MaxRPM {
+			monitor.StalledCycles[fanIdx]++
+		} else {
+			if monitor.FanFailed[fanIdx] {
+				logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "rpm": rpm, "duty": duty}.Infof("GPU %d Fan %d is spinning again: %d RPM at %d%%", monitor.Index, fanIdx, rpm, duty)
+				alerts.emit(monitor, eventFanFailure, true, "fan %d is spinning again: %d RPM at %d%%", fanIdx, rpm, duty)
+			}
+			monitor.StalledCycles[fanIdx] = 0
+			monitor.FanFailed[fanIdx] = false
+			continue
+		}
+		if monitor.StalledCycles[fanIdx] == config.Cycles {
+			monitor.FanFailed[fanIdx] = true
+			logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "rpm": rpm, "duty": duty}.Errorf("GPU %d Fan %d appears to have failed: %d RPM at %d%% for %d updates", monitor.Index, fanIdx, rpm, duty, config.Cycles)
+			alerts.emit(monitor, eventFanFailure, false, "fan %d appears to have failed: %d RPM at %d%%", fanIdx, rpm, duty)
+		}
+	}
+}
+
+func hasFailedFan(monitor *DeviceMonitor) bool {
+	for _, failed := range monitor.FanFailed {
+		if failed {
+			return true
+		}
+	}
+	return false
+}
+
+func validateFans(fans []FanConfig) error {
+	seen := map[int]bool{}
+	for i, fan := range fans {
+		if fan.Index < 0 {
+			return fmt.Errorf("fans[%d]: index (%d) is negative", i, fan.Index)
+		}
+		if seen[fan.Index] {
+			return fmt.Errorf("fans[%d]: fan %d is configured twice", i, fan.Index)
+		}
+		seen[fan.Index] = true
+		if fan.Offset < -100 || fan.Offset > 100 {
+			return fmt.Errorf("fans[%d]: offset (%d) is outside -100-100", i, fan.Offset)
+		}
+		if len(fan.CurvePoints) > 0 {
+			if err := curve.ValidatePoints(fan.CurvePoints, fan.CurveHysteresis); err != nil {
+				return fmt.Errorf("fans[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func describeFan(fan FanConfig) string {
+	description := fmt.Sprintf("fan%d:", fan.Index)
+	if len(fan.CurvePoints) > 0 {
+		description += "curve"
+		for _, p := range fan.CurvePoints {
+			description += fmt.Sprintf(",%d°C=%d%%", p.Temperature, p.FanSpeed)
+		}
+	}
+	if fan.Offset != 0 {
+		description += fmt.Sprintf("%+d%%", fan.Offset)
+	}
+	return description
+}
+
+func uniformFanSpeeds(monitor *DeviceMonitor, speed int) []int {
+	speeds := make([]int, monitor.NumFans)
+	for fanIdx := range speeds {
+		speeds[fanIdx] = speed
+	}
+	return speeds
+}
+
+// fanTargets spreads the GPU's speed over its fans. A fan with its own
+// curve follows that curve at the GPU's control temperature instead, and
+// offsets are added last.
+func fanTargets(monitor *DeviceMonitor, speed int) []int {
+	speeds := uniformFanSpeeds(monitor, speed)
+	for _, fan := range monitor.Settings.Fans {
+		if fan.Index >= monitor.NumFans {
+			continue
+		}
+		fanSpeed := speed
+		if len(fan.CurvePoints) > 0 {
+			fanSpeed = curve.InterpolateWithHysteresis(monitor.Temperature, monitor.CurrentFanSpeeds[fan.Index]-fan.Offset, fan.CurvePoints, fan.CurveHysteresis)
+		}
+		speeds[fan.Index] = clampFanSpeed(fanSpeed + fan.Offset)
+	}
+	return speeds
+}
+
+// applyStartupFanSpeed sets the fans to startup_fan_speed as soon as the
+// GPU is set up, and holds them there until the first update one interval
+// later, instead of leaving them wherever the previous controller did.
+func applyStartupFanSpeed(monitor *DeviceMonitor) {
+	speed := monitor.Settings.StartupFanSpeed
+	if speed <= 0 || monitor.NumFans == 0 {
+		return
+	}
+	if _, _, ok := writeFanSpeeds(monitor, uniformFanSpeeds(monitor, speed)); !ok {
+		logFields{"gpu_index": monitor.Index}.Warnf("GPU %d: failed to apply the startup fan speed of %d%%.", monitor.Index, speed)
+		return
+	}
+	logFields{"gpu_index": monitor.Index, "new_speed": speed}.Infof("GPU %d: fans set to the startup speed of %d%%.", monitor.Index, speed)
+	monitor.NextUpdate = time.Now().Add(updateInterval(monitor))
+}
+
+func clampFanSpeed(speed int) int {
+	if speed < 0 {
+		return 0
+	}
+	if speed > 100 {
+		return 100
+	}
+	return speed
+}
+
+func validateZeroRPM(config ZeroRPMConfig) error {
+	if config.KickSpeed < 0 || config.KickSpeed > 100 {
+		return fmt.Errorf("kick_speed (%d) is outside 0-100", config.KickSpeed)
+	}
+	if config.KickSeconds < 0 {
+		return fmt.Errorf("kick_seconds (%g) is negative", config.KickSeconds)
+	}
+	return nil
+}
+
+// applyZeroRPM keeps stopped fans at 0% until the GPU reaches the re-engage
+// temperature, and gives a restarting fan a short kick, since many fans
+// will not start from a standstill at a low duty.
+func applyZeroRPM(monitor *DeviceMonitor, speeds []int) {
+	config := monitor.Settings.ZeroRPM
+	if !config.Enabled {
+		return
+	}
+	now := clock()
+	for fanIdx := range speeds {
+		switch {
+		case speeds[fanIdx] <= 0:
+			if !monitor.FanStopped[fanIdx] {
+				logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "temperature": monitor.Temperature}.Infof("Stopping GPU %d Fan %d at %d°C", monitor.Index, fanIdx, monitor.Temperature)
+			}
+			monitor.FanStopped[fanIdx] = true
+			speeds[fanIdx] = 0
+			continue
+		case monitor.FanStopped[fanIdx] && monitor.Temperature < config.ReengageTemperature:
+			speeds[fanIdx] = 0
+			continue
+		case monitor.FanStopped[fanIdx]:
+			monitor.FanStopped[fanIdx] = false
+			monitor.KickUntil[fanIdx] = now.Add(time.Duration(config.KickSeconds * float64(time.Second)))
+			logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "temperature": monitor.Temperature, "kick_speed": config.KickSpeed}.Infof("Restarting GPU %d Fan %d at %d°C with a %d%% kick", monitor.Index, fanIdx, monitor.Temperature, config.KickSpeed)
+		}
+		if now.Before(monitor.KickUntil[fanIdx]) && speeds[fanIdx] < config.KickSpeed {
+			speeds[fanIdx] = config.KickSpeed
+		}
+	}
+}
+
+func clampToDevice(monitor *DeviceMonitor, speed int) int {
+	if speed < monitor.MinFanSpeed {
+		return monitor.MinFanSpeed
+	}
+	if speed > monitor.MaxFanSpeed {
+		return monitor.MaxFanSpeed
+	}
+	return spinFloor(monitor, speed)
+}
+
+// configuredSpeeds lists every fan speed the settings can ask for, to check
+// them against the device limits.
+func configuredSpeeds(config ControlConfig) []int {
+	speeds := []int{}
+	switch config.CurveMode {
+	case "interpolated":
+		for _, p := range config.CurvePoints {
+			speeds = append(speeds, p.FanSpeed)
+		}
+	case "pid":
+		speeds = append(speeds, config.PID.MinFanSpeed, config.PID.MaxFanSpeed)
+	default:
+		for _, r := range config.TemperatureRanges {
+			speeds = append(speeds, r.FanSpeed)
+		}
+	}
+	for _, fan := range config.Fans {
+		for _, p := range fan.CurvePoints {
+			speeds = append(speeds, p.FanSpeed+fan.Offset)
+		}
+	}
+	return speeds
+}
+
+func checkFanSpeedLimits(monitor *DeviceMonitor) {
+	if monitor.MinFanSpeed == 0 && monitor.MaxFanSpeed == 100 {
+		return
+	}
+	for _, speed := range configuredSpeeds(monitor.Settings) {
+		if speed < monitor.MinFanSpeed || speed > monitor.MaxFanSpeed {
+			logFields{"gpu_index": monitor.Index, "fan_speed": speed, "min_speed": monitor.MinFanSpeed, "max_speed": monitor.MaxFanSpeed}.Warnf("GPU %d only accepts fan speeds of %d-%d%%; configured speeds outside this range, such as %d%%, are clamped", monitor.Index, monitor.MinFanSpeed, monitor.MaxFanSpeed, speed)
+			break
+		}
+	}
+	if monitor.Settings.ZeroRPM.Enabled && monitor.MinFanSpeed > 0 {
+		logFields{"gpu_index": monitor.Index, "min_speed": monitor.MinFanSpeed}.Warnf("GPU %d cannot stop its fans (minimum %d%%), zero_rpm has no effect", monitor.Index, monitor.MinFanSpeed)
+	}
+}
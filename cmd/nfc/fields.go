@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// usesSensor reports whether the control temperature or an input curve
+// reads sensor.
+func usesSensor(config ControlConfig, sensor string) bool {
+	if config.Sensor == sensor {
+		return true
+	}
+	for _, input := range config.Sensors {
+		if input.Sensor == sensor {
+			return true
+		}
+	}
+	for _, c := range config.InputCurves {
+		if c.Input == sensor {
+			return true
+		}
+	}
+	return false
+}
+
+// batchedFields lists the readings of this update that NVML also offers as
+// field values: the memory temperature when a sensor needs it, and the
+// power draw unless the board only reports it through its own call.
+func batchedFields(monitor *DeviceMonitor) []uint32 {
+	fields := []uint32{}
+	if usesSensor(monitor.Settings, device.SensorMemory) {
+		fields = append(fields, nvml.FI_DEV_MEMORY_TEMP)
+	}
+	if !monitor.UnbatchedFields[nvml.FI_DEV_POWER_INSTANT] {
+		fields = append(fields, nvml.FI_DEV_POWER_INSTANT)
+	}
+	return fields
+}
+
+func unsupported(ret nvml.Return) bool {
+	return ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND
+}
+
+// prefetchFields reads the batched fields in a single call, for the readers
+// later in the update. A value that is missing from Fields, because the
+// call or the field failed, is read through its own call instead, with the
+// usual retries and error handling.
+func prefetchFields(monitor *DeviceMonitor) {
+	monitor.Fields = nil
+	if monitor.HWMon != "" || monitor.FieldsUnsupported {
+		return
+	}
+	ids := batchedFields(monitor)
+	if len(ids) == 0 {
+		return
+	}
+	values := make([]nvml.FieldValue, len(ids))
+	for i, id := range ids {
+		values[i].FieldId = id
+	}
+	ret := gpuBackend.DeviceGetFieldValues(monitor.Handle, values)
+	if unsupported(ret) {
+		monitor.FieldsUnsupported = true
+		logFields{"gpu_index": monitor.Index}.Debugf("GPU %d does not support field values, reading each sensor on its own.", monitor.Index)
+		return
+	}
+	if ret != nvml.SUCCESS {
+		return
+	}
+	monitor.Fields = map[uint32]nvml.FieldValue{}
+	for _, value := range values {
+		ret := nvml.Return(value.NvmlReturn)
+		switch {
+		case ret == nvml.SUCCESS:
+			monitor.Fields[value.FieldId] = value
+		case value.FieldId == nvml.FI_DEV_POWER_INSTANT && unsupported(ret):
+			// Boards before Ampere only report the power draw through
+			// DeviceGetPowerUsage.
+			if monitor.UnbatchedFields == nil {
+				monitor.UnbatchedFields = map[uint32]bool{}
+			}
+			monitor.UnbatchedFields[value.FieldId] = true
+		case unsupported(ret):
+			// The memory temperature is only ever a field value, so
+			// asking again on its own would get the same answer.
+			monitor.Fields[value.FieldId] = value
+		}
+	}
+}
+
+// readSensor reads a temperature sensor, from the prefetched fields when it
+// is one of them.
+func readSensor(monitor *DeviceMonitor, sensor string) (int, nvml.Return) {
+	if value, ok := monitor.Fields[nvml.FI_DEV_MEMORY_TEMP]; ok && sensor == device.SensorMemory {
+		if ret := nvml.Return(value.NvmlReturn); ret != nvml.SUCCESS {
+			return 0, ret
+		}
+		return device.FieldValueInt(value), nvml.SUCCESS
+	}
+	var temp int
+	ret := retryNVML(monitor, func() nvml.Return {
+		var ret nvml.Return
+		temp, ret = device.ReadTemperature(gpuBackend, monitor.Handle, sensor)
+		return ret
+	})
+	return temp, ret
+}
+
+// CallTiming sums up the calls made to one NVML function.
+type CallTiming struct {
+	Calls int `json:"calls"`
+	Seconds float64 `json:"seconds"`
+}
+
+// callTimings collects the duration of every NVML call the control loop
+// makes, from all the workers.
+type callTimings struct {
+	mu sync.Mutex
+	calls map[string]CallTiming
+}
+
+var nvmlTimings = &callTimings{}
+
+func (c *callTimings) observe(call string, elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]CallTiming{}
+	}
+	timing := c.calls[call]
+	timing.Calls++
+	timing.Seconds += elapsed.Seconds()
+	c.calls[call] = timing
+}
+
+func (c *callTimings) snapshot() map[string]CallTiming {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := map[string]CallTiming{}
+	for call, timing := range c.calls {
+		calls[call] = timing
+	}
+	return calls
+}
+
+// writeTimingMetrics writes the NVML call counts and durations, and how
+// long the last update of each GPU took.
+func writeTimingMetrics(w io.Writer, snapshot StatusSnapshot) {
+	fmt.Fprintln(w, "# HELP nfc_nvml_calls_total NVML calls made by the control loop.")
+	fmt.Fprintln(w, "# TYPE nfc_nvml_calls_total counter")
+	for _, call := range sortedKeys(snapshot.NVMLCalls) {
+		fmt.Fprintf(w, "nfc_nvml_calls_total{call=%q} %d\n", call, snapshot.NVMLCalls[call].Calls)
+	}
+	fmt.Fprintln(w, "# HELP nfc_nvml_call_seconds_total Time spent in NVML calls made by the control loop.")
+	fmt.Fprintln(w, "# TYPE nfc_nvml_call_seconds_total counter")
+	for _, call := range sortedKeys(snapshot.NVMLCalls) {
+		fmt.Fprintf(w, "nfc_nvml_call_seconds_total{call=%q} %g\n", call, snapshot.NVMLCalls[call].Seconds)
+	}
+	fmt.Fprintln(w, "# HELP nfc_gpu_update_duration_seconds Duration of the last update of the GPU.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_update_duration_seconds gauge")
+	for _, d := range snapshot.Devices {
+		fmt.Fprintf(w, "nfc_gpu_update_duration_seconds{%s} %g\n", gpuLabels(d), d.UpdateDuration.Seconds())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+)
+
+func gpuConfigMatches(gpu GPUMatch, monitor *DeviceMonitor) bool {
+	if gpu.Index != nil && *gpu.Index != monitor.Index {
+		return false
+	}
+	if gpu.UUID != "" && !strings.EqualFold(gpu.UUID, monitor.UUID) {
+		return false
+	}
+	if gpu.PCIBusID != "" && device.NormalizePCIBusID(gpu.PCIBusID) != device.NormalizePCIBusID(monitor.PCIBusID) {
+		return false
+	}
+	if gpu.Name != "" {
+		if matched, err := path.Match(gpu.Name, monitor.Name); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func validateGPUMatch(gpu GPUMatch) error {
+	if gpu.Index == nil && gpu.UUID == "" && gpu.PCIBusID == "" && gpu.Name == "" {
+		return fmt.Errorf("no index, uuid, pci_bus_id or name to match on")
+	}
+	if _, err := path.Match(gpu.Name, ""); err != nil {
+		return fmt.Errorf("name %q: %w", gpu.Name, err)
+	}
+	return nil
+}
+
+// managedDevice tells whether the daemon controls the GPU: it must match
+// one of include, if there are any, and none of exclude.
+func managedDevice(config Config, monitor *DeviceMonitor) bool {
+	included := len(config.Include) == 0
+	for _, match := range config.Include {
+		included = included || gpuConfigMatches(match, monitor)
+	}
+	for _, match := range config.Exclude {
+		if gpuConfigMatches(match, monitor) {
+			return false
+		}
+	}
+	return included
+}
+
+func describeGPUMatch(gpu GPUMatch) string {
+	criteria := []string{}
+	if gpu.Index != nil {
+		criteria = append(criteria, fmt.Sprintf("index=%d", *gpu.Index))
+	}
+	if gpu.UUID != "" {
+		criteria = append(criteria, "uuid="+gpu.UUID)
+	}
+	if gpu.PCIBusID != "" {
+		criteria = append(criteria, "pci_bus_id="+gpu.PCIBusID)
+	}
+	if gpu.Name != "" {
+		criteria = append(criteria, fmt.Sprintf("name=%q", gpu.Name))
+	}
+	return strings.Join(criteria, " ")
+}
+
+func bindDeviceConfig(profile ProfileConfig, monitor *DeviceMonitor) {
+	settings, section := *profile.Default, "default"
+	for i, gpu := range profile.GPUs {
+		if gpuConfigMatches(gpu.GPUMatch, monitor) {
+			settings, section = gpu.ControlConfig, fmt.Sprintf("gpus[%d]", i)
+			break
+		}
+	}
+	monitor.Settings = settings
+	monitor.Controller = newFanController(settings)
+	for _, fan := range settings.Fans {
+		if fan.Index >= monitor.NumFans {
+			logWarnf("GPU %d has %d fan(s), ignoring the settings for fan %d.", monitor.Index, monitor.NumFans, fan.Index)
+		}
+	}
+	logInfof("GPU %d (%s) uses %s configuration: %s", monitor.Index, monitor.Name, section, describeControlConfig(settings))
+	checkFanSpeedLimits(monitor)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+)
+
+// GroupConfig drives the fans of GPUs that share airflow together: the curve
+// of every member sees the hottest member's temperature, so a starved card
+// in the middle of a stack raises the fans of its neighbours too. Members
+// are given by index, UUID or PCI bus ID.
+type GroupConfig struct {
+	Name string `json:"name"`
+	GPUs []string `json:"gpus"`
+}
+
+func validateGroups(groups []GroupConfig) error {
+	names := map[string]bool{}
+	members := map[string]string{}
+	for i, group := range groups {
+		if group.Name == "" {
+			return fmt.Errorf("groups[%d]: name is empty", i)
+		}
+		if names[group.Name] {
+			return fmt.Errorf("groups[%d]: duplicate name %q", i, group.Name)
+		}
+		names[group.Name] = true
+		if len(group.GPUs) < 2 {
+			return fmt.Errorf("groups[%d]: a group needs at least two gpus", i)
+		}
+		for _, id := range group.GPUs {
+			key := groupMemberID(id)
+			if other, ok := members[key]; ok {
+				return fmt.Errorf("groups[%d]: gpu %q is already in group %q", i, id, other)
+			}
+			members[key] = group.Name
+		}
+	}
+	return nil
+}
+
+// groupMemberID normalizes a member as given in the config, so the same
+// GPU given twice in one form is caught. The index, UUID and bus ID of one
+// GPU can only be matched up once it is found.
+func groupMemberID(id string) string {
+	if index, err := strconv.Atoi(id); err == nil {
+		return strconv.Itoa(index)
+	}
+	return device.NormalizePCIBusID(id)
+}
+
+// readingKey tells the members of a group apart: by UUID, which survives
+// rescans, or by index for amdgpu cards, which have none.
+func readingKey(monitor *DeviceMonitor) string {
+	if monitor.UUID != "" {
+		return monitor.UUID
+	}
+	return "index:" + strconv.Itoa(monitor.Index)
+}
+
+func groupMemberMatches(id string, monitor *DeviceMonitor) bool {
+	if index, err := strconv.Atoi(id); err == nil {
+		return index == monitor.Index
+	}
+	return strings.EqualFold(id, monitor.UUID) || (monitor.PCIBusID != "" && device.NormalizePCIBusID(id) == device.NormalizePCIBusID(monitor.PCIBusID))
+}
+
+type groupReading struct {
+	temperature int
+	expires time.Time
+}
+
+// groupRegistry collects the latest temperature of every group member.
+// Workers update their GPUs concurrently, so readings go through it rather
+// than through the other monitors.
+type groupRegistry struct {
+	mu sync.Mutex
+	groups []GroupConfig
+	readings map[string]map[string]groupReading
+}
+
+var fanGroups = &groupRegistry{}
+
+func (r *groupRegistry) configure(groups []GroupConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups = groups
+	r.readings = map[string]map[string]groupReading{}
+	for _, group := range groups {
+		r.readings[group.Name] = map[string]groupReading{}
+	}
+}
+
+// group is the name of the first group the monitor belongs to, if any.
+func (r *groupRegistry) group(monitor *DeviceMonitor) string {
+	for _, group := range r.groups {
+		for _, id := range group.GPUs {
+			if groupMemberMatches(id, monitor) {
+				return group.Name
+			}
+		}
+	}
+	return ""
+}
+
+// report records the monitor's own control temperature. It counts for three
+// update intervals, so a member that stops reporting drops out of the group.
+func (r *groupRegistry) report(monitor *DeviceMonitor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name := r.group(monitor); name != "" {
+		r.readings[name][readingKey(monitor)] = groupReading{temperature: monitor.Temperature, expires: clock().Add(3 * updateInterval(monitor))}
+	}
+}
+
+// temperature is what the monitor's curve should see: the hottest current
+// reading of its group, or its own temperature outside a group.
+func (r *groupRegistry) temperature(monitor *DeviceMonitor) (int, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := r.group(monitor)
+	temperature := monitor.Temperature
+	if name == "" {
+		return temperature, ""
+	}
+	now := clock()
+	for _, reading := range r.readings[name] {
+		if now.Before(reading.expires) {
+			temperature = max(temperature, reading.temperature)
+		}
+	}
+	return temperature, name
+}
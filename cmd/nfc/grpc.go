@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	nfcv1 "github.com/jumbled00r/nvidia-fan-control/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer implements the FanControl service of api/v1/nfc.proto on top
+// of the same status store and commands as the REST API.
+type grpcServer struct {
+	nfcv1.UnimplementedFanControlServer
+	d *Daemon
+}
+
+func gpuMessage(d DeviceStatus) *nfcv1.GPU {
+	gpu := &nfcv1.GPU{
+		Index: int32(d.Index),
+		Name: d.Name,
+		Uuid: d.UUID,
+		PciBusId: d.PCIBusID,
+		Temperature: int32(d.Temperature),
+		RawTemperature: int32(d.RawTemperature),
+		PowerWatts: int32(d.PowerWatts),
+		Utilization: int32(d.Utilization),
+		FailSafe: d.FailSafe,
+		SpeedCap: int32(d.SpeedCap),
+		Throttle: d.Throttle,
+		DriverControl: d.DriverControl,
+		ProcessProfile: d.ProcessProfile,
+	}
+	for fanIdx, speed := range d.FanSpeeds {
+		fan := &nfcv1.Fan{Index: int32(fanIdx), SpeedPercent: int32(speed), Rpm: -1}
+		if fanIdx < len(d.FanRPMs) {
+			fan.Rpm = int32(d.FanRPMs[fanIdx])
+		}
+		if fanIdx < len(d.FanFailed) {
+			fan.Failed = d.FanFailed[fanIdx]
+		}
+		gpu.Fans = append(gpu.Fans, fan)
+	}
+	if d.OverrideSpeed != nil {
+		gpu.OverrideSpeed = proto.Int32(int32(*d.OverrideSpeed))
+	}
+	return gpu
+}
+
+// gpuMatches accepts either the NVML index or the UUID of a GPU, like
+// findMonitor; an empty id matches every GPU.
+func gpuMatches(d DeviceStatus, id string) bool {
+	index, err := strconv.Atoi(id)
+	return id == "" || (err == nil && d.Index == index) || strings.EqualFold(d.UUID, id)
+}
+
+func statusMessage(snapshot StatusSnapshot, gpu string) *nfcv1.Status {
+	message := &nfcv1.Status{
+		Time: timestamppb.New(snapshot.Time),
+		StartTime: timestamppb.New(snapshot.StartTime),
+		Profile: snapshot.Profile,
+		Profiles: snapshot.Profiles,
+		Paused: snapshot.Paused,
+		DryRun: snapshot.DryRun,
+		NvmlDown: snapshot.NVMLDown,
+		PowerSource: snapshot.PowerSource,
+	}
+	for _, d := range snapshot.Devices {
+		if gpuMatches(d, gpu) {
+			message.Gpus = append(message.Gpus, gpuMessage(d))
+		}
+	}
+	return message
+}
+
+func (s *grpcServer) GetStatus(ctx context.Context, request *nfcv1.GetStatusRequest) (*nfcv1.Status, error) {
+	return statusMessage(s.d.Status.Snapshot(), ""), nil
+}
+
+func (s *grpcServer) StreamTelemetry(request *nfcv1.StreamTelemetryRequest, stream grpc.ServerStreamingServer[nfcv1.Status]) error {
+	snapshots, unsubscribe := s.d.Status.Subscribe()
+	defer unsubscribe()
+	if err := stream.Send(statusMessage(s.d.Status.Snapshot(), request.Gpu)); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case snapshot := <-snapshots:
+			if err := stream.Send(statusMessage(snapshot, request.Gpu)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcServer) SetProfile(ctx context.Context, request *nfcv1.SetProfileRequest) (*nfcv1.SetProfileResponse, error) {
+	if err := s.d.Do(func(d *Daemon) error { return d.SetProfile(request.Profile) }); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &nfcv1.SetProfileResponse{Profile: request.Profile}, nil
+}
+
+func (s *grpcServer) OverrideFan(ctx context.Context, request *nfcv1.OverrideFanRequest) (*nfcv1.GPU, error) {
+	var speed *int
+	if request.Speed != nil {
+		value := int(*request.Speed)
+		speed = &value
+	}
+	if !request.Release && (speed == nil || *speed < 0 || *speed > 100) {
+		return nil, status.Error(codes.InvalidArgument, "speed must be between 0 and 100, or release must be true")
+	}
+	d, err := overrideFan(s.d, request.Gpu, speed, request.Release)
+	if errors.Is(err, errNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no managed GPU %q", request.Gpu)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return gpuMessage(d), nil
+}
+
+// checkGRPCToken requires the api_token as bearer token in the metadata.
+func checkGRPCToken(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// startGRPCServer serves the FanControl service on address, a host:port or
+// a unix: socket path. Without api_token it only serves a unix socket, which
+// like the control socket is only accessible to the daemon's user.
+func startGRPCServer(address string, d *Daemon) (func(), error) {
+	token := d.Config.APIToken
+	network, path := "tcp", address
+	if strings.HasPrefix(address, "unix:") {
+		network, path = "unix", strings.TrimPrefix(address, "unix:")
+		os.Remove(path)
+	}
+	if token == "" && network != "unix" {
+		return nil, fmt.Errorf("api_token is not set, refusing to serve the gRPC API on %s; set api_token or listen on a unix: socket", address)
+	}
+	listener, err := net.Listen(network, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	if network == "unix" {
+		if err := os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to restrict permissions of %s: %w", path, err)
+		}
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkGRPCToken(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, request)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkGRPCToken(stream.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	nfcv1.RegisterFanControlServer(server, &grpcServer{d: d})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logErrorf("gRPC server stopped: %v", err)
+		}
+	}()
+	logInfof("gRPC API listening on %s", listener.Addr())
+	return server.Stop, nil
+}
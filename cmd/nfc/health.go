@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// healthProblems lists what is wrong with the daemon according to its last
+// status: a loop that stopped publishing, NVML that is down, GPUs in
+// fail-safe, or no GPU under control at all. No problems means healthy.
+func healthProblems(snapshot StatusSnapshot, now time.Time) []string {
+	problems := []string{}
+	if snapshot.Time.IsZero() {
+		return append(problems, "the monitoring loop has not started")
+	}
+	// The loop publishes on every tick; allow for a few missed ones and
+	// for slow NVML calls.
+	if stale := max(3*snapshot.LoopInterval, 10*time.Second); now.Sub(snapshot.Time) > stale {
+		problems = append(problems, fmt.Sprintf("the monitoring loop is stalled, last update %s ago", now.Sub(snapshot.Time).Round(time.Second)))
+	}
+	if snapshot.NVMLDown {
+		problems = append(problems, "NVML is down, waiting for the driver")
+	}
+	if len(snapshot.Devices) == 0 {
+		problems = append(problems, "no GPU is under control")
+	}
+	for _, d := range snapshot.Devices {
+		if d.FailSafe {
+			problems = append(problems, fmt.Sprintf("GPU %d is in fail-safe", d.Index))
+		}
+	}
+	return problems
+}
+
+// registerHealth serves /healthz without a token, so container runtimes and
+// load balancers can probe it. It only tells whether the daemon is healthy.
+func registerHealth(mux *http.ServeMux, d *Daemon) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		problems := healthProblems(d.Status.Snapshot(), time.Now())
+		if len(problems) > 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unhealthy", "problems": problems})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	registerReadiness(mux, d)
+}
+
+// registerReadiness serves /readyz, which answers 200 once the daemon
+// controls at least one GPU through a working NVML session.
+func registerReadiness(mux *http.ServeMux, d *Daemon) {
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := d.Status.Snapshot()
+		if snapshot.Time.IsZero() || snapshot.NVMLDown || len(snapshot.Devices) == 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	})
+}
+
+func cmdHealthcheck(args []string) {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	quiet := flags.Bool("quiet", false, "print nothing, only set the exit status")
+	flags.Parse(args)
+	response, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"})
+	problems := []string{}
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		problems = healthProblems(*response.Status, time.Now())
+	}
+	if len(problems) == 0 {
+		if !*quiet {
+			fmt.Println("healthy")
+		}
+		return
+	}
+	if !*quiet {
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "unhealthy: %s\n", problem)
+		}
+	}
+	os.Exit(1)
+}
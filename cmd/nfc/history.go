@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HistoryConfig struct {
+	Enabled bool `json:"enabled"`
+	Directory string `json:"directory"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+	RetentionDays int `json:"retention_days"`
+}
+
+func applyHistoryDefaults(config *HistoryConfig) {
+	if config.Directory == "" {
+		config.Directory = defaultHistoryDir
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 10
+	}
+	if config.RetentionDays <= 0 {
+		config.RetentionDays = 7
+	}
+}
+
+var historyHeader = []string{"time", "gpu", "uuid", "temperature", "raw_temperature", "power_watts", "utilization", "fan_speeds", "fan_rpms", "fail_safe"}
+
+// The history is one CSV file per day. The current day is written
+// uncompressed and synced on every sample, so it survives a crash or a
+// thermal shutdown; earlier days are gzipped.
+const historyDateLayout = "2006-01-02"
+
+func historyFile(dir string, day time.Time, compressed bool) string {
+	name := day.Format(historyDateLayout) + ".csv"
+	if compressed {
+		name += ".gz"
+	}
+	return filepath.Join(dir, name)
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ";")
+}
+
+func historyRecords(snapshot StatusSnapshot) [][]string {
+	records := [][]string{}
+	for _, d := range snapshot.Devices {
+		records = append(records, []string{
+			snapshot.Time.Format(time.RFC3339),
+			strconv.Itoa(d.Index),
+			d.UUID,
+			strconv.Itoa(d.Temperature),
+			strconv.Itoa(d.RawTemperature),
+			strconv.Itoa(d.PowerWatts),
+			strconv.Itoa(d.Utilization),
+			joinInts(d.FanSpeeds),
+			joinInts(d.FanRPMs),
+			strconv.FormatBool(d.FailSafe),
+		})
+	}
+	return records
+}
+
+// compressFile gzips path next to itself and removes the original.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(out)
+	if _, err := io.Copy(writer, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// maintainHistory compresses the plain files of past days and deletes the
+// files older than the retention.
+func maintainHistory(config HistoryConfig, today time.Time) {
+	files, _ := filepath.Glob(filepath.Join(config.Directory, "*.csv*"))
+	oldest := today.AddDate(0, 0, -config.RetentionDays)
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".gz"), ".csv")
+		day, err := time.ParseInLocation(historyDateLayout, name, time.Local)
+		if err != nil {
+			continue
+		}
+		switch {
+		case day.Before(oldest):
+			if err := os.Remove(file); err != nil {
+				logWarnf("History: %v", err)
+			}
+		case !strings.HasSuffix(file, ".gz") && day.Before(today):
+			if err := compressFile(file); err != nil {
+				logWarnf("History: failed to compress %s: %v", file, err)
+			}
+		}
+	}
+}
+
+// startHistory records the latest status every interval until the returned
+// function is called.
+func startHistory(config HistoryConfig, d *Daemon) (func(), error) {
+	if err := os.MkdirAll(config.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Duration(config.IntervalSeconds * float64(time.Second)))
+		defer ticker.Stop()
+		var file *os.File
+		var writer *csv.Writer
+		day := ""
+		var last time.Time
+		defer func() {
+			if file != nil {
+				file.Close()
+			}
+		}()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			snapshot := d.Status.Snapshot()
+			if snapshot.Time.IsZero() || snapshot.Time.Equal(last) {
+				continue
+			}
+			last = snapshot.Time
+			now := time.Now()
+			if today := now.Format(historyDateLayout); today != day {
+				if file != nil {
+					file.Close()
+					file = nil
+				}
+				midnight, _ := time.ParseInLocation(historyDateLayout, today, time.Local)
+				maintainHistory(config, midnight)
+				path := historyFile(config.Directory, midnight, false)
+				_, statErr := os.Stat(path)
+				opened, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					logWarnf("History: %v", err)
+					continue
+				}
+				file, writer, day = opened, csv.NewWriter(opened), today
+				if statErr != nil {
+					writer.Write(historyHeader)
+				}
+			}
+			// Synced on every sample: a thermal shutdown cuts the power
+			// without flushing the page cache.
+			writer.WriteAll(historyRecords(snapshot))
+			err := writer.Error()
+			if err == nil {
+				err = file.Sync()
+			}
+			if err != nil {
+				logWarnf("History: failed to write %s: %v", file.Name(), err)
+			}
+		}
+	}()
+	logInfof("Recording history to %s every %gs, keeping %d day(s).", config.Directory, config.IntervalSeconds, config.RetentionDays)
+	return func() {
+		close(stop)
+		<-done
+	}, nil
+}
+
+// readHistory calls visit for every record between since and until, in
+// time order.
+func readHistory(dir string, since, until time.Time, visit func(at time.Time, record []string)) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".gz"), ".csv")
+		day, err := time.ParseInLocation(historyDateLayout, name, time.Local)
+		if err != nil || day.AddDate(0, 0, 1).Before(since) || day.After(until) {
+			continue
+		}
+		if err := readHistoryFile(file, since, until, visit); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func readHistoryFile(file string, since, until time.Time, visit func(at time.Time, record []string)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var input io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		input = gz
+	}
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// The last line of the current day may be cut short by a
+			// crash; keep what was read.
+			if strings.HasSuffix(file, ".csv") {
+				return nil
+			}
+			return err
+		}
+		if len(record) < len(historyHeader) || record[0] == historyHeader[0] {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, record[0])
+		if err != nil || at.Before(since) || at.After(until) {
+			continue
+		}
+		visit(at, record)
+	}
+}
+
+func cmdHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file, for history.directory")
+	dir := flags.String("dir", "", "history directory, overriding the config")
+	gpu := flags.String("gpu", "", "index or UUID of the GPU to show (default all)")
+	since := flags.Duration("since", time.Hour, "how far back to start")
+	until := flags.Duration("until", 0, "how far back to stop")
+	asCSV := flags.Bool("csv", false, "print the raw CSV records")
+	flags.Parse(args)
+	if *dir == "" {
+		*dir = defaultHistoryDir
+		setLogHandler(&sinkHandler{level: slog.LevelWarn, write: writerSink(os.Stderr)})
+		if config, err := loadConfig(*configFile); err == nil {
+			*dir = config.History.Directory
+		}
+	}
+	now := time.Now()
+	writer := csv.NewWriter(os.Stdout)
+	if *asCSV {
+		writer.Write(historyHeader)
+	} else {
+		fmt.Printf("%-20s %4s %6s %6s %6s %5s  %s\n", "TIME", "GPU", "TEMP", "RAW", "POWER", "UTIL", "FANS")
+	}
+	count := 0
+	err := readHistory(*dir, now.Add(-*since), now.Add(-*until), func(at time.Time, record []string) {
+		if *gpu != "" && record[1] != *gpu && !strings.EqualFold(record[2], *gpu) {
+			return
+		}
+		count++
+		if *asCSV {
+			writer.Write(record)
+			return
+		}
+		fmt.Printf("%-20s %4s %5s° %5s° %5sW %4s%%  %s%%\n", at.Local().Format("2006-01-02 15:04:05"), record[1], record[3], record[4], record[5], record[6], strings.ReplaceAll(record[7], ";", "% "))
+	})
+	writer.Flush()
+	if err != nil {
+		exitf("%v", err)
+	}
+	if count == 0 {
+		fmt.Fprintf(os.Stderr, "no history in %s for that period\n", *dir)
+	}
+}
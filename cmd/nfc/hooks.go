@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events that only hooks and listeners get, since they are not problems
+// worth a webhook or a desktop notification.
+const (
+	eventRangeChanged = "range_changed"
+	eventDeviceLost = "device_lost"
+)
+
+var hookEvents = append(append([]string(nil), alertEvents...), eventRangeChanged, eventDeviceLost)
+
+// HookConfig runs command whenever one of events occurs, with the event in
+// NFC_* environment variables. Without events it runs for all of them.
+type HookConfig struct {
+	Command []string `json:"command"`
+	Events []string `json:"events"`
+	TimeoutSeconds float64 `json:"timeout_seconds"`
+}
+
+func applyHookDefaults(config *HookConfig) {
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 10
+	}
+}
+
+func validateHook(config HookConfig) error {
+	if len(config.Command) == 0 || config.Command[0] == "" {
+		return fmt.Errorf("command is empty")
+	}
+	for _, event := range config.Events {
+		if !slices.Contains(hookEvents, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// hookRunner runs the hooks one at a time from a goroutine of its own, in
+// the order the events occurred, so a slow script neither holds up the
+// control loop nor races its own previous run.
+type hookRunner struct {
+	mu sync.Mutex
+	configs []HookConfig
+	queue chan Event
+}
+
+var hooks = &hookRunner{}
+
+func (h *hookRunner) configure(configs []HookConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.configs = configs
+	if h.queue == nil && len(configs) > 0 {
+		h.queue = make(chan Event, 64)
+		alerts.listen(h.enqueue)
+		go func() {
+			for event := range h.queue {
+				h.run(event)
+			}
+		}()
+	}
+}
+
+func (h *hookRunner) enqueue(event Event) {
+	select {
+	case h.queue <- event:
+	default:
+		logWarnf("Hook queue is full, dropping %s event for GPU %d.", event.Kind, event.GPUIndex)
+	}
+}
+
+// hookEnv describes the event to a hook, details included as
+// NFC_<DETAIL>.
+func hookEnv(event Event) []string {
+	env := []string{
+		"NFC_EVENT=" + event.Kind,
+		"NFC_RESOLVED=" + strconv.FormatBool(event.Resolved),
+		"NFC_HOST=" + event.Host,
+		"NFC_GPU_INDEX=" + strconv.Itoa(event.GPUIndex),
+		"NFC_GPU_NAME=" + event.GPUName,
+		"NFC_GPU_UUID=" + event.GPUUUID,
+		"NFC_TEMPERATURE=" + strconv.Itoa(event.Temperature),
+		"NFC_MESSAGE=" + event.Message,
+		"NFC_TIME=" + event.Time.Format(time.RFC3339),
+	}
+	keys := make([]string, 0, len(event.Details))
+	for key := range event.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, "NFC_"+strings.ToUpper(key)+"="+event.Details[key])
+	}
+	return env
+}
+
+func (h *hookRunner) run(event Event) {
+	h.mu.Lock()
+	configs := h.configs
+	h.mu.Unlock()
+	for _, config := range configs {
+		if len(config.Events) > 0 && !slices.Contains(config.Events, event.Kind) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.TimeoutSeconds*float64(time.Second)))
+		cmd := exec.CommandContext(ctx, config.Command[0], config.Command[1:]...)
+		cmd.Env = append(os.Environ(), hookEnv(event)...)
+		output, err := cmd.CombinedOutput()
+		cancel()
+		fields := logFields{"gpu_index": event.GPUIndex, "event": event.Kind, "hook": config.Command[0]}
+		if err != nil {
+			fields.Warnf("Hook %s failed for the %s event of GPU %d: %v: %s", config.Command[0], event.Kind, event.GPUIndex, err, strings.TrimSpace(string(output)))
+			continue
+		}
+		fields.Debugf("Hook %s ran for the %s event of GPU %d.", config.Command[0], event.Kind, event.GPUIndex)
+	}
+}
+
+func describeRange(r TemperatureRange) string {
+	if r.MaxTemperature == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d..%d°C", r.MinTemperature, r.MaxTemperature)
+}
+
+// checkRangeChange raises a range_changed event when a stepped curve has
+// moved to another range.
+func checkRangeChange(monitor *DeviceMonitor, previous TemperatureRange) {
+	current := monitor.CurrentTemperatureRange
+	if current == previous || current.MaxTemperature == 0 {
+		return
+	}
+	details := map[string]string{
+		"range_min": strconv.Itoa(current.MinTemperature),
+		"range_max": strconv.Itoa(current.MaxTemperature),
+		"fan_speed": strconv.Itoa(current.FanSpeed),
+	}
+	if previous.MaxTemperature != 0 {
+		details["previous_range_min"] = strconv.Itoa(previous.MinTemperature)
+		details["previous_range_max"] = strconv.Itoa(previous.MaxTemperature)
+		details["previous_fan_speed"] = strconv.Itoa(previous.FanSpeed)
+	}
+	alerts.emitDetails(monitor, eventRangeChanged, false, details, "range changed from %s to %s (%d%%) at %d°C", describeRange(previous), describeRange(current), current.FanSpeed, monitor.Temperature)
+}
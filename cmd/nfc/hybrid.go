@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// HybridConfig leaves the fans to the driver's automatic policy, with its
+// zero-RPM idle, while the GPU is cool. The daemon takes manual control at
+// manual_temperature and hands the fans back once the GPU has cooled to
+// hysteresis degrees below it.
+type HybridConfig struct {
+	ManualTemperature int `json:"manual_temperature"`
+	Hysteresis int `json:"hysteresis"`
+}
+
+func validateHybrid(config HybridConfig) error {
+	if config.ManualTemperature < 0 {
+		return fmt.Errorf("manual_temperature (%d) is negative", config.ManualTemperature)
+	}
+	if config.Hysteresis < 0 {
+		return fmt.Errorf("hysteresis (%d) is negative", config.Hysteresis)
+	}
+	return nil
+}
+
+// driverControlled reports whether the driver drives the fans of the GPU
+// for this update, handing them back or taking them over as the temperature
+// crosses the band. A pinned speed, the fail-safe and a failed fan always
+// take manual control.
+func driverControlled(monitor *DeviceMonitor) bool {
+	config := monitor.Settings.Hybrid
+	forced := monitor.OverrideSpeed != nil || failSafeSpeed(monitor) || monitor.PanicActive || (monitor.FanFailure.FullSpeed && hasFailedFan(monitor))
+	fields := logFields{"gpu_index": monitor.Index, "temperature": monitor.Temperature}
+	switch {
+	case monitor.DriverControl && (config.ManualTemperature <= 0 || forced || monitor.Temperature >= config.ManualTemperature):
+		fields.Infof("GPU %d is at %d°C, taking manual control of its fans.", monitor.Index, monitor.Temperature)
+		monitor.DriverControl = false
+	case !monitor.DriverControl && config.ManualTemperature > 0 && !forced && monitor.Temperature <= config.ManualTemperature-config.Hysteresis:
+		handBackFans(monitor)
+	}
+	return monitor.DriverControl
+}
+
+// handBackFans restores the automatic policy of every fan. The commanded
+// speeds are forgotten, so taking over again writes the policy and speed of
+// every fan.
+func handBackFans(monitor *DeviceMonitor) {
+	fields := logFields{"gpu_index": monitor.Index, "temperature": monitor.Temperature}
+	if monitor.DryRun {
+		fields.Infof("Dry run: would hand the fans of GPU %d back to the driver at %d°C.", monitor.Index, monitor.Temperature)
+	}
+	for fanIdx := 0; fanIdx < monitor.NumFans; fanIdx++ {
+		if !monitor.DryRun {
+			if ret := monitor.Backend.RestoreAuto(monitor, fanIdx); ret != nvml.SUCCESS {
+				countError(monitor, "set_policy")
+				checkNVMLLost(monitor, ret)
+				fields["nvml_error"] = nvml.ErrorString(ret)
+				fields.Errorf("Failed to hand GPU %d Fan %d back to the driver: %v", monitor.Index, fanIdx, nvml.ErrorString(ret))
+				return
+			}
+		}
+		monitor.FanControlled[fanIdx] = false
+		monitor.CurrentFanSpeeds[fanIdx] = -1
+	}
+	if !monitor.DryRun {
+		fields.Infof("GPU %d cooled to %d°C, handed its fans back to the driver.", monitor.Index, monitor.Temperature)
+	}
+	monitor.DriverControl = true
+}
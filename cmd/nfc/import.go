@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+)
+
+const (
+	importGWE = "gwe"
+	importAfterburner = "afterburner"
+	importFancontrol = "fancontrol"
+)
+
+// importedCurve is a fan curve read from another tool. Interval is zero when
+// the tool does not store one.
+type importedCurve struct {
+	Points []CurvePoint
+	Interval float64
+}
+
+// importGWECurve reads a GreenWithEnvy profile from the CSV written by
+//
+//	sqlite3 -csv ~/.config/gwe/gwe.db "SELECT p.name, s.temperature, s.duty FROM fan_profile p JOIN speed_step s ON s.profile_id = p.id"
+//
+// since GWE keeps its profiles in SQLite.
+func importGWECurve(r io.Reader, profile string) (importedCurve, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return importedCurve{}, err
+	}
+	profiles := map[string][]CurvePoint{}
+	for i, record := range records {
+		if len(record) != 3 {
+			return importedCurve{}, fmt.Errorf("line %d: expected name,temperature,duty", i+1)
+		}
+		temp, err1 := strconv.Atoi(record[1])
+		duty, err2 := strconv.Atoi(record[2])
+		if err1 != nil || err2 != nil {
+			if i == 0 {
+				continue
+			}
+			return importedCurve{}, fmt.Errorf("line %d: temperature and duty must be integers", i+1)
+		}
+		profiles[record[0]] = append(profiles[record[0]], CurvePoint{Temperature: temp, FanSpeed: duty})
+	}
+	if profile == "" {
+		if len(profiles) != 1 {
+			return importedCurve{}, fmt.Errorf("%d profiles found (%s), pick one with --profile", len(profiles), strings.Join(sortedKeys(profiles), ", "))
+		}
+		profile = sortedKeys(profiles)[0]
+	}
+	points, ok := profiles[profile]
+	if !ok {
+		return importedCurve{}, fmt.Errorf("no profile %q, found %s", profile, strings.Join(sortedKeys(profiles), ", "))
+	}
+	return importedCurve{Points: points}, nil
+}
+
+// importAfterburnerCurve reads SWAutoFanControlCurve from an MSI Afterburner
+// profile (.cfg). The value is hex: a version word, the number of points,
+// then that many temperature and duty pairs as little-endian float32.
+func importAfterburnerCurve(r io.Reader) (importedCurve, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || key != "SWAutoFanControlCurve" {
+			continue
+		}
+		data, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(data) < 8 {
+			return importedCurve{}, fmt.Errorf("SWAutoFanControlCurve is not a valid curve")
+		}
+		count := int(binary.LittleEndian.Uint32(data[4:8]))
+		if count == 0 || len(data) < 8+count*8 {
+			return importedCurve{}, fmt.Errorf("SWAutoFanControlCurve holds %d point(s) but only %d bytes", count, len(data))
+		}
+		points := []CurvePoint{}
+		for i := 0; i < count; i++ {
+			temp := math.Float32frombits(binary.LittleEndian.Uint32(data[8+i*8:]))
+			duty := math.Float32frombits(binary.LittleEndian.Uint32(data[12+i*8:]))
+			points = append(points, CurvePoint{Temperature: int(math.Round(float64(temp))), FanSpeed: int(math.Round(float64(duty)))})
+		}
+		return importedCurve{Points: points}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return importedCurve{}, err
+	}
+	return importedCurve{}, fmt.Errorf("no SWAutoFanControlCurve found; is the software fan curve enabled in this profile?")
+}
+
+// importFancontrolCurve converts one channel of an lm-sensors fancontrol
+// config. fancontrol keeps the fan at MINPWM below MINTEMP, ramps it from
+// MINSTOP to MAXPWM up to MAXTEMP and holds MAXPWM above.
+func importFancontrolCurve(r io.Reader, channel string) (importedCurve, error) {
+	settings := map[string]map[string]string{}
+	channels := []string{}
+	interval := 0.0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch key {
+		case "INTERVAL":
+			interval, _ = strconv.ParseFloat(value, 64)
+			continue
+		case "FCTEMPS", "FCFANS", "MINTEMP", "MAXTEMP", "MINSTART", "MINSTOP", "MINPWM", "MAXPWM":
+		default:
+			continue
+		}
+		for _, entry := range strings.Fields(value) {
+			pwm, setting, ok := strings.Cut(entry, "=")
+			if !ok {
+				continue
+			}
+			if settings[pwm] == nil {
+				settings[pwm] = map[string]string{}
+				channels = append(channels, pwm)
+			}
+			settings[pwm][key] = setting
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return importedCurve{}, err
+	}
+	if len(channels) == 0 {
+		return importedCurve{}, fmt.Errorf("no fan channels found")
+	}
+	if channel == "" {
+		channel = channels[0]
+		if len(channels) > 1 {
+			fmt.Fprintf(os.Stderr, "Importing %s; the file also has %s, pick another with --channel.\n", channel, strings.Join(channels[1:], ", "))
+		}
+	}
+	values := settings[channel]
+	if values == nil {
+		return importedCurve{}, fmt.Errorf("no channel %q, found %s", channel, strings.Join(channels, ", "))
+	}
+	number := func(key string, def int) (int, error) {
+		if values[key] == "" {
+			if def < 0 {
+				return 0, fmt.Errorf("%s is missing for %s", key, channel)
+			}
+			return def, nil
+		}
+		return strconv.Atoi(values[key])
+	}
+	minTemp, err := number("MINTEMP", -1)
+	if err != nil {
+		return importedCurve{}, err
+	}
+	maxTemp, err := number("MAXTEMP", -1)
+	if err != nil {
+		return importedCurve{}, err
+	}
+	minStop, err := number("MINSTOP", -1)
+	if err != nil {
+		return importedCurve{}, err
+	}
+	minPWM, err := number("MINPWM", 0)
+	if err != nil {
+		return importedCurve{}, err
+	}
+	maxPWM, err := number("MAXPWM", 255)
+	if err != nil {
+		return importedCurve{}, err
+	}
+	percent := func(pwm int) int { return int(math.Round(float64(pwm) * 100 / 255)) }
+	points := []CurvePoint{}
+	if minPWM < minStop {
+		points = append(points, CurvePoint{Temperature: minTemp - 1, FanSpeed: percent(minPWM)})
+	}
+	points = append(points, CurvePoint{Temperature: minTemp, FanSpeed: percent(minStop)}, CurvePoint{Temperature: maxTemp, FanSpeed: percent(maxPWM)})
+	return importedCurve{Points: points, Interval: interval}, nil
+}
+
+func cmdImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	from := flags.String("from", "", "format of the file: gwe, afterburner or fancontrol")
+	profile := flags.String("profile", "", "GreenWithEnvy profile to import (default the only one)")
+	channel := flags.String("channel", "", "fancontrol channel to import, e.g. hwmon1/pwm1 (default the first)")
+	mode := flags.String("mode", "interpolated", "curve to write: interpolated or stepped")
+	output := flags.String("output", "config.json", "file to write, or - for stdout")
+	force := flags.Bool("force", false, "overwrite an existing file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: nvidia-fan-control import --from gwe|afterburner|fancontrol [flags] file\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *mode != "stepped" && *mode != "interpolated" {
+		exitf("--mode must be stepped or interpolated")
+	}
+	if _, err := os.Stat(*output); *output != "-" && err == nil && !*force {
+		exitf("%s already exists, use --force to overwrite it", *output)
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer file.Close()
+	var imported importedCurve
+	switch *from {
+	case importGWE:
+		imported, err = importGWECurve(file, *profile)
+	case importAfterburner:
+		imported, err = importAfterburnerCurve(file)
+	case importFancontrol:
+		imported, err = importFancontrolCurve(file, *channel)
+	default:
+		exitf("--from must be gwe, afterburner or fancontrol")
+	}
+	if err != nil {
+		exitf("%s: %v", flags.Arg(0), err)
+	}
+	sort.SliceStable(imported.Points, func(i, j int) bool { return imported.Points[i].Temperature < imported.Points[j].Temperature })
+	if err := curve.ValidatePoints(imported.Points, 3); err != nil {
+		exitf("%s: the imported curve is invalid: %v", flags.Arg(0), err)
+	}
+	report := os.Stdout
+	if *output == "-" {
+		report = os.Stderr
+	}
+	fmt.Fprintf(report, "Imported %d point(s): %s\n", len(imported.Points), formatPoints(imported.Points))
+	config := initConfig{TimeToUpdate: 2}
+	if imported.Interval > 0 {
+		config.TimeToUpdate = imported.Interval
+	}
+	config.initCurve = initCurve{CurveMode: *mode, CurvePoints: imported.Points, CurveHysteresis: 3}
+	if *mode == "stepped" {
+		config.initCurve = initCurve{CurveMode: *mode, TemperatureRanges: curve.Steps(imported.Points, 3)}
+	}
+	writeInitConfig(config, *output, report)
+}
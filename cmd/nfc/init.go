@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// defaultSlowdown is assumed for GPUs that do not report their thermal
+// thresholds, and for the config written without --auto.
+const defaultSlowdown = 90
+
+// initCurve and initGPU are the parts of the config init writes, kept
+// apart from ControlConfig so the file only holds the generated settings.
+type initCurve struct {
+	CurveMode string `json:"curve_mode"`
+	TemperatureRanges []TemperatureRange `json:"temperature_ranges,omitempty"`
+	CurvePoints []CurvePoint `json:"curve_points,omitempty"`
+	CurveHysteresis int `json:"curve_hysteresis,omitempty"`
+}
+
+type initGPU struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+	initCurve
+}
+
+type initConfig struct {
+	TimeToUpdate float64 `json:"time_to_update"`
+	initCurve
+	GPUs []initGPU `json:"gpus,omitempty"`
+}
+
+func generateCurve(mode string, slowdown int, minSpeed int, maxSpeed int) initCurve {
+	points := curve.Generate(slowdown, minSpeed, maxSpeed)
+	if mode == "interpolated" {
+		return initCurve{CurveMode: mode, CurvePoints: points, CurveHysteresis: 3}
+	}
+	return initCurve{CurveMode: mode, TemperatureRanges: curve.Steps(points, 3)}
+}
+
+// initProbe is what init learns about a GPU.
+type initProbe struct {
+	Index int
+	Name string
+	UUID string
+	Temperature int
+	NumFans int
+	Slowdown int
+	MinSpeed int
+	MaxSpeed int
+}
+
+// probeGPUs reads the name, thresholds and fan limits of every GPU and
+// reports them.
+func probeGPUs(report io.Writer) []initProbe {
+	count, ret := gpuBackend.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		exitf("unable to get NVIDIA device count: %v", nvml.ErrorString(ret))
+	}
+	gpus := []initProbe{}
+	for i := 0; i < count; i++ {
+		handle, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			fmt.Fprintf(report, "GPU %d: skipped: %v\n", i, nvml.ErrorString(ret))
+			continue
+		}
+		gpu := initProbe{Index: i}
+		gpu.Name, _ = gpuBackend.DeviceGetName(handle)
+		if gpu.UUID, ret = gpuBackend.DeviceGetUUID(handle); ret != nvml.SUCCESS {
+			fmt.Fprintf(report, "GPU %d: skipped: unable to get UUID: %v\n", i, nvml.ErrorString(ret))
+			continue
+		}
+		temp, _ := gpuBackend.DeviceGetTemperature(handle, nvml.TEMPERATURE_GPU)
+		gpu.Temperature = int(temp)
+		gpu.NumFans, _ = gpuBackend.DeviceGetNumFans(handle)
+		slowdown, ok := device.SlowdownTemperature(gpuBackend, handle)
+		source := "reported by the driver"
+		if !ok {
+			slowdown, source = defaultSlowdown, "assumed, the driver reports no thresholds"
+		}
+		gpu.Slowdown = slowdown
+		gpu.MinSpeed, gpu.MaxSpeed = device.FanSpeedLimits(gpuBackend, handle)
+		fmt.Fprintf(report, "GPU %d: %s: %d°C now, %d fan(s) at %d-%d%%, slowdown at %d°C (%s)\n", i, gpu.Name, gpu.Temperature, gpu.NumFans, gpu.MinSpeed, gpu.MaxSpeed, slowdown, source)
+		gpus = append(gpus, gpu)
+	}
+	return gpus
+}
+
+func cmdInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	auto := flags.Bool("auto", false, "read the thermal thresholds and fan limits of every GPU and write a curve for each")
+	interactive := flags.Bool("interactive", false, "show every GPU and build its curve step by step")
+	mode := flags.String("mode", "stepped", "curve to write: stepped or interpolated")
+	output := flags.String("output", "config.json", "file to write, or - for stdout")
+	force := flags.Bool("force", false, "overwrite an existing file")
+	flags.Parse(args)
+	if *mode != "stepped" && *mode != "interpolated" {
+		exitf("--mode must be stepped or interpolated")
+	}
+	if _, err := os.Stat(*output); *output != "-" && err == nil && !*force {
+		exitf("%s already exists, use --force to overwrite it", *output)
+	}
+	report := os.Stdout
+	if *output == "-" {
+		report = os.Stderr
+	}
+
+	config := initConfig{TimeToUpdate: 2}
+	// The top-level curve covers GPUs without their own section, such as
+	// hotplugged ones, so it follows the GPU that throttles first.
+	coolest := defaultSlowdown
+	if *auto || *interactive {
+		nvmlCleanup, err := initNVML()
+		if err != nil {
+			exitf("%v", err)
+		}
+		defer nvmlCleanup()
+		gpus := probeGPUs(report)
+		if *interactive {
+			config, *mode = runWizard(os.Stdin, report, gpus, *mode)
+		} else {
+			for _, gpu := range gpus {
+				config.GPUs = append(config.GPUs, initGPU{UUID: gpu.UUID, Name: gpu.Name, initCurve: generateCurve(*mode, gpu.Slowdown, gpu.MinSpeed, gpu.MaxSpeed)})
+			}
+		}
+		for _, gpu := range gpus {
+			coolest = min(coolest, gpu.Slowdown)
+		}
+	}
+	config.initCurve = generateCurve(*mode, coolest, 0, 100)
+
+	writeInitConfig(config, *output, report)
+}
+
+// writeInitConfig writes config to output, or stdout for "-", and checks
+// that the daemon loads it.
+func writeInitConfig(config initConfig, output string, report io.Writer) {
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		exitf("%v", err)
+	}
+	data = append(data, '\n')
+	if output == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		exitf("%v", err)
+	}
+	setLogHandler(&sinkHandler{level: slog.LevelWarn, write: writerSink(os.Stderr)})
+	if _, err := loadConfig(output); err != nil {
+		exitf("%s was written but does not load: %v", output, err)
+	}
+	fmt.Fprintf(report, "Wrote %s; check it with \"nvidia-fan-control validate --config %s\".\n", output, output)
+}
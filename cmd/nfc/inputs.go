@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// Inputs an input curve can be keyed on, besides the temperature sensors.
+const (
+	inputPower = "power"
+	inputUtilization = "utilization"
+)
+
+// InputCurve is an extra curve on one input: a temperature sensor, the
+// power draw in watts or the utilization in percent. The fans run at the
+// highest speed any curve asks for, the main curve included, so a metric
+// that lags behind cannot hold them back.
+type InputCurve struct {
+	Input string `json:"input"`
+	Points []InputPoint `json:"points"`
+	Hysteresis int `json:"hysteresis"`
+}
+
+type InputPoint struct {
+	Value int `json:"value"`
+	FanSpeed int `json:"fan_speed"`
+}
+
+// validateInputCurves keeps the speeds within 0-100: like power_points, the
+// input curves give a duty cycle even with speed_unit "rpm".
+func validateInputCurves(curves []InputCurve) error {
+	for i, c := range curves {
+		switch c.Input {
+		case device.SensorGPU, device.SensorMemory, inputPower, inputUtilization:
+		case "":
+			return fmt.Errorf("input_curves[%d]: no input given", i)
+		default:
+			return fmt.Errorf("input_curves[%d]: unknown input %q, expected \"gpu\", \"memory\", \"power\" or \"utilization\"", i, c.Input)
+		}
+		if len(c.Points) == 0 {
+			return fmt.Errorf("input_curves[%d]: points is empty", i)
+		}
+		for j, p := range c.Points {
+			if p.FanSpeed < 0 || p.FanSpeed > 100 {
+				return fmt.Errorf("input_curves[%d]: points[%d]: fan_speed (%d) is outside 0-100", i, j, p.FanSpeed)
+			}
+			if j > 0 && p.Value <= c.Points[j-1].Value {
+				return fmt.Errorf("input_curves[%d]: points[%d]: value (%d) must be greater than the previous point (%d)", i, j, p.Value, c.Points[j-1].Value)
+			}
+		}
+		if c.Hysteresis < 0 {
+			return fmt.Errorf("input_curves[%d]: hysteresis (%d) is negative", i, c.Hysteresis)
+		}
+	}
+	return nil
+}
+
+func inputPoints(points []InputPoint) []CurvePoint {
+	converted := make([]CurvePoint, len(points))
+	for i, p := range points {
+		converted[i] = CurvePoint{Temperature: p.Value, FanSpeed: p.FanSpeed}
+	}
+	return converted
+}
+
+// readCurveInputs reads the sensors the input curves need that the control
+// temperature did not, into SensorTemperatures. A sensor that fails, or
+// that the board does not have, only leaves its curve out.
+func readCurveInputs(monitor *DeviceMonitor) {
+	for _, c := range monitor.Settings.InputCurves {
+		if c.Input == inputPower || c.Input == inputUtilization {
+			continue
+		}
+		if _, ok := monitor.SensorTemperatures[c.Input]; ok {
+			continue
+		}
+		temp, ret := readSensor(monitor, c.Input)
+		if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			countError(monitor, "get_temperature")
+			logFields{"gpu_index": monitor.Index, "sensor": c.Input, "nvml_error": nvml.ErrorString(ret)}.Warnf("Failed to get %s temperature for device %d: %v", c.Input, monitor.Index, nvml.ErrorString(ret))
+			continue
+		}
+		if monitor.SensorTemperatures == nil {
+			monitor.SensorTemperatures = map[string]int{}
+		}
+		monitor.SensorTemperatures[c.Input] = temp
+	}
+}
+
+// inputValue is the latest reading of input, or false if there is none.
+func inputValue(monitor *DeviceMonitor, input string) (int, bool) {
+	switch input {
+	case inputPower:
+		return monitor.PowerWatts, monitor.PowerWatts >= 0
+	case inputUtilization:
+		return monitor.Utilization, monitor.Utilization >= 0
+	}
+	temp, ok := monitor.SensorTemperatures[input]
+	return temp, ok
+}
+
+// inputCurvesFloor is the highest speed the input curves ask for, and the
+// input it came from.
+func inputCurvesFloor(monitor *DeviceMonitor) (int, string) {
+	floor, leading := 0, ""
+	for _, c := range monitor.Settings.InputCurves {
+		value, ok := inputValue(monitor, c.Input)
+		if !ok {
+			continue
+		}
+		if speed := curve.InterpolateWithHysteresis(value, monitor.BaseFanSpeed, inputPoints(c.Points), c.Hysteresis); speed > floor {
+			floor, leading = speed, c.Input
+		}
+	}
+	return floor, leading
+}
+
+// describeInputCurves lists the input curves, e.g. " memory:70=40%,90=100%".
+func describeInputCurves(curves []InputCurve) string {
+	description := ""
+	for _, c := range curves {
+		points := make([]string, len(c.Points))
+		for i, p := range c.Points {
+			points[i] = fmt.Sprintf("%d=%d%%", p.Value, p.FanSpeed)
+		}
+		description += fmt.Sprintf(" %s:%s", c.Input, strings.Join(points, ","))
+		if c.Hysteresis > 0 {
+			description += fmt.Sprintf("/h%d", c.Hysteresis)
+		}
+	}
+	return description
+}
@@ -0,0 +1,206 @@
+//go:build !windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	unitName = "nvidia-fan-control.service"
+	defaultUnitFile = "/etc/systemd/system/" + unitName
+)
+
+// longestInterval is the largest time_to_update, or adaptive max_seconds,
+// in the config, including every GPU and profile.
+func longestInterval(config Config) float64 {
+	longest := 0.0
+	profiles := []ProfileConfig{config.ProfileConfig}
+	for _, profile := range config.Profiles {
+		profiles = append(profiles, profile)
+	}
+	for _, profile := range profiles {
+		if profile.Default != nil {
+			longest = math.Max(longest, math.Max(profile.Default.TimeToUpdate, profile.Default.AdaptiveInterval.MaxSeconds))
+		}
+		for _, gpu := range profile.GPUs {
+			longest = math.Max(longest, math.Max(gpu.TimeToUpdate, gpu.AdaptiveInterval.MaxSeconds))
+		}
+	}
+	return longest
+}
+
+// writablePaths lists the directories the daemon writes to, which the unit
+// exempts from ProtectSystem=strict.
+func writablePaths(config Config) []string {
+	socket := config.ControlSocket
+	if socket == "" {
+		socket = defaultControlSocket
+	}
+	files := []string{config.PIDFile, socket, config.CalibrationFile, config.State.File}
+	if output := strings.ToLower(config.Log.Output); output == "" || output == "file" {
+		files = append(files, config.Log.File)
+	}
+	if config.Textfile.File != "" {
+		files = append(files, config.Textfile.File)
+	}
+	dirs := []string{}
+	for _, file := range files {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	if config.History.Enabled {
+		dirs = append(dirs, config.History.Directory)
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// systemdUnit renders a unit that runs executable with configFile, with the
+// sandboxing the config allows: sysfs stays writable for amdgpu cards and
+// hwmon outputs, USB stays open for liquidctl, and /tmp and exec stay
+// available for nvidia-settings, liquidctl and notifications.
+func systemdUnit(executable string, configFile string, config Config) string {
+	watchdog := max(30, int(math.Ceil(3*longestInterval(config))))
+	var unit strings.Builder
+	fmt.Fprintf(&unit, `[Unit]
+Description=NVIDIA Fan Control
+After=sysinit.target nvidia-persistenced.service
+StartLimitIntervalSec=300
+StartLimitBurst=5
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart=%s run --config %s
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+WatchdogSec=%d
+User=root
+
+# Only the NVIDIA device nodes are needed from /dev.
+DevicePolicy=closed
+DeviceAllow=char-nvidia-frontend rw
+DeviceAllow=char-nvidia-caps rw
+DeviceAllow=char-nvidia-uvm rw
+`, systemdQuote(executable), systemdQuote(configFile), watchdog)
+	if hasOutput(config, outputLiquidctl) {
+		unit.WriteString("DeviceAllow=char-hidraw rw\nDeviceAllow=char-usb_device rw\n")
+	}
+	unit.WriteString("ProtectSystem=strict\nProtectHome=read-only\n")
+	for _, dir := range writablePaths(config) {
+		fmt.Fprintf(&unit, "ReadWritePaths=-%s\n", systemdQuote(dir))
+	}
+	unit.WriteString(`NoNewPrivileges=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+SystemCallArchitectures=native
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+`)
+	if !config.AMDGPU && !hasOutput(config, outputHWMon) {
+		unit.WriteString("ProtectKernelTunables=yes\n")
+	}
+	if !needsExec(config) {
+		unit.WriteString("PrivateTmp=yes\n")
+	}
+	unit.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	return unit.String()
+}
+
+func systemdQuote(value string) string {
+	if !strings.ContainsAny(value, " \t\"'\\") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func systemctl(args ...string) {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		exitf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+}
+
+func cmdInstall(args []string) {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file the service runs with")
+	unitFile := flags.String("unit", defaultUnitFile, "path of the unit file to write")
+	printOnly := flags.Bool("print", false, "print the unit instead of writing it")
+	force := flags.Bool("force", false, "overwrite an existing unit file")
+	enable := flags.Bool("enable", false, "enable the service to start at boot")
+	start := flags.Bool("start", false, "start (or restart) the service now")
+	flags.Parse(args)
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		exitf("Cannot locate the executable: %v", err)
+	}
+	if *configFile, err = filepath.Abs(*configFile); err != nil {
+		exitf("%v", err)
+	}
+	setLogHandler(&sinkHandler{level: slog.LevelWarn, write: writerSink(os.Stderr)})
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		exitf("%s: %v", *configFile, err)
+	}
+	unit := systemdUnit(executable, *configFile, config)
+	if *printOnly {
+		fmt.Print(unit)
+		return
+	}
+	if _, err := os.Stat(*unitFile); err == nil && !*force {
+		exitf("%s already exists; pass --force to overwrite it", *unitFile)
+	}
+	for _, dir := range writablePaths(config) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			exitf("%v", err)
+		}
+	}
+	if err := os.WriteFile(*unitFile, []byte(unit), 0644); err != nil {
+		exitf("%v", err)
+	}
+	fmt.Printf("Wrote %s for %s with %s.\n", *unitFile, executable, *configFile)
+	systemctl("daemon-reload")
+	if *enable {
+		systemctl("enable", filepath.Base(*unitFile))
+		fmt.Println("Service enabled.")
+	}
+	if *start {
+		systemctl("restart", filepath.Base(*unitFile))
+		fmt.Println("Service started.")
+	}
+}
+
+func cmdUninstall(args []string) {
+	flags := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	unitFile := flags.String("unit", defaultUnitFile, "path of the unit file to remove")
+	flags.Parse(args)
+	if _, err := os.Stat(*unitFile); err != nil {
+		exitf("%v", err)
+	}
+	// Stopping first lets the daemon hand the fans back to the driver.
+	unit := filepath.Base(*unitFile)
+	exec.Command("systemctl", "disable", "--now", unit).Run()
+	if err := os.Remove(*unitFile); err != nil {
+		exitf("%v", err)
+	}
+	systemctl("daemon-reload")
+	fmt.Printf("Stopped, disabled and removed %s.\n", *unitFile)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+// On Windows install and uninstall manage the Windows service.
+
+func cmdInstall(args []string) {
+	cmdService(append([]string{"install"}, args...))
+}
+
+func cmdUninstall(args []string) {
+	cmdService(append([]string{"uninstall"}, args...))
+}
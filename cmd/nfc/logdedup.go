@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// logDedup collapses identical warnings and errors: the first is logged,
+// the repeats within the window are only counted, and a summary with the
+// count is logged when the window ends. A message that keeps recurring so
+// shows up once per window instead of once per update.
+type logDedup struct {
+	mu sync.Mutex
+	window time.Duration
+	entries map[string]*dedupEntry
+	messages map[slog.Level]int
+	suppressed map[slog.Level]int
+}
+
+type dedupEntry struct {
+	start time.Time
+	count int
+	record slog.Record
+}
+
+var logDeduplicator = &logDedup{window: 5 * time.Minute, entries: map[string]*dedupEntry{}, messages: map[slog.Level]int{}, suppressed: map[slog.Level]int{}}
+
+func applyLogDedupDefaults(config *LogConfig) {
+	if config.DedupSeconds == 0 {
+		config.DedupSeconds = 300
+	}
+}
+
+func (l *logDedup) configure(seconds float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.window = time.Duration(seconds * float64(time.Second))
+}
+
+// suppress counts the record and tells whether it repeats one logged less
+// than a window ago.
+func (l *logDedup) suppress(record slog.Record) bool {
+	if record.Level < slog.LevelWarn || record.Level >= levelFatal {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages[record.Level]++
+	if l.window <= 0 {
+		return false
+	}
+	key := record.Level.String() + " " + record.Message
+	entry := l.entries[key]
+	if entry == nil || record.Time.Sub(entry.start) >= l.window {
+		// Forget what no longer repeats, or the map grows with every
+		// message that ever carried a changing value.
+		for other, old := range l.entries {
+			if old.count == 0 && record.Time.Sub(old.start) >= l.window {
+				delete(l.entries, other)
+			}
+		}
+		l.entries[key] = &dedupEntry{start: record.Time, record: record}
+		return false
+	}
+	entry.count++
+	l.suppressed[record.Level]++
+	if entry.count == 1 {
+		time.AfterFunc(time.Until(entry.start.Add(l.window)), func() { l.flush(key, entry) })
+	}
+	return true
+}
+
+// flush logs how often the entry's message was suppressed, and starts the
+// next window, in which it is again only counted.
+func (l *logDedup) flush(key string, entry *dedupEntry) {
+	l.mu.Lock()
+	if l.entries[key] != entry || entry.count == 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	summary := slog.NewRecord(now, entry.record.Level, fmt.Sprintf("%s (repeated %d time(s) in the last %s)", entry.record.Message, entry.count, describeWindow(now.Sub(entry.start))), entry.record.PC)
+	entry.record.Attrs(func(a slog.Attr) bool {
+		summary.AddAttrs(a)
+		return true
+	})
+	summary.AddAttrs(slog.Int("repeated", entry.count))
+	entry.start, entry.count = now, 0
+	l.mu.Unlock()
+	slog.Default().Handler().Handle(context.Background(), summary)
+}
+
+func describeWindow(d time.Duration) string {
+	if minutes := int(d.Round(time.Minute) / time.Minute); minutes > 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	if seconds := int(d.Round(time.Second) / time.Second); seconds < 60 {
+		return fmt.Sprintf("%d second(s)", seconds)
+	}
+	return "minute"
+}
+
+// logCounts returns the warnings and errors logged so far, suppressed
+// repeats included, and the repeats alone.
+func (l *logDedup) logCounts() (map[slog.Level]int, map[slog.Level]int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	messages, suppressed := map[slog.Level]int{}, map[slog.Level]int{}
+	for level, count := range l.messages {
+		messages[level] = count
+	}
+	for level, count := range l.suppressed {
+		suppressed[level] = count
+	}
+	return messages, suppressed
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const levelFatal = slog.Level(12)
+
+// sinkHandler formats records as single lines and hands them to a backend
+// specific write function, so every sink shares the same message layout.
+type sinkHandler struct {
+	level slog.Level
+	attrs []slog.Attr
+	write func(level slog.Level, t time.Time, source string, line string, attrs []slog.Attr) error
+}
+
+func (h *sinkHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *sinkHandler) Handle(_ context.Context, record slog.Record) error {
+	// Structured fields are only forwarded to journald; the text layout
+	// already carries them in the formatted message.
+	line := record.Message
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	source := ""
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		source = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+	return h.write(record.Level, record.Time, source, line, attrs)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{level: h.level, attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...), write: h.write}
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+func levelName(level slog.Level) string {
+	if level >= levelFatal {
+		return "FATAL"
+	}
+	return level.String()
+}
+
+func writerSink(w io.Writer) func(slog.Level, time.Time, string, string, []slog.Attr) error {
+	return func(level slog.Level, t time.Time, source string, line string, _ []slog.Attr) error {
+		if source != "" {
+			source += ": "
+		}
+		_, err := fmt.Fprintf(w, "%s %s%s: %s\n", t.Format("2006/01/02 15:04:05"), source, levelName(level), line)
+		return err
+	}
+}
+
+func parseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+}
+
+func setLogHandler(handler slog.Handler) {
+	slog.SetDefault(slog.New(handler))
+	// Route anything still using the standard log package through the sink.
+	log.SetFlags(0)
+	log.SetOutput(&stdLogWriter{handler: handler})
+}
+
+type stdLogWriter struct {
+	handler slog.Handler
+}
+
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, strings.TrimSuffix(string(p), "\n"), 0)
+	return len(p), w.handler.Handle(context.Background(), record)
+}
+
+func init() {
+	setLogHandler(&sinkHandler{level: slog.LevelInfo, write: writerSink(os.Stderr)})
+}
+
+func setupLogging(logConfig LogConfig, foreground bool) (io.Closer, error) {
+	level, err := parseLogLevel(logConfig.Level)
+	if err != nil {
+		return nil, err
+	}
+	output := strings.ToLower(logConfig.Output)
+	if foreground {
+		output = "stderr"
+	}
+	format := strings.ToLower(logConfig.Format)
+	if format != "" && format != "text" && format != "json" {
+		return nil, fmt.Errorf("unknown log format %q", logConfig.Format)
+	}
+	logDeduplicator.configure(logConfig.DedupSeconds)
+	handler := &sinkHandler{level: level}
+	var closer io.Closer = io.NopCloser(nil)
+	var writer io.Writer
+	switch output {
+	case "", "file":
+		// lumberjack only opens the file on the first write, so check up front
+		// that it is writable to fail at startup rather than silently later.
+		logFile, err := os.OpenFile(logConfig.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file %s: %w", logConfig.File, err)
+		}
+		logFile.Close()
+		rotator := &lumberjack.Logger{
+			Filename: logConfig.File,
+			MaxSize: logConfig.MaxSizeMB,
+			MaxBackups: logConfig.MaxBackups,
+			MaxAge: logConfig.MaxAgeDays,
+			Compress: logConfig.Compress,
+		}
+		writer = rotator
+		closer = rotator
+	case "stdout":
+		writer = os.Stdout
+	case "stderr":
+		writer = os.Stderr
+	default:
+		write, sinkCloser, err := platformSink(output)
+		if err != nil {
+			return nil, err
+		}
+		handler.write = write
+		closer = sinkCloser
+	}
+	switch {
+	case writer != nil && format == "json":
+		setLogHandler(slog.NewJSONHandler(writer, &slog.HandlerOptions{
+			AddSource: true,
+			Level: level,
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				if level, ok := a.Value.Any().(slog.Level); ok && a.Key == slog.LevelKey {
+					return slog.String(slog.LevelKey, levelName(level))
+				}
+				return a
+			},
+		}))
+	case writer != nil:
+		handler.write = writerSink(writer)
+		setLogHandler(handler)
+	default:
+		setLogHandler(handler)
+	}
+	return closer, nil
+}
+
+// logFields attaches structured fields to a message for the json format and
+// journald, e.g. logFields{"gpu_index": 0}.Infof("...").
+type logFields map[string]interface{}
+
+func logAt(level slog.Level, fields logFields, format string, args ...interface{}) {
+	logger := slog.Default()
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, args...), pcs[0])
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, fields[key]))
+	}
+	if logDeduplicator.suppress(record) {
+		return
+	}
+	logger.Handler().Handle(context.Background(), record)
+}
+
+func logDebugf(format string, args ...interface{}) {
+	logAt(slog.LevelDebug, nil, format, args...)
+}
+
+func logInfof(format string, args ...interface{}) {
+	logAt(slog.LevelInfo, nil, format, args...)
+}
+
+func logWarnf(format string, args ...interface{}) {
+	logAt(slog.LevelWarn, nil, format, args...)
+}
+
+func logErrorf(format string, args ...interface{}) {
+	logAt(slog.LevelError, nil, format, args...)
+}
+
+func logFatalf(format string, args ...interface{}) {
+	logAt(levelFatal, nil, format, args...)
+	os.Exit(1)
+}
+
+// failureLogger keeps a job that retries on every tick from logging the
+// same failure each time: only the first of a run of failures is logged,
+// and recovered, if set, once the run ends.
+type failureLogger struct {
+	recovered string
+	failing bool
+}
+
+// observe logs err, after the message given by format, if it starts a run
+// of failures. It returns whether err is set.
+func (f *failureLogger) observe(err error, format string, args ...interface{}) bool {
+	switch {
+	case err != nil && !f.failing:
+		logWarnf(format+": %v", append(args, err)...)
+	case err == nil && f.failing && f.recovered != "":
+		logInfof("%s", f.recovered)
+	}
+	f.failing = err != nil
+	return err != nil
+}
+
+func (f logFields) Debugf(format string, args ...interface{}) {
+	logAt(slog.LevelDebug, f, format, args...)
+}
+
+func (f logFields) Infof(format string, args ...interface{}) {
+	logAt(slog.LevelInfo, f, format, args...)
+}
+
+func (f logFields) Warnf(format string, args ...interface{}) {
+	logAt(slog.LevelWarn, f, format, args...)
+}
+
+func (f logFields) Errorf(format string, args ...interface{}) {
+	logAt(slog.LevelError, f, format, args...)
+}
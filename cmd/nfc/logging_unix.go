@@ -0,0 +1,92 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strings"
+	"time"
+)
+
+var platformLogOutputs = []string{"syslog", "journald"}
+
+func platformSink(output string) (func(slog.Level, time.Time, string, string, []slog.Attr) error, io.Closer, error) {
+	switch output {
+	case "syslog":
+		writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "nvidia-fan-control")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return syslogSink(writer), writer, nil
+	case "journald":
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: "/run/systemd/journal/socket", Net: "unixgram"})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to journald: %w", err)
+		}
+		return journaldSink(conn), conn, nil
+	}
+	return nil, nil, fmt.Errorf("unknown log output %q", output)
+}
+
+func syslogSink(writer *syslog.Writer) func(slog.Level, time.Time, string, string, []slog.Attr) error {
+	return func(level slog.Level, _ time.Time, _ string, line string, _ []slog.Attr) error {
+		switch {
+		case level >= levelFatal:
+			return writer.Crit(line)
+		case level >= slog.LevelError:
+			return writer.Err(line)
+		case level >= slog.LevelWarn:
+			return writer.Warning(line)
+		case level >= slog.LevelInfo:
+			return writer.Info(line)
+		default:
+			return writer.Debug(line)
+		}
+	}
+}
+
+func journaldPriority(level slog.Level) int {
+	switch {
+	case level >= levelFatal:
+		return 2
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// journaldSink speaks the native journal protocol, using the length-prefixed
+// field encoding so messages may contain newlines.
+func journaldSink(conn *net.UnixConn) func(slog.Level, time.Time, string, string, []slog.Attr) error {
+	return func(level slog.Level, _ time.Time, source string, line string, attrs []slog.Attr) error {
+		var entry []byte
+		fields := [][2]string{
+			{"MESSAGE", line},
+			{"PRIORITY", fmt.Sprint(journaldPriority(level))},
+			{"SYSLOG_IDENTIFIER", "nvidia-fan-control"},
+		}
+		if file, lineNumber, ok := strings.Cut(source, ":"); ok {
+			fields = append(fields, [2]string{"CODE_FILE", file}, [2]string{"CODE_LINE", lineNumber})
+		}
+		for _, a := range attrs {
+			fields = append(fields, [2]string{strings.ToUpper(a.Key), a.Value.String()})
+		}
+		for _, field := range fields {
+			entry = append(entry, field[0]+"\n"...)
+			entry = binary.LittleEndian.AppendUint64(entry, uint64(len(field[1])))
+			entry = append(entry, field[1]+"\n"...)
+		}
+		_, err := conn.Write(entry)
+		return err
+	}
+}
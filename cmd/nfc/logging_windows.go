@@ -0,0 +1,40 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+var platformLogOutputs = []string{"eventlog"}
+
+func platformSink(output string) (func(slog.Level, time.Time, string, string, []slog.Attr) error, io.Closer, error) {
+	if output != "eventlog" {
+		return nil, nil, fmt.Errorf("unknown log output %q", output)
+	}
+	writer, err := eventlog.Open(serviceName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the event log: %w", err)
+	}
+	return eventlogSink(writer), writer, nil
+}
+
+// eventlogSink writes to the Application log under the source registered by
+// "service install". The event log has no debug level, so debug messages are
+// recorded as information.
+func eventlogSink(writer *eventlog.Log) func(slog.Level, time.Time, string, string, []slog.Attr) error {
+	return func(level slog.Level, _ time.Time, _ string, line string, _ []slog.Attr) error {
+		switch {
+		case level >= slog.LevelError:
+			return writer.Error(1, line)
+		case level >= slog.LevelWarn:
+			return writer.Warning(1, line)
+		default:
+			return writer.Info(1, line)
+		}
+	}
+}
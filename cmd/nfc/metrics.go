@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+)
+
+func writeMetrics(w io.Writer, snapshot StatusSnapshot) {
+	fmt.Fprintln(w, "# HELP nfc_gpu_temperature_celsius GPU temperature driving the curve, after smoothing.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_temperature_celsius gauge")
+	for _, d := range snapshot.Devices {
+		fmt.Fprintf(w, "nfc_gpu_temperature_celsius{%s} %d\n", gpuLabels(d), d.Temperature)
+	}
+	fmt.Fprintln(w, "# HELP nfc_gpu_temperature_raw_celsius GPU temperature before smoothing.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_temperature_raw_celsius gauge")
+	for _, d := range snapshot.Devices {
+		fmt.Fprintf(w, "nfc_gpu_temperature_raw_celsius{%s} %d\n", gpuLabels(d), d.RawTemperature)
+	}
+	fmt.Fprintln(w, "# HELP nfc_gpu_power_watts GPU power draw.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_power_watts gauge")
+	for _, d := range snapshot.Devices {
+		if d.PowerWatts >= 0 {
+			fmt.Fprintf(w, "nfc_gpu_power_watts{%s} %d\n", gpuLabels(d), d.PowerWatts)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_gpu_utilization_percent GPU utilization.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_utilization_percent gauge")
+	for _, d := range snapshot.Devices {
+		if d.Utilization >= 0 {
+			fmt.Fprintf(w, "nfc_gpu_utilization_percent{%s} %d\n", gpuLabels(d), d.Utilization)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_sensor_temperature_celsius Individual sensor readings of GPUs that aggregate several sensors.")
+	fmt.Fprintln(w, "# TYPE nfc_sensor_temperature_celsius gauge")
+	for _, d := range snapshot.Devices {
+		sensors := make([]string, 0, len(d.SensorTemperatures))
+		for sensor := range d.SensorTemperatures {
+			sensors = append(sensors, sensor)
+		}
+		sort.Strings(sensors)
+		for _, sensor := range sensors {
+			fmt.Fprintf(w, "nfc_sensor_temperature_celsius{%s,sensor=%q} %d\n", gpuLabels(d), sensor, d.SensorTemperatures[sensor])
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fan_speed_percent Commanded fan duty.")
+	fmt.Fprintln(w, "# TYPE nfc_fan_speed_percent gauge")
+	for _, d := range snapshot.Devices {
+		for fanIdx, speed := range d.FanSpeeds {
+			fmt.Fprintf(w, "nfc_fan_speed_percent{%s,fan=\"%d\"} %d\n", gpuLabels(d), fanIdx, speed)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fan_speed_rpm Fan tachometer reading.")
+	fmt.Fprintln(w, "# TYPE nfc_fan_speed_rpm gauge")
+	for _, d := range snapshot.Devices {
+		for fanIdx, rpm := range d.FanRPMs {
+			if rpm >= 0 {
+				fmt.Fprintf(w, "nfc_fan_speed_rpm{%s,fan=\"%d\"} %d\n", gpuLabels(d), fanIdx, rpm)
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fan_target_rpm Fan speed the curve asks for, on GPUs with speed_unit rpm.")
+	fmt.Fprintln(w, "# TYPE nfc_fan_target_rpm gauge")
+	for _, d := range snapshot.Devices {
+		if d.TargetRPM > 0 {
+			fmt.Fprintf(w, "nfc_fan_target_rpm{%s,fan=\"0\"} %d\n", gpuLabels(d), d.TargetRPM)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fan_failed Whether fan failure detection considers the fan dead or stuck.")
+	fmt.Fprintln(w, "# TYPE nfc_fan_failed gauge")
+	for _, d := range snapshot.Devices {
+		for fanIdx, failed := range d.FanFailed {
+			value := 0
+			if failed {
+				value = 1
+			}
+			fmt.Fprintf(w, "nfc_fan_failed{%s,fan=\"%d\"} %d\n", gpuLabels(d), fanIdx, value)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fan_reapplies_total Times a fan's speed was written again because it did not hold its setpoint.")
+	fmt.Fprintln(w, "# TYPE nfc_fan_reapplies_total counter")
+	for _, d := range snapshot.Devices {
+		for fanIdx, count := range d.FanReapplies {
+			fmt.Fprintf(w, "nfc_fan_reapplies_total{%s,fan=\"%d\"} %d\n", gpuLabels(d), fanIdx, count)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fail_safe_active Whether the fail-safe has taken over the GPU after repeated NVML errors.")
+	fmt.Fprintln(w, "# TYPE nfc_fail_safe_active gauge")
+	for _, d := range snapshot.Devices {
+		value := 0
+		if d.FailSafe {
+			value = 1
+		}
+		fmt.Fprintf(w, "nfc_fail_safe_active{%s} %d\n", gpuLabels(d), value)
+	}
+	fmt.Fprintln(w, "# HELP nfc_panic_active Whether the GPU reached its panic temperature and runs every fan at 100%.")
+	fmt.Fprintln(w, "# TYPE nfc_panic_active gauge")
+	for _, d := range snapshot.Devices {
+		fmt.Fprintf(w, "nfc_panic_active{%s} %d\n", gpuLabels(d), int(boolValue(d.Panic)))
+	}
+	fmt.Fprintln(w, "# HELP nfc_gpu_throttle_active Whether the GPU's clocks are currently held back, by reason.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_throttle_active gauge")
+	for _, d := range snapshot.Devices {
+		for _, class := range throttleClasses {
+			value := 0
+			if slices.Contains(d.Throttle, class) {
+				value = 1
+			}
+			fmt.Fprintf(w, "nfc_gpu_throttle_active{%s,reason=%q} %d\n", gpuLabels(d), class, value)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_gpu_throttle_seconds_total Time the GPU's clocks were held back, by reason.")
+	fmt.Fprintln(w, "# TYPE nfc_gpu_throttle_seconds_total counter")
+	for _, d := range snapshot.Devices {
+		for _, class := range throttleClasses {
+			fmt.Fprintf(w, "nfc_gpu_throttle_seconds_total{%s,reason=%q} %g\n", gpuLabels(d), class, d.ThrottleSeconds[class])
+		}
+	}
+	writeStatsMetrics(w, snapshot)
+	fmt.Fprintln(w, "# HELP nfc_temperature_range_min_celsius Lower bound of the active temperature range.")
+	fmt.Fprintln(w, "# TYPE nfc_temperature_range_min_celsius gauge")
+	for _, d := range snapshot.Devices {
+		if d.TemperatureRange != nil {
+			fmt.Fprintf(w, "nfc_temperature_range_min_celsius{%s} %d\n", gpuLabels(d), d.TemperatureRange.MinTemperature)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_temperature_range_max_celsius Upper bound of the active temperature range.")
+	fmt.Fprintln(w, "# TYPE nfc_temperature_range_max_celsius gauge")
+	for _, d := range snapshot.Devices {
+		if d.TemperatureRange != nil {
+			fmt.Fprintf(w, "nfc_temperature_range_max_celsius{%s} %d\n", gpuLabels(d), d.TemperatureRange.MaxTemperature)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_nvml_errors_total Failed NVML calls by operation.")
+	fmt.Fprintln(w, "# TYPE nfc_nvml_errors_total counter")
+	for _, d := range snapshot.Devices {
+		operations := make([]string, 0, len(d.Errors))
+		for operation := range d.Errors {
+			operations = append(operations, operation)
+		}
+		sort.Strings(operations)
+		for _, operation := range operations {
+			fmt.Fprintf(w, "nfc_nvml_errors_total{%s,operation=%q} %d\n", gpuLabels(d), operation, d.Errors[operation])
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_nvml_failed_attempts_total Failed NVML attempts, including retried ones, by error class.")
+	fmt.Fprintln(w, "# TYPE nfc_nvml_failed_attempts_total counter")
+	for _, d := range snapshot.Devices {
+		for _, class := range []string{device.ErrorTransient, device.ErrorFatal, device.ErrorLost} {
+			fmt.Fprintf(w, "nfc_nvml_failed_attempts_total{%s,class=%q} %d\n", gpuLabels(d), class, d.ErrorClasses[class])
+		}
+	}
+	messages, suppressed := logDeduplicator.logCounts()
+	fmt.Fprintln(w, "# HELP nfc_log_messages_total Warnings and errors logged, including repeats that were suppressed.")
+	fmt.Fprintln(w, "# TYPE nfc_log_messages_total counter")
+	fmt.Fprintf(w, "nfc_log_messages_total{level=\"warn\"} %d\n", messages[slog.LevelWarn])
+	fmt.Fprintf(w, "nfc_log_messages_total{level=\"error\"} %d\n", messages[slog.LevelError])
+	fmt.Fprintln(w, "# HELP nfc_log_suppressed_total Repeated warnings and errors that were only counted, see log.dedup_seconds.")
+	fmt.Fprintln(w, "# TYPE nfc_log_suppressed_total counter")
+	fmt.Fprintf(w, "nfc_log_suppressed_total{level=\"warn\"} %d\n", suppressed[slog.LevelWarn])
+	fmt.Fprintf(w, "nfc_log_suppressed_total{level=\"error\"} %d\n", suppressed[slog.LevelError])
+	fmt.Fprintln(w, "# HELP nfc_loop_duration_seconds Duration of the last monitoring loop iteration.")
+	fmt.Fprintln(w, "# TYPE nfc_loop_duration_seconds gauge")
+	fmt.Fprintf(w, "nfc_loop_duration_seconds %g\n", snapshot.LoopDuration.Seconds())
+	writeTimingMetrics(w, snapshot)
+}
+
+func gpuLabels(d DeviceStatus) string {
+	return "gpu=\"" + strconv.Itoa(d.Index) + "\",uuid=" + strconv.Quote(d.UUID) + ",name=" + strconv.Quote(d.Name)
+}
+
+func startHTTPServer(address string, d *Daemon) (func(), error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, d.Status.Snapshot())
+	})
+	registerHealth(mux, d)
+	if d.Config.APIToken != "" {
+		registerAPI(mux, d, d.Config.APIToken)
+		if d.Config.Dashboard {
+			registerDashboard(mux)
+		}
+	} else {
+		logInfof("api_token is not set, REST API disabled.")
+		if d.Config.Dashboard {
+			logWarnf("The web dashboard needs api_token, dashboard disabled.")
+		}
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logErrorf("HTTP server stopped: %v", err)
+		}
+	}()
+	logInfof("HTTP listener started on %s", listener.Addr())
+	return func() { server.Close() }, nil
+}
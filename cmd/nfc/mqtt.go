@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MQTTConfig struct {
+	Broker string `json:"broker"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ClientID string `json:"client_id"`
+	TopicPrefix string `json:"topic_prefix"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+	HomeAssistant bool `json:"home_assistant"`
+	DiscoveryPrefix string `json:"discovery_prefix"`
+	Commands bool `json:"commands"`
+}
+
+// topLevelProfile stands for the top-level settings where a profile name
+// must not be empty, as in the Home Assistant select.
+const topLevelProfile = "top-level"
+
+func applyMQTTDefaults(config *MQTTConfig) {
+	host, _ := os.Hostname()
+	if config.ClientID == "" {
+		config.ClientID = "nvidia-fan-control-" + host
+	}
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = "nvidia-fan-control/" + host
+	}
+	config.TopicPrefix = strings.TrimSuffix(config.TopicPrefix, "/")
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 10
+	}
+	if config.DiscoveryPrefix == "" {
+		config.DiscoveryPrefix = "homeassistant"
+	}
+	if config.Broker != "" && !strings.Contains(strings.TrimPrefix(config.Broker, "tcp://"), ":") {
+		config.Broker += ":1883"
+	}
+}
+
+func validateMQTT(config MQTTConfig) error {
+	if config.Broker == "" {
+		return nil
+	}
+	if strings.Contains(config.Broker, "://") && !strings.HasPrefix(config.Broker, "tcp://") {
+		return fmt.Errorf("broker %q: only tcp:// is supported", config.Broker)
+	}
+	if strings.ContainsAny(config.TopicPrefix, "+#") {
+		return fmt.Errorf("topic_prefix %q must not contain wildcards", config.TopicPrefix)
+	}
+	return nil
+}
+
+// mqttConn is a minimal MQTT 3.1.1 client: QoS 0 publishing and
+// subscriptions, which is all the daemon needs.
+type mqttConn struct {
+	conn net.Conn
+	reader *bufio.Reader
+	mu sync.Mutex
+	lastWrite time.Time
+}
+
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func (c *mqttConn) writePacket(header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(append(packet, body...))
+	c.lastWrite = time.Now()
+	return err
+}
+
+func (c *mqttConn) readPacket() (byte, []byte, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed packet length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// dialMQTT connects and logs in, leaving a retained "offline" will on the
+// availability topic in case the connection drops.
+func dialMQTT(config MQTTConfig, keepAlive time.Duration) (*mqttConn, error) {
+	conn, err := net.DialTimeout("tcp", strings.TrimPrefix(config.Broker, "tcp://"), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttConn{conn: conn, reader: bufio.NewReader(conn)}
+	flags := byte(0x02 | 0x04 | 0x20)
+	if config.Username != "" {
+		flags |= 0x80
+	}
+	if config.Password != "" {
+		flags |= 0x40
+	}
+	body := append(mqttString("MQTT"), 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive.Seconds()))
+	body = append(body, mqttString(config.ClientID)...)
+	body = append(body, mqttString(config.TopicPrefix+"/status")...)
+	body = append(body, mqttString("offline")...)
+	if config.Username != "" {
+		body = append(body, mqttString(config.Username)...)
+	}
+	if config.Password != "" {
+		body = append(body, mqttString(config.Password)...)
+	}
+	if err := c.writePacket(0x10, body); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	header, ack, err := c.readPacket()
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if header != 0x20 || len(ack) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected reply to CONNECT")
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused the connection (code %d)", ack[1])
+	}
+	return c, nil
+}
+
+func (c *mqttConn) publish(topic string, payload []byte, retain bool) error {
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	return c.writePacket(header, append(mqttString(topic), payload...))
+}
+
+func (c *mqttConn) subscribe(topic string) error {
+	body := binary.BigEndian.AppendUint16(nil, 1)
+	return c.writePacket(0x82, append(append(body, mqttString(topic)...), 0))
+}
+
+func (c *mqttConn) close() {
+	c.writePacket(0xe0, nil)
+	c.conn.Close()
+}
+
+// readMessages passes every incoming PUBLISH to handle until the
+// connection fails. Other packets, such as SUBACK and PINGRESP, are ignored.
+func (c *mqttConn) readMessages(handle func(topic string, payload []byte)) error {
+	for {
+		header, body, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if header&0xf0 != 0x30 || len(body) < 2 {
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+length {
+			continue
+		}
+		payload := body[2+length:]
+		if header&0x06 != 0 {
+			// QoS 1 and 2 messages carry a packet identifier.
+			if len(payload) < 2 {
+				continue
+			}
+			payload = payload[2:]
+		}
+		handle(string(body[2:2+length]), payload)
+	}
+}
+
+var topicUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// mqttGPUState is the retained state published per GPU.
+type mqttGPUState struct {
+	Temperature int `json:"temperature"`
+	FanSpeeds []int `json:"fan_speeds"`
+	FanRPMs []int `json:"fan_rpms"`
+	PowerWatts int `json:"power_watts"`
+	Utilization int `json:"utilization"`
+	FailSafe bool `json:"fail_safe"`
+	FanFailed bool `json:"fan_failed"`
+}
+
+func gpuTopicID(d DeviceStatus) string {
+	return topicUnsafe.ReplaceAllString(strings.ToLower(d.UUID), "_")
+}
+
+func publishMQTTState(c *mqttConn, config MQTTConfig, snapshot StatusSnapshot) error {
+	for _, d := range snapshot.Devices {
+		state := mqttGPUState{Temperature: d.Temperature, FanSpeeds: d.FanSpeeds, FanRPMs: d.FanRPMs, PowerWatts: d.PowerWatts, Utilization: d.Utilization, FailSafe: d.FailSafe}
+		for _, failed := range d.FanFailed {
+			state.FanFailed = state.FanFailed || failed
+		}
+		payload, _ := json.Marshal(state)
+		if err := c.publish(config.TopicPrefix+"/gpu/"+gpuTopicID(d)+"/state", payload, true); err != nil {
+			return err
+		}
+	}
+	profile := snapshot.Profile
+	if profile == "" {
+		profile = topLevelProfile
+	}
+	return c.publish(config.TopicPrefix+"/profile", []byte(profile), true)
+}
+
+// publishDiscovery announces a Home Assistant device per GPU with sensors
+// for its temperature, fans, power and utilization, plus a select for the
+// profile when commands are enabled.
+func publishDiscovery(c *mqttConn, config MQTTConfig, snapshot StatusSnapshot) error {
+	availability := config.TopicPrefix + "/status"
+	node := topicUnsafe.ReplaceAllString(config.ClientID, "_")
+	for _, d := range snapshot.Devices {
+		id := gpuTopicID(d)
+		deviceInfo := map[string]interface{}{"identifiers": []string{d.UUID}, "name": fmt.Sprintf("GPU %d %s", d.Index, d.Name), "model": d.Name}
+		sensor := func(key, name, template, unit, class string) error {
+			entity := map[string]interface{}{
+				"name": name,
+				"unique_id": id + "_" + key,
+				"state_topic": config.TopicPrefix + "/gpu/" + id + "/state",
+				"value_template": template,
+				"availability_topic": availability,
+				"device": deviceInfo,
+			}
+			if unit != "" {
+				entity["unit_of_measurement"] = unit
+				entity["state_class"] = "measurement"
+			}
+			if class != "" {
+				entity["device_class"] = class
+			}
+			payload, _ := json.Marshal(entity)
+			return c.publish(config.DiscoveryPrefix+"/sensor/"+node+"/"+id+"_"+key+"/config", payload, true)
+		}
+		if err := sensor("temperature", "Temperature", "{{ value_json.temperature }}", "°C", "temperature"); err != nil {
+			return err
+		}
+		for fanIdx := range d.FanSpeeds {
+			if err := sensor(fmt.Sprintf("fan%d", fanIdx), fmt.Sprintf("Fan %d", fanIdx), fmt.Sprintf("{{ value_json.fan_speeds[%d] }}", fanIdx), "%", ""); err != nil {
+				return err
+			}
+			if fanIdx < len(d.FanRPMs) && d.FanRPMs[fanIdx] >= 0 {
+				if err := sensor(fmt.Sprintf("fan%d_rpm", fanIdx), fmt.Sprintf("Fan %d RPM", fanIdx), fmt.Sprintf("{{ value_json.fan_rpms[%d] }}", fanIdx), "RPM", ""); err != nil {
+					return err
+				}
+			}
+		}
+		if d.PowerWatts >= 0 {
+			if err := sensor("power", "Power", "{{ value_json.power_watts }}", "W", "power"); err != nil {
+				return err
+			}
+		}
+		if d.Utilization >= 0 {
+			if err := sensor("utilization", "Utilization", "{{ value_json.utilization }}", "%", ""); err != nil {
+				return err
+			}
+		}
+	}
+	if !config.Commands {
+		return nil
+	}
+	options := append([]string{topLevelProfile}, snapshot.Profiles...)
+	payload, _ := json.Marshal(map[string]interface{}{
+		"name": "Fan profile",
+		"unique_id": node + "_profile",
+		"state_topic": config.TopicPrefix + "/profile",
+		"command_topic": config.TopicPrefix + "/profile/set",
+		"options": options,
+		"availability_topic": availability,
+		"device": map[string]interface{}{"identifiers": []string{config.ClientID}, "name": "nvidia-fan-control " + strings.TrimPrefix(config.ClientID, "nvidia-fan-control-")},
+	})
+	return c.publish(config.DiscoveryPrefix+"/select/"+node+"/profile/config", payload, true)
+}
+
+// startMQTT publishes the daemon's state to the broker until the returned
+// function is called, reconnecting whenever the connection is lost.
+func startMQTT(config MQTTConfig, d *Daemon) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	interval := time.Duration(config.IntervalSeconds * float64(time.Second))
+	keepAlive := max(60*time.Second, 2*interval)
+	go func() {
+		defer close(done)
+		backoff := time.Second
+		for {
+			err := runMQTTSession(config, d, interval, keepAlive, stop)
+			if err == nil {
+				return
+			}
+			logWarnf("MQTT: %v. Reconnecting in %s.", err, backoff)
+			select {
+			case <-stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+		}
+	}()
+	logInfof("Publishing to MQTT broker %s under %s.", config.Broker, config.TopicPrefix)
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// runMQTTSession serves one connection. It returns nil once stopped, and
+// the connection error otherwise.
+func runMQTTSession(config MQTTConfig, d *Daemon, interval, keepAlive time.Duration, stop <-chan struct{}) error {
+	c, err := dialMQTT(config, keepAlive)
+	if err != nil {
+		return err
+	}
+	defer c.conn.Close()
+	failed := make(chan error, 1)
+	go func() {
+		failed <- c.readMessages(func(topic string, payload []byte) {
+			if topic != config.TopicPrefix+"/profile/set" {
+				return
+			}
+			name := strings.TrimSpace(string(payload))
+			if name == topLevelProfile {
+				name = ""
+			}
+			if err := d.Do(func(d *Daemon) error { return d.SetProfile(name) }); err != nil {
+				logWarnf("MQTT: cannot switch to profile %q: %v", name, err)
+			}
+		})
+	}()
+	if err := c.publish(config.TopicPrefix+"/status", []byte("online"), true); err != nil {
+		return err
+	}
+	if config.Commands {
+		if err := c.subscribe(config.TopicPrefix + "/profile/set"); err != nil {
+			return err
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	announced := ""
+	for {
+		snapshot := d.Status.Snapshot()
+		if !snapshot.Time.IsZero() {
+			// Announce again whenever the set of GPUs changes.
+			devices := fmt.Sprint(len(snapshot.Profiles))
+			for _, gpu := range snapshot.Devices {
+				devices += "," + gpu.UUID
+			}
+			if config.HomeAssistant && devices != announced {
+				if err := publishDiscovery(c, config, snapshot); err != nil {
+					return err
+				}
+				announced = devices
+			}
+			if err := publishMQTTState(c, config, snapshot); err != nil {
+				return err
+			}
+		}
+		if time.Since(c.lastWrite) > keepAlive/2 {
+			if err := c.writePacket(0xc0, nil); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-stop:
+			c.publish(config.TopicPrefix+"/status", []byte("offline"), true)
+			c.close()
+			return nil
+		case err := <-failed:
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("broker closed the connection")
+			}
+			return err
+		case <-ticker.C:
+		}
+	}
+}
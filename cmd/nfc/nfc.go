@@ -0,0 +1,1716 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"github.com/BurntSushi/toml"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+	"gopkg.in/yaml.v3"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+type Config struct {
+	WatchConfig bool `json:"watch_config"`
+	HTTPListen string `json:"http_listen"`
+	GRPCListen string `json:"grpc_listen"`
+	Dashboard bool `json:"dashboard"`
+	MQTT MQTTConfig `json:"mqtt"`
+	Controller ControllerConfig `json:"controller"`
+	DBus DBusConfig `json:"dbus"`
+	Exporters []ExporterConfig `json:"exporters"`
+	Outputs []OutputConfig `json:"outputs"`
+	Textfile TextfileConfig `json:"textfile"`
+	History HistoryConfig `json:"history"`
+	State StateConfig `json:"state"`
+	APIToken string `json:"api_token"`
+	ControlSocket string `json:"control_socket"`
+	PIDFile string `json:"pid_file"`
+	Privileges PrivilegesConfig `json:"privileges"`
+	Log LogConfig `json:"log"`
+	FanFailure FanFailureConfig `json:"fan_failure"`
+	FanVerify FanVerifyConfig `json:"fan_verify"`
+	FailSafe FailSafeConfig `json:"fail_safe"`
+	PowerLimit PowerLimitConfig `json:"power_limit"`
+	PersistenceMode PersistenceModeConfig `json:"persistence_mode"`
+	Alerts AlertsConfig `json:"alerts"`
+	Hooks []HookConfig `json:"hooks"`
+	Groups []GroupConfig `json:"groups"`
+	Include []GPUMatch `json:"include"`
+	Exclude []GPUMatch `json:"exclude"`
+	ControlConfig
+	ProfileConfig
+	Profiles map[string]ProfileConfig `json:"profiles"`
+	ActiveProfile string `json:"active_profile"`
+	Schedules []ScheduleConfig `json:"schedules"`
+	PowerSource PowerSourceConfig `json:"power_source"`
+	ProcessProfiles []ProcessProfileConfig `json:"process_profiles"`
+	ProcessCheckSeconds float64 `json:"process_check_seconds"`
+	RescanInterval float64 `json:"rescan_interval"`
+	FanBackend string `json:"fan_backend"`
+	AMDGPU bool `json:"amdgpu"`
+	NVControl NVControlConfig `json:"nvcontrol"`
+	CalibrationFile string `json:"calibration_file"`
+	Calibrations map[string]FanCalibration `json:"-"`
+}
+
+type LogConfig struct {
+	Output string `json:"output"`
+	Level string `json:"level"`
+	Format string `json:"format"`
+	File string `json:"file"`
+	MaxSizeMB int `json:"max_size_mb"`
+	MaxBackups int `json:"max_backups"`
+	MaxAgeDays int `json:"max_age_days"`
+	Compress bool `json:"compress"`
+	DedupSeconds float64 `json:"dedup_seconds"`
+}
+
+type ProfileConfig struct {
+	Default *ControlConfig `json:"default"`
+	GPUs []GPUConfig `json:"gpus"`
+}
+
+type ControlConfig struct {
+	TimeToUpdate float64 `json:"time_to_update"`
+	Sensor string `json:"sensor"`
+	Sensors []SensorInput `json:"sensors"`
+	SensorAggregation string `json:"sensor_aggregation"`
+	CurveMode string `json:"curve_mode"`
+	TemperatureRanges []TemperatureRange `json:"temperature_ranges"`
+	CurvePoints []CurvePoint `json:"curve_points"`
+	CurveHysteresis int `json:"curve_hysteresis"`
+	PID PIDConfig `json:"pid"`
+	MaxChangePerUpdate int `json:"max_change_per_update"`
+	Smoothing SmoothingConfig `json:"smoothing"`
+	MinDwellSeconds float64 `json:"min_dwell_seconds"`
+	Fans []FanConfig `json:"fans"`
+	ZeroRPM ZeroRPMConfig `json:"zero_rpm"`
+	PowerPoints []PowerPoint `json:"power_points"`
+	InputCurves []InputCurve `json:"input_curves"`
+	UtilizationBoost UtilizationBoostConfig `json:"utilization_boost"`
+	Trend TrendConfig `json:"trend"`
+	AdaptiveInterval AdaptiveIntervalConfig `json:"adaptive_interval"`
+	Hybrid HybridConfig `json:"hybrid"`
+	StartupFanSpeed int `json:"startup_fan_speed"`
+	SpeedUnit string `json:"speed_unit"`
+	RPMTolerance int `json:"rpm_tolerance"`
+	PanicTemperature int `json:"panic_temperature"`
+	PanicMargin int `json:"panic_margin"`
+	PanicSeconds float64 `json:"panic_seconds"`
+}
+
+// GPUMatch picks GPUs by any combination of index, UUID, PCI bus ID and
+// name glob; all given fields must match.
+type GPUMatch struct {
+	Index *int `json:"index"`
+	UUID string `json:"uuid"`
+	PCIBusID string `json:"pci_bus_id"`
+	Name string `json:"name"`
+}
+
+type GPUConfig struct {
+	GPUMatch
+	ControlConfig
+}
+
+type TemperatureRange = curve.Range
+
+type CurvePoint = curve.Point
+
+type PIDConfig = curve.PIDConfig
+
+type DeviceMonitor struct {
+	Index int
+	Name string
+	UUID string
+	PCIBusID string
+	Handle nvml.Device
+	NumFans int
+	MinFanSpeed int
+	MaxFanSpeed int
+	CurrentFanSpeeds []int
+	BaseFanSpeed int
+	TargetRPM int
+	RPMUnreadable bool
+	Group string
+	GroupTemperature int
+	CurrentTemperatureRange TemperatureRange
+	Controller FanController
+	Settings ControlConfig
+	NextUpdate time.Time
+	Interval time.Duration
+	UpdateDuration time.Duration
+	mu *sync.Mutex
+	LastSpeedChange time.Time
+	DownshiftSince time.Time
+	Temperature int
+	RawTemperature int
+	PowerWatts int
+	Utilization int
+	BusySince time.Time
+	TemperatureSamples []int
+	SmoothedTemperature float64
+	TrendTemperature int
+	TrendTime time.Time
+	TemperatureRate float64
+	Trending bool
+	FanRPMs []int
+	SensorTemperatures map[string]int
+	Fields map[uint32]nvml.FieldValue
+	UnbatchedFields map[uint32]bool
+	FieldsUnsupported bool
+	CurveInput string
+	ErrorCounts map[string]int
+	ErrorClasses map[string]int
+	OverrideSpeed *int
+	FanFailure FanFailureConfig
+	StalledCycles []int
+	FanFailed []bool
+	FanStopped []bool
+	FanControlled []bool
+	DriverControl bool
+	FanMismatches []int
+	FanVerify FanVerifyConfig
+	FanReapplies []int
+	FanReappliesTotal []int
+	TargetSpeedUnsupported bool
+	KickUntil []time.Time
+	FailSafe FailSafeConfig
+	ConsecutiveFailures int
+	PowerLimit PowerLimitConfig
+	CriticalSince time.Time
+	OriginalPowerLimit uint32
+	RestorePersistence bool
+	ProcessProfile string
+	NextProcessCheck time.Time
+	PowerLimitWatts int
+	ThrottleSince map[string]time.Time
+	ThrottleSeconds map[string]float64
+	ThrottleUnsupported bool
+	FailSafeActive bool
+	Overtemp bool
+	ErrorAlerted bool
+	Lost bool
+	SpeedCap int
+	PanicTemperature int
+	PanicActive bool
+	Stats statsTracker
+	PanicCoolSince time.Time
+	DryRun bool
+	Backend fanBackend
+	FanAPI device.FanAPI
+	BackendMode string
+	NVControlDisplay string
+	FanBase int
+	HWMon string
+	Calibration *FanCalibration
+}
+
+type Daemon struct {
+	Config Config
+	Options RunOptions
+	Monitors []DeviceMonitor
+	Profile string
+	Status *StatusStore
+	Commands chan func(*Daemon)
+	StartTime time.Time
+	Paused bool
+	ticker *time.Ticker
+	tickInterval time.Duration
+	workersStop chan struct{}
+	workersDone []chan struct{}
+	activeSchedule int
+	profileBeforeSchedule string
+	powerSource string
+	nextPowerSourceCheck time.Time
+	nextRescan time.Time
+	knownUnmanaged map[string]bool
+	nvmlDown bool
+	savedState []byte
+	stateSaved time.Time
+	fileProfiles map[string]ProfileConfig
+	remote *remoteAssignment
+}
+
+// clock is the time the control logic sees; simulations replace it.
+var clock = time.Now
+
+// gpuBackend serves every NVML call, so the daemon can also run against
+// device.Fake.
+var gpuBackend device.GPUBackend = device.Timed(device.NVML(nvmlLibrary()), nvmlTimings.observe)
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func getFanSpeedForTemperature(temp int, monitor *DeviceMonitor) int {
+	return monitor.Controller.FanSpeed(temp, monitor)
+}
+
+func loadConfig(file string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	if dropIns := configDropIns(file); len(dropIns) > 0 {
+		if err := decodeMergedConfig(file, data, dropIns, &config); err != nil {
+			return config, err
+		}
+		logInfof("Merged %d config fragment(s) from %s.", len(dropIns), filepath.Dir(dropIns[0]))
+	} else if err := decodeConfig(file, data, &config); err != nil {
+		return config, err
+	}
+	applyEnvOverrides(&config)
+	// Without a "default" section the top-level settings act as the default,
+	// which keeps single-curve configs working unchanged.
+	if config.Default == nil {
+		defaults := config.ControlConfig
+		config.Default = &defaults
+	}
+	if config.Default.TimeToUpdate <= 0 {
+		logWarnf("time_to_update (%f) is invalid, defaulting to 2.0 seconds.", config.Default.TimeToUpdate)
+		config.Default.TimeToUpdate = 2.0
+	}
+	if config.Log.File == "" {
+		config.Log.File = defaultLogFile
+	}
+	if config.Log.MaxSizeMB <= 0 {
+		config.Log.MaxSizeMB = 10
+	}
+	if config.Log.MaxBackups <= 0 {
+		config.Log.MaxBackups = 5
+	}
+	applyLogDedupDefaults(&config.Log)
+	applyFanFailureDefaults(&config.FanFailure)
+	applyFanVerifyDefaults(&config.FanVerify)
+	applyFailSafeDefaults(&config.FailSafe)
+	applyPowerLimitDefaults(&config.PowerLimit)
+	applyPowerSourceDefaults(&config.PowerSource)
+	if config.ProcessCheckSeconds == 0 {
+		config.ProcessCheckSeconds = 5
+	}
+	applyAlertsDefaults(&config.Alerts)
+	applyMQTTDefaults(&config.MQTT)
+	applyControllerDefaults(&config.Controller)
+	applyDBusDefaults(&config.DBus)
+	applyTextfileDefaults(&config.Textfile)
+	for i := range config.Exporters {
+		applyExporterDefaults(&config.Exporters[i])
+	}
+	for i := range config.Outputs {
+		applyOutputDefaults(&config.Outputs[i])
+	}
+	for i := range config.Hooks {
+		applyHookDefaults(&config.Hooks[i])
+	}
+	applyHistoryDefaults(&config.History)
+	applyStateDefaults(&config.State)
+	if config.RescanInterval == 0 {
+		config.RescanInterval = 30
+	}
+	if config.FanBackend == "" {
+		config.FanBackend = backendNVML
+	}
+	if config.NVControl.Display == "" {
+		config.NVControl.Display = ":0"
+	}
+	if config.PIDFile == "" {
+		config.PIDFile = defaultPIDFile
+	}
+	if config.CalibrationFile == "" {
+		config.CalibrationFile = defaultCalibrationFile
+	}
+	if config.Calibrations, err = loadCalibrations(config.CalibrationFile); err != nil {
+		return config, err
+	}
+	normalizeProfile(&config.ProfileConfig, *config.Default)
+	for name, profile := range config.Profiles {
+		normalizeProfile(&profile, *config.Default)
+		config.Profiles[name] = profile
+	}
+	if err := validateConfig(config); err != nil {
+		return config, err
+	}
+	logInfof("Configuration loaded.")
+	return config, nil
+}
+
+// decodeConfig picks the format from the file extension. YAML and TOML are
+// converted to JSON first so every format maps onto the same json tags.
+// Keys that match no setting are rejected rather than ignored.
+func decodeConfig(file string, data []byte, config *Config) error {
+	generic, err := decodeConfigMap(file, data)
+	if err != nil {
+		return err
+	}
+	if err := checkConfigFields(generic); err != nil {
+		return err
+	}
+	if ext := strings.ToLower(filepath.Ext(file)); ext != ".yaml" && ext != ".yml" && ext != ".toml" {
+		if err := json.Unmarshal(data, config); err != nil {
+			return configDecodeError(data, err)
+		}
+		return nil
+	}
+	converted, err := json.Marshal(generic)
+	if err != nil {
+		return fmt.Errorf("failed to convert config %s: %w", file, err)
+	}
+	if err := json.Unmarshal(converted, config); err != nil {
+		return configDecodeError(nil, err)
+	}
+	return nil
+}
+
+func decodeConfigMap(file string, data []byte) (map[string]interface{}, error) {
+	var generic map[string]interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config %s: %w", file, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config %s: %w", file, err)
+		}
+	default:
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON config %s: %w", file, configDecodeError(data, err))
+		}
+	}
+	return generic, nil
+}
+
+// configDropIns lists the fragments in the config.d directory next to file,
+// in lexical order.
+func configDropIns(file string) []string {
+	entries, err := os.ReadDir(filepath.Join(filepath.Dir(file), "config.d"))
+	if err != nil {
+		return nil
+	}
+	files := []string{}
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml", ".toml":
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				files = append(files, filepath.Join(filepath.Dir(file), "config.d", entry.Name()))
+			}
+		}
+	}
+	return files
+}
+
+// mergeConfigMaps merges over into base: objects are merged key by key,
+// everything else, lists included, is replaced.
+func mergeConfigMaps(base, over map[string]interface{}) {
+	for key, value := range over {
+		overMap, overIsMap := value.(map[string]interface{})
+		baseMap, baseIsMap := base[key].(map[string]interface{})
+		if overIsMap && baseIsMap {
+			mergeConfigMaps(baseMap, overMap)
+			continue
+		}
+		base[key] = value
+	}
+}
+
+// decodeMergedConfig decodes file with its drop-ins merged over it.
+func decodeMergedConfig(file string, data []byte, dropIns []string, config *Config) error {
+	merged, err := decodeConfigMap(file, data)
+	if err != nil {
+		return err
+	}
+	if err := checkConfigFields(merged); err != nil {
+		return err
+	}
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+	for _, dropIn := range dropIns {
+		fragmentData, err := os.ReadFile(dropIn)
+		if err != nil {
+			return err
+		}
+		fragment, err := decodeConfigMap(dropIn, fragmentData)
+		if err != nil {
+			return err
+		}
+		if err := checkConfigFields(fragment); err != nil {
+			return fmt.Errorf("%s: %w", dropIn, err)
+		}
+		mergeConfigMaps(merged, fragment)
+	}
+	converted, err := json.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to convert config %s: %w", file, err)
+	}
+	if err := json.Unmarshal(converted, config); err != nil {
+		return configDecodeError(nil, err)
+	}
+	return nil
+}
+
+func normalizeProfile(profile *ProfileConfig, fallback ControlConfig) {
+	if profile.Default == nil {
+		defaults := fallback
+		profile.Default = &defaults
+	}
+	if profile.Default.TimeToUpdate <= 0 {
+		profile.Default.TimeToUpdate = fallback.TimeToUpdate
+	}
+	applyControlDefaults(profile.Default)
+	for i := range profile.GPUs {
+		if profile.GPUs[i].TimeToUpdate <= 0 {
+			profile.GPUs[i].TimeToUpdate = profile.Default.TimeToUpdate
+		}
+		if profile.GPUs[i].Sensor == "" && len(profile.GPUs[i].Sensors) == 0 {
+			profile.GPUs[i].Sensor = profile.Default.Sensor
+			profile.GPUs[i].Sensors = profile.Default.Sensors
+			profile.GPUs[i].SensorAggregation = profile.Default.SensorAggregation
+		}
+		if profile.GPUs[i].MaxChangePerUpdate == 0 {
+			profile.GPUs[i].MaxChangePerUpdate = profile.Default.MaxChangePerUpdate
+		}
+		if profile.GPUs[i].Smoothing.Method == "" {
+			profile.GPUs[i].Smoothing = profile.Default.Smoothing
+		}
+		if profile.GPUs[i].MinDwellSeconds == 0 {
+			profile.GPUs[i].MinDwellSeconds = profile.Default.MinDwellSeconds
+		}
+		if profile.GPUs[i].Fans == nil {
+			profile.GPUs[i].Fans = profile.Default.Fans
+		}
+		if profile.GPUs[i].UtilizationBoost.MinFanSpeed == 0 {
+			profile.GPUs[i].UtilizationBoost = profile.Default.UtilizationBoost
+		}
+		if profile.GPUs[i].Trend.Rate == 0 {
+			profile.GPUs[i].Trend = profile.Default.Trend
+		}
+		if profile.GPUs[i].PowerPoints == nil {
+			profile.GPUs[i].PowerPoints = profile.Default.PowerPoints
+		}
+		if profile.GPUs[i].InputCurves == nil {
+			profile.GPUs[i].InputCurves = profile.Default.InputCurves
+		}
+		if !profile.GPUs[i].AdaptiveInterval.Enabled {
+			profile.GPUs[i].AdaptiveInterval = profile.Default.AdaptiveInterval
+		}
+		if !profile.GPUs[i].ZeroRPM.Enabled {
+			profile.GPUs[i].ZeroRPM = profile.Default.ZeroRPM
+		}
+		if profile.GPUs[i].Hybrid.ManualTemperature == 0 {
+			profile.GPUs[i].Hybrid = profile.Default.Hybrid
+		}
+		if profile.GPUs[i].StartupFanSpeed == 0 {
+			profile.GPUs[i].StartupFanSpeed = profile.Default.StartupFanSpeed
+		}
+		if profile.GPUs[i].PanicTemperature == 0 {
+			profile.GPUs[i].PanicTemperature = profile.Default.PanicTemperature
+			profile.GPUs[i].PanicMargin = profile.Default.PanicMargin
+			profile.GPUs[i].PanicSeconds = profile.Default.PanicSeconds
+		}
+		if !hasCurve(profile.GPUs[i].ControlConfig) {
+			interval, startup := profile.GPUs[i].TimeToUpdate, profile.GPUs[i].StartupFanSpeed
+			profile.GPUs[i].ControlConfig = *profile.Default
+			profile.GPUs[i].TimeToUpdate = interval
+			profile.GPUs[i].StartupFanSpeed = startup
+		}
+		applyControlDefaults(&profile.GPUs[i].ControlConfig)
+	}
+}
+
+func activeProfile(config Config, name string) ProfileConfig {
+	if profile, ok := config.Profiles[name]; ok {
+		return profile
+	}
+	return config.ProfileConfig
+}
+
+func profileNames(config Config) []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func applyControlDefaults(control *ControlConfig) {
+	if control.CurveMode == "pid" && control.PID.MaxFanSpeed == 0 {
+		control.PID.MaxFanSpeed = 100
+	}
+	if control.Trend.Rate > 0 && control.Trend.LookaheadSeconds == 0 {
+		control.Trend.LookaheadSeconds = 10
+	}
+	applyAdaptiveIntervalDefaults(&control.AdaptiveInterval, control.TimeToUpdate)
+	if control.ZeroRPM.Enabled && control.ZeroRPM.KickSpeed == 0 {
+		control.ZeroRPM.KickSpeed = 40
+	}
+	if control.ZeroRPM.Enabled && control.ZeroRPM.KickSeconds == 0 {
+		control.ZeroRPM.KickSeconds = 2
+	}
+	if control.Hybrid.ManualTemperature > 0 && control.Hybrid.Hysteresis == 0 {
+		control.Hybrid.Hysteresis = 3
+	}
+	if control.SpeedUnit == speedUnitRPM && control.RPMTolerance == 0 {
+		control.RPMTolerance = 50
+	}
+	applyPanicDefaults(control)
+}
+
+func hasCurve(control ControlConfig) bool {
+	return control.CurveMode != "" || len(control.TemperatureRanges) > 0 || len(control.CurvePoints) > 0
+}
+
+func validateConfig(config Config) error {
+	if _, err := parseLogLevel(config.Log.Level); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	switch output := strings.ToLower(config.Log.Output); output {
+	case "", "file", "stdout", "stderr":
+	default:
+		if !slices.Contains(platformLogOutputs, output) {
+			outputs := append([]string{"file", "stdout", "stderr"}, platformLogOutputs...)
+			return fmt.Errorf("log: unknown output %q, expected %s or %s", config.Log.Output, strings.Join(outputs[:len(outputs)-1], ", "), outputs[len(outputs)-1])
+		}
+	}
+	switch strings.ToLower(config.Log.Format) {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("log: unknown format %q, expected text or json", config.Log.Format)
+	}
+	if err := validateFailSafe(config.FailSafe); err != nil {
+		return fmt.Errorf("fail_safe: %w", err)
+	}
+	if err := validatePowerLimit(config.PowerLimit); err != nil {
+		return fmt.Errorf("power_limit: %w", err)
+	}
+	if err := validateAlerts(config.Alerts); err != nil {
+		return fmt.Errorf("alerts: %w", err)
+	}
+	if err := validateMQTT(config.MQTT); err != nil {
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	if err := validateController(config.Controller); err != nil {
+		return fmt.Errorf("controller: %w", err)
+	}
+	if err := validateDBus(config.DBus); err != nil {
+		return fmt.Errorf("dbus: %w", err)
+	}
+	if err := validateGroups(config.Groups); err != nil {
+		return err
+	}
+	for i, match := range config.Include {
+		if err := validateGPUMatch(match); err != nil {
+			return fmt.Errorf("include[%d]: %w", i, err)
+		}
+	}
+	for i, match := range config.Exclude {
+		if err := validateGPUMatch(match); err != nil {
+			return fmt.Errorf("exclude[%d]: %w", i, err)
+		}
+	}
+	for i, hook := range config.Hooks {
+		if err := validateHook(hook); err != nil {
+			return fmt.Errorf("hooks[%d]: %w", i, err)
+		}
+	}
+	for i, exporter := range config.Exporters {
+		if err := validateExporter(exporter); err != nil {
+			return fmt.Errorf("exporters[%d]: %w", i, err)
+		}
+	}
+	for i, output := range config.Outputs {
+		if err := validateOutput(output); err != nil {
+			return fmt.Errorf("outputs[%d]: %w", i, err)
+		}
+	}
+	if err := validateTextfile(config.Textfile); err != nil {
+		return fmt.Errorf("textfile: %w", err)
+	}
+	if err := validateFanBackend(config); err != nil {
+		return err
+	}
+	if err := validatePrivileges(config); err != nil {
+		return fmt.Errorf("privileges: %w", err)
+	}
+	if config.FanFailure.MinDuty > 100 {
+		return fmt.Errorf("fan_failure: min_duty (%d) is above 100", config.FanFailure.MinDuty)
+	}
+	if err := validateFanVerify(config.FanVerify); err != nil {
+		return fmt.Errorf("fan_verify: %w", err)
+	}
+	if err := validateProfile(config.ProfileConfig); err != nil {
+		return err
+	}
+	for name, profile := range config.Profiles {
+		if name == "" {
+			return fmt.Errorf("profiles: profile names must not be empty")
+		}
+		if err := validateProfile(profile); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+	}
+	if _, ok := config.Profiles[config.ActiveProfile]; config.ActiveProfile != "" && !ok {
+		return fmt.Errorf("active_profile %q is not defined in profiles", config.ActiveProfile)
+	}
+	if err := validateSchedules(config); err != nil {
+		return err
+	}
+	if err := validatePowerSource(config); err != nil {
+		return err
+	}
+	if err := validateProcessProfiles(config); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateProfile(profile ProfileConfig) error {
+	if err := validateControlConfig(*profile.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for i, gpu := range profile.GPUs {
+		if err := validateGPUMatch(gpu.GPUMatch); err != nil {
+			return fmt.Errorf("gpus[%d]: %w", i, err)
+		}
+		if err := validateControlConfig(gpu.ControlConfig); err != nil {
+			return fmt.Errorf("gpus[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateControlConfig(config ControlConfig) error {
+	if err := validateSensors(config); err != nil {
+		return err
+	}
+	if err := validateSmoothing(config.Smoothing); err != nil {
+		return err
+	}
+	if err := validateFans(config.Fans); err != nil {
+		return err
+	}
+	if err := validateUtilizationBoost(config.UtilizationBoost); err != nil {
+		return err
+	}
+	if err := validatePowerPoints(config.PowerPoints); err != nil {
+		return err
+	}
+	if err := validateInputCurves(config.InputCurves); err != nil {
+		return err
+	}
+	if err := validatePanic(config); err != nil {
+		return err
+	}
+	if err := validateTrend(config.Trend); err != nil {
+		return err
+	}
+	if err := validateAdaptiveInterval(config.AdaptiveInterval); err != nil {
+		return err
+	}
+	if err := validateZeroRPM(config.ZeroRPM); err != nil {
+		return fmt.Errorf("zero_rpm: %w", err)
+	}
+	if err := validateHybrid(config.Hybrid); err != nil {
+		return fmt.Errorf("hybrid: %w", err)
+	}
+	if config.MinDwellSeconds < 0 {
+		return fmt.Errorf("min_dwell_seconds (%g) is negative", config.MinDwellSeconds)
+	}
+	if config.MaxChangePerUpdate < 0 || config.MaxChangePerUpdate > 100 {
+		return fmt.Errorf("max_change_per_update (%d) is outside 0-100", config.MaxChangePerUpdate)
+	}
+	if config.StartupFanSpeed < 0 || config.StartupFanSpeed > 100 {
+		return fmt.Errorf("startup_fan_speed (%d) is outside 0-100", config.StartupFanSpeed)
+	}
+	if err := validateSpeedUnit(config); err != nil {
+		return err
+	}
+	switch config.CurveMode {
+	case "", "stepped":
+	case "interpolated":
+		return curve.ValidatePointsMax(config.CurvePoints, config.CurveHysteresis, speedLimit(config))
+	case "pid":
+		return config.PID.Validate()
+	default:
+		return fmt.Errorf("unknown curve_mode %q, expected \"stepped\", \"interpolated\" or \"pid\"", config.CurveMode)
+	}
+	return curve.ValidateRangesMax(config.TemperatureRanges, speedLimit(config))
+}
+
+// configWarnings collects the curve.CheckRanges findings of every
+// stepped curve in the config.
+func configWarnings(config Config) []string {
+	warnings := profileWarnings("", config.ProfileConfig)
+	for _, name := range profileNames(config) {
+		warnings = append(warnings, profileWarnings("profiles."+name+".", config.Profiles[name])...)
+	}
+	return warnings
+}
+
+func profileWarnings(prefix string, profile ProfileConfig) []string {
+	warnings := []string{}
+	add := func(section string, control ControlConfig) {
+		if control.CurveMode != "" && control.CurveMode != "stepped" {
+			return
+		}
+		for _, warning := range curve.CheckRanges(control.TemperatureRanges) {
+			warnings = append(warnings, prefix+section+": "+warning)
+		}
+	}
+	add("default", *profile.Default)
+	for i, gpu := range profile.GPUs {
+		add(fmt.Sprintf("gpus[%d]", i), gpu.ControlConfig)
+	}
+	return warnings
+}
+
+func initNVML() (func(), error) {
+	if ret := gpuBackend.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("unable to initialize NVML: %v", nvml.ErrorString(ret))
+	}
+	return func() {
+		if ret := gpuBackend.Shutdown(); ret != nvml.SUCCESS {
+			logErrorf("Unable to shutdown NVML cleanly: %v", nvml.ErrorString(ret))
+		}
+	}, nil
+}
+
+func initDevices(config Config) ([]DeviceMonitor, error) {
+	count, ret := gpuBackend.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("unable to get NVIDIA device count: %v", nvml.ErrorString(ret))
+	}
+	if count == 0 && !config.AMDGPU {
+		return nil, fmt.Errorf("no NVIDIA devices found")
+	}
+	logInfof("Found %d NVIDIA device(s).", count)
+	monitors := []DeviceMonitor{}
+	for i := 0; i < count; i++ {
+		handle, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			logFields{"gpu_index": i, "nvml_error": nvml.ErrorString(ret)}.Warnf("Unable to get handle for device %d: %v. Skipping.", i, nvml.ErrorString(ret))
+			continue
+		}
+		if monitor, ok := initDevice(config, config.ActiveProfile, i, handle); ok {
+			monitors = append(monitors, monitor)
+		}
+	}
+	if config.AMDGPU {
+		monitors = append(monitors, initAMDGPUs(config, count)...)
+	}
+	if len(monitors) == 0 && count > 0 {
+		return nil, fmt.Errorf("found %d devices, but failed to initialize any for fan control", count)
+	}
+	return monitors, nil
+}
+
+// newDeviceMonitor sets up the per-fan state shared by every vendor; the
+// caller fills in the device identity and backend.
+func newDeviceMonitor(config Config, i int, currentSpeeds []int) DeviceMonitor {
+	numFans := len(currentSpeeds)
+	fanStopped := make([]bool, numFans)
+	for fanIdx, speed := range currentSpeeds {
+		fanStopped[fanIdx] = speed == 0
+	}
+	fanRPMs := make([]int, numFans)
+	for fanIdx := range fanRPMs {
+		fanRPMs[fanIdx] = -1
+	}
+	return DeviceMonitor{
+		mu: &sync.Mutex{},
+		Index: i,
+		NumFans: numFans,
+		MinFanSpeed: 0,
+		MaxFanSpeed: 100,
+		CurrentFanSpeeds: currentSpeeds,
+		BaseFanSpeed: currentSpeeds[0],
+		PowerWatts: -1,
+		Utilization: -1,
+		FanRPMs: fanRPMs,
+		ErrorCounts: map[string]int{},
+		ErrorClasses: map[string]int{},
+		ThrottleSince: map[string]time.Time{},
+		ThrottleSeconds: map[string]float64{},
+		FanFailure: config.FanFailure,
+		FanVerify: config.FanVerify,
+		FailSafe: config.FailSafe,
+		PowerLimit: config.PowerLimit,
+		StalledCycles: make([]int, numFans),
+		FanFailed: make([]bool, numFans),
+		FanStopped: fanStopped,
+		FanControlled: make([]bool, numFans),
+		FanMismatches: make([]int, numFans),
+		FanReapplies: make([]int, numFans),
+		FanReappliesTotal: make([]int, numFans),
+		KickUntil: make([]time.Time, numFans),
+	}
+}
+
+func initDevice(config Config, profile string, i int, handle nvml.Device) (DeviceMonitor, bool) {
+	fanAPI, ret := device.ProbeFanAPI(gpuBackend, handle)
+	if (ret != nvml.SUCCESS || fanAPI.NumFans <= 0) && config.FanBackend != backendNVML {
+		// Older drivers cannot count the fans; nvidia-settings can still
+		// drive the first one.
+		logFields{"gpu_index": i, "fan_backend": config.FanBackend}.Infof("Device %d does not report its fans, assuming 1 for %s.", i, config.FanBackend)
+		fanAPI.NumFans, ret = 1, nvml.SUCCESS
+	}
+	if ret != nvml.SUCCESS || fanAPI.NumFans <= 0 {
+		logFields{"gpu_index": i}.Infof("Device %d reports 0 controllable fans or control not supported. Skipping.", i)
+		return DeviceMonitor{}, false
+	}
+	numFans := fanAPI.NumFans
+	currentSpeeds := make([]int, numFans)
+	temp, _ := gpuBackend.DeviceGetTemperature(handle, nvml.TEMPERATURE_GPU)
+	for fanIdx := 0; fanIdx < numFans; fanIdx++ {
+		speed, ret := device.ReadFanSpeed(gpuBackend, handle, fanAPI, fanIdx)
+		if ret != nvml.SUCCESS {
+			logFields{"gpu_index": i, "fan_index": fanIdx, "nvml_error": nvml.ErrorString(ret)}.Warnf("Failed to get initial speed for device %d Fan %d. Using 0.", i, fanIdx)
+			speed = 0
+		}
+		currentSpeeds[fanIdx] = speed
+	}
+	name, _ := gpuBackend.DeviceGetName(handle)
+	uuid, _ := gpuBackend.DeviceGetUUID(handle)
+	pciBusID := ""
+	if pciInfo, ret := gpuBackend.DeviceGetPciInfo(handle); ret == nvml.SUCCESS {
+		pciBusID = device.PCIBusID(pciInfo)
+	}
+	monitor := newDeviceMonitor(config, i, currentSpeeds)
+	monitor.Name = name
+	monitor.UUID = uuid
+	monitor.PCIBusID = pciBusID
+	if !managedDevice(config, &monitor) {
+		logFields{"gpu_index": i, "gpu_name": name, "gpu_uuid": uuid}.Infof("Device %d (%s) is not selected by include/exclude. Skipping.", i, name)
+		return DeviceMonitor{}, false
+	}
+	monitor.Handle = handle
+	monitor.MinFanSpeed, monitor.MaxFanSpeed = device.FanSpeedLimits(gpuBackend, handle)
+	monitor.Temperature = int(temp)
+	monitor.Backend = newFanBackend(config)
+	monitor.FanAPI = fanAPI
+	if fanAPI.Legacy || fanAPI.NoPolicy {
+		logFields{"gpu_index": i, "legacy_speed": fanAPI.Legacy, "no_policy": fanAPI.NoPolicy}.Infof("GPU %d lacks some NVML fan calls, using the legacy fan API: %s.", i, describeFanAPI(fanAPI))
+	}
+	monitor.BackendMode = config.FanBackend
+	monitor.NVControlDisplay = config.NVControl.Display
+	if config.FanBackend != backendNVML {
+		monitor.FanBase = nvcontrolFanBase(i)
+	}
+	applyCalibration(config, &monitor)
+	bindDeviceConfig(activeProfile(config, profile), &monitor)
+	logFields{"gpu_index": i, "gpu_name": monitor.Name, "gpu_uuid": monitor.UUID, "temperature": int(temp), "fan_speeds": currentSpeeds}.Infof("Initialized GPU %d (%s): Temp=%d°C, FanSpeeds=%v%%", i, monitor.Name, int(temp), currentSpeeds)
+	return monitor, true
+}
+
+func restoreAutoFanPolicy(monitors []DeviceMonitor) {
+	for i := range monitors {
+		monitor := &monitors[i]
+		if monitor.DryRun {
+			logFields{"gpu_index": monitor.Index}.Infof("Dry run: would restore automatic fan policy for GPU %d.", monitor.Index)
+			continue
+		}
+		restoredFansIndices := []int{}
+		for fanIdx := 0; fanIdx < monitor.NumFans; fanIdx++ {
+			if ret := monitor.Backend.RestoreAuto(monitor, fanIdx); ret != nvml.SUCCESS {
+				logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "nvml_error": nvml.ErrorString(ret)}.Errorf("Failed to restore automatic policy for GPU %d Fan %d: %v", monitor.Index, fanIdx, nvml.ErrorString(ret))
+				continue
+			}
+			monitor.FanControlled[fanIdx] = false
+			restoredFansIndices = append(restoredFansIndices, fanIdx)
+		}
+		logFields{"gpu_index": monitor.Index, "fan_indices": restoredFansIndices}.Infof("Restored automatic fan policy for GPU %d: Fans %v", monitor.Index, restoredFansIndices)
+	}
+}
+
+func reloadConfig(options RunOptions, config Config) (Config, bool) {
+	newConfig, err := loadRunConfig(options)
+	if err == nil {
+		err = checkPrivilegesReload(config, newConfig)
+	}
+	if err != nil {
+		logErrorf("Failed to reload config, keeping current configuration: %v", err)
+		return config, false
+	}
+	logInfof("Configuration reloaded. Old: %s", describeConfig(config))
+	logInfof("Configuration reloaded. New: %s", describeConfig(newConfig))
+	return newConfig, true
+}
+
+func describeConfig(config Config) string {
+	description := describeProfile(config.ProfileConfig)
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		description += fmt.Sprintf("; profiles.%s: {%s}", name, describeProfile(config.Profiles[name]))
+	}
+	if config.ActiveProfile != "" {
+		description += "; active_profile=" + config.ActiveProfile
+	}
+	for _, match := range config.Include {
+		description += "; include " + describeGPUMatch(match)
+	}
+	for _, match := range config.Exclude {
+		description += "; exclude " + describeGPUMatch(match)
+	}
+	for _, group := range config.Groups {
+		description += fmt.Sprintf("; group %s: gpus %s", group.Name, strings.Join(group.GPUs, ","))
+	}
+	for _, output := range config.Outputs {
+		description += fmt.Sprintf("; output %s: %s, %d point(s)", output.Name, output.Type, len(output.CurvePoints))
+	}
+	if config.Controller.Address != "" {
+		description += fmt.Sprintf("; controller %s as %s", config.Controller.Address, config.Controller.Host)
+	}
+	return description
+}
+
+func describeProfile(profile ProfileConfig) string {
+	description := "default: " + describeControlConfig(*profile.Default)
+	for i, gpu := range profile.GPUs {
+		description += fmt.Sprintf("; gpus[%d] (%s): %s", i, describeGPUMatch(gpu.GPUMatch), describeControlConfig(gpu.ControlConfig))
+	}
+	return description
+}
+
+func describeControlConfig(config ControlConfig) string {
+	description := describeCurve(config)
+	if config.SpeedUnit == speedUnitRPM {
+		description += fmt.Sprintf(" rpm_tolerance=%d", config.RPMTolerance)
+	}
+	if sensor := describeSensors(config); sensor != device.SensorGPU {
+		description += " sensor=" + sensor
+	}
+	if config.Smoothing.Method != "" {
+		description += fmt.Sprintf(" smoothing=%s/%d", config.Smoothing.Method, config.Smoothing.Samples)
+	}
+	if config.MinDwellSeconds > 0 {
+		description += fmt.Sprintf(" min_dwell=%gs", config.MinDwellSeconds)
+	}
+	if config.StartupFanSpeed > 0 {
+		description += fmt.Sprintf(" startup_fan_speed=%d%%", config.StartupFanSpeed)
+	}
+	if config.PanicTemperature > 0 {
+		description += fmt.Sprintf(" panic=%d°C/-%d/%gs", config.PanicTemperature, config.PanicMargin, config.PanicSeconds)
+	}
+	for _, fan := range config.Fans {
+		description += " " + describeFan(fan)
+	}
+	if len(config.PowerPoints) > 0 {
+		description += " power:"
+		for _, p := range config.PowerPoints {
+			description += fmt.Sprintf(" %dW=%d%%", p.Watts, p.FanSpeed)
+		}
+	}
+	if len(config.InputCurves) > 0 {
+		description += " input_curves:" + describeInputCurves(config.InputCurves)
+	}
+	if boost := config.UtilizationBoost; boost.MinFanSpeed > 0 {
+		description += fmt.Sprintf(" utilization_boost(>=%d%% for %gs: %d%%)", boost.Threshold, boost.Seconds, boost.MinFanSpeed)
+	}
+	if adaptive := config.AdaptiveInterval; adaptive.Enabled {
+		description += fmt.Sprintf(" adaptive_interval(%g-%gs)", adaptive.MinSeconds, adaptive.MaxSeconds)
+	}
+	if trend := config.Trend; trend.Rate > 0 {
+		description += fmt.Sprintf(" trend(>=%g°C/s: +%gs ahead, +%d%%)", trend.Rate, trend.LookaheadSeconds, trend.Boost)
+	}
+	if config.ZeroRPM.Enabled {
+		description += fmt.Sprintf(" zero_rpm(reengage=%d°C kick=%d%%/%gs)", config.ZeroRPM.ReengageTemperature, config.ZeroRPM.KickSpeed, config.ZeroRPM.KickSeconds)
+	}
+	if config.Hybrid.ManualTemperature > 0 {
+		description += fmt.Sprintf(" hybrid(manual>=%d°C/h%d)", config.Hybrid.ManualTemperature, config.Hybrid.Hysteresis)
+	}
+	if config.MaxChangePerUpdate > 0 {
+		description += fmt.Sprintf(" max_change_per_update=%d%%", config.MaxChangePerUpdate)
+	}
+	return description
+}
+
+func describeCurve(config ControlConfig) string {
+	unit := "%"
+	if config.SpeedUnit == speedUnitRPM {
+		unit = "rpm"
+	}
+	if config.CurveMode == "interpolated" {
+		points := ""
+		for _, p := range config.CurvePoints {
+			points += fmt.Sprintf(" %d°C=%d%s", p.Temperature, p.FanSpeed, unit)
+		}
+		return fmt.Sprintf("time_to_update=%.2fs curve_mode=interpolated curve_hysteresis=%d points:%s", config.TimeToUpdate, config.CurveHysteresis, points)
+	}
+	if config.CurveMode == "pid" {
+		return fmt.Sprintf("time_to_update=%.2fs curve_mode=pid target=%d°C kp=%g ki=%g kd=%g limits=%d-%d%%",
+			config.TimeToUpdate, config.PID.TargetTemperature, config.PID.Kp, config.PID.Ki, config.PID.Kd, config.PID.MinFanSpeed, config.PID.MaxFanSpeed)
+	}
+	ranges := ""
+	for _, r := range config.TemperatureRanges {
+		ranges += fmt.Sprintf(" [%d..%d]°C=%d%s/h%d", r.MinTemperature, r.MaxTemperature, r.FanSpeed, unit, r.Hysteresis)
+		if r.DownshiftDelaySeconds > 0 {
+			ranges += fmt.Sprintf("/d%gs", r.DownshiftDelaySeconds)
+		}
+	}
+	return fmt.Sprintf("time_to_update=%.2fs ranges:%s", config.TimeToUpdate, ranges)
+}
+
+func countError(monitor *DeviceMonitor, operation string) {
+	monitor.ErrorCounts[operation]++
+}
+
+// go-nvml does not expose the fan index of nvmlDeviceGetFanSpeedRPM, so only
+// the tachometer of the first fan can be read.
+func readFanRPMs(monitor *DeviceMonitor) {
+	if monitor.HWMon != "" {
+		rpm, ret := readSysfsInt(filepath.Join(monitor.HWMon, "fan1_input"))
+		if ret != nvml.SUCCESS {
+			rpm = -1
+		}
+		monitor.FanRPMs[0] = rpm
+		return
+	}
+	info, ret := gpuBackend.DeviceGetFanSpeedRPM(monitor.Handle)
+	if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+		return
+	}
+	if ret != nvml.SUCCESS {
+		countError(monitor, "get_fan_rpm")
+		monitor.FanRPMs[0] = -1
+		return
+	}
+	monitor.FanRPMs[0] = int(info.Speed)
+}
+
+func readSensors(monitor *DeviceMonitor) bool {
+	prefetchFields(monitor)
+	temp, ret := readControlTemperature(monitor)
+	if ret != nvml.SUCCESS {
+		countError(monitor, "get_temperature")
+		checkNVMLLost(monitor, ret)
+		logFields{"gpu_index": monitor.Index, "sensor": describeSensors(monitor.Settings), "nvml_error": nvml.ErrorString(ret)}.Errorf("Failed to get %s temperature for device %d: %v. Skipping cycle.", describeSensors(monitor.Settings), monitor.Index, nvml.ErrorString(ret))
+		return false
+	}
+	monitor.RawTemperature = temp
+	monitor.Temperature = smoothTemperature(monitor, temp)
+	fanGroups.report(monitor)
+	updateTrend(monitor)
+	readPower(monitor)
+	readUtilization(monitor)
+	readCurveInputs(monitor)
+	readFanRPMs(monitor)
+	readThrottle(monitor)
+	return true
+}
+
+func updateDevice(monitor *DeviceMonitor) {
+	if !readSensors(monitor) {
+		recordFailure(monitor)
+		if failSafeSpeed(monitor) {
+			writeFanSpeeds(monitor, uniformFanSpeeds(monitor, 100))
+		}
+		return
+	}
+	reconcileFans(monitor)
+	checkFanFailure(monitor)
+	checkOvertemp(monitor)
+	checkPanic(monitor)
+	if driverControlled(monitor) {
+		recordSuccess(monitor)
+		recordStats(monitor)
+		checkPowerLimit(monitor)
+		return
+	}
+	tempInt, group := fanGroups.temperature(monitor)
+	monitor.Group, monitor.GroupTemperature = group, tempInt
+	previousRange := monitor.CurrentTemperatureRange
+	newFanSpeed := getFanSpeedForTemperature(tempInt, monitor)
+	downshiftHeld := holdDownshift(monitor, previousRange, newFanSpeed)
+	if dwell := dwellTime(monitor, previousRange); newFanSpeed < curveSpeed(monitor) && (downshiftHeld || clock().Sub(monitor.LastSpeedChange) < dwell) {
+		// Hold the current speed, and the range it belongs to, so the
+		// stepped hysteresis is evaluated against it again next time.
+		newFanSpeed = curveSpeed(monitor)
+		monitor.CurrentTemperatureRange = previousRange
+	}
+	checkRangeChange(monitor, previousRange)
+	if monitor.Settings.SpeedUnit == speedUnitRPM {
+		monitor.TargetRPM = newFanSpeed
+		newFanSpeed = rpmDuty(monitor, newFanSpeed)
+	}
+	if floor := powerFloor(monitor); floor > newFanSpeed {
+		newFanSpeed = floor
+	}
+	monitor.CurveInput = ""
+	if floor, input := inputCurvesFloor(monitor); floor > newFanSpeed {
+		newFanSpeed = floor
+		monitor.CurveInput = input
+	}
+	if floor := utilizationFloor(monitor); floor > newFanSpeed {
+		newFanSpeed = floor
+	}
+	if floor := trendFloor(monitor, newFanSpeed); floor > newFanSpeed {
+		newFanSpeed = floor
+	}
+	monitor.BaseFanSpeed = curve.LimitChange(monitor.BaseFanSpeed, newFanSpeed, monitor.Settings.MaxChangePerUpdate)
+	newFanSpeeds := fanTargets(monitor, newFanSpeed)
+	applySpeedCap(monitor, newFanSpeeds)
+	if monitor.OverrideSpeed != nil {
+		newFanSpeeds = uniformFanSpeeds(monitor, *monitor.OverrideSpeed)
+	}
+	for fanIdx := range newFanSpeeds {
+		newFanSpeeds[fanIdx] = curve.LimitChange(monitor.CurrentFanSpeeds[fanIdx], newFanSpeeds[fanIdx], monitor.Settings.MaxChangePerUpdate)
+	}
+	applyZeroRPM(monitor, newFanSpeeds)
+	// The panic mode skips the slew rate, the caps and the override.
+	if (monitor.FanFailure.FullSpeed && hasFailedFan(monitor)) || failSafeSpeed(monitor) || monitor.PanicActive {
+		newFanSpeeds = uniformFanSpeeds(monitor, 100)
+	}
+	logFields{"gpu_index": monitor.Index, "temperature": tempInt, "raw_temperature": monitor.RawTemperature, "new_speeds": newFanSpeeds}.Debugf("GPU %d: Temp=%d°C (raw %d°C), TargetSpeeds=%v%%, CurrentSpeeds=%v%%", monitor.Index, tempInt, monitor.RawTemperature, newFanSpeeds, monitor.CurrentFanSpeeds)
+	updatedFansIndices, oldSpeeds, ok := writeFanSpeeds(monitor, newFanSpeeds)
+	if len(updatedFansIndices) > 0 {
+		logFields{"gpu_index": monitor.Index, "fan_indices": updatedFansIndices, "temperature": tempInt, "raw_temperature": monitor.RawTemperature, "old_speeds": oldSpeeds, "new_speeds": newFanSpeeds}.Infof("Updated GPU %d: Fans %v: Temp=%d°C, NewSpeeds=%v%%",
+			monitor.Index, updatedFansIndices, tempInt, monitor.CurrentFanSpeeds)
+	}
+	if ok {
+		recordSuccess(monitor)
+	} else {
+		recordFailure(monitor)
+	}
+	recordStats(monitor)
+	checkPowerLimit(monitor)
+}
+
+// writeFanSpeeds sets every fan that is not already at its entry in
+// newFanSpeeds and reports which fans changed and whether all writes
+// succeeded.
+func writeFanSpeeds(monitor *DeviceMonitor, newFanSpeeds []int) ([]int, []int, bool) {
+	updatedFansIndices := []int{}
+	oldSpeeds := []int{}
+	ok := true
+	for fanIdx := 0; fanIdx < monitor.NumFans; fanIdx++ {
+		newFanSpeed := clampToDevice(monitor, newFanSpeeds[fanIdx])
+		if newFanSpeed != newFanSpeeds[fanIdx] && newFanSpeed != monitor.CurrentFanSpeeds[fanIdx] {
+			logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "requested_speed": newFanSpeeds[fanIdx], "new_speed": newFanSpeed}.Debugf("GPU %d Fan %d: %d%% is outside the device range %d-%d%%, using %d%%", monitor.Index, fanIdx, newFanSpeeds[fanIdx], monitor.MinFanSpeed, monitor.MaxFanSpeed, newFanSpeed)
+		}
+		if newFanSpeed != monitor.CurrentFanSpeeds[fanIdx] {
+			if monitor.DryRun {
+				logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "temperature": monitor.Temperature, "old_speed": monitor.CurrentFanSpeeds[fanIdx], "new_speed": newFanSpeed}.Infof("Dry run: would set GPU %d Fan %d to %d%% (Temp=%d°C)", monitor.Index, fanIdx, newFanSpeed, monitor.Temperature)
+				monitor.CurrentFanSpeeds[fanIdx] = newFanSpeed
+				monitor.DriverControl = false
+				monitor.LastSpeedChange = clock()
+				continue
+			}
+			stage, ret := setFanSpeed(monitor, fanIdx, newFanSpeed)
+			if fallBackToNVControl(monitor, ret) {
+				stage, ret = setFanSpeed(monitor, fanIdx, newFanSpeed)
+			}
+			if stage == "set_policy" {
+				countError(monitor, "set_policy")
+				checkNVMLLost(monitor, ret)
+				logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "nvml_error": nvml.ErrorString(ret)}.Errorf("Failed to set manual policy for GPU %d Fan %d: %v", monitor.Index, fanIdx, nvml.ErrorString(ret))
+				ok = false
+				continue
+			}
+			if ret != nvml.SUCCESS {
+				countError(monitor, "set_speed")
+				checkNVMLLost(monitor, ret)
+				logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "old_speed": monitor.CurrentFanSpeeds[fanIdx], "new_speed": newFanSpeed, "nvml_error": nvml.ErrorString(ret)}.Errorf("Failed to set speed for GPU %d Fan %d to %d%%: %v", monitor.Index, fanIdx, newFanSpeed, nvml.ErrorString(ret))
+				ok = false
+				continue
+			}
+			oldSpeeds = append(oldSpeeds, monitor.CurrentFanSpeeds[fanIdx])
+			monitor.CurrentFanSpeeds[fanIdx] = newFanSpeed
+			monitor.FanControlled[fanIdx] = true
+			monitor.DriverControl = false
+			updatedFansIndices = append(updatedFansIndices, fanIdx)
+		}
+	}
+	if len(updatedFansIndices) > 0 {
+		monitor.LastSpeedChange = clock()
+	}
+	return updatedFansIndices, oldSpeeds, ok
+}
+
+// setFanSpeed switches the fan to manual control and sets its speed through
+// the monitor's backend, returning the stage that failed, if any.
+func setFanSpeed(monitor *DeviceMonitor, fanIdx int, speed int) (string, nvml.Return) {
+	if ret := retryNVML(monitor, func() nvml.Return { return monitor.Backend.SetManual(monitor, fanIdx) }); ret != nvml.SUCCESS && ret != nvml.ERROR_NOT_SUPPORTED {
+		return "set_policy", ret
+	}
+	ret := retryNVML(monitor, func() nvml.Return { return monitor.Backend.SetSpeed(monitor, fanIdx, speed) })
+	if ret != nvml.SUCCESS {
+		return "set_speed", ret
+	}
+	return "", ret
+}
+
+// dwellTime is how long a speed must be held before it may be lowered: the
+// active range's min_dwell_seconds, or the GPU's if the range has none.
+func dwellTime(monitor *DeviceMonitor, current TemperatureRange) time.Duration {
+	seconds := monitor.Settings.MinDwellSeconds
+	if current.MinDwellSeconds > 0 {
+		seconds = current.MinDwellSeconds
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// holdDownshift reports whether a step down out of current has to wait for
+// its downshift_delay_seconds. The wait starts with the first update that
+// asks for a lower speed and restarts whenever one does not.
+func holdDownshift(monitor *DeviceMonitor, current TemperatureRange, newFanSpeed int) bool {
+	if newFanSpeed >= curveSpeed(monitor) || current.DownshiftDelaySeconds <= 0 {
+		monitor.DownshiftSince = time.Time{}
+		return false
+	}
+	now := clock()
+	if monitor.DownshiftSince.IsZero() {
+		monitor.DownshiftSince = now
+	}
+	if now.Sub(monitor.DownshiftSince) < time.Duration(current.DownshiftDelaySeconds*float64(time.Second)) {
+		return true
+	}
+	monitor.DownshiftSince = time.Time{}
+	return false
+}
+
+// loopInterval is how often the loop wakes up: as often as the GPU with
+// the shortest interval is due, using the adaptive interval it is on if any.
+func loopInterval(monitors []DeviceMonitor) time.Duration {
+	var interval time.Duration
+	for i := range monitors {
+		current := monitors[i].Interval
+		if current == 0 {
+			current = time.Duration(monitors[i].Settings.TimeToUpdate * float64(time.Second))
+		}
+		if interval == 0 || current < interval {
+			interval = current
+		}
+	}
+	if interval == 0 {
+		// All GPUs are gone; keep ticking so rescans can find them again.
+		interval = 2 * time.Second
+	}
+	return interval
+}
+
+// resetTicker moves the loop to a new interval once an adaptive interval
+// has changed it.
+func (d *Daemon) resetTicker() {
+	if interval := loopInterval(d.Monitors); d.ticker != nil && interval != d.tickInterval {
+		d.ticker.Reset(interval)
+		d.tickInterval = interval
+	}
+}
+
+func (d *Daemon) applyProfile() {
+	for i := range d.Monitors {
+		bindDeviceConfig(d.monitorProfile(&d.Monitors[i]), &d.Monitors[i])
+		d.Monitors[i].FanFailure = d.Config.FanFailure
+		d.Monitors[i].FanVerify = d.Config.FanVerify
+		d.Monitors[i].FailSafe = d.Config.FailSafe
+		d.Monitors[i].PowerLimit = d.Config.PowerLimit
+		// The new settings pick their own interval on the next update.
+		d.Monitors[i].Interval = 0
+	}
+	d.resetTicker()
+}
+
+func (d *Daemon) reload() {
+	newConfig, ok := reloadConfig(d.Options, d.Config)
+	if !ok {
+		return
+	}
+	d.fileProfiles = newConfig.Profiles
+	if d.remote != nil {
+		merged, err := withRemoteProfiles(newConfig, d.remote.Profiles)
+		if err != nil {
+			logWarnf("The profiles from the controller do not apply to the reloaded config, dropping them: %v", err)
+			d.remote = nil
+		} else {
+			newConfig = merged
+		}
+	}
+	// A profile switched at runtime survives reloads unless the file itself
+	// changes active_profile or drops the profile.
+	if _, exists := newConfig.Profiles[d.Profile]; newConfig.ActiveProfile != d.Config.ActiveProfile || (d.Profile != "" && !exists) {
+		d.Profile = newConfig.ActiveProfile
+	}
+	d.Config = newConfig
+	alerts.configure(d.Config.Alerts)
+	hooks.configure(d.Config.Hooks)
+	fanGroups.configure(d.Config.Groups)
+	for i := range d.Monitors {
+		applyCalibration(d.Config, &d.Monitors[i])
+	}
+	d.applyProfile()
+}
+
+func (d *Daemon) SetProfile(name string) error {
+	if _, ok := d.Config.Profiles[name]; name != "" && !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	logInfof("Switching profile from %q to %q.", d.Profile, name)
+	d.Profile = name
+	d.applyProfile()
+	d.updateAll()
+	return nil
+}
+
+func (d *Daemon) Pause() {
+	if d.Paused {
+		return
+	}
+	logInfof("Pausing fan control.")
+	restoreAutoFanPolicy(d.Monitors)
+	d.Paused = true
+	publishStatus(d, 0)
+}
+
+func (d *Daemon) Resume() {
+	if !d.Paused {
+		return
+	}
+	logInfof("Resuming fan control.")
+	d.Paused = false
+	// The driver owned the fans while paused, so force every fan to be
+	// written again instead of trusting the last commanded speeds.
+	for i := range d.Monitors {
+		for fanIdx := range d.Monitors[i].CurrentFanSpeeds {
+			d.Monitors[i].CurrentFanSpeeds[fanIdx] = -1
+		}
+	}
+	d.updateAll()
+}
+
+func (d *Daemon) updateAll() {
+	now := time.Now()
+	for i := range d.Monitors {
+		monitor := &d.Monitors[i]
+		start := time.Now()
+		d.updateMonitor(monitor)
+		monitor.UpdateDuration = time.Since(start)
+		monitor.Interval = updateInterval(monitor)
+		monitor.NextUpdate = now.Add(monitor.Interval)
+	}
+	d.resetTicker()
+	publishStatus(d, 0)
+}
+
+func (d *Daemon) updateMonitor(monitor *DeviceMonitor) {
+	if d.Paused {
+		readSensors(monitor)
+		return
+	}
+	d.checkProcesses(monitor)
+	updateDevice(monitor)
+}
+
+// Do runs command on the monitoring loop goroutine, which owns the monitors,
+// and waits for its result.
+func (d *Daemon) Do(command func(*Daemon) error) error {
+	reply := make(chan error, 1)
+	timeout := time.After(10 * time.Second)
+	select {
+	case d.Commands <- func(d *Daemon) { reply <- command(d) }:
+	case <-timeout:
+		return fmt.Errorf("monitoring loop did not accept the command in time")
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-timeout:
+		return fmt.Errorf("monitoring loop did not finish the command in time")
+	}
+}
+
+func runMonitoringLoop(d *Daemon, signals <-chan os.Signal, configChanged <-chan struct{}) {
+	logInfof("Starting monitoring loop...")
+	d.StartTime = time.Now()
+	publishStatus(d, 0)
+	d.tickInterval = loopInterval(d.Monitors)
+	d.ticker = time.NewTicker(d.tickInterval)
+	defer d.ticker.Stop()
+	d.nextRescan = time.Now().Add(time.Duration(d.Config.RescanInterval * float64(time.Second)))
+	d.applySchedule(time.Now())
+	d.applyPowerSource(d.pollPowerSource(time.Now()))
+	// The heartbeat is only sent once the loop has got hold of every GPU, so
+	// a worker stuck inside an NVML call gets the daemon restarted by systemd.
+	if watchdog := watchdogInterval(); watchdog > 0 && watchdog <= loopInterval(d.Monitors) {
+		logWarnf("systemd WatchdogSec (%v) is not longer than the update interval (%v); the service will be restarted spuriously.", watchdog, loopInterval(d.Monitors))
+	}
+	sdNotify("READY=1\n" + systemdStatus(d))
+	d.startWorkers()
+	defer d.stopWorkers()
+	reloadPending := false
+	for {
+		var now time.Time
+		select {
+		case <-configChanged:
+			reloadPending = true
+			continue
+		case command := <-d.Commands:
+			d.lockMonitors()
+			command(d)
+			d.unlockMonitors()
+			continue
+		case sig := <-signals:
+			if sig == syscall.SIGHUP || (dumpSignal != nil && sig == dumpSignal) || (pauseSignal != nil && sig == pauseSignal) {
+				d.lockMonitors()
+				switch {
+				case sig == syscall.SIGHUP:
+					d.reload()
+				case sig == dumpSignal:
+					d.dumpStatus()
+				case d.Paused:
+					d.Resume()
+				default:
+					d.Pause()
+				}
+				d.unlockMonitors()
+				continue
+			}
+			logInfof("Received %v, stopping monitoring loop.", sig)
+			sdNotify("STOPPING=1")
+			return
+		case now = <-d.ticker.C:
+		}
+		d.lockMonitors()
+		if reloadPending {
+			reloadPending = false
+			d.reload()
+		}
+		lost := d.nvmlDown || d.lostDevice()
+		d.unlockMonitors()
+		if lost {
+			recovered := false
+			d.exclusive(func() { recovered = d.recoverNVML() })
+			if !recovered {
+				d.lockMonitors()
+				publishStatus(d, 0)
+				d.unlockMonitors()
+				sdNotify("WATCHDOG=1\nSTATUS=Waiting for the NVIDIA driver")
+				continue
+			}
+		}
+		if d.Config.RescanInterval > 0 && !now.Before(d.nextRescan) {
+			d.nextRescan = now.Add(time.Duration(d.Config.RescanInterval * float64(time.Second)))
+			d.exclusive(d.rescanDevices)
+		}
+		source := d.pollPowerSource(now)
+		d.lockMonitors()
+		d.applySchedule(now)
+		d.applyPowerSource(source)
+		d.resetTicker()
+		publishStatus(d, longestUpdate(d.Monitors))
+		d.saveState(false)
+		status := systemdStatus(d)
+		d.unlockMonitors()
+		sdNotify("WATCHDOG=1\n" + status)
+	}
+}
+
+type RunOptions struct {
+	ConfigFile string
+	LogFile string
+	Interval float64
+	Foreground bool
+	DryRun bool
+	Force bool
+	Container bool
+	Once bool
+}
+
+func loadRunConfig(options RunOptions) (Config, error) {
+	config, err := loadConfig(options.ConfigFile)
+	if err != nil {
+		return config, err
+	}
+	for _, warning := range configWarnings(config) {
+		logWarnf("Config: %s.", warning)
+	}
+	if options.LogFile != "" {
+		config.Log.File = options.LogFile
+	}
+	// Container runtimes collect stdout.
+	if options.Container && config.Log.Output == "" && options.LogFile == "" {
+		config.Log.Output = "stdout"
+	}
+	if options.Interval > 0 {
+		config.Default.TimeToUpdate = options.Interval
+		for i := range config.GPUs {
+			config.GPUs[i].TimeToUpdate = options.Interval
+		}
+	}
+	return config, nil
+}
+
+// runDaemon controls the fans until a stop signal arrives on signals. SIGHUP
+// reloads the configuration, SIGUSR1 logs the state and SIGUSR2 toggles
+// pause.
+func runDaemon(options RunOptions, signals chan os.Signal) {
+	config, err := loadRunConfig(options)
+	if err != nil {
+		logFatalf("Failed to load config: %v", err)
+	}
+	logCloser, err := setupLogging(config.Log, options.Foreground)
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	defer logCloser.Close()
+	// A dry run writes nothing, so it may run next to the real daemon. A
+	// container cannot see the daemons of other containers, and the
+	// orchestrator keeps it to one per node.
+	if !options.DryRun && !options.Container {
+		releasePIDFile, err := acquirePIDFile(config.PIDFile, options.Force)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+		defer releasePIDFile()
+	}
+	alerts.configure(config.Alerts)
+	hooks.configure(config.Hooks)
+	fanGroups.configure(config.Groups)
+	nvmlWait := time.Duration(0)
+	if options.Container {
+		logInfof("Running in container mode.")
+		nvmlWait = nvmlWaitTimeout
+	}
+	nvmlCleanup, err := waitForNVML(nvmlWait)
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	defer nvmlCleanup()
+	monitors, err := initDevices(config)
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	if len(monitors) == 0 {
+		logInfof("No devices with controllable fans were found or initialized. Exiting.")
+		return
+	}
+	if options.DryRun {
+		logWarnf("Dry run: fan speeds and policies will be logged but not written.")
+		for i := range monitors {
+			monitors[i].DryRun = true
+		}
+	}
+	state := savedState(config.State)
+	for i := range monitors {
+		if !restoreState(state, &monitors[i]) {
+			applyStartupFanSpeed(&monitors[i])
+		}
+		enablePersistenceMode(config.PersistenceMode, &monitors[i])
+	}
+	var configChanged <-chan struct{}
+	if config.WatchConfig {
+		changed, stopWatching, err := watchConfigFile(options.ConfigFile)
+		if err != nil {
+			logWarnf("%v. Automatic reload disabled.", err)
+		} else {
+			defer stopWatching()
+			configChanged = changed
+		}
+	}
+	daemon := &Daemon{
+		Config: config,
+		Options: options,
+		Monitors: monitors,
+		Profile: config.ActiveProfile,
+		Status: &StatusStore{},
+		Commands: make(chan func(*Daemon)),
+		activeSchedule: -1,
+		knownUnmanaged: map[string]bool{},
+		fileProfiles: config.Profiles,
+	}
+	if config.HTTPListen != "" {
+		stopServer, err := startHTTPServer(config.HTTPListen, daemon)
+		if err != nil {
+			logErrorf("%v. HTTP listener disabled.", err)
+		} else {
+			defer stopServer()
+		}
+	}
+	if config.GRPCListen != "" {
+		stopGRPC, err := startGRPCServer(config.GRPCListen, daemon)
+		if err != nil {
+			logErrorf("%v. gRPC API disabled.", err)
+		} else {
+			defer stopGRPC()
+		}
+	}
+	if config.MQTT.Broker != "" {
+		defer startMQTT(config.MQTT, daemon)()
+	}
+	if config.Controller.Address != "" {
+		defer startAgent(config.Controller, daemon)()
+	}
+	if config.DBus.Enabled {
+		stopDBus, err := startDBus(config.DBus, daemon)
+		if err != nil {
+			logErrorf("%v. D-Bus interface disabled.", err)
+		} else {
+			defer stopDBus()
+		}
+	}
+	if len(config.Exporters) > 0 {
+		defer startExporters(config.Exporters, daemon)()
+	}
+	if config.Textfile.File != "" {
+		defer startTextfile(config.Textfile, daemon)()
+	}
+	if len(config.Outputs) > 0 && options.DryRun {
+		logInfof("Dry run: not driving the %d output(s).", len(config.Outputs))
+	} else if len(config.Outputs) > 0 {
+		defer startOutputs(config.Outputs, daemon)()
+	}
+	if config.History.Enabled {
+		stopHistory, err := startHistory(config.History, daemon)
+		if err != nil {
+			logErrorf("%v. History disabled.", err)
+		} else {
+			defer stopHistory()
+		}
+	}
+	socketPath := config.ControlSocket
+	if socketPath == "" {
+		socketPath = defaultControlSocket
+	}
+	stopSocket, err := startControlSocket(socketPath, daemon)
+	if err != nil {
+		logWarnf("%v. Control socket disabled.", err)
+	} else {
+		defer stopSocket()
+	}
+	if err := reducePrivileges(config); err != nil {
+		// Running on with more rights than configured would go unnoticed.
+		restoreAutoFanPolicy(daemon.Monitors)
+		logFatalf("%v. Refusing to run without the configured privileges.", err)
+	}
+	runMonitoringLoop(daemon, signals, configChanged)
+	daemon.shutdown()
+	logInfof("Exiting.")
+}
+
+// shutdown saves the state and hands every GPU the daemon controls at exit,
+// including ones attached or looked up again since startup, back to the
+// driver.
+func (d *Daemon) shutdown() {
+	d.saveState(true)
+	restorePowerLimits(d.Monitors)
+	restorePersistenceModes(d.Monitors)
+	restoreAutoFanPolicy(d.Monitors)
+}
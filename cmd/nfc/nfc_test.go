@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// loadTestConfig loads data as the config file, keeping the state file out
+// of the system directories.
+func loadTestConfig(t *testing.T, data string) Config {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.State.File = filepath.Join(filepath.Dir(file), "state.json")
+	return config
+}
+
+// testConfig loads a config with a stepped curve of three ranges.
+func testConfig(t *testing.T) Config {
+	return loadTestConfig(t, `{
+		"time_to_update": 2,
+		"temperature_ranges": [
+			{ "min_temperature": -999, "max_temperature": 50, "fan_speed": 30, "hysteresis": 0 },
+			{ "min_temperature": 50, "max_temperature": 60, "fan_speed": 50, "hysteresis": 5 },
+			{ "min_temperature": 60, "max_temperature": 999, "fan_speed": 100, "hysteresis": 2 }
+		]
+	}`)
+}
+
+// fakeGPUs serves count GPUs at 40°C with fans fans each through
+// gpuBackend for the rest of the test.
+func fakeGPUs(t *testing.T, count int, fans int) *device.Fake {
+	gpus := make([]*device.FakeGPU, count)
+	for i := range gpus {
+		gpus[i] = &device.FakeGPU{Name: "Test GPU", UUID: fmt.Sprintf("GPU-test-%d", i), Temperature: 40, FanSpeeds: make([]int, fans)}
+	}
+	fake := device.NewFake(gpus...)
+	backend := gpuBackend
+	gpuBackend = fake
+	t.Cleanup(func() { gpuBackend = backend })
+	return fake
+}
+
+func testMonitor(t *testing.T, config Config, fake *device.Fake, gpu int) DeviceMonitor {
+	t.Helper()
+	handle, _ := fake.DeviceGetHandleByIndex(gpu)
+	monitor, ok := initDevice(config, config.ActiveProfile, gpu, handle)
+	if !ok {
+		t.Fatalf("GPU %d was not initialized", gpu)
+	}
+	return monitor
+}
+
+// fakeClock makes every reading of the clock two seconds later than the
+// last, as if each update came on time.
+func fakeClock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock = func() time.Time {
+		now = now.Add(2 * time.Second)
+		return now
+	}
+	t.Cleanup(func() { clock = time.Now })
+}
+
+func setTemperature(fake *device.Fake, gpu int, temp int) {
+	fake.Update(func(gpus []*device.FakeGPU) { gpus[gpu].Temperature = temp })
+}
+
+func fanState(fake *device.Fake, gpu int) (speeds []int, manual []bool) {
+	fake.Update(func(gpus []*device.FakeGPU) {
+		speeds = append(speeds, gpus[gpu].FanSpeeds...)
+		manual = append(manual, gpus[gpu].Manual...)
+	})
+	return speeds, manual
+}
+
+func TestGetFanSpeedForTemperature(t *testing.T) {
+	fake := fakeGPUs(t, 1, 1)
+	config := loadTestConfig(t, `{
+		"curve_mode": "interpolated",
+		"curve_points": [{ "temperature": 40, "fan_speed": 30 }, { "temperature": 80, "fan_speed": 100 }]
+	}`)
+	monitor := testMonitor(t, config, fake, 0)
+	tests := []struct {
+		temp int
+		want int
+	}{
+		{20, 30},
+		{40, 30},
+		{60, 65},
+		{80, 100},
+		{95, 100},
+	}
+	for _, test := range tests {
+		if got := getFanSpeedForTemperature(test.temp, &monitor); got != test.want {
+			t.Errorf("getFanSpeedForTemperature(%d) = %d, want %d", test.temp, got, test.want)
+		}
+	}
+}
+
+func TestUpdateDeviceHysteresis(t *testing.T) {
+	fakeClock(t)
+	fake := fakeGPUs(t, 1, 2)
+	monitor := testMonitor(t, testConfig(t), fake, 0)
+	steps := []struct {
+		temp int
+		want int
+	}{
+		{55, 50},
+		{47, 50},
+		{45, 30},
+		{65, 100},
+		{59, 100},
+		{58, 50},
+		{20, 30},
+	}
+	for _, step := range steps {
+		setTemperature(fake, 0, step.temp)
+		updateDevice(&monitor)
+		speeds, manual := fanState(fake, 0)
+		for fanIdx, speed := range speeds {
+			if speed != step.want || !manual[fanIdx] {
+				t.Errorf("at %d°C: fan %d at %d%% (manual %v), want %d%% under manual control", step.temp, fanIdx, speed, manual[fanIdx], step.want)
+			}
+		}
+	}
+}
+
+func TestUpdateDeviceFailSafe(t *testing.T) {
+	fakeClock(t)
+	fake := fakeGPUs(t, 1, 1)
+	monitor := testMonitor(t, testConfig(t), fake, 0)
+	updateDevice(&monitor)
+	fake.Update(func(gpus []*device.FakeGPU) {
+		gpus[0].Errors = map[string]nvml.Return{"DeviceGetTemperature": nvml.ERROR_INVALID_ARGUMENT}
+	})
+	for i := 1; i <= monitor.FailSafe.Cycles; i++ {
+		updateDevice(&monitor)
+		speeds, _ := fanState(fake, 0)
+		engaged := i == monitor.FailSafe.Cycles
+		if monitor.FailSafeActive != engaged || engaged != (speeds[0] == 100) {
+			t.Fatalf("after %d failed updates: fail-safe %v at %d%%, want engaged only after %d at 100%%", i, monitor.FailSafeActive, speeds[0], monitor.FailSafe.Cycles)
+		}
+	}
+	// The first good reading releases the fail-safe, and the update after it
+	// goes back to the curve.
+	fake.Update(func(gpus []*device.FakeGPU) { gpus[0].Errors = nil })
+	updateDevice(&monitor)
+	if monitor.FailSafeActive {
+		t.Fatalf("fail-safe still engaged after a good reading")
+	}
+	updateDevice(&monitor)
+	if speeds, _ := fanState(fake, 0); speeds[0] != 30 {
+		t.Errorf("after recovering: fan at %d%%, want 30%%", speeds[0])
+	}
+}
+
+func TestMonitoringLoop(t *testing.T) {
+	fake := fakeGPUs(t, 2, 1)
+	setTemperature(fake, 1, 65)
+	config := loadTestConfig(t, `{
+		"time_to_update": 0.01,
+		"temperature_ranges": [
+			{ "min_temperature": -999, "max_temperature": 60, "fan_speed": 30 },
+			{ "min_temperature": 60, "max_temperature": 999, "fan_speed": 100 }
+		]
+	}`)
+	d := &Daemon{
+		Config: config,
+		Monitors: []DeviceMonitor{testMonitor(t, config, fake, 0), testMonitor(t, config, fake, 1)},
+		Profile: config.ActiveProfile,
+		Status: &StatusStore{},
+		Commands: make(chan func(*Daemon)),
+		knownUnmanaged: map[string]bool{},
+	}
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		runMonitoringLoop(d, signals, nil)
+		close(done)
+	}()
+	want := []int{30, 100}
+	deadline := time.Now().Add(5 * time.Second)
+	for gpu := 0; gpu < len(want); gpu++ {
+		for {
+			if speeds, _ := fanState(fake, gpu); speeds[0] == want[gpu] {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GPU %d never reached %d%%", gpu, want[gpu])
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	signals <- syscall.SIGTERM
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the loop did not stop on SIGTERM")
+	}
+}
+
+func TestShutdownRestoresAttachedGPUs(t *testing.T) {
+	fakeClock(t)
+	fake := fakeGPUs(t, 2, 1)
+	setTemperature(fake, 0, 55)
+	setTemperature(fake, 1, 55)
+	config := testConfig(t)
+	d := &Daemon{
+		Config: config,
+		Monitors: []DeviceMonitor{testMonitor(t, config, fake, 0)},
+		Profile: config.ActiveProfile,
+		Status: &StatusStore{},
+		knownUnmanaged: map[string]bool{},
+	}
+	// GPU 1 shows up after startup, as if hot-plugged.
+	d.rescanDevices()
+	if len(d.Monitors) != 2 {
+		t.Fatalf("rescan found %d GPUs, want 2", len(d.Monitors))
+	}
+	for i := range d.Monitors {
+		updateDevice(&d.Monitors[i])
+	}
+	d.shutdown()
+	for gpu := 0; gpu < 2; gpu++ {
+		speeds, manual := fanState(fake, gpu)
+		if manual[0] {
+			t.Errorf("GPU %d fan 0 still under manual control at %d%% after shutdown", gpu, speeds[0])
+		}
+	}
+}
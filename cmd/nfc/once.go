@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// runOnce is run --once: every GPU gets a single update, what it did is
+// printed, and the fans are left where it put them rather than handed back
+// to the driver. The controller state is restored and saved like the
+// daemon's, so repeated runs keep the hysteresis and dwell times. It
+// reports whether every update succeeded.
+func runOnce(options RunOptions) bool {
+	setLogHandler(&sinkHandler{level: slog.LevelWarn, write: writerSink(os.Stderr)})
+	config, err := loadRunConfig(options)
+	if err != nil {
+		exitf("Failed to load config: %v", err)
+	}
+	if !options.DryRun {
+		releasePIDFile, err := acquirePIDFile(config.PIDFile, options.Force)
+		if err != nil {
+			exitf("%v", err)
+		}
+		defer releasePIDFile()
+	}
+	nvmlCleanup, err := initNVML()
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer nvmlCleanup()
+	monitors, err := initDevices(config)
+	if err != nil {
+		exitf("%v", err)
+	}
+	state := savedState(config.State)
+	// Groups need every member's temperature before the first update.
+	fanGroups.configure(config.Groups)
+	for i := 0; i < len(monitors) && len(config.Groups) > 0; i++ {
+		readSensors(&monitors[i])
+	}
+	ok := true
+	for i := range monitors {
+		monitor := &monitors[i]
+		monitor.DryRun = options.DryRun
+		oldSpeeds := append([]int(nil), monitor.CurrentFanSpeeds...)
+		restoreState(state, monitor)
+		enablePersistenceMode(config.PersistenceMode, monitor)
+		// A fan the driver controls is written even if it already runs at
+		// the speed the curve asks for, to take it over.
+		takeOver := false
+		for fanIdx := 0; fanIdx < monitor.NumFans && monitor.HWMon == ""; fanIdx++ {
+			if policy, ret := readFanPolicy(monitor, fanIdx); ret == nvml.SUCCESS && policy != nvml.FAN_POLICY_MANUAL {
+				monitor.CurrentFanSpeeds[fanIdx] = -1
+				takeOver = true
+			}
+		}
+		updateDevice(monitor)
+		fmt.Println(describeOnce(monitor, oldSpeeds, takeOver))
+		ok = ok && monitor.ConsecutiveFailures == 0
+	}
+	(&Daemon{Config: config, Options: options, Monitors: monitors}).saveState(true)
+	return ok
+}
+
+func describeOnce(monitor *DeviceMonitor, oldSpeeds []int, takeOver bool) string {
+	line := fmt.Sprintf("GPU %d (%s): %d°C", monitor.Index, monitor.Name, monitor.Temperature)
+	if monitor.Temperature != monitor.RawTemperature {
+		line += fmt.Sprintf(" (raw %d°C)", monitor.RawTemperature)
+	}
+	if r := monitor.CurrentTemperatureRange; r.MaxTemperature != 0 {
+		line += fmt.Sprintf(", range %s", describeRange(r))
+	}
+	if monitor.Settings.SpeedUnit == speedUnitRPM {
+		line += fmt.Sprintf(", target %d RPM", monitor.TargetRPM)
+	}
+	switch {
+	case monitor.ConsecutiveFailures > 0:
+		return line + ", update failed"
+	case monitor.DriverControl:
+		return line + ", fans left to the driver"
+	case takeOver && slices.Equal(oldSpeeds, monitor.CurrentFanSpeeds):
+		return line + fmt.Sprintf(", fans taken over from the driver at %v%%", monitor.CurrentFanSpeeds)
+	case slices.Equal(oldSpeeds, monitor.CurrentFanSpeeds):
+		return line + fmt.Sprintf(", fans unchanged at %v%%", monitor.CurrentFanSpeeds)
+	case monitor.DryRun:
+		return line + fmt.Sprintf(", would set fans %v%% -> %v%%", oldSpeeds, monitor.CurrentFanSpeeds)
+	}
+	return line + fmt.Sprintf(", fans %v%% -> %v%%", oldSpeeds, monitor.CurrentFanSpeeds)
+}
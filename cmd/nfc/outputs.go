@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+const (
+	outputHWMon = "hwmon"
+	outputLiquidctl = "liquidctl"
+)
+
+// outputStaleSeconds is how old the status may get before an output stops
+// trusting it and runs at full speed.
+const outputStaleSeconds = 60
+
+// OutputConfig drives a fan that is not on a GPU from the GPUs' temperature:
+// a motherboard header through its hwmon pwm file, or a pump or fan channel
+// of a controller that liquidctl supports. The speed comes from curve_points
+// at the hottest of gpus, or of all GPUs if gpus is empty.
+type OutputConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	PWM string `json:"pwm"`
+	Device string `json:"device"`
+	Channel string `json:"channel"`
+	GPUs []string `json:"gpus"`
+	CurvePoints []CurvePoint `json:"curve_points"`
+	CurveHysteresis int `json:"curve_hysteresis"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+}
+
+var pwmFilePattern = regexp.MustCompile(`^pwm[0-9]+$`)
+
+func applyOutputDefaults(config *OutputConfig) {
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 5
+	}
+	if config.Name == "" && config.Type == outputHWMon {
+		config.Name = config.PWM
+	}
+	if config.Name == "" && config.Type == outputLiquidctl {
+		config.Name = strings.TrimPrefix(config.Device+" "+config.Channel, " ")
+	}
+}
+
+func validateOutput(config OutputConfig) error {
+	switch config.Type {
+	case outputHWMon:
+		if !pwmFilePattern.MatchString(filepath.Base(config.PWM)) {
+			return fmt.Errorf("pwm %q is not a pwm file, such as /sys/class/hwmon/hwmon2/pwm1", config.PWM)
+		}
+	case outputLiquidctl:
+		if config.Channel == "" {
+			return fmt.Errorf("channel is required for liquidctl")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected hwmon or liquidctl", config.Type)
+	}
+	if len(config.CurvePoints) == 0 {
+		return fmt.Errorf("curve_points is empty")
+	}
+	return curve.ValidatePoints(config.CurvePoints, config.CurveHysteresis)
+}
+
+func hasOutput(config Config, kind string) bool {
+	for _, output := range config.Outputs {
+		if output.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// outputTemperature is the hottest temperature of the output's GPUs. It
+// fails when one of them, or the status as a whole, cannot be trusted.
+func outputTemperature(config OutputConfig, snapshot StatusSnapshot) (int, error) {
+	if age := time.Since(snapshot.Time); age > outputStaleSeconds*time.Second {
+		return 0, fmt.Errorf("status is %s old", age.Round(time.Second))
+	}
+	temperature, found := 0, false
+	for _, d := range snapshot.Devices {
+		if len(config.GPUs) > 0 && !outputSource(config.GPUs, d) {
+			continue
+		}
+		if d.FailSafe {
+			return 0, fmt.Errorf("GPU %d is in fail-safe mode", d.Index)
+		}
+		temperature, found = max(temperature, d.Temperature), true
+	}
+	if !found {
+		return 0, fmt.Errorf("none of its GPUs is present")
+	}
+	return temperature, nil
+}
+
+func outputSource(ids []string, d DeviceStatus) bool {
+	for _, id := range ids {
+		monitor := DeviceMonitor{Index: d.Index, UUID: d.UUID, PCIBusID: d.PCIBusID}
+		if groupMemberMatches(id, &monitor) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOutput sets the output to speed percent.
+func writeOutput(config OutputConfig, speed int) error {
+	if config.Type == outputHWMon {
+		return os.WriteFile(config.PWM, []byte(strconv.Itoa(int(math.Round(float64(speed)*255/100)))), 0644)
+	}
+	args := []string{}
+	if config.Device != "" {
+		args = append(args, "--match", config.Device)
+	}
+	args = append(args, "set", config.Channel, "speed", strconv.Itoa(speed))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, "liquidctl", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("liquidctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// takeOutput switches a hwmon header to manual control and returns the mode
+// it was in, for releaseOutput. liquidctl channels need no switching.
+func takeOutput(config OutputConfig) (int, error) {
+	if config.Type != outputHWMon {
+		return 0, nil
+	}
+	enable := config.PWM + "_enable"
+	mode, ret := readSysfsInt(enable)
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("cannot read %s", enable)
+	}
+	if err := os.WriteFile(enable, []byte("1"), 0644); err != nil {
+		return 0, err
+	}
+	return mode, nil
+}
+
+// releaseOutput hands a hwmon header back to the mode it was in. liquidctl
+// channels keep their last speed.
+func releaseOutput(config OutputConfig, mode int) {
+	if config.Type != outputHWMon || mode == 1 {
+		return
+	}
+	if err := os.WriteFile(config.PWM+"_enable", []byte(strconv.Itoa(mode)), 0644); err != nil {
+		logWarnf("Output %s: failed to restore automatic control: %v", config.Name, err)
+		return
+	}
+	logInfof("Output %s: restored automatic control.", config.Name)
+}
+
+// startOutputs drives every output from the latest status on its own
+// interval until the returned function is called, which hands the hwmon
+// headers back to their previous mode.
+func startOutputs(configs []OutputConfig, d *Daemon) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{}, len(configs))
+	for _, config := range configs {
+		go func(config OutputConfig) {
+			defer func() { done <- struct{}{} }()
+			mode, err := takeOutput(config)
+			if err != nil {
+				logErrorf("Output %s: failed to take control: %v", config.Name, err)
+				return
+			}
+			defer releaseOutput(config, mode)
+			ticker := time.NewTicker(time.Duration(config.IntervalSeconds * float64(time.Second)))
+			defer ticker.Stop()
+			speed := -1
+			failures, blind := failureLogger{}, false
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+				snapshot := d.Status.Snapshot()
+				if snapshot.Time.IsZero() {
+					continue
+				}
+				// Without a temperature to go by, the output runs at full
+				// speed rather than at whatever it was last set to.
+				target := 100
+				temperature, err := outputTemperature(config, snapshot)
+				if err == nil {
+					target = curve.InterpolateWithHysteresis(temperature, speed, config.CurvePoints, config.CurveHysteresis)
+				}
+				if err != nil && !blind {
+					logWarnf("Output %s: running at 100%%: %v", config.Name, err)
+				}
+				blind = err != nil
+				if target == speed {
+					continue
+				}
+				if failures.observe(writeOutput(config, target), "Output %s: failed to set %d%%", config.Name, target) {
+					continue
+				}
+				if !blind {
+					logFields{"output": config.Name, "temperature": temperature, "old_speed": speed, "new_speed": target}.Infof("Output %s: %d%% at %d°C.", config.Name, target, temperature)
+				}
+				speed = target
+			}
+		}(config)
+		logInfof("Driving output %s (%s) every %gs.", config.Name, config.Type, config.IntervalSeconds)
+	}
+	return func() {
+		close(stop)
+		for range configs {
+			<-done
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func applyPanicDefaults(control *ControlConfig) {
+	if control.PanicTemperature <= 0 {
+		return
+	}
+	if control.PanicMargin == 0 {
+		control.PanicMargin = 5
+	}
+	if control.PanicSeconds == 0 {
+		control.PanicSeconds = 30
+	}
+}
+
+func validatePanic(config ControlConfig) error {
+	if config.PanicTemperature < 0 {
+		return fmt.Errorf("panic_temperature (%d) is negative", config.PanicTemperature)
+	}
+	if config.PanicMargin < 0 {
+		return fmt.Errorf("panic_margin (%d) is negative", config.PanicMargin)
+	}
+	if config.PanicSeconds < 0 {
+		return fmt.Errorf("panic_seconds (%g) is negative", config.PanicSeconds)
+	}
+	if config.PanicTemperature > 0 && config.PanicMargin >= config.PanicTemperature {
+		return fmt.Errorf("panic_margin (%d) must be below panic_temperature (%d)", config.PanicMargin, config.PanicTemperature)
+	}
+	return nil
+}
+
+// checkPanic engages the panic mode once the GPU reaches panic_temperature,
+// going by the raw reading so smoothing cannot delay it. It is released
+// once the GPU has stayed panic_margin degrees below for panic_seconds.
+func checkPanic(monitor *DeviceMonitor) {
+	config := monitor.Settings
+	temperature := max(monitor.RawTemperature, monitor.Temperature)
+	fields := logFields{"gpu_index": monitor.Index, "temperature": temperature, "panic_temperature": config.PanicTemperature}
+	switch {
+	case !monitor.PanicActive && config.PanicTemperature > 0 && temperature >= config.PanicTemperature:
+		monitor.PanicActive = true
+		monitor.PanicCoolSince = time.Time{}
+		fields.Errorf("PANIC: GPU %d reached %d°C, at or above its panic temperature of %d°C. Running every fan at 100%% until it stays at or below %d°C for %gs.", monitor.Index, temperature, config.PanicTemperature, config.PanicTemperature-config.PanicMargin, config.PanicSeconds)
+		alerts.emit(monitor, eventPanic, false, "temperature %d°C reached the %d°C panic temperature, fans at 100%%", temperature, config.PanicTemperature)
+	case monitor.PanicActive && config.PanicTemperature <= 0:
+		// The panic temperature was removed by a reload.
+		releasePanic(monitor, temperature)
+	case monitor.PanicActive && temperature <= config.PanicTemperature-config.PanicMargin:
+		now := clock()
+		if monitor.PanicCoolSince.IsZero() {
+			monitor.PanicCoolSince = now
+		}
+		if now.Sub(monitor.PanicCoolSince) >= time.Duration(config.PanicSeconds*float64(time.Second)) {
+			releasePanic(monitor, temperature)
+		}
+	case monitor.PanicActive:
+		monitor.PanicCoolSince = time.Time{}
+	}
+}
+
+func releasePanic(monitor *DeviceMonitor, temperature int) {
+	monitor.PanicActive = false
+	monitor.PanicCoolSince = time.Time{}
+	logFields{"gpu_index": monitor.Index, "temperature": temperature}.Warnf("GPU %d cooled to %d°C, leaving panic mode.", monitor.Index, temperature)
+	alerts.emit(monitor, eventPanic, true, "cooled to %d°C, panic mode released", temperature)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+const (
+	defaultConfigDir = "/etc/nvidia-fan-control"
+	defaultLogFile = "/var/log/nvidia-fan-control.log"
+	defaultControlSocket = "/run/nvidia-fan-control.sock"
+	defaultPIDFile = "/run/nvidia-fan-control.pid"
+	defaultCalibrationFile = "/var/lib/nvidia-fan-control/calibration.json"
+	defaultHistoryDir = "/var/lib/nvidia-fan-control/history"
+	defaultStateFile = "/var/lib/nvidia-fan-control/state.json"
+	nvmlLibraryPath = ""
+)
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+var (
+	defaultConfigDir = filepath.Join(programData(), "nvidia-fan-control")
+	defaultLogFile = filepath.Join(programData(), "nvidia-fan-control", "nvidia-fan-control.log")
+	defaultControlSocket = filepath.Join(programData(), "nvidia-fan-control", "nvidia-fan-control.sock")
+	defaultPIDFile = filepath.Join(programData(), "nvidia-fan-control", "nvidia-fan-control.pid")
+	defaultCalibrationFile = filepath.Join(programData(), "nvidia-fan-control", "calibration.json")
+	defaultHistoryDir = filepath.Join(programData(), "nvidia-fan-control", "history")
+	defaultStateFile = filepath.Join(programData(), "nvidia-fan-control", "state.json")
+)
+
+// The driver installs nvml.dll into System32, the only directory a bare
+// name is loaded from.
+const nvmlLibraryPath = "nvml.dll"
+
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
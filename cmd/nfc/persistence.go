@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// PersistenceModeConfig keeps the driver loaded on headless machines, where
+// it would otherwise unload whenever no client holds the GPU, losing its
+// state and making the next read slow. With restore, GPUs that had
+// persistence mode off get it turned off again on exit.
+type PersistenceModeConfig struct {
+	Enabled bool `json:"enabled"`
+	Restore bool `json:"restore"`
+}
+
+// enablePersistenceMode turns on persistence mode for the monitor's GPU,
+// remembering whether to turn it off again on exit.
+func enablePersistenceMode(config PersistenceModeConfig, monitor *DeviceMonitor) {
+	if !config.Enabled || monitor.HWMon != "" {
+		return
+	}
+	fields := logFields{"gpu_index": monitor.Index}
+	mode, ret := gpuBackend.DeviceGetPersistenceMode(monitor.Handle)
+	if ret != nvml.SUCCESS {
+		fields["nvml_error"] = nvml.ErrorString(ret)
+		fields.Warnf("Cannot read the persistence mode of GPU %d: %v", monitor.Index, nvml.ErrorString(ret))
+		return
+	}
+	if mode == nvml.FEATURE_ENABLED {
+		return
+	}
+	if monitor.DryRun {
+		fields.Infof("Dry run: would enable persistence mode for GPU %d.", monitor.Index)
+		return
+	}
+	if ret := gpuBackend.DeviceSetPersistenceMode(monitor.Handle, nvml.FEATURE_ENABLED); ret != nvml.SUCCESS {
+		fields["nvml_error"] = nvml.ErrorString(ret)
+		fields.Errorf("Failed to enable persistence mode for GPU %d: %v", monitor.Index, nvml.ErrorString(ret))
+		return
+	}
+	monitor.RestorePersistence = config.Restore
+	fields.Infof("Enabled persistence mode for GPU %d.", monitor.Index)
+}
+
+// restorePersistenceModes turns persistence mode off again on the GPUs it
+// was enabled for with restore, on exit.
+func restorePersistenceModes(monitors []DeviceMonitor) {
+	for i := range monitors {
+		monitor := &monitors[i]
+		if !monitor.RestorePersistence {
+			continue
+		}
+		fields := logFields{"gpu_index": monitor.Index}
+		if ret := gpuBackend.DeviceSetPersistenceMode(monitor.Handle, nvml.FEATURE_DISABLED); ret != nvml.SUCCESS {
+			fields["nvml_error"] = nvml.ErrorString(ret)
+			fields.Errorf("Failed to disable persistence mode for GPU %d again: %v", monitor.Index, nvml.ErrorString(ret))
+			continue
+		}
+		monitor.RestorePersistence = false
+		fields.Infof("Disabled persistence mode for GPU %d again.", monitor.Index)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errLocked = errors.New("locked")
+
+// acquirePIDFile takes an exclusive lock on path and writes the process ID
+// into it, so a second daemon refuses to fight the first over the fans. The
+// lock goes away with the process, so a stale file left by a crash does not
+// block the next start. With force a held lock is only warned about.
+func acquirePIDFile(path string, force bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("pid file: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("pid file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		owner := "another instance"
+		if data, readErr := os.ReadFile(path); readErr == nil {
+			if pid, convErr := strconv.Atoi(strings.TrimSpace(string(data))); convErr == nil {
+				owner = fmt.Sprintf("another instance (pid %d)", pid)
+			}
+		}
+		file.Close()
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("failed to lock pid file %s: %w", path, err)
+		}
+		if force {
+			logWarnf("Ignoring the lock on %s because of --force: %s already controls the fans.", path, owner)
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("%s already controls the fans (%s); stop it first, or pass --force to run alongside it", owner, path)
+	}
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() {
+		os.Remove(path)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// PowerLimitConfig is the last line of defence against overheating: once a
+// GPU has stayed at or above critical_temperature for seconds with every fan
+// at its maximum, its power limit is lowered by step_watts, and again after
+// every further seconds, down to min_watts or the driver's minimum. The
+// original limit is restored once the GPU has cooled to
+// restore_temperature.
+type PowerLimitConfig struct {
+	CriticalTemperature int `json:"critical_temperature"`
+	Seconds float64 `json:"seconds"`
+	StepWatts int `json:"step_watts"`
+	MinWatts int `json:"min_watts"`
+	RestoreTemperature int `json:"restore_temperature"`
+}
+
+func applyPowerLimitDefaults(config *PowerLimitConfig) {
+	if config.CriticalTemperature <= 0 {
+		return
+	}
+	if config.Seconds <= 0 {
+		config.Seconds = 30
+	}
+	if config.StepWatts <= 0 {
+		config.StepWatts = 25
+	}
+	if config.RestoreTemperature == 0 {
+		config.RestoreTemperature = config.CriticalTemperature - 10
+	}
+}
+
+func validatePowerLimit(config PowerLimitConfig) error {
+	if config.CriticalTemperature < 0 {
+		return fmt.Errorf("critical_temperature (%d) is negative", config.CriticalTemperature)
+	}
+	if config.MinWatts < 0 {
+		return fmt.Errorf("min_watts (%d) is negative", config.MinWatts)
+	}
+	if config.CriticalTemperature > 0 && config.RestoreTemperature >= config.CriticalTemperature {
+		return fmt.Errorf("restore_temperature (%d) must be below critical_temperature (%d)", config.RestoreTemperature, config.CriticalTemperature)
+	}
+	return nil
+}
+
+// fansAtMaximum reports whether every fan already runs as fast as the device
+// allows, so more cooling can only come from drawing less power.
+func fansAtMaximum(monitor *DeviceMonitor) bool {
+	for _, speed := range monitor.CurrentFanSpeeds {
+		if speed < monitor.MaxFanSpeed {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPowerLimit lowers the power limit of a GPU that stays critical
+// despite full fans, and restores it once the GPU has cooled down.
+func checkPowerLimit(monitor *DeviceMonitor) {
+	config := monitor.PowerLimit
+	if monitor.HWMon != "" {
+		return
+	}
+	if monitor.OriginalPowerLimit > 0 && (config.CriticalTemperature <= 0 || monitor.Temperature <= config.RestoreTemperature) {
+		restorePowerLimit(monitor)
+		return
+	}
+	if config.CriticalTemperature <= 0 || monitor.Temperature < config.CriticalTemperature || !fansAtMaximum(monitor) {
+		monitor.CriticalSince = time.Time{}
+		return
+	}
+	now := clock()
+	if monitor.CriticalSince.IsZero() {
+		monitor.CriticalSince = now
+	}
+	if now.Sub(monitor.CriticalSince) < time.Duration(config.Seconds*float64(time.Second)) {
+		return
+	}
+	// The next step waits for another full period.
+	monitor.CriticalSince = now
+	reducePowerLimit(monitor)
+}
+
+func reducePowerLimit(monitor *DeviceMonitor) {
+	config := monitor.PowerLimit
+	fields := logFields{"gpu_index": monitor.Index, "temperature": monitor.Temperature}
+	current, ret := gpuBackend.DeviceGetPowerManagementLimit(monitor.Handle)
+	if ret != nvml.SUCCESS {
+		fields["nvml_error"] = nvml.ErrorString(ret)
+		fields.Errorf("GPU %d is at %d°C with full fans, but its power limit cannot be read: %v", monitor.Index, monitor.Temperature, nvml.ErrorString(ret))
+		return
+	}
+	floor := uint32(config.MinWatts * 1000)
+	if minLimit, _, ret := gpuBackend.DeviceGetPowerManagementLimitConstraints(monitor.Handle); ret == nvml.SUCCESS && minLimit > floor {
+		floor = minLimit
+	}
+	limit := floor
+	if step := uint32(config.StepWatts * 1000); current > floor+step {
+		limit = current - step
+	}
+	if limit >= current {
+		fields.Warnf("GPU %d is still at %d°C with full fans and its power limit is already at the minimum of %dW.", monitor.Index, monitor.Temperature, current/1000)
+		return
+	}
+	fields["old_watts"], fields["new_watts"] = current/1000, limit/1000
+	if monitor.DryRun {
+		fields.Warnf("Dry run: would lower the power limit of GPU %d from %dW to %dW at %d°C.", monitor.Index, current/1000, limit/1000, monitor.Temperature)
+		return
+	}
+	if ret := gpuBackend.DeviceSetPowerManagementLimit(monitor.Handle, limit); ret != nvml.SUCCESS {
+		fields["nvml_error"] = nvml.ErrorString(ret)
+		fields.Errorf("Failed to lower the power limit of GPU %d to %dW: %v", monitor.Index, limit/1000, nvml.ErrorString(ret))
+		return
+	}
+	if monitor.OriginalPowerLimit == 0 {
+		monitor.OriginalPowerLimit = current
+	}
+	monitor.PowerLimitWatts = int(limit / 1000)
+	fields.Warnf("GPU %d is at %d°C despite full fans, lowered its power limit from %dW to %dW.", monitor.Index, monitor.Temperature, current/1000, limit/1000)
+	alerts.emit(monitor, eventPowerLimit, false, "temperature %d°C despite full fans, power limit lowered from %dW to %dW", monitor.Temperature, current/1000, limit/1000)
+}
+
+// restorePowerLimit puts back the limit the GPU had before it was lowered.
+func restorePowerLimit(monitor *DeviceMonitor) {
+	if monitor.OriginalPowerLimit == 0 {
+		return
+	}
+	fields := logFields{"gpu_index": monitor.Index, "temperature": monitor.Temperature, "new_watts": monitor.OriginalPowerLimit / 1000}
+	if ret := gpuBackend.DeviceSetPowerManagementLimit(monitor.Handle, monitor.OriginalPowerLimit); ret != nvml.SUCCESS {
+		fields["nvml_error"] = nvml.ErrorString(ret)
+		fields.Errorf("Failed to restore the power limit of GPU %d to %dW: %v", monitor.Index, monitor.OriginalPowerLimit/1000, nvml.ErrorString(ret))
+		return
+	}
+	fields.Infof("GPU %d cooled to %d°C, restored its power limit to %dW.", monitor.Index, monitor.Temperature, monitor.OriginalPowerLimit/1000)
+	alerts.emit(monitor, eventPowerLimit, true, "cooled to %d°C, power limit restored to %dW", monitor.Temperature, monitor.OriginalPowerLimit/1000)
+	monitor.OriginalPowerLimit = 0
+	monitor.PowerLimitWatts = 0
+	monitor.CriticalSince = time.Time{}
+}
+
+// restorePowerLimits restores every lowered power limit, on exit.
+func restorePowerLimits(monitors []DeviceMonitor) {
+	for i := range monitors {
+		restorePowerLimit(&monitors[i])
+	}
+}
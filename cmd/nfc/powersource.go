@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	powerSourceSysfs = "sysfs"
+	powerSourceUPower = "upower"
+	powerAC = "ac"
+	powerBattery = "battery"
+)
+
+// PowerSourceConfig switches profiles when a laptop is plugged in or runs
+// on battery. The power source is read from /sys/class/power_supply, or
+// asked from UPower over the system bus, every interval_seconds.
+type PowerSourceConfig struct {
+	Plugged string `json:"plugged"`
+	Battery string `json:"battery"`
+	Source string `json:"source"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+}
+
+func applyPowerSourceDefaults(config *PowerSourceConfig) {
+	if config.Source == "" {
+		config.Source = powerSourceSysfs
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 5
+	}
+}
+
+func validatePowerSource(config Config) error {
+	source := config.PowerSource
+	switch source.Source {
+	case powerSourceSysfs, powerSourceUPower:
+	default:
+		return fmt.Errorf("power_source: unknown source %q, expected sysfs or upower", source.Source)
+	}
+	for _, name := range []string{source.Plugged, source.Battery} {
+		if _, ok := config.Profiles[name]; name != "" && !ok {
+			return fmt.Errorf("power_source: profile %q is not defined in profiles", name)
+		}
+	}
+	return nil
+}
+
+func powerSourceEnabled(config PowerSourceConfig) bool {
+	return config.Plugged != "" || config.Battery != ""
+}
+
+var powerSupplyDir = "/sys/class/power_supply"
+
+func readPowerSupply(supply, attribute string) string {
+	data, err := os.ReadFile(filepath.Join(supply, attribute))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// sysfsPowerSource reports ac while a mains or USB adapter is online. Without
+// any adapter, as on some eGPU enclosures, a discharging battery means
+// battery. It returns "" when the machine has neither.
+func sysfsPowerSource() string {
+	supplies, _ := filepath.Glob(filepath.Join(powerSupplyDir, "*"))
+	adapters, online, discharging := 0, false, false
+	for _, supply := range supplies {
+		switch readPowerSupply(supply, "type") {
+		case "Mains", "USB":
+			adapters++
+			online = online || readPowerSupply(supply, "online") == "1"
+		case "Battery":
+			discharging = discharging || readPowerSupply(supply, "status") == "Discharging"
+		}
+	}
+	switch {
+	case online || (adapters == 0 && len(supplies) > 0 && !discharging):
+		return powerAC
+	case adapters > 0 || discharging:
+		return powerBattery
+	}
+	return ""
+}
+
+func upowerPowerSource() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "gdbus", "call", "--system",
+		"--dest", "org.freedesktop.UPower",
+		"--object-path", "/org/freedesktop/UPower",
+		"--method", "org.freedesktop.DBus.Properties.Get",
+		"org.freedesktop.UPower", "OnBattery").Output()
+	switch {
+	case err != nil:
+		return ""
+	case strings.Contains(string(output), "true"):
+		return powerBattery
+	}
+	return powerAC
+}
+
+// pollPowerSource reads the power source when it is due, outside the
+// monitor locks since UPower may be slow to answer. It returns "" when it is
+// not due or the source is unknown.
+func (d *Daemon) pollPowerSource(now time.Time) string {
+	config := d.Config.PowerSource
+	if !powerSourceEnabled(config) || now.Before(d.nextPowerSourceCheck) {
+		return ""
+	}
+	d.nextPowerSourceCheck = now.Add(time.Duration(config.IntervalSeconds * float64(time.Second)))
+	if config.Source == powerSourceUPower {
+		return upowerPowerSource()
+	}
+	return sysfsPowerSource()
+}
+
+// applyPowerSource switches to the profile configured for source when the
+// power source changes, or is first known.
+func (d *Daemon) applyPowerSource(source string) {
+	if source == "" || source == d.powerSource {
+		return
+	}
+	d.powerSource = source
+	profile := d.Config.PowerSource.Plugged
+	if source == powerBattery {
+		profile = d.Config.PowerSource.Battery
+	}
+	if profile == "" {
+		logInfof("Running on %s.", source)
+		return
+	}
+	logInfof("Running on %s, switching to profile %q.", source, profile)
+	if err := d.SetProfile(profile); err != nil {
+		logWarnf("Power source %s: %v", source, err)
+	}
+}
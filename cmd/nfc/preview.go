@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+)
+
+// previewSettle is how long every temperature of a preview is held, so
+// that dwell times, downshift delays, smoothing and ramping have run out
+// and only the curve and its hysteresis decide the speed.
+const previewSettle = 10 * time.Minute
+
+type previewRow struct {
+	Temperature int
+	Rising []int
+	Falling []int
+	Range string
+}
+
+// sweepCurve holds the simulated GPU at every temperature from from to to
+// in turn and returns the speeds the fans settle at.
+func sweepCurve(fake *device.Fake, gpu int, monitor *DeviceMonitor, from, to int, now *time.Time) ([][]int, []string) {
+	step := 1
+	if to < from {
+		step = -1
+	}
+	interval := time.Duration(monitor.Settings.TimeToUpdate * float64(time.Second))
+	speeds, ranges := [][]int{}, []string{}
+	for temp := from; ; temp += step {
+		fake.Update(func(gpus []*device.FakeGPU) {
+			gpus[gpu].Temperature = temp
+			gpus[gpu].MemoryTemperature = temp
+		})
+		for held := time.Duration(0); held < previewSettle; held += interval {
+			*now = now.Add(interval)
+			updateDevice(monitor)
+		}
+		speeds = append(speeds, append([]int(nil), monitor.CurrentFanSpeeds...))
+		rangeText := ""
+		if r := monitor.CurrentTemperatureRange; monitor.Settings.CurveMode == "" || monitor.Settings.CurveMode == "stepped" {
+			rangeText = "-"
+			if r.MaxTemperature != 0 {
+				rangeText = fmt.Sprintf("%d..%d", r.MinTemperature, r.MaxTemperature)
+			}
+		}
+		ranges = append(ranges, rangeText)
+		if temp == to {
+			return speeds, ranges
+		}
+	}
+}
+
+func speedsText(speeds []int) string {
+	if len(speeds) == 1 {
+		return strconv.Itoa(speeds[0]) + "%"
+	}
+	return fmt.Sprintf("%v%%", speeds)
+}
+
+// plotPreview draws the first fan's speed over temperature, rising as '*'
+// and falling as 'o' where the two differ.
+func plotPreview(rows []previewRow) string {
+	var plot strings.Builder
+	for level := 100; level >= 0; level -= 5 {
+		line := []byte(strings.Repeat(" ", len(rows)))
+		for i, row := range rows {
+			rising, falling := row.Rising[0], row.Falling[0]
+			if falling != rising && falling >= level && falling < level+5 {
+				line[i] = 'o'
+			}
+			if rising >= level && rising < level+5 || (level == 100 && rising > 100) {
+				line[i] = '*'
+			}
+		}
+		fmt.Fprintf(&plot, "%4d%% |%s\n", level, strings.TrimRight(string(line), " "))
+	}
+	fmt.Fprintf(&plot, "      +%s\n", strings.Repeat("-", len(rows)))
+	axis := []byte(strings.Repeat(" ", len(rows)+10))
+	for i, row := range rows {
+		if row.Temperature%10 == 0 {
+			label := strconv.Itoa(row.Temperature)
+			copy(axis[7+i:], label)
+		}
+	}
+	fmt.Fprintf(&plot, "%s °C\n", strings.TrimRight(string(axis), " "))
+	return plot.String()
+}
+
+func cmdCurve(args []string) {
+	if len(args) == 0 || args[0] != "preview" {
+		exitf("usage: curve preview [flags]")
+	}
+	flags := flag.NewFlagSet("curve preview", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file")
+	gpu := flags.Int("gpu", 0, "index of the GPU whose curve is previewed")
+	fans := flags.Int("fans", 1, "number of fans of the previewed GPU")
+	profile := flags.String("profile", "", "profile to preview instead of the active one")
+	from := flags.Int("from", 20, "lowest temperature of the table")
+	to := flags.Int("to", 100, "highest temperature of the table")
+	plot := flags.Bool("plot", false, "also draw an ASCII plot of the first fan")
+	flags.Parse(args[1:])
+	if *gpu < 0 || *fans < 1 || *from >= *to {
+		exitf("--gpu must not be negative, --fans must be at least 1 and --from below --to")
+	}
+	setLogHandler(&sinkHandler{level: slog.LevelError, write: writerSink(os.Stderr)})
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		exitf("%s: %v", *configFile, err)
+	}
+	if _, ok := config.Profiles[*profile]; *profile != "" && !ok {
+		exitf("profile %q is not defined in profiles", *profile)
+	}
+	fake := simulatedGPUs(*gpu, *fans)
+	now := time.Now()
+	clock = func() time.Time { return now }
+	fake.Update(func(gpus []*device.FakeGPU) { gpus[*gpu].Temperature = *from })
+	monitor := simulatedMonitor(config, *profile, fake, *gpu)
+	if monitor.Settings.CurveMode == "pid" {
+		exitf("a pid curve has no fixed speed per temperature; use simulate with a trace instead")
+	}
+	rising, ranges := sweepCurve(fake, *gpu, &monitor, *from, *to, &now)
+	falling, _ := sweepCurve(fake, *gpu, &monitor, *to, *from, &now)
+	slices.Reverse(falling)
+	rows := make([]previewRow, len(rising))
+	for i := range rows {
+		rows[i] = previewRow{Temperature: *from + i, Rising: rising[i], Falling: falling[i], Range: ranges[i]}
+	}
+
+	fmt.Printf("Previewing GPU %d with %s\n", *gpu, describeControlConfig(monitor.Settings))
+	// The range column only means something for stepped curves.
+	rangeHeader, rangeFormat := "", "%.0s"
+	if rows[0].Range != "" {
+		rangeHeader, rangeFormat = "RANGE", "%-12s "
+	}
+	fmt.Println(strings.TrimRight(fmt.Sprintf("%5s %10s %10s  %s", "TEMP", "RISING", "FALLING", rangeHeader), " "))
+	for _, row := range rows {
+		note := ""
+		if !slices.Equal(row.Rising, row.Falling) {
+			note = "hysteresis band"
+		}
+		line := fmt.Sprintf("%4d° %10s %10s  "+rangeFormat+"%s", row.Temperature, speedsText(row.Rising), speedsText(row.Falling), row.Range, note)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	if *plot {
+		fmt.Printf("\n%s", plotPreview(rows))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// PrivilegesConfig reduces what the daemon may do once the GPUs are set up,
+// so a compromise of one of its listeners does not hand over the machine.
+type PrivilegesConfig struct {
+	User string `json:"user"`
+	Group string `json:"group"`
+	Seccomp bool `json:"seccomp"`
+}
+
+func validatePrivileges(config Config) error {
+	if config.Privileges.Group != "" && config.Privileges.User == "" {
+		return fmt.Errorf("group requires user")
+	}
+	// NVML and the amdgpu sysfs files only accept fan changes from root, and
+	// restoring the automatic policy on exit needs the same access.
+	if config.Privileges.User != "" && config.FanBackend != backendNVControl {
+		return fmt.Errorf("user requires fan_backend \"nvcontrol\": %s only lets root change the fans", config.FanBackend)
+	}
+	if config.Privileges.User != "" && hasOutput(config, outputHWMon) {
+		return fmt.Errorf("user cannot be combined with hwmon outputs: only root can write their pwm files")
+	}
+	if config.Privileges.User != "" && config.PersistenceMode.Restore {
+		return fmt.Errorf("user cannot be combined with persistence_mode.restore: only root can change the persistence mode on exit")
+	}
+	if config.Privileges.User != "" && config.PowerLimit.CriticalTemperature > 0 {
+		return fmt.Errorf("user cannot be combined with power_limit.critical_temperature: only root can lower and restore the power limit")
+	}
+	return nil
+}
+
+// writtenDirectories lists the directories the daemon creates, replaces or
+// removes files in after it has dropped its privileges, with what for.
+func writtenDirectories(config Config) map[string]string {
+	dirs := map[string]string{}
+	if (config.Log.Output == "" || config.Log.Output == "file") && config.Log.File != "" {
+		dirs[filepath.Dir(config.Log.File)] = "log rotation"
+	}
+	if config.PIDFile != "" {
+		dirs[filepath.Dir(config.PIDFile)] = "pid_file"
+	}
+	socket := config.ControlSocket
+	if socket == "" {
+		socket = defaultControlSocket
+	}
+	dirs[filepath.Dir(socket)] = "control_socket"
+	if config.State.File != "" {
+		dirs[filepath.Dir(config.State.File)] = "state.file"
+	}
+	if config.Textfile.File != "" {
+		dirs[filepath.Dir(config.Textfile.File)] = "textfile.file"
+	}
+	if config.History.Enabled {
+		dirs[config.History.Directory] = "history.directory"
+	}
+	return dirs
+}
+
+// checkPrivilegesReload rejects a reloaded config that has to start
+// programs when the seccomp filter installed at startup forbids it; the
+// filter cannot be loosened without a restart.
+func checkPrivilegesReload(old, config Config) error {
+	if old.Privileges.Seccomp && !needsExec(old) && needsExec(config) {
+		return fmt.Errorf("privileges: the seccomp filter installed at startup blocks running programs, which the new hooks, outputs, notifications or fan_backend need; restart the daemon to apply them")
+	}
+	return nil
+}
+
+// needsExec tells whether the daemon still starts programs after
+// initialization, which the seccomp policy then has to allow.
+func needsExec(config Config) bool {
+	return config.FanBackend != backendNVML || config.Alerts.Desktop.Enabled || len(config.Hooks) > 0 || hasOutput(config, outputLiquidctl) || (powerSourceEnabled(config.PowerSource) && config.PowerSource.Source == powerSourceUPower)
+}
@@ -0,0 +1,149 @@
+//go:build linux && (amd64 || arm64)
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls are never made by the daemon, and would let whoever took
+// over the process change the system rather than just the fans.
+var deniedSyscalls = []uint32{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT, unix.SYS_CHROOT,
+	unix.SYS_FSOPEN, unix.SYS_FSMOUNT, unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE,
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_KEXEC_LOAD, unix.SYS_KEXEC_FILE_LOAD, unix.SYS_REBOOT,
+	unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_SETNS, unix.SYS_UNSHARE, unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_ACCT, unix.SYS_QUOTACTL, unix.SYS_PERSONALITY, unix.SYS_USERFAULTFD,
+	unix.SYS_SETTIMEOFDAY, unix.SYS_CLOCK_SETTIME, unix.SYS_ADJTIMEX,
+	unix.SYS_SETHOSTNAME, unix.SYS_SETDOMAINNAME,
+}
+
+var auditArch = map[string]uint32{"amd64": unix.AUDIT_ARCH_X86_64, "arm64": unix.AUDIT_ARCH_AARCH64}
+
+const (
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+	seccompSetModeFilter = 1
+	seccompFilterFlagTSync = 1
+	x32SyscallBit = 0x40000000
+)
+
+// seccompFilter builds a BPF program that fails the denied syscalls with
+// EPERM, as well as every syscall made through another ABI.
+func seccompFilter(denied []uint32) []unix.SockFilter {
+	deny := func(at int, total int) uint8 { return uint8(total - at - 2) }
+	total := 4 + len(denied) + 2
+	if runtime.GOARCH == "amd64" {
+		total++
+	}
+	program := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 4},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: auditArch[runtime.GOARCH]},
+		{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetErrno | uint32(unix.EPERM)},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+	}
+	if runtime.GOARCH == "amd64" {
+		program = append(program, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: deny(len(program), total), K: x32SyscallBit})
+	}
+	for _, nr := range denied {
+		program = append(program, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: deny(len(program), total), K: nr})
+	}
+	return append(program,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetAllow},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetErrno | uint32(unix.EPERM)},
+	)
+}
+
+func applySeccomp(config Config) error {
+	denied := deniedSyscalls
+	if !needsExec(config) {
+		denied = append(append([]uint32(nil), denied...), unix.SYS_EXECVE, unix.SYS_EXECVEAT)
+	}
+	program := seccompFilter(denied)
+	prog := unix.SockFprog{Len: uint16(len(program)), Filter: &program[0]}
+	// no_new_privs is per thread, but the kernel copies it to every thread
+	// the filter is synchronized to.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("seccomp: failed to set no_new_privs: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTSync, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("seccomp: %w", errno)
+	}
+	return nil
+}
+
+func dropUser(config PrivilegesConfig) error {
+	account, err := user.Lookup(config.User)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(account.Uid)
+	gid, _ := strconv.Atoi(account.Gid)
+	if config.Group != "" {
+		group, err := user.LookupGroup(config.Group)
+		if err != nil {
+			return err
+		}
+		gid, _ = strconv.Atoi(group.Gid)
+	}
+	// The Go runtime applies these to every thread of the process.
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid %d: %w", uid, err)
+	}
+	return nil
+}
+
+// checkWritable makes sure the user switched to can still write where the
+// daemon keeps its files; access checks the real user, which is now it.
+func checkWritable(config Config) error {
+	dirs := writtenDirectories(config)
+	for _, dir := range sortedKeys(dirs) {
+		if err := unix.Access(dir, unix.W_OK); err != nil {
+			return fmt.Errorf("user %s cannot write to %s, needed for %s: %w", config.Privileges.User, dir, dirs[dir], err)
+		}
+	}
+	return nil
+}
+
+// reducePrivileges switches to the configured user and installs the seccomp
+// filter. It runs once the GPUs, log file and listeners are set up.
+func reducePrivileges(config Config) error {
+	if config.Privileges.User != "" {
+		if os.Geteuid() != 0 {
+			logWarnf("Not running as root, ignoring privileges.user.")
+		} else if err := dropUser(config.Privileges); err != nil {
+			return fmt.Errorf("failed to switch to user %s: %w", config.Privileges.User, err)
+		} else {
+			logInfof("Switched to user %s (uid %d, gid %d).", config.Privileges.User, os.Getuid(), os.Getgid())
+			if err := checkWritable(config); err != nil {
+				return err
+			}
+		}
+	}
+	if config.Privileges.Seccomp {
+		if err := applySeccomp(config); err != nil {
+			return err
+		}
+		logInfof("Seccomp filter installed.")
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux || !(amd64 || arm64)
+
+package main
+
+import "fmt"
+
+func reducePrivileges(config Config) error {
+	if config.Privileges.User != "" || config.Privileges.Seccomp {
+		return fmt.Errorf("privileges are only supported on Linux on amd64 and arm64")
+	}
+	return nil
+}
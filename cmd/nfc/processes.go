@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// ProcessProfileConfig switches a GPU to profile while process, the name of
+// an executable such as "blender" or "python3", runs on it.
+type ProcessProfileConfig struct {
+	Process string `json:"process"`
+	Profile string `json:"profile"`
+}
+
+func validateProcessProfiles(config Config) error {
+	if config.ProcessCheckSeconds < 0 {
+		return fmt.Errorf("process_check_seconds (%g) is negative", config.ProcessCheckSeconds)
+	}
+	for i, rule := range config.ProcessProfiles {
+		if rule.Process == "" {
+			return fmt.Errorf("process_profiles[%d]: process is empty", i)
+		}
+		if _, ok := config.Profiles[rule.Profile]; !ok {
+			return fmt.Errorf("process_profiles[%d]: profile %q is not defined in profiles", i, rule.Profile)
+		}
+	}
+	return nil
+}
+
+// processBase strips the directory and a .exe suffix from the name NVML
+// reports, which is a full path on Linux and Windows alike.
+func processBase(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	if len(name) > 4 && strings.EqualFold(name[len(name)-4:], ".exe") {
+		name = name[:len(name)-4]
+	}
+	return name
+}
+
+// runningProcesses lists the names of the compute and graphics processes
+// on the GPU.
+func runningProcesses(monitor *DeviceMonitor) ([]string, nvml.Return) {
+	compute, ret := gpuBackend.DeviceGetComputeRunningProcesses(monitor.Handle)
+	if ret != nvml.SUCCESS {
+		return nil, ret
+	}
+	// Graphics processes are not reported on every board.
+	graphics, _ := gpuBackend.DeviceGetGraphicsRunningProcesses(monitor.Handle)
+	names := []string{}
+	for _, process := range append(compute, graphics...) {
+		if name, ret := gpuBackend.SystemGetProcessName(int(process.Pid)); ret == nvml.SUCCESS {
+			names = append(names, processBase(name))
+		}
+	}
+	return names, nvml.SUCCESS
+}
+
+// matchProcessProfile returns the first rule with a process running on the
+// GPU, or an empty rule.
+func matchProcessProfile(rules []ProcessProfileConfig, names []string) ProcessProfileConfig {
+	for _, rule := range rules {
+		for _, name := range names {
+			if strings.EqualFold(name, processBase(rule.Process)) {
+				return rule
+			}
+		}
+	}
+	return ProcessProfileConfig{}
+}
+
+// monitorProfile is the profile the monitor follows: the one of a matching
+// process, or else the daemon's.
+func (d *Daemon) monitorProfile(monitor *DeviceMonitor) ProfileConfig {
+	if monitor.ProcessProfile != "" {
+		return activeProfile(d.Config, monitor.ProcessProfile)
+	}
+	return activeProfile(d.Config, d.Profile)
+}
+
+// checkProcesses switches the GPU to the profile of the first configured
+// process running on it, and back once none runs anymore. It runs on the
+// GPU's worker every process_check_seconds.
+func (d *Daemon) checkProcesses(monitor *DeviceMonitor) {
+	if monitor.HWMon != "" || (len(d.Config.ProcessProfiles) == 0 && monitor.ProcessProfile == "") {
+		return
+	}
+	now := clock()
+	if now.Before(monitor.NextProcessCheck) {
+		return
+	}
+	monitor.NextProcessCheck = now.Add(time.Duration(d.Config.ProcessCheckSeconds * float64(time.Second)))
+	names, ret := runningProcesses(monitor)
+	if ret != nvml.SUCCESS {
+		countError(monitor, "get_processes")
+		logFields{"gpu_index": monitor.Index, "nvml_error": nvml.ErrorString(ret)}.Debugf("Failed to list the processes on GPU %d: %v", monitor.Index, nvml.ErrorString(ret))
+		return
+	}
+	rule := matchProcessProfile(d.Config.ProcessProfiles, names)
+	if rule.Profile == monitor.ProcessProfile {
+		return
+	}
+	fields := logFields{"gpu_index": monitor.Index, "process": rule.Process, "profile": rule.Profile}
+	if rule.Profile != "" {
+		fields.Infof("%s is running on GPU %d, switching it to profile %q.", rule.Process, monitor.Index, rule.Profile)
+	} else {
+		fields["profile"] = d.Profile
+		fields.Infof("No configured process runs on GPU %d anymore, switching it back to profile %q.", monitor.Index, d.Profile)
+	}
+	monitor.ProcessProfile = rule.Profile
+	bindDeviceConfig(d.monitorProfile(monitor), monitor)
+	monitor.Interval = 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// FanVerifyConfig sets how the speeds written to the fans are checked. A
+// fan more than tolerance percent off its setpoint for cycles updates in a
+// row gets it written again; alert_after such re-applies in a row, with no
+// good reading in between, raise an alert.
+type FanVerifyConfig struct {
+	Tolerance int `json:"tolerance"`
+	Cycles int `json:"cycles"`
+	AlertAfter int `json:"alert_after"`
+}
+
+func applyFanVerifyDefaults(config *FanVerifyConfig) {
+	// The default tolerance allows for boards that report the actual duty,
+	// which trails the target while the fan ramps.
+	if config.Tolerance <= 0 {
+		config.Tolerance = 5
+	}
+	if config.Cycles <= 0 {
+		config.Cycles = 2
+	}
+	if config.AlertAfter <= 0 {
+		config.AlertAfter = 3
+	}
+}
+
+func validateFanVerify(config FanVerifyConfig) error {
+	if config.Tolerance >= 100 {
+		return fmt.Errorf("tolerance (%d) must be below 100", config.Tolerance)
+	}
+	return nil
+}
+
+// readFanSetpoint reads the speed the driver is driving a fan towards. It
+// falls back to the reported duty on boards without a target speed.
+func readFanSetpoint(monitor *DeviceMonitor, fanIdx int) (int, nvml.Return) {
+	if !monitor.TargetSpeedUnsupported {
+		speed, ret := gpuBackend.DeviceGetTargetFanSpeed(monitor.Handle, fanIdx)
+		if !unsupported(ret) {
+			return speed, ret
+		}
+		monitor.TargetSpeedUnsupported = true
+		logFields{"gpu_index": monitor.Index}.Debugf("GPU %d does not report target fan speeds, checking the reported duty instead.", monitor.Index)
+	}
+	return device.ReadFanSpeed(gpuBackend, monitor.Handle, monitor.FanAPI, fanIdx)
+}
+
+// readFanPolicy reads the control policy of a fan, and fails at once on
+// boards without one.
+func readFanPolicy(monitor *DeviceMonitor, fanIdx int) (nvml.FanControlPolicy, nvml.Return) {
+	if monitor.FanAPI.NoPolicy {
+		return 0, nvml.ERROR_NOT_SUPPORTED
+	}
+	return gpuBackend.DeviceGetFanControlPolicy_v2(monitor.Handle, fanIdx)
+}
+
+// reconcileFans reads back the policy and speed of every fan the daemon has
+// set, and forces it to be written again when something else, such as
+// nvidia-settings or a driver reset, changed it, or when the board silently
+// ignored the write. Otherwise the skipping of unchanged speeds would leave
+// the fan where the other party put it.
+func reconcileFans(monitor *DeviceMonitor) {
+	if monitor.DryRun || monitor.HWMon != "" || monitor.FailSafeActive {
+		return
+	}
+	config := monitor.FanVerify
+	for fanIdx := 0; fanIdx < monitor.NumFans; fanIdx++ {
+		commanded := monitor.CurrentFanSpeeds[fanIdx]
+		if !monitor.FanControlled[fanIdx] || commanded < 0 {
+			continue
+		}
+		fields := logFields{"gpu_index": monitor.Index, "fan_index": fanIdx, "commanded_speed": commanded}
+		if policy, ret := readFanPolicy(monitor, fanIdx); ret == nvml.SUCCESS && policy != nvml.FAN_POLICY_MANUAL {
+			fields.Warnf("GPU %d Fan %d was handed back to automatic control behind our back, taking it over again.", monitor.Index, fanIdx)
+			monitor.CurrentFanSpeeds[fanIdx] = -1
+			monitor.FanMismatches[fanIdx] = 0
+			continue
+		}
+		speed, ret := readFanSetpoint(monitor, fanIdx)
+		if ret != nvml.SUCCESS {
+			monitor.FanMismatches[fanIdx] = 0
+			continue
+		}
+		if abs(speed-commanded) <= config.Tolerance {
+			if monitor.FanReapplies[fanIdx] >= config.AlertAfter {
+				fields.Infof("GPU %d Fan %d holds its %d%% setpoint again.", monitor.Index, fanIdx, commanded)
+				alerts.emit(monitor, eventFanSetpoint, true, "fan %d holds its %d%% setpoint again", fanIdx, commanded)
+			}
+			monitor.FanMismatches[fanIdx] = 0
+			monitor.FanReapplies[fanIdx] = 0
+			continue
+		}
+		// One reading off could be a fan still ramping; several in a row
+		// are a change made elsewhere or a write the board dropped.
+		monitor.FanMismatches[fanIdx]++
+		if monitor.FanMismatches[fanIdx] < config.Cycles {
+			continue
+		}
+		fields["reported_speed"] = speed
+		fields.Warnf("GPU %d Fan %d reports %d%% instead of the %d%% set, applying it again.", monitor.Index, fanIdx, speed, commanded)
+		monitor.CurrentFanSpeeds[fanIdx] = -1
+		monitor.FanMismatches[fanIdx] = 0
+		monitor.FanReapplies[fanIdx]++
+		monitor.FanReappliesTotal[fanIdx]++
+		if monitor.FanReapplies[fanIdx] == config.AlertAfter {
+			fields.Errorf("GPU %d Fan %d ignored its %d%% setpoint %d times in a row.", monitor.Index, fanIdx, commanded, config.AlertAfter)
+			alerts.emit(monitor, eventFanSetpoint, false, "fan %d ignored its %d%% setpoint %d times in a row, reporting %d%%", fanIdx, commanded, config.AlertAfter, speed)
+		}
+	}
+}
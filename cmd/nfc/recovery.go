@@ -0,0 +1,92 @@
+package main
+
+import (
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// retryNVML runs call until it succeeds or fails with a non-transient error,
+// backing off exponentially. The retries of one call may take up to a
+// quarter of the GPU's update interval, and never more than a second.
+func retryNVML(monitor *DeviceMonitor, call func() nvml.Return) nvml.Return {
+	budget := time.Duration(monitor.Settings.TimeToUpdate * float64(time.Second) / 4)
+	if budget > time.Second {
+		budget = time.Second
+	}
+	return device.Retry(budget, call, func(class string) {
+		if monitor.ErrorClasses == nil {
+			monitor.ErrorClasses = map[string]int{}
+		}
+		monitor.ErrorClasses[class]++
+	})
+}
+
+// checkNVMLLost marks the monitor when an error means its handle, or the
+// whole NVML session, is no longer valid, as after a driver reload, a GPU
+// reset or a resume from suspend.
+func checkNVMLLost(monitor *DeviceMonitor, ret nvml.Return) {
+	if device.Classify(ret) != device.ErrorLost {
+		return
+	}
+	if !monitor.Lost {
+		logFields{"gpu_index": monitor.Index, "nvml_error": nvml.ErrorString(ret)}.Warnf("GPU %d: %v, reinitializing NVML.", monitor.Index, nvml.ErrorString(ret))
+		alerts.emit(monitor, eventDeviceLost, false, "%v", nvml.ErrorString(ret))
+	}
+	monitor.Lost = true
+}
+
+func (d *Daemon) lostDevice() bool {
+	for i := range d.Monitors {
+		if d.Monitors[i].Lost {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverNVML restarts the NVML session and looks the monitored GPUs up
+// again by UUID. Their curve state is kept, but every fan is written again
+// since the driver will have reset them to automatic control. It returns
+// false while NVML cannot be initialized, and is retried on the next tick.
+func (d *Daemon) recoverNVML() bool {
+	gpuBackend.Shutdown()
+	if ret := gpuBackend.Init(); ret != nvml.SUCCESS {
+		if !d.nvmlDown {
+			logErrorf("Unable to reinitialize NVML: %v. Retrying.", nvml.ErrorString(ret))
+		}
+		d.nvmlDown = true
+		return false
+	}
+	monitors := d.Monitors[:0]
+	for i := range d.Monitors {
+		monitor := &d.Monitors[i]
+		if monitor.HWMon != "" {
+			monitors = append(monitors, *monitor)
+			continue
+		}
+		device, ret := gpuBackend.DeviceGetHandleByUUID(monitor.UUID)
+		if ret != nvml.SUCCESS {
+			logFields{"gpu_index": monitor.Index, "gpu_uuid": monitor.UUID, "nvml_error": nvml.ErrorString(ret)}.Warnf("GPU %d (%s) did not come back: %v. Dropping it until it is attached again.", monitor.Index, monitor.UUID, nvml.ErrorString(ret))
+			continue
+		}
+		monitor.Handle = device
+		if monitor.Lost {
+			alerts.emit(monitor, eventDeviceLost, true, "recovered after reinitializing NVML")
+		}
+		monitor.Lost = false
+		monitor.ConsecutiveFailures = 0
+		// A restarted driver starts with persistence mode off.
+		monitor.RestorePersistence = false
+		enablePersistenceMode(d.Config.PersistenceMode, monitor)
+		for fanIdx := range monitor.CurrentFanSpeeds {
+			monitor.CurrentFanSpeeds[fanIdx] = -1
+		}
+		monitors = append(monitors, *monitor)
+	}
+	d.Monitors = monitors
+	d.nvmlDown = false
+	logInfof("NVML reinitialized, controlling %d GPU(s).", len(d.Monitors))
+	d.resetTicker()
+	return true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	speedUnitPercent = "percent"
+	speedUnitRPM = "rpm"
+	// maxTargetRPM bounds the fan_speed of an rpm curve.
+	maxTargetRPM = 20000
+	// rpmMaxStep is how far the duty may move in one update while it
+	// chases a target RPM, so a noisy tachometer cannot make it swing.
+	rpmMaxStep = 10
+)
+
+func validateSpeedUnit(config ControlConfig) error {
+	switch config.SpeedUnit {
+	case "", speedUnitPercent:
+	case speedUnitRPM:
+		if config.CurveMode == "pid" {
+			return fmt.Errorf("speed_unit rpm does not apply to curve_mode pid, which sets the duty itself")
+		}
+	default:
+		return fmt.Errorf("unknown speed_unit %q, expected \"percent\" or \"rpm\"", config.SpeedUnit)
+	}
+	if config.RPMTolerance < 0 {
+		return fmt.Errorf("rpm_tolerance (%d) is negative", config.RPMTolerance)
+	}
+	return nil
+}
+
+// speedLimit is the highest fan_speed the curve may ask for in its unit.
+func speedLimit(config ControlConfig) int {
+	if config.SpeedUnit == speedUnitRPM {
+		return maxTargetRPM
+	}
+	return 100
+}
+
+// curveSpeed is the speed the curve's hysteresis and dwell compare against:
+// the target RPM in rpm mode, the base duty otherwise.
+func curveSpeed(monitor *DeviceMonitor) int {
+	if monitor.Settings.SpeedUnit == speedUnitRPM {
+		return monitor.TargetRPM
+	}
+	return monitor.BaseFanSpeed
+}
+
+// rpmDuty turns a target RPM into the duty to command, closing the loop on
+// the first fan's tachometer: the duty is left alone while the measured RPM
+// is within rpm_tolerance of the target, and otherwise scaled by how far off
+// it is, at most rpmMaxStep at a time. Without a reading it falls back to
+// the calibration, if any.
+func rpmDuty(monitor *DeviceMonitor, target int) int {
+	if target <= 0 {
+		return 0
+	}
+	duty := monitor.CurrentFanSpeeds[0]
+	measured := monitor.FanRPMs[0]
+	if measured < 0 {
+		fallback := "holding the duty"
+		if monitor.Calibration != nil {
+			fallback, duty = "using the calibration", monitor.Calibration.Duty(target)
+		}
+		if !monitor.RPMUnreadable {
+			monitor.RPMUnreadable = true
+			logFields{"gpu_index": monitor.Index}.Warnf("GPU %d: speed_unit is rpm but the fan speed cannot be read, %s.", monitor.Index, fallback)
+		}
+		return duty
+	}
+	monitor.RPMUnreadable = false
+	if int(math.Abs(float64(target-measured))) <= monitor.Settings.RPMTolerance {
+		return duty
+	}
+	estimate := duty + rpmMaxStep
+	switch {
+	case measured > 0 && duty > 0:
+		// Fan speed grows roughly linearly with duty above the stall point.
+		estimate = int(math.Round(float64(duty) * float64(target) / float64(measured)))
+	case monitor.Calibration != nil:
+		estimate = monitor.Calibration.Duty(target)
+	}
+	if target > measured {
+		estimate = min(max(estimate, duty+1), duty+rpmMaxStep)
+	} else {
+		estimate = max(min(estimate, duty-1), duty-rpmMaxStep)
+	}
+	return clampFanSpeed(estimate)
+}
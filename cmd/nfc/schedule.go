@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ScheduleConfig struct {
+	Start string `json:"start"`
+	End string `json:"end"`
+	Days []string `json:"days"`
+	MaxFanSpeed int `json:"max_fan_speed"`
+	Profile string `json:"profile"`
+	PanicTemperature int `json:"panic_temperature"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func validateSchedules(config Config) error {
+	for i, schedule := range config.Schedules {
+		if _, err := parseClock(schedule.Start); err != nil {
+			return fmt.Errorf("schedules[%d]: start: %w", i, err)
+		}
+		if _, err := parseClock(schedule.End); err != nil {
+			return fmt.Errorf("schedules[%d]: end: %w", i, err)
+		}
+		for _, day := range schedule.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("schedules[%d]: unknown day %q, expected mon, tue, wed, thu, fri, sat or sun", i, day)
+			}
+		}
+		if schedule.MaxFanSpeed < 0 || schedule.MaxFanSpeed > 100 {
+			return fmt.Errorf("schedules[%d]: max_fan_speed (%d) is outside 0-100", i, schedule.MaxFanSpeed)
+		}
+		if _, ok := config.Profiles[schedule.Profile]; schedule.Profile != "" && !ok {
+			return fmt.Errorf("schedules[%d]: profile %q is not defined in profiles", i, schedule.Profile)
+		}
+		if schedule.MaxFanSpeed == 0 && schedule.Profile == "" {
+			return fmt.Errorf("schedules[%d]: neither max_fan_speed nor profile is set", i)
+		}
+	}
+	return nil
+}
+
+// scheduleActive reports whether now falls into the window. A window whose
+// end is not after its start runs past midnight, and its days refer to the
+// day it started on.
+func scheduleActive(schedule ScheduleConfig, now time.Time) bool {
+	start, _ := parseClock(schedule.Start)
+	end, _ := parseClock(schedule.End)
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	day := now.Weekday()
+	inside := clock >= start && clock < end
+	if end <= start {
+		inside = clock >= start || clock < end
+		if clock < end {
+			day = (day + 6) % 7
+		}
+	}
+	if !inside || len(schedule.Days) == 0 {
+		return inside
+	}
+	for _, name := range schedule.Days {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// applySchedule activates the first schedule matching now. Its profile is
+// switched to when the window opens and the previous profile restored when
+// it closes.
+func (d *Daemon) applySchedule(now time.Time) {
+	active := -1
+	for i, schedule := range d.Config.Schedules {
+		if scheduleActive(schedule, now) {
+			active = i
+			break
+		}
+	}
+	if active != d.activeSchedule {
+		if d.activeSchedule >= 0 && d.activeSchedule < len(d.Config.Schedules) && d.Config.Schedules[d.activeSchedule].Profile != "" {
+			if err := d.SetProfile(d.profileBeforeSchedule); err != nil {
+				logWarnf("Schedule ended but profile %q could not be restored: %v", d.profileBeforeSchedule, err)
+			}
+		}
+		if active >= 0 {
+			schedule := d.Config.Schedules[active]
+			logInfof("Schedule %s-%s started.", schedule.Start, schedule.End)
+			if schedule.Profile != "" {
+				d.profileBeforeSchedule = d.Profile
+				if err := d.SetProfile(schedule.Profile); err != nil {
+					logWarnf("Schedule %s-%s: %v", schedule.Start, schedule.End, err)
+				}
+			}
+		} else {
+			logInfof("Schedule ended.")
+		}
+		d.activeSchedule = active
+	}
+	speedCap, panicTemperature := 0, 0
+	if active >= 0 {
+		speedCap, panicTemperature = d.Config.Schedules[active].MaxFanSpeed, d.Config.Schedules[active].PanicTemperature
+	}
+	for i := range d.Monitors {
+		d.Monitors[i].SpeedCap = speedCap
+		d.Monitors[i].PanicTemperature = panicTemperature
+	}
+}
+
+// applySpeedCap limits the speeds to the schedule's cap unless the GPU is at
+// or above the panic temperature.
+func applySpeedCap(monitor *DeviceMonitor, speeds []int) {
+	if monitor.SpeedCap <= 0 || (monitor.PanicTemperature > 0 && monitor.Temperature >= monitor.PanicTemperature) {
+		return
+	}
+	for fanIdx := range speeds {
+		if speeds[fanIdx] > monitor.SpeedCap {
+			speeds[fanIdx] = monitor.SpeedCap
+		}
+	}
+}
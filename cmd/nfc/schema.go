@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaKey may name the JSON Schema of a config file, for editors; it is
+// the only key the config accepts that has no setting behind it.
+const schemaKey = "$schema"
+
+type jsonField struct {
+	Name string
+	Type reflect.Type
+}
+
+// jsonFields lists the keys encoding/json decodes into a struct, with the
+// fields of embedded structs promoted unless an outer field has their name.
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+	embedded := []reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{Name: name, Type: field.Type})
+	}
+	for _, inner := range embedded {
+		for _, field := range jsonFields(inner) {
+			if findJSONField(fields, field.Name) == nil {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// findJSONField matches a key like encoding/json does: exactly, or else
+// ignoring case.
+func findJSONField(fields []jsonField, key string) *jsonField {
+	for i := range fields {
+		if fields[i].Name == key {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].Name, key) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// closestField suggests the field a typo'd key was probably meant to be.
+func closestField(fields []jsonField, key string) string {
+	best, bestDistance := "", max(2, len(key)/3)+1
+	for _, field := range fields {
+		if distance := editDistance(strings.ToLower(key), field.Name); distance < bestDistance {
+			best, bestDistance = field.Name, distance
+		}
+	}
+	return best
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// unknownFields walks a decoded config value along the type it is decoded
+// into and lists every key that would be dropped, with its path.
+func unknownFields(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	v := reflect.ValueOf(value)
+	if value == nil {
+		return nil
+	}
+	problems := []string{}
+	switch t.Kind() {
+	case reflect.Struct:
+		if v.Kind() != reflect.Map {
+			return nil
+		}
+		fields := jsonFields(t)
+		keys := []string{}
+		for _, key := range v.MapKeys() {
+			keys = append(keys, fmt.Sprint(key.Interface()))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if path == "" && key == schemaKey {
+				continue
+			}
+			field := findJSONField(fields, key)
+			if field == nil {
+				problem := fmt.Sprintf("unknown field %q", joinPath(path, key))
+				if suggestion := closestField(fields, key); suggestion != "" {
+					problem += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				problems = append(problems, problem)
+				continue
+			}
+			problems = append(problems, unknownFields(v.MapIndex(reflect.ValueOf(key)).Interface(), field.Type, joinPath(path, key))...)
+		}
+	case reflect.Map:
+		if v.Kind() != reflect.Map {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			problems = append(problems, unknownFields(v.MapIndex(key).Interface(), t.Elem(), joinPath(path, fmt.Sprint(key.Interface())))...)
+		}
+		sort.Strings(problems)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() != reflect.Slice {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			problems = append(problems, unknownFields(v.Index(i).Interface(), t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return problems
+}
+
+// checkConfigFields rejects the keys of a decoded config that match no
+// setting, which are usually typos that would otherwise be ignored.
+func checkConfigFields(generic map[string]interface{}) error {
+	if problems := unknownFields(generic, reflect.TypeOf(Config{}), ""); len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// configDecodeError points a decoding error at the line or the setting it
+// is about.
+func configDecodeError(data []byte, err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		line := 1 + strings.Count(string(data[:min(int(syntaxError.Offset), len(data))]), "\n")
+		return fmt.Errorf("line %d: %w", line, err)
+	case errors.As(err, &typeError) && typeError.Field != "":
+		return fmt.Errorf("%s: expected %s, got %s", typeError.Field, schemaType(typeError.Type), typeError.Value)
+	}
+	return err
+}
+
+// schemaType names the JSON type a Go type is decoded from.
+func schemaType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return ""
+}
+
+// typeSchema describes t, with every named struct in defs so that types
+// used in several places, such as ControlConfig, are described once.
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	}
+	if name := schemaType(t); name != "" {
+		return map[string]interface{}{"type": name}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, field := range jsonFields(t) {
+		properties[field.Name] = typeSchema(field.Type, defs)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// configSchema is the JSON Schema of the config file.
+func configSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	schema := structSchema(reflect.TypeOf(Config{}), defs)
+	schema["properties"].(map[string]interface{})[schemaKey] = map[string]interface{}{"type": "string"}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "nvidia-fan-control configuration"
+	schema["$defs"] = defs
+	return schema
+}
+
+func cmdSchema(args []string) {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	output := flags.String("o", "", "write the schema to this file instead of stdout")
+	flags.Parse(args)
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		exitf("%v", err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		exitf("%v", err)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+type SmoothingConfig struct {
+	Method string `json:"method"`
+	Samples int `json:"samples"`
+}
+
+type PowerPoint struct {
+	Watts int `json:"watts"`
+	FanSpeed int `json:"fan_speed"`
+}
+
+type UtilizationBoostConfig struct {
+	Threshold int `json:"threshold"`
+	Seconds float64 `json:"seconds"`
+	MinFanSpeed int `json:"min_fan_speed"`
+}
+
+type SensorInput struct {
+	Sensor string `json:"sensor"`
+	Weight float64 `json:"weight"`
+}
+
+func validateSensor(sensor string) error {
+	switch sensor {
+	case "", device.SensorGPU, device.SensorMemory:
+		return nil
+	case "hotspot":
+		return fmt.Errorf("sensor \"hotspot\" is not exposed by NVML, use \"gpu\" or \"memory\"")
+	default:
+		return fmt.Errorf("unknown sensor %q, expected \"gpu\" or \"memory\"", sensor)
+	}
+}
+
+func validateSensors(config ControlConfig) error {
+	if err := validateSensor(config.Sensor); err != nil {
+		return err
+	}
+	if len(config.Sensors) == 0 {
+		if config.SensorAggregation != "" {
+			return fmt.Errorf("sensor_aggregation is set but no sensors are listed")
+		}
+		return nil
+	}
+	if config.Sensor != "" {
+		return fmt.Errorf("set either sensor or sensors, not both")
+	}
+	switch config.SensorAggregation {
+	case "", "max", "min", "average":
+	default:
+		return fmt.Errorf("unknown sensor_aggregation %q, expected \"max\", \"min\" or \"average\"", config.SensorAggregation)
+	}
+	for i, input := range config.Sensors {
+		if input.Sensor == "" {
+			return fmt.Errorf("sensors[%d]: no sensor given", i)
+		}
+		if err := validateSensor(input.Sensor); err != nil {
+			return fmt.Errorf("sensors[%d]: %w", i, err)
+		}
+		if input.Weight < 0 {
+			return fmt.Errorf("sensors[%d]: weight (%g) is negative", i, input.Weight)
+		}
+	}
+	return nil
+}
+
+// readControlTemperature reads every configured sensor and combines them
+// into the temperature the curve sees. A sensor that fails is left out as
+// long as another one could be read.
+func readControlTemperature(monitor *DeviceMonitor) (int, nvml.Return) {
+	inputs := monitor.Settings.Sensors
+	if len(inputs) == 0 {
+		inputs = []SensorInput{{Sensor: monitor.Settings.Sensor}}
+	}
+	readings := map[string]int{}
+	total, totalWeight := 0.0, 0.0
+	result, lastRet := 0, nvml.SUCCESS
+	for _, input := range inputs {
+		name := sensorName(input.Sensor)
+		temp, ret := readSensor(monitor, input.Sensor)
+		if ret != nvml.SUCCESS {
+			lastRet = ret
+			if len(inputs) > 1 {
+				countError(monitor, "get_temperature")
+				logFields{"gpu_index": monitor.Index, "sensor": name, "nvml_error": nvml.ErrorString(ret)}.Warnf("Failed to get %s temperature for device %d: %v", name, monitor.Index, nvml.ErrorString(ret))
+			}
+			continue
+		}
+		weight := input.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		switch {
+		case len(readings) == 0:
+			result = temp
+		case monitor.Settings.SensorAggregation == "min" && temp < result:
+			result = temp
+		case monitor.Settings.SensorAggregation != "min" && temp > result:
+			result = temp
+		}
+		readings[name] = temp
+		total += float64(temp) * weight
+		totalWeight += weight
+	}
+	if len(readings) == 0 {
+		return 0, lastRet
+	}
+	if monitor.Settings.SensorAggregation == "average" {
+		result = int(math.Round(total / totalWeight))
+	}
+	monitor.SensorTemperatures = readings
+	return result, nvml.SUCCESS
+}
+
+func sensorName(sensor string) string {
+	if sensor == "" {
+		return device.SensorGPU
+	}
+	return sensor
+}
+
+// describeSensors names the sensor setup, e.g. "gpu" or "max(gpu,memory)".
+func describeSensors(config ControlConfig) string {
+	if len(config.Sensors) == 0 {
+		return sensorName(config.Sensor)
+	}
+	aggregation := config.SensorAggregation
+	if aggregation == "" {
+		aggregation = "max"
+	}
+	names := make([]string, 0, len(config.Sensors))
+	for _, input := range config.Sensors {
+		if aggregation == "average" && input.Weight != 0 && input.Weight != 1 {
+			names = append(names, fmt.Sprintf("%s*%g", input.Sensor, input.Weight))
+			continue
+		}
+		names = append(names, input.Sensor)
+	}
+	return aggregation + "(" + strings.Join(names, ",") + ")"
+}
+
+func validateSmoothing(config SmoothingConfig) error {
+	switch config.Method {
+	case "":
+		return nil
+	case "ema", "median":
+	default:
+		return fmt.Errorf("smoothing: unknown method %q, expected \"ema\" or \"median\"", config.Method)
+	}
+	if config.Samples < 0 {
+		return fmt.Errorf("smoothing: samples (%d) is negative", config.Samples)
+	}
+	return nil
+}
+
+// smoothTemperature feeds a raw reading into the monitor's smoothing window
+// and returns the value the curve should see.
+func smoothTemperature(monitor *DeviceMonitor, raw int) int {
+	config := monitor.Settings.Smoothing
+	samples := config.Samples
+	if samples <= 0 {
+		samples = 5
+	}
+	switch config.Method {
+	case "ema":
+		alpha := 2 / float64(samples+1)
+		if len(monitor.TemperatureSamples) == 0 {
+			monitor.SmoothedTemperature = float64(raw)
+		} else {
+			monitor.SmoothedTemperature += alpha * (float64(raw) - monitor.SmoothedTemperature)
+		}
+		monitor.TemperatureSamples = []int{raw}
+		return int(math.Round(monitor.SmoothedTemperature))
+	case "median":
+		monitor.TemperatureSamples = append(monitor.TemperatureSamples, raw)
+		if len(monitor.TemperatureSamples) > samples {
+			monitor.TemperatureSamples = monitor.TemperatureSamples[len(monitor.TemperatureSamples)-samples:]
+		}
+		sorted := append([]int(nil), monitor.TemperatureSamples...)
+		sort.Ints(sorted)
+		middle := len(sorted) / 2
+		if len(sorted)%2 == 0 {
+			return int(math.Round(float64(sorted[middle-1]+sorted[middle]) / 2))
+		}
+		return sorted[middle]
+	default:
+		monitor.TemperatureSamples = nil
+		return raw
+	}
+}
+
+func readPower(monitor *DeviceMonitor) {
+	milliwatts, ret := uint32(0), nvml.SUCCESS
+	if monitor.HWMon != "" {
+		milliwatts, ret = hwmonPowerUsage(monitor)
+	} else if value, ok := monitor.Fields[nvml.FI_DEV_POWER_INSTANT]; ok {
+		milliwatts = uint32(device.FieldValueInt(value))
+	} else {
+		milliwatts, ret = gpuBackend.DeviceGetPowerUsage(monitor.Handle)
+	}
+	if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+		monitor.PowerWatts = -1
+		return
+	}
+	if ret != nvml.SUCCESS {
+		countError(monitor, "get_power")
+		monitor.PowerWatts = -1
+		return
+	}
+	monitor.PowerWatts = int(math.Round(float64(milliwatts) / 1000))
+}
+
+func powerCurve(points []PowerPoint) []CurvePoint {
+	curve := make([]CurvePoint, len(points))
+	for i, p := range points {
+		curve[i] = CurvePoint{Temperature: p.Watts, FanSpeed: p.FanSpeed}
+	}
+	return curve
+}
+
+func validatePowerPoints(points []PowerPoint) error {
+	for i, p := range points {
+		if p.FanSpeed < 0 || p.FanSpeed > 100 {
+			return fmt.Errorf("power_points[%d]: fan_speed (%d) is outside 0-100", i, p.FanSpeed)
+		}
+		if i > 0 && p.Watts <= points[i-1].Watts {
+			return fmt.Errorf("power_points[%d]: watts (%d) must be greater than the previous point (%d)", i, p.Watts, points[i-1].Watts)
+		}
+	}
+	return nil
+}
+
+// powerFloor is the minimum speed the power curve asks for, so the fans
+// spin up as soon as a heavy job starts instead of waiting for the heat.
+func powerFloor(monitor *DeviceMonitor) int {
+	if len(monitor.Settings.PowerPoints) == 0 || monitor.PowerWatts < 0 {
+		return 0
+	}
+	return curve.Interpolate(monitor.PowerWatts, powerCurve(monitor.Settings.PowerPoints))
+}
+
+func readUtilization(monitor *DeviceMonitor) {
+	utilization, ret := 0, nvml.SUCCESS
+	if monitor.HWMon != "" {
+		utilization, ret = hwmonUtilization(monitor)
+	} else {
+		var rates nvml.Utilization
+		rates, ret = gpuBackend.DeviceGetUtilizationRates(monitor.Handle)
+		utilization = int(rates.Gpu)
+	}
+	if ret != nvml.SUCCESS {
+		if ret != nvml.ERROR_NOT_SUPPORTED && ret != nvml.ERROR_FUNCTION_NOT_FOUND {
+			countError(monitor, "get_utilization")
+		}
+		monitor.Utilization = -1
+		monitor.BusySince = time.Time{}
+		return
+	}
+	monitor.Utilization = utilization
+	threshold := monitor.Settings.UtilizationBoost.Threshold
+	if threshold <= 0 || monitor.Utilization < threshold {
+		monitor.BusySince = time.Time{}
+	} else if monitor.BusySince.IsZero() {
+		monitor.BusySince = clock()
+	}
+}
+
+func validateUtilizationBoost(config UtilizationBoostConfig) error {
+	if config.MinFanSpeed == 0 {
+		return nil
+	}
+	if config.Threshold <= 0 || config.Threshold > 100 {
+		return fmt.Errorf("utilization_boost: threshold (%d) is outside 1-100", config.Threshold)
+	}
+	if config.MinFanSpeed < 0 || config.MinFanSpeed > 100 {
+		return fmt.Errorf("utilization_boost: min_fan_speed (%d) is outside 0-100", config.MinFanSpeed)
+	}
+	if config.Seconds < 0 {
+		return fmt.Errorf("utilization_boost: seconds (%g) is negative", config.Seconds)
+	}
+	return nil
+}
+
+// utilizationFloor raises the minimum speed once the GPU has been busy for
+// long enough, ahead of the temperature rise.
+func utilizationFloor(monitor *DeviceMonitor) int {
+	config := monitor.Settings.UtilizationBoost
+	if config.MinFanSpeed <= 0 || monitor.BusySince.IsZero() {
+		return 0
+	}
+	if clock().Sub(monitor.BusySince) < time.Duration(config.Seconds*float64(time.Second)) {
+		return 0
+	}
+	return config.MinFanSpeed
+}
+
+// TrendConfig ramps the fans ahead of a fast rise: while the control
+// temperature climbs faster than rate °C/s, the curve is read at the
+// temperature expected lookahead_seconds from now and boost is added on top.
+type TrendConfig struct {
+	Rate float64 `json:"rate"`
+	LookaheadSeconds float64 `json:"lookahead_seconds"`
+	Boost int `json:"boost"`
+}
+
+func validateTrend(config TrendConfig) error {
+	if config.Rate < 0 {
+		return fmt.Errorf("trend: rate (%g) is negative", config.Rate)
+	}
+	if config.LookaheadSeconds < 0 {
+		return fmt.Errorf("trend: lookahead_seconds (%g) is negative", config.LookaheadSeconds)
+	}
+	if config.Boost < 0 || config.Boost > 100 {
+		return fmt.Errorf("trend: boost (%d) is outside 0-100", config.Boost)
+	}
+	return nil
+}
+
+// updateTrend feeds the control temperature into the monitor's rate of
+// change, averaged over a few readings so a single 1°C step does not count
+// as a ramp.
+func updateTrend(monitor *DeviceMonitor) {
+	now := clock()
+	if !monitor.TrendTime.IsZero() {
+		if elapsed := now.Sub(monitor.TrendTime).Seconds(); elapsed > 0 {
+			rate := float64(monitor.Temperature-monitor.TrendTemperature) / elapsed
+			monitor.TemperatureRate += 0.5 * (rate - monitor.TemperatureRate)
+		}
+	}
+	monitor.TrendTemperature, monitor.TrendTime = monitor.Temperature, now
+}
+
+// curveSpeedAt reads the speed for temp straight off the configured curve,
+// without hysteresis or any other state. The PID mode has no curve to read
+// and returns -1.
+func curveSpeedAt(config ControlConfig, temp int) int {
+	switch config.CurveMode {
+	case "interpolated":
+		return curve.Interpolate(temp, config.CurvePoints)
+	case "pid":
+		return -1
+	}
+	speed := -1
+	for _, r := range config.TemperatureRanges {
+		if temp >= r.MinTemperature && temp <= r.MaxTemperature {
+			speed = r.FanSpeed
+		}
+	}
+	return speed
+}
+
+// trendFloor is the minimum speed while the temperature is climbing faster
+// than the trend rate, given the speed the curve picked for now.
+func trendFloor(monitor *DeviceMonitor, speed int) int {
+	config := monitor.Settings.Trend
+	rising := config.Rate > 0 && monitor.TemperatureRate >= config.Rate
+	if rising != monitor.Trending {
+		monitor.Trending = rising
+		if rising {
+			logFields{"gpu_index": monitor.Index, "rate": monitor.TemperatureRate}.Infof("GPU %d: temperature rising %.2f°C/s, ramping ahead.", monitor.Index, monitor.TemperatureRate)
+		} else {
+			logFields{"gpu_index": monitor.Index, "rate": monitor.TemperatureRate}.Debugf("GPU %d: temperature rise slowed to %.2f°C/s.", monitor.Index, monitor.TemperatureRate)
+		}
+	}
+	if !rising {
+		return 0
+	}
+	ahead := monitor.Temperature + int(math.Round(monitor.TemperatureRate*config.LookaheadSeconds))
+	if aheadSpeed := curveSpeedAt(monitor.Settings, ahead); aheadSpeed > speed {
+		speed = aheadSpeed
+	}
+	return min(speed+config.Boost, 100)
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+	nfcv1 "github.com/jumbled00r/nvidia-fan-control/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultServerConfigFile = "/etc/nvidia-fan-control/server.json"
+
+// ServerConfig is the configuration of nfc server, the central controller
+// the daemons with a controller section report to.
+type ServerConfig struct {
+	Listen string `json:"listen"`
+	Token string `json:"token"`
+	TLS ServerTLSConfig `json:"tls"`
+	Agents []AgentRule `json:"agents"`
+}
+
+// ServerTLSConfig is the controller's certificate. With client_ca_file set,
+// agents must also present a certificate signed by it.
+type ServerTLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"`
+}
+
+// AgentRule assigns profile, and the profiles to go with it, to the agents
+// whose host matches one of hosts. The first matching rule applies.
+type AgentRule struct {
+	Hosts []string `json:"hosts"`
+	Profile string `json:"profile"`
+	Profiles map[string]json.RawMessage `json:"profiles"`
+}
+
+func loadServerConfig(file string) (ServerConfig, error) {
+	var config ServerConfig
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	generic, err := decodeConfigMap(file, data)
+	if err != nil {
+		return config, err
+	}
+	converted, err := json.Marshal(generic)
+	if err != nil {
+		return config, fmt.Errorf("failed to convert config %s: %w", file, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(converted))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, configDecodeError(nil, err)
+	}
+	if config.Listen == "" {
+		config.Listen = ":9840"
+	}
+	if err := validateServerConfig(config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func validateServerConfig(config ServerConfig) error {
+	if config.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if config.TLS.CertFile == "" || config.TLS.KeyFile == "" {
+		return fmt.Errorf("tls: cert_file and key_file are required")
+	}
+	for i, rule := range config.Agents {
+		if len(rule.Hosts) == 0 {
+			return fmt.Errorf("agents[%d]: hosts is empty", i)
+		}
+		for _, host := range rule.Hosts {
+			if _, err := filepath.Match(host, ""); err != nil {
+				return fmt.Errorf("agents[%d]: invalid host pattern %q", i, host)
+			}
+		}
+		if rule.Profile == "" && len(rule.Profiles) == 0 {
+			return fmt.Errorf("agents[%d]: neither profile nor profiles is set", i)
+		}
+		for name, profile := range rule.Profiles {
+			var generic map[string]interface{}
+			if err := json.Unmarshal(profile, &generic); err != nil {
+				return fmt.Errorf("agents[%d]: profiles.%s: %w", i, name, err)
+			}
+			if err := checkConfigFields(map[string]interface{}{"profiles": map[string]interface{}{name: generic}}); err != nil {
+				return fmt.Errorf("agents[%d]: %w", i, err)
+			}
+			var decoded ProfileConfig
+			if err := json.Unmarshal(profile, &decoded); err != nil {
+				return fmt.Errorf("agents[%d]: profiles.%s: %w", i, name, err)
+			}
+			if err := validateAssignedProfile(decoded); err != nil {
+				return fmt.Errorf("agents[%d]: profiles.%s: %w", i, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAssignedProfile checks a profile the way the daemons it is
+// assigned to will. A profile without a default takes the daemon's, which
+// the controller does not know, as do its gpus entries without a curve;
+// those are only checked by the daemon.
+func validateAssignedProfile(profile ProfileConfig) error {
+	ownDefault := profile.Default != nil
+	normalizeProfile(&profile, ControlConfig{TimeToUpdate: 2})
+	if ownDefault {
+		return validateProfile(profile)
+	}
+	for i, gpu := range profile.GPUs {
+		if err := validateGPUMatch(gpu.GPUMatch); err != nil {
+			return fmt.Errorf("gpus[%d]: %w", i, err)
+		}
+		if !hasCurve(gpu.ControlConfig) {
+			continue
+		}
+		if err := validateControlConfig(gpu.ControlConfig); err != nil {
+			return fmt.Errorf("gpus[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// assignmentFor is the assignment of the first rule matching host, or an
+// empty one, which takes back whatever the agent was assigned before. The
+// revision is a hash of the content, so an agent only applies what changed.
+func assignmentFor(config ServerConfig, host string) *nfcv1.Assignment {
+	assignment := &nfcv1.Assignment{}
+	for _, rule := range config.Agents {
+		matched := false
+		for _, pattern := range rule.Hosts {
+			if ok, _ := filepath.Match(pattern, host); ok {
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+		assignment.Profile = rule.Profile
+		if len(rule.Profiles) > 0 {
+			assignment.Profiles, _ = json.Marshal(rule.Profiles)
+		}
+		break
+	}
+	sum := sha256.Sum256(append([]byte(assignment.Profile+"\x00"), assignment.Profiles...))
+	assignment.Revision = hex.EncodeToString(sum[:6])
+	return assignment
+}
+
+// fleetServer implements the Fleet service of api/v1/fleet.proto.
+type fleetServer struct {
+	nfcv1.UnimplementedFleetServer
+	mu sync.Mutex
+	config ServerConfig
+	agents map[string]*agentState
+}
+
+// agentState is the latest report of an agent. notify is set while the
+// agent is connected and wakes its stream when the config changes.
+type agentState struct {
+	agent *nfcv1.Agent
+	notify chan struct{}
+}
+
+func (s *fleetServer) configure(config ServerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+	for _, state := range s.agents {
+		if state.notify != nil {
+			select {
+			case state.notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (s *fleetServer) assignment(host string) *nfcv1.Assignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return assignmentFor(s.config, host)
+}
+
+func (s *fleetServer) Connect(stream grpc.BidiStreamingServer[nfcv1.AgentReport, nfcv1.Assignment]) error {
+	report, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	host := report.Host
+	if host == "" {
+		return status.Error(codes.InvalidArgument, "the first report has no host")
+	}
+	address := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		address = p.Addr.String()
+	}
+	notify := make(chan struct{}, 1)
+	s.record(host, report, address, notify, true)
+	logFields{"host": host, "address": address}.Infof("Agent %s connected from %s.", host, address)
+	defer func() {
+		s.mu.Lock()
+		if state := s.agents[host]; state.notify == notify {
+			state.notify = nil
+			state.agent.Connected = false
+		}
+		s.mu.Unlock()
+		logFields{"host": host}.Infof("Agent %s disconnected.", host)
+	}()
+	reports := make(chan *nfcv1.AgentReport)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			report, err := stream.Recv()
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case reports <- report:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+	sent := ""
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-failed:
+			return nil
+		case report := <-reports:
+			if report.Error != "" && report.Error != s.agentError(host) {
+				logFields{"host": host, "revision": report.Revision}.Warnf("Agent %s cannot apply assignment %s: %s", host, report.Revision, report.Error)
+			}
+			s.record(host, report, address, notify, false)
+		case <-notify:
+			assignment := s.assignment(host)
+			if assignment.Revision == sent {
+				continue
+			}
+			if err := stream.Send(assignment); err != nil {
+				return err
+			}
+			sent = assignment.Revision
+			logFields{"host": host, "revision": assignment.Revision, "profile": assignment.Profile}.Infof("Sent assignment %s to agent %s.", assignment.Revision, host)
+		}
+	}
+}
+
+func (s *fleetServer) agentError(host string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.agents[host]; ok {
+		return state.agent.Error
+	}
+	return ""
+}
+
+// record keeps the report as the latest of host. The first report of a
+// connection takes over from any older connection of the same host, whose
+// reports are ignored from then on.
+func (s *fleetServer) record(host string, report *nfcv1.AgentReport, address string, notify chan struct{}, first bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.agents[host]
+	if !ok {
+		state = &agentState{}
+		s.agents[host] = state
+	}
+	if !first && state.notify != notify {
+		return
+	}
+	state.notify = notify
+	state.agent = &nfcv1.Agent{
+		Host: host,
+		Version: report.Version,
+		Address: address,
+		Connected: true,
+		LastSeen: timestamppb.Now(),
+		Revision: report.Revision,
+		Error: report.Error,
+		Status: report.Status,
+	}
+}
+
+func (s *fleetServer) ListAgents(ctx context.Context, request *nfcv1.ListAgentsRequest) (*nfcv1.ListAgentsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response := &nfcv1.ListAgentsResponse{}
+	for _, host := range sortedKeys(s.agents) {
+		agent := proto.Clone(s.agents[host].agent).(*nfcv1.Agent)
+		agent.AssignedRevision = assignmentFor(s.config, host).Revision
+		response.Agents = append(response.Agents, agent)
+	}
+	return response, nil
+}
+
+// serverCredentials loads the controller's certificate, and the CA that
+// signs the agents' if client certificates are required.
+func serverCredentials(config ServerTLSConfig) (credentials.TransportCredentials, error) {
+	certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{certificate}}
+	if config.ClientCAFile != "" {
+		data, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s holds no PEM certificate", config.ClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// startFleetServer serves the Fleet service on config.Listen.
+func startFleetServer(config ServerConfig, fleet *fleetServer) (func(), error) {
+	creds, err := serverCredentials(config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.Listen, err)
+	}
+	token := config.Token
+	server := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.UnaryInterceptor(func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkGRPCToken(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, request)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkGRPCToken(stream.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	nfcv1.RegisterFleetServer(server, fleet)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logErrorf("Controller stopped: %v", err)
+		}
+	}()
+	logInfof("Controller listening on %s", listener.Addr())
+	return server.Stop, nil
+}
+
+// cmdServer runs the central controller until SIGINT or SIGTERM. SIGHUP
+// reloads the config file and sends the changed assignments out. The
+// listen address and the TLS and token settings are read at startup only.
+func cmdServer(args []string) {
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	configFile := flags.String("config", defaultServerConfigFile, "path to the controller config file (.json, .yaml, .yml or .toml)")
+	flags.Parse(args)
+	config, err := loadServerConfig(*configFile)
+	if err != nil {
+		exitf("%s: %v", *configFile, err)
+	}
+	fleet := &fleetServer{config: config, agents: map[string]*agentState{}}
+	stop, err := startFleetServer(config, fleet)
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer stop()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			logInfof("Received %v, stopping the controller.", sig)
+			return
+		}
+		newConfig, err := loadServerConfig(*configFile)
+		if err != nil {
+			logErrorf("Failed to reload %s, keeping the current rules: %v", *configFile, err)
+			continue
+		}
+		fleet.configure(newConfig)
+		logInfof("Reloaded %s: %d rule(s).", *configFile, len(newConfig.Agents))
+	}
+}
+
+// cmdAgents lists the agents of a controller.
+func cmdAgents(args []string) {
+	flags := flag.NewFlagSet("agents", flag.ExitOnError)
+	address := flags.String("server", "localhost:9840", "address of the controller")
+	token := flags.String("token", os.Getenv("NFC_TOKEN"), "token of the controller (or NFC_TOKEN)")
+	caFile := flags.String("ca-file", "", "CA certificate to verify the controller with (default the system roots)")
+	certFile := flags.String("cert-file", "", "client certificate, for controllers that require one")
+	keyFile := flags.String("key-file", "", "key of the client certificate")
+	serverName := flags.String("server-name", "", "name to verify the controller's certificate against (default the host of --server)")
+	asJSON := flags.Bool("json", false, "print the agents as JSON")
+	flags.Parse(args)
+	creds, err := controllerCredentials(*caFile, *certFile, *keyFile, *serverName)
+	if err != nil {
+		exitf("%v", err)
+	}
+	conn, err := grpc.NewClient(*address, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(bearerToken(*token)))
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	response, err := nfcv1.NewFleetClient(conn).ListAgents(ctx, &nfcv1.ListAgentsRequest{})
+	if err != nil {
+		exitf("cannot list the agents of %s: %v", *address, err)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(response.Agents)
+		return
+	}
+	printAgents(response.Agents)
+}
+
+func printAgents(agents []*nfcv1.Agent) {
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Host < agents[j].Host })
+	fmt.Printf("%-20s %-8s %-10s %-12s %-22s %s\n", "HOST", "STATE", "LAST SEEN", "PROFILE", "ASSIGNMENT", "GPUS")
+	for _, agent := range agents {
+		state := "offline"
+		if agent.Connected {
+			state = "online"
+		}
+		assignment := agent.Revision
+		switch {
+		case agent.Error != "":
+			assignment += " (failed)"
+		case agent.Revision != agent.AssignedRevision:
+			assignment += " (pending)"
+		}
+		profile, gpus := "", ""
+		if agent.Status != nil {
+			profile = agent.Status.Profile
+			for i, gpu := range agent.Status.Gpus {
+				if i > 0 {
+					gpus += ", "
+				}
+				speed := int32(-1)
+				for _, fan := range gpu.Fans {
+					speed = max(speed, fan.SpeedPercent)
+				}
+				gpus += fmt.Sprintf("%d: %d°C %d%%", gpu.Index, gpu.Temperature, speed)
+			}
+		}
+		if profile == "" {
+			profile = "-"
+		}
+		seen := time.Since(agent.LastSeen.AsTime()).Round(time.Second).String()
+		fmt.Printf("%-20s %-8s %-10s %-12s %-22s %s\n", agent.Host, state, seen, profile, assignment, gpus)
+		if agent.Error != "" {
+			fmt.Printf("  error: %s\n", agent.Error)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+func isService() bool {
+	return false
+}
+
+func runService(options RunOptions) {}
+
+func cmdService(args []string) {
+	exitf("The service command is only available on Windows; use the systemd unit elsewhere.")
+}
@@ -0,0 +1,156 @@
+//go:build windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "nvidia-fan-control"
+
+func isService() bool {
+	service, err := svc.IsWindowsService()
+	return err == nil && service
+}
+
+type fanService struct {
+	options RunOptions
+}
+
+// Execute runs the daemon and turns service stop and shutdown requests into
+// the SIGTERM it already handles, so the fans are handed back to the driver
+// before the service reports that it stopped.
+func (s *fanService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runDaemon(s.options, signals)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				signals <- syscall.SIGTERM
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+func runService(options RunOptions) {
+	if err := svc.Run(serviceName, &fanService{options: options}); err != nil {
+		logFatalf("Service failed: %v", err)
+	}
+}
+
+func cmdService(args []string) {
+	flags := flag.NewFlagSet("service", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file the service runs with (install only)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: nvidia-fan-control service install|uninstall|start|stop [flags]\n")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	flags.Parse(args[1:])
+	manager, err := mgr.Connect()
+	if err != nil {
+		exitf("Cannot connect to the service manager: %v", err)
+	}
+	defer manager.Disconnect()
+	switch action {
+	case "install":
+		installService(manager, *configFile)
+	case "uninstall":
+		service := openService(manager)
+		defer service.Close()
+		if err := service.Delete(); err != nil {
+			exitf("Cannot remove the service: %v", err)
+		}
+		eventlog.Remove(serviceName)
+		fmt.Println("Service removed.")
+	case "start":
+		service := openService(manager)
+		defer service.Close()
+		if err := service.Start(); err != nil {
+			exitf("Cannot start the service: %v", err)
+		}
+	case "stop":
+		service := openService(manager)
+		defer service.Close()
+		if _, err := service.Control(svc.Stop); err != nil {
+			exitf("Cannot stop the service: %v", err)
+		}
+		// Wait for the fans to be handed back before returning.
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+			if status, err := service.Query(); err != nil || status.State == svc.Stopped {
+				return
+			}
+		}
+		exitf("The service did not stop within 10 seconds.")
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+func installService(manager *mgr.Mgr, configFile string) {
+	executable, err := os.Executable()
+	if err != nil {
+		exitf("Cannot locate the executable: %v", err)
+	}
+	// Services start in System32, so the config path has to be absolute.
+	configFile, err = filepath.Abs(configFile)
+	if err != nil {
+		exitf("%v", err)
+	}
+	if _, err := loadConfig(configFile); err != nil {
+		exitf("%s: %v", configFile, err)
+	}
+	service, err := manager.CreateService(serviceName, executable, mgr.Config{
+		DisplayName: "NVIDIA Fan Control",
+		Description: "Controls NVIDIA GPU fan speeds from a temperature curve.",
+		StartType: mgr.StartAutomatic,
+	}, "run", "-config", configFile)
+	if err != nil {
+		exitf("Cannot create the service: %v", err)
+	}
+	defer service.Close()
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil && !strings.Contains(err.Error(), "exists") {
+		logWarnf("Cannot register the event log source: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(defaultLogFile), 0755); err != nil {
+		logWarnf("Cannot create %s: %v", filepath.Dir(defaultLogFile), err)
+	}
+	fmt.Printf("Service installed with %s. Start it with \"nvidia-fan-control service start\".\n", configFile)
+}
+
+func openService(manager *mgr.Mgr) *mgr.Service {
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		exitf("Cannot open the service: %v", err)
+	}
+	return service
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal toggles between pausing and resuming fan control.
+var pauseSignal os.Signal = syscall.SIGUSR2
+
+// dumpSignal logs the full state of the daemon.
+var dumpSignal os.Signal = syscall.SIGUSR1
+
+var platformSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
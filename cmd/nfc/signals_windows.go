@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Windows has no user signals; pause and resume go through the control
+// socket or the REST API instead, and the state through status.
+var (
+	pauseSignal os.Signal
+	dumpSignal os.Signal
+)
+
+var platformSignals []os.Signal
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// traceSample is one row of a temperature trace. Columns a trace does not
+// have are -1.
+type traceSample struct {
+	At time.Duration
+	Temperature float64
+	MemoryTemperature float64
+	PowerWatts float64
+	Utilization float64
+}
+
+// readTrace parses a CSV trace of time,temperature[,memory_temperature
+// [,power_watts[,utilization]]] rows. Time is in seconds or an RFC 3339
+// timestamp, and a header row is skipped.
+func readTrace(r io.Reader) ([]traceSample, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	samples := []traceSample{}
+	var start time.Time
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected at least time and temperature", line)
+		}
+		values := []float64{-1, -1, -1, -1}
+		valid := true
+		for i := 1; i < len(record) && i <= len(values); i++ {
+			if record[i] == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(record[i], 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			values[i-1] = value
+		}
+		var at time.Duration
+		if seconds, err := strconv.ParseFloat(record[0], 64); err == nil {
+			at = time.Duration(seconds * float64(time.Second))
+		} else if timestamp, err := time.Parse(time.RFC3339, record[0]); err == nil {
+			if start.IsZero() {
+				start = timestamp
+			}
+			at = timestamp.Sub(start)
+		} else {
+			valid = false
+		}
+		if !valid {
+			if line == 1 && len(samples) == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: cannot parse %q", line, strings.Join(record, ","))
+		}
+		if len(samples) > 0 && at < samples[len(samples)-1].At {
+			return nil, fmt.Errorf("line %d: time goes backwards", line)
+		}
+		samples = append(samples, traceSample{At: at, Temperature: values[0], MemoryTemperature: values[1], PowerWatts: values[2], Utilization: values[3]})
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("the trace is empty")
+	}
+	return samples, nil
+}
+
+// sampleAt interpolates the trace linearly at t, and holds the last row
+// after the end.
+func sampleAt(samples []traceSample, t time.Duration) traceSample {
+	for i := 1; i < len(samples); i++ {
+		lower, upper := samples[i-1], samples[i]
+		if t > upper.At {
+			continue
+		}
+		if upper.At == lower.At {
+			return upper
+		}
+		fraction := float64(t-lower.At) / float64(upper.At-lower.At)
+		mix := func(a, b float64) float64 {
+			if a < 0 || b < 0 {
+				return a
+			}
+			return a + fraction*(b-a)
+		}
+		return traceSample{
+			At: t,
+			Temperature: mix(lower.Temperature, upper.Temperature),
+			MemoryTemperature: mix(lower.MemoryTemperature, upper.MemoryTemperature),
+			PowerWatts: mix(lower.PowerWatts, upper.PowerWatts),
+			Utilization: mix(lower.Utilization, upper.Utilization),
+		}
+	}
+	return samples[len(samples)-1]
+}
+
+// simulatedGPUs fakes every GPU up to the simulated one, so that index
+// based gpus sections match as they would on the real machine, and makes
+// the fakes the backend.
+func simulatedGPUs(gpu int, fans int) *device.Fake {
+	gpus := make([]*device.FakeGPU, gpu+1)
+	for i := range gpus {
+		gpus[i] = &device.FakeGPU{Name: "Simulated GPU", UUID: fmt.Sprintf("GPU-simulated-%d", i), FanSpeeds: make([]int, fans)}
+	}
+	fake := device.NewFake(gpus...)
+	gpuBackend = device.Timed(fake, nvmlTimings.observe)
+	return fake
+}
+
+// simulatedMonitor sets up the monitor of a simulated GPU with the settings
+// of profile, or of the active profile if it is empty.
+func simulatedMonitor(config Config, profile string, fake *device.Fake, gpu int) DeviceMonitor {
+	handle, _ := fake.DeviceGetHandleByIndex(gpu)
+	if profile == "" {
+		profile = config.ActiveProfile
+	}
+	monitor, ok := initDevice(config, profile, gpu, handle)
+	if !ok {
+		exitf("cannot set up the simulated GPU")
+	}
+	return monitor
+}
+
+func cmdSimulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	configFile := flags.String("config", findConfigFile(), "path to the config file")
+	traceFile := flags.String("trace", "", "CSV trace of time,temperature[,memory_temperature[,power_watts[,utilization]]] rows")
+	gpu := flags.Int("gpu", 0, "index of the GPU whose settings are simulated")
+	fans := flags.Int("fans", 1, "number of fans of the simulated GPU")
+	profile := flags.String("profile", "", "profile to simulate instead of the active one")
+	verbose := flags.Bool("verbose", false, "also print the daemon's log messages")
+	flags.Parse(args)
+	if *traceFile == "" {
+		exitf("--trace is required")
+	}
+	if *gpu < 0 || *fans < 1 {
+		exitf("--gpu must not be negative and --fans must be at least 1")
+	}
+	if !*verbose {
+		setLogHandler(&sinkHandler{level: slog.LevelWarn, write: writerSink(os.Stderr)})
+	}
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		exitf("%s: %v", *configFile, err)
+	}
+	if _, ok := config.Profiles[*profile]; *profile != "" && !ok {
+		exitf("profile %q is not defined in profiles", *profile)
+	}
+	file, err := os.Open(*traceFile)
+	if err != nil {
+		exitf("%v", err)
+	}
+	samples, err := readTrace(file)
+	file.Close()
+	if err != nil {
+		exitf("%s: %v", *traceFile, err)
+	}
+
+	fake := simulatedGPUs(*gpu, *fans)
+	start := time.Now()
+	now := start
+	clock = func() time.Time { return now }
+	apply := func(sample traceSample) {
+		fake.Update(func(gpus []*device.FakeGPU) {
+			simulated := gpus[*gpu]
+			simulated.Temperature = int(math.Round(sample.Temperature))
+			simulated.MemoryTemperature = int(math.Round(math.Max(sample.MemoryTemperature, 0)))
+			simulated.PowerWatts = int(math.Round(sample.PowerWatts))
+			simulated.Utilization = int(math.Round(sample.Utilization))
+			// Columns missing from the trace read as unsupported, like on
+			// boards without the sensor.
+			simulated.Errors = map[string]nvml.Return{}
+			if sample.PowerWatts < 0 {
+				simulated.Errors["DeviceGetPowerUsage"] = nvml.ERROR_NOT_SUPPORTED
+			}
+			if sample.Utilization < 0 {
+				simulated.Errors["DeviceGetUtilizationRates"] = nvml.ERROR_NOT_SUPPORTED
+			}
+		})
+	}
+	apply(samples[0])
+	monitor := simulatedMonitor(config, *profile, fake, *gpu)
+	fmt.Printf("Simulating GPU %d with %s\n", *gpu, describeControlConfig(monitor.Settings))
+	fmt.Printf("%8s %6s %6s  %-12s %s\n", "TIME", "RAW", "TEMP", "RANGE", "FANS")
+	interval := time.Duration(monitor.Settings.TimeToUpdate * float64(time.Second))
+	end := samples[len(samples)-1].At
+	previous := append([]int(nil), monitor.CurrentFanSpeeds...)
+	for t := time.Duration(0); t <= end; t += interval {
+		now = start.Add(t)
+		apply(sampleAt(samples, t))
+		updateDevice(&monitor)
+		rangeText := "-"
+		if r := monitor.CurrentTemperatureRange; r.MaxTemperature != 0 && (monitor.Settings.CurveMode == "" || monitor.Settings.CurveMode == "stepped") {
+			rangeText = fmt.Sprintf("%d..%d", r.MinTemperature, r.MaxTemperature)
+		}
+		notes := []string{}
+		if !slices.Equal(previous, monitor.CurrentFanSpeeds) {
+			notes = append(notes, "changed")
+		}
+		if monitor.FailSafeActive {
+			notes = append(notes, "fail-safe")
+		}
+		if hasFailedFan(&monitor) {
+			notes = append(notes, "fan failed")
+		}
+		line := fmt.Sprintf("%7.1fs %5d° %5d°  %-12s %v%% %s", t.Seconds(), monitor.RawTemperature, monitor.Temperature, rangeText, monitor.CurrentFanSpeeds, strings.Join(notes, ", "))
+		fmt.Println(strings.TrimRight(line, " "))
+		previous = append(previous[:0], monitor.CurrentFanSpeeds...)
+	}
+}
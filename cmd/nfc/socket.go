@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+type SocketRequest struct {
+	Command string `json:"command"`
+	Profile string `json:"profile,omitempty"`
+}
+
+type SocketResponse struct {
+	OK bool `json:"ok"`
+	Error string `json:"error,omitempty"`
+	Status *StatusSnapshot `json:"status,omitempty"`
+}
+
+func startControlSocket(path string, d *Daemon) (func(), error) {
+	// A socket file left behind by a crashed instance would make Listen fail,
+	// but one that still accepts connections belongs to a live daemon.
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another instance", path)
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict permissions of %s: %w", path, err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logErrorf("Control socket stopped: %v", err)
+				}
+				return
+			}
+			go serveControlConn(conn, d)
+		}
+	}()
+	logInfof("Control socket listening on %s", path)
+	return func() {
+		listener.Close()
+		os.Remove(path)
+	}, nil
+}
+
+func serveControlConn(conn net.Conn, d *Daemon) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return
+	}
+	var request SocketRequest
+	response := SocketResponse{}
+	if err := json.Unmarshal(line, &request); err != nil {
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if err := handleControlRequest(request, d); err != nil {
+		response.Error = err.Error()
+	} else {
+		response.OK = true
+		snapshot := d.Status.Snapshot()
+		response.Status = &snapshot
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func handleControlRequest(request SocketRequest, d *Daemon) error {
+	switch request.Command {
+	case "status":
+		return nil
+	case "pause":
+		return d.Do(func(d *Daemon) error { d.Pause(); return nil })
+	case "resume":
+		return d.Do(func(d *Daemon) error { d.Resume(); return nil })
+	case "profile":
+		return d.Do(func(d *Daemon) error { return d.SetProfile(request.Profile) })
+	default:
+		return fmt.Errorf("unknown command %q", request.Command)
+	}
+}
+
+func sendControlRequest(path string, request SocketRequest) (SocketResponse, error) {
+	var response SocketResponse
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return response, fmt.Errorf("unable to reach the daemon at %s: %w", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return response, fmt.Errorf("failed to send request: %w", err)
+	}
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return response, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !response.OK {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
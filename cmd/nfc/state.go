@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateConfig keeps the controller's hysteresis across restarts: the active
+// temperature range, the speeds last commanded and the dwell timers are
+// written to file whenever they change, and restored at startup if the file
+// is less than max_age_seconds old. A negative max_age_seconds turns this
+// off.
+type StateConfig struct {
+	File string `json:"file"`
+	MaxAgeSeconds float64 `json:"max_age_seconds"`
+}
+
+func applyStateDefaults(config *StateConfig) {
+	if config.File == "" {
+		config.File = defaultStateFile
+	}
+	if config.MaxAgeSeconds == 0 {
+		config.MaxAgeSeconds = 300
+	}
+}
+
+// GPUState is what a GPU's monitor needs to carry on where it left off.
+type GPUState struct {
+	Range *TemperatureRange `json:"range,omitempty"`
+	BaseFanSpeed int `json:"base_fan_speed"`
+	TargetRPM int `json:"target_rpm,omitempty"`
+	FanSpeeds []int `json:"fan_speeds"`
+	LastSpeedChange time.Time `json:"last_speed_change"`
+	DownshiftSince time.Time `json:"downshift_since"`
+}
+
+// ControllerState is the state file, keyed by GPU UUID.
+type ControllerState struct {
+	Time time.Time `json:"time"`
+	GPUs map[string]GPUState `json:"gpus"`
+}
+
+func monitorState(monitor *DeviceMonitor) GPUState {
+	state := GPUState{
+		BaseFanSpeed: monitor.BaseFanSpeed,
+		TargetRPM: monitor.TargetRPM,
+		FanSpeeds: append([]int(nil), monitor.CurrentFanSpeeds...),
+		LastSpeedChange: monitor.LastSpeedChange,
+		DownshiftSince: monitor.DownshiftSince,
+	}
+	if monitor.CurrentTemperatureRange.MaxTemperature != 0 {
+		current := monitor.CurrentTemperatureRange
+		state.Range = &current
+	}
+	return state
+}
+
+func loadState(file string) (ControllerState, error) {
+	state := ControllerState{GPUs: map[string]GPUState{}}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse state file %s: %w", file, err)
+	}
+	return state, nil
+}
+
+// saveState replaces file through a rename, so a crash while writing leaves
+// the previous state rather than half of the new one.
+func saveState(file string, state ControllerState) error {
+	data, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	temp := file + ".tmp"
+	if err := os.WriteFile(temp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, file)
+}
+
+// savedState is the state file if restoring is on and it is recent enough,
+// and an empty state otherwise.
+func savedState(config StateConfig) ControllerState {
+	empty := ControllerState{GPUs: map[string]GPUState{}}
+	if config.MaxAgeSeconds < 0 {
+		return empty
+	}
+	state, err := loadState(config.File)
+	if err != nil {
+		logWarnf("Not restoring the controller state: %v", err)
+		return empty
+	}
+	if time.Since(state.Time) > time.Duration(config.MaxAgeSeconds*float64(time.Second)) {
+		return empty
+	}
+	return state
+}
+
+// restoreState puts the saved state of the monitor's GPU back. The fans are
+// set to the saved speeds straight away, so they do not drop while the new
+// process settles, and the range is only restored if the GPU's curve still
+// has it. It reports whether there was anything to restore.
+func restoreState(state ControllerState, monitor *DeviceMonitor) bool {
+	saved, ok := state.GPUs[monitor.UUID]
+	if !ok || len(saved.FanSpeeds) != monitor.NumFans {
+		return false
+	}
+	fields := logFields{"gpu_index": monitor.Index, "new_speeds": saved.FanSpeeds}
+	if _, _, ok := writeFanSpeeds(monitor, saved.FanSpeeds); !ok {
+		fields.Warnf("GPU %d: failed to restore the fan speeds %v%%.", monitor.Index, saved.FanSpeeds)
+		return false
+	}
+	monitor.BaseFanSpeed = saved.BaseFanSpeed
+	monitor.TargetRPM = saved.TargetRPM
+	monitor.LastSpeedChange = saved.LastSpeedChange
+	monitor.DownshiftSince = saved.DownshiftSince
+	if saved.Range != nil && hasRange(monitor.Settings, *saved.Range) {
+		monitor.CurrentTemperatureRange = *saved.Range
+	}
+	fields.Infof("GPU %d: restored the controller state saved %s ago, fans at %v%%.", monitor.Index, time.Since(state.Time).Round(time.Second), saved.FanSpeeds)
+	monitor.NextUpdate = time.Now().Add(updateInterval(monitor))
+	return true
+}
+
+func hasRange(settings ControlConfig, r TemperatureRange) bool {
+	if settings.CurveMode != "" && settings.CurveMode != "stepped" {
+		return false
+	}
+	for _, configured := range settings.TemperatureRanges {
+		if configured == r {
+			return true
+		}
+	}
+	return false
+}
+
+// saveState writes the monitors' state if it differs from what was last
+// written, or to keep the file from going stale; force writes it anyway.
+// Dry runs leave the file to the real daemon.
+func (d *Daemon) saveState(force bool) {
+	config := d.Config.State
+	if config.MaxAgeSeconds < 0 || d.Options.DryRun {
+		return
+	}
+	state := ControllerState{Time: time.Now(), GPUs: map[string]GPUState{}}
+	for i := range d.Monitors {
+		if !d.Monitors[i].Lost {
+			state.GPUs[d.Monitors[i].UUID] = monitorState(&d.Monitors[i])
+		}
+	}
+	encoded, _ := json.Marshal(state.GPUs)
+	stale := state.Time.Sub(d.stateSaved) > time.Duration(config.MaxAgeSeconds*float64(time.Second)/2)
+	if !force && !stale && bytes.Equal(encoded, d.savedState) {
+		return
+	}
+	if err := saveState(config.File, state); err != nil {
+		logWarnf("Failed to save the controller state: %v", err)
+		return
+	}
+	d.savedState, d.stateSaved = encoded, state.Time
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// speedBucketWidth is the width of the fan speed buckets in percent; 100%
+// gets a bucket of its own.
+const speedBucketWidth = 10
+
+// GPUStats sums up how a GPU ran since the daemon took control of it. The
+// time per range is only kept for stepped curves; the time per fan speed
+// bucket is keyed by the bucket's lower bound, so 40 is 40-49%.
+type GPUStats struct {
+	Since time.Time `json:"since"`
+	Seconds float64 `json:"seconds"`
+	MinTemperature int `json:"min_temperature"`
+	MaxTemperature int `json:"max_temperature"`
+	AvgTemperature float64 `json:"avg_temperature"`
+	RangeSeconds map[string]float64 `json:"range_seconds,omitempty"`
+	SpeedSeconds map[int]float64 `json:"speed_seconds"`
+	RangeTransitions int `json:"range_transitions"`
+}
+
+// statsTracker accumulates GPUStats. Each interval between two updates is
+// counted for the temperature, range and speed measured at its start.
+type statsTracker struct {
+	stats GPUStats
+	temperatureSeconds float64
+	last time.Time
+	lastTemperature int
+	lastRange string
+	lastBucket int
+}
+
+func speedBucket(speed int) int {
+	if speed >= 100 {
+		return 100
+	}
+	return speed / speedBucketWidth * speedBucketWidth
+}
+
+func describeSpeedBucket(bucket int) string {
+	if bucket >= 100 {
+		return "100%"
+	}
+	return fmt.Sprintf("%d-%d%%", bucket, bucket+speedBucketWidth-1)
+}
+
+// recordStats adds the monitor's latest update to its statistics.
+func recordStats(monitor *DeviceMonitor) {
+	t := &monitor.Stats
+	now := clock()
+	speed := -1
+	for _, s := range monitor.CurrentFanSpeeds {
+		speed = max(speed, s)
+	}
+	rangeKey := ""
+	if monitor.CurrentTemperatureRange.MaxTemperature != 0 {
+		rangeKey = describeRange(monitor.CurrentTemperatureRange)
+	}
+	if t.last.IsZero() {
+		t.stats = GPUStats{Since: now, MinTemperature: monitor.Temperature, MaxTemperature: monitor.Temperature, AvgTemperature: float64(monitor.Temperature), RangeSeconds: map[string]float64{}, SpeedSeconds: map[int]float64{}}
+	} else {
+		seconds := now.Sub(t.last).Seconds()
+		t.temperatureSeconds += float64(t.lastTemperature) * seconds
+		t.stats.Seconds = now.Sub(t.stats.Since).Seconds()
+		if t.stats.Seconds > 0 {
+			t.stats.AvgTemperature = t.temperatureSeconds / t.stats.Seconds
+		}
+		if t.lastRange != "" {
+			t.stats.RangeSeconds[t.lastRange] += seconds
+		}
+		if t.lastBucket >= 0 {
+			t.stats.SpeedSeconds[t.lastBucket] += seconds
+		}
+		if rangeKey != "" && t.lastRange != "" && rangeKey != t.lastRange {
+			t.stats.RangeTransitions++
+		}
+		t.stats.MinTemperature = min(t.stats.MinTemperature, monitor.Temperature)
+		t.stats.MaxTemperature = max(t.stats.MaxTemperature, monitor.Temperature)
+	}
+	t.last, t.lastTemperature, t.lastRange = now, monitor.Temperature, rangeKey
+	t.lastBucket = -1
+	if speed >= 0 {
+		t.lastBucket = speedBucket(speed)
+	}
+}
+
+// statsSnapshot copies the statistics, for readers on other goroutines.
+func statsSnapshot(monitor *DeviceMonitor) *GPUStats {
+	if monitor.Stats.last.IsZero() {
+		return nil
+	}
+	stats := monitor.Stats.stats
+	stats.RangeSeconds = map[string]float64{}
+	for key, seconds := range monitor.Stats.stats.RangeSeconds {
+		stats.RangeSeconds[key] = seconds
+	}
+	stats.SpeedSeconds = map[int]float64{}
+	for bucket, seconds := range monitor.Stats.stats.SpeedSeconds {
+		stats.SpeedSeconds[bucket] = seconds
+	}
+	return &stats
+}
+
+// writeStatsMetrics writes the statistics of every GPU that has any.
+func writeStatsMetrics(w io.Writer, snapshot StatusSnapshot) {
+	gauges := []struct {
+		name, help string
+		value func(s *GPUStats) float64
+	}{
+		{"nfc_gpu_temperature_min_celsius", "Lowest control temperature since the daemon took over the GPU.", func(s *GPUStats) float64 { return float64(s.MinTemperature) }},
+		{"nfc_gpu_temperature_max_celsius", "Highest control temperature since the daemon took over the GPU.", func(s *GPUStats) float64 { return float64(s.MaxTemperature) }},
+		{"nfc_gpu_temperature_avg_celsius", "Time-weighted average control temperature since the daemon took over the GPU.", func(s *GPUStats) float64 { return s.AvgTemperature }},
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, d := range snapshot.Devices {
+			if d.Stats != nil {
+				fmt.Fprintf(w, "%s{%s} %g\n", gauge.name, gpuLabels(d), gauge.value(d.Stats))
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_temperature_range_seconds_total Time spent in each range of a stepped curve.")
+	fmt.Fprintln(w, "# TYPE nfc_temperature_range_seconds_total counter")
+	for _, d := range snapshot.Devices {
+		if d.Stats != nil {
+			for _, key := range sortedRanges(d.Stats.RangeSeconds) {
+				fmt.Fprintf(w, "nfc_temperature_range_seconds_total{%s,range=%q} %g\n", gpuLabels(d), strings.TrimSuffix(key, "°C"), d.Stats.RangeSeconds[key])
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_temperature_range_transitions_total Moves of a stepped curve from one range to another.")
+	fmt.Fprintln(w, "# TYPE nfc_temperature_range_transitions_total counter")
+	for _, d := range snapshot.Devices {
+		if d.Stats != nil {
+			fmt.Fprintf(w, "nfc_temperature_range_transitions_total{%s} %d\n", gpuLabels(d), d.Stats.RangeTransitions)
+		}
+	}
+	fmt.Fprintln(w, "# HELP nfc_fan_speed_seconds_total Time the fastest fan spent in each 10% speed bucket.")
+	fmt.Fprintln(w, "# TYPE nfc_fan_speed_seconds_total counter")
+	for _, d := range snapshot.Devices {
+		if d.Stats != nil {
+			for _, bucket := range sortedBuckets(d.Stats.SpeedSeconds) {
+				fmt.Fprintf(w, "nfc_fan_speed_seconds_total{%s,bucket=%q} %g\n", gpuLabels(d), strings.TrimSuffix(describeSpeedBucket(bucket), "%"), d.Stats.SpeedSeconds[bucket])
+			}
+		}
+	}
+}
+
+// sortedRanges orders range keys such as "40..60°C" by their minimum.
+func sortedRanges(ranges map[string]float64) []string {
+	keys := sortedKeys(ranges)
+	sort.SliceStable(keys, func(i, j int) bool {
+		var a, b int
+		fmt.Sscanf(keys[i], "%d", &a)
+		fmt.Sscanf(keys[j], "%d", &b)
+		return a < b
+	})
+	return keys
+}
+
+func sortedBuckets(buckets map[int]float64) []int {
+	keys := make([]int, 0, len(buckets))
+	for bucket := range buckets {
+		keys = append(keys, bucket)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// describeShare prints seconds with its share of total, e.g. "1h2m (35%)".
+func describeShare(seconds float64, total float64) string {
+	share := 0.0
+	if total > 0 {
+		share = 100 * seconds / total
+	}
+	return fmt.Sprintf("%s (%.0f%%)", (time.Duration(seconds) * time.Second).String(), math.Round(share))
+}
+
+func printStats(snapshot StatusSnapshot) {
+	for i, d := range snapshot.Devices {
+		if i > 0 {
+			fmt.Println()
+		}
+		if d.Stats == nil {
+			fmt.Printf("GPU %d (%s): no statistics yet\n", d.Index, d.Name)
+			continue
+		}
+		s := d.Stats
+		total := s.Seconds
+		fmt.Printf("GPU %d (%s), since %s (%s):\n", d.Index, d.Name, s.Since.Local().Format("2006-01-02 15:04:05"), time.Duration(total)*time.Second)
+		fmt.Printf("  Temperature: min %d°C, avg %.1f°C, max %d°C\n", s.MinTemperature, s.AvgTemperature, s.MaxTemperature)
+		if len(s.RangeSeconds) > 0 {
+			fmt.Printf("  Ranges (%d transition(s)):\n", s.RangeTransitions)
+			for _, key := range sortedRanges(s.RangeSeconds) {
+				fmt.Printf("    %-12s %s\n", key, describeShare(s.RangeSeconds[key], total))
+			}
+		}
+		fmt.Println("  Fan speed:")
+		for _, bucket := range sortedBuckets(s.SpeedSeconds) {
+			fmt.Printf("    %-12s %s\n", describeSpeedBucket(bucket), describeShare(s.SpeedSeconds[bucket], total))
+		}
+	}
+}
+
+func cmdStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	gpu := flags.String("gpu", "", "index or UUID of the GPU to show (default all)")
+	asJSON := flags.Bool("json", false, "print the statistics as JSON")
+	flags.Parse(args)
+	response, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"})
+	if err != nil {
+		exitf("%v", err)
+	}
+	snapshot := *response.Status
+	devices := []DeviceStatus{}
+	for _, d := range snapshot.Devices {
+		if gpuMatches(d, *gpu) {
+			devices = append(devices, d)
+		}
+	}
+	if len(devices) == 0 && *gpu != "" {
+		exitf("the daemon does not control GPU %s", *gpu)
+	}
+	snapshot.Devices = devices
+	if *asJSON {
+		stats := map[string]*GPUStats{}
+		for _, d := range devices {
+			stats[d.UUID] = d.Stats
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(stats)
+		return
+	}
+	printStats(snapshot)
+}
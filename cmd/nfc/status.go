@@ -0,0 +1,197 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type DeviceStatus struct {
+	Index int `json:"index"`
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+	PCIBusID string `json:"pci_bus_id"`
+	Temperature int `json:"temperature"`
+	RawTemperature int `json:"raw_temperature"`
+	PowerWatts int `json:"power_watts"`
+	Utilization int `json:"utilization"`
+	Sensor string `json:"sensor"`
+	SensorTemperatures map[string]int `json:"sensor_temperatures,omitempty"`
+	CurveInput string `json:"curve_input,omitempty"`
+	FanSpeeds []int `json:"fan_speeds"`
+	MinFanSpeed int `json:"min_fan_speed"`
+	MaxFanSpeed int `json:"max_fan_speed"`
+	FanRPMs []int `json:"fan_rpms"`
+	FanFailed []bool `json:"fan_failed"`
+	FanReapplies []int `json:"fan_reapplies"`
+	TemperatureRange *TemperatureRange `json:"temperature_range,omitempty"`
+	Errors map[string]int `json:"errors"`
+	ErrorClasses map[string]int `json:"error_classes"`
+	OverrideSpeed *int `json:"override_speed,omitempty"`
+	FailSafe bool `json:"fail_safe"`
+	Panic bool `json:"panic"`
+	Stats *GPUStats `json:"stats,omitempty"`
+	DriverControl bool `json:"driver_control"`
+	SpeedCap int `json:"speed_cap,omitempty"`
+	PowerLimitWatts int `json:"power_limit_watts,omitempty"`
+	Throttle []string `json:"throttle"`
+	ThrottleSeconds map[string]float64 `json:"throttle_seconds"`
+	FanBackend string `json:"fan_backend"`
+	ProcessProfile string `json:"process_profile,omitempty"`
+	MinSpinDuty int `json:"min_spin_duty,omitempty"`
+	ExpectedRPM int `json:"expected_rpm,omitempty"`
+	TargetRPM int `json:"target_rpm,omitempty"`
+	Group string `json:"group,omitempty"`
+	GroupTemperature int `json:"group_temperature,omitempty"`
+	UpdateDuration time.Duration `json:"update_duration_ns"`
+}
+
+type StatusSnapshot struct {
+	Time time.Time `json:"time"`
+	StartTime time.Time `json:"start_time"`
+	LoopDuration time.Duration `json:"loop_duration_ns"`
+	LoopInterval time.Duration `json:"loop_interval_ns"`
+	NVMLDown bool `json:"nvml_down"`
+	Profile string `json:"profile"`
+	Profiles []string `json:"profiles"`
+	Paused bool `json:"paused"`
+	PowerSource string `json:"power_source,omitempty"`
+	DryRun bool `json:"dry_run"`
+	Devices []DeviceStatus `json:"devices"`
+	NVMLCalls map[string]CallTiming `json:"nvml_calls,omitempty"`
+}
+
+// StatusStore hands the latest loop state to readers on other goroutines,
+// such as the HTTP listener, without letting them touch the monitors.
+type StatusStore struct {
+	mu sync.Mutex
+	snapshot StatusSnapshot
+	subscribers map[chan StatusSnapshot]bool
+}
+
+func (s *StatusStore) Publish(snapshot StatusSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+	for subscriber := range s.subscribers {
+		// A subscriber that falls behind only gets the latest snapshot.
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- snapshot
+	}
+}
+
+// Subscribe delivers every published snapshot until the returned function
+// is called.
+func (s *StatusStore) Subscribe() (<-chan StatusSnapshot, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = map[chan StatusSnapshot]bool{}
+	}
+	subscriber := make(chan StatusSnapshot, 1)
+	s.subscribers[subscriber] = true
+	return subscriber, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, subscriber)
+	}
+}
+
+func (s *StatusStore) Snapshot() StatusSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot
+}
+
+func deviceStatus(monitor *DeviceMonitor) DeviceStatus {
+	status := DeviceStatus{
+		Index: monitor.Index,
+		Name: monitor.Name,
+		UUID: monitor.UUID,
+		PCIBusID: monitor.PCIBusID,
+		Temperature: monitor.Temperature,
+		RawTemperature: monitor.RawTemperature,
+		PowerWatts: monitor.PowerWatts,
+		Utilization: monitor.Utilization,
+		Sensor: describeSensors(monitor.Settings),
+		FanSpeeds: append([]int(nil), monitor.CurrentFanSpeeds...),
+		MinFanSpeed: monitor.MinFanSpeed,
+		MaxFanSpeed: monitor.MaxFanSpeed,
+		FanRPMs: append([]int(nil), monitor.FanRPMs...),
+		FanFailed: append([]bool(nil), monitor.FanFailed...),
+		FanReapplies: append([]int(nil), monitor.FanReappliesTotal...),
+		Errors: map[string]int{},
+		FailSafe: monitor.FailSafeActive,
+		Panic: monitor.PanicActive,
+		Stats: statsSnapshot(monitor),
+		DriverControl: monitor.DriverControl,
+		SpeedCap: monitor.SpeedCap,
+		PowerLimitWatts: monitor.PowerLimitWatts,
+		Throttle: []string{},
+		ThrottleSeconds: throttleTotals(monitor),
+		FanBackend: monitor.Backend.Name(),
+		ProcessProfile: monitor.ProcessProfile,
+		CurveInput: monitor.CurveInput,
+		UpdateDuration: monitor.UpdateDuration,
+	}
+	for _, class := range throttleClasses {
+		if _, ok := monitor.ThrottleSince[class]; ok {
+			status.Throttle = append(status.Throttle, class)
+		}
+	}
+	if monitor.CurrentTemperatureRange.MaxTemperature != 0 {
+		current := monitor.CurrentTemperatureRange
+		status.TemperatureRange = &current
+	}
+	if len(monitor.Settings.Sensors) > 0 || len(monitor.Settings.InputCurves) > 0 {
+		status.SensorTemperatures = map[string]int{}
+		for sensor, temp := range monitor.SensorTemperatures {
+			status.SensorTemperatures[sensor] = temp
+		}
+	}
+	status.ErrorClasses = map[string]int{}
+	for class, count := range monitor.ErrorClasses {
+		status.ErrorClasses[class] = count
+	}
+	for operation, count := range monitor.ErrorCounts {
+		status.Errors[operation] = count
+	}
+	if monitor.OverrideSpeed != nil {
+		override := *monitor.OverrideSpeed
+		status.OverrideSpeed = &override
+	}
+	if monitor.Calibration != nil {
+		status.MinSpinDuty = monitor.Calibration.MinSpinDuty
+		status.ExpectedRPM = monitor.Calibration.RPM(monitor.CurrentFanSpeeds[0])
+	}
+	if monitor.Settings.SpeedUnit == speedUnitRPM {
+		status.TargetRPM = monitor.TargetRPM
+	}
+	if monitor.Group != "" {
+		status.Group, status.GroupTemperature = monitor.Group, monitor.GroupTemperature
+	}
+	return status
+}
+
+func publishStatus(d *Daemon, loopDuration time.Duration) {
+	snapshot := StatusSnapshot{
+		Time: time.Now(),
+		StartTime: d.StartTime,
+		LoopDuration: loopDuration,
+		LoopInterval: d.tickInterval,
+		NVMLDown: d.nvmlDown,
+		Profile: d.Profile,
+		Profiles: profileNames(d.Config),
+		Paused: d.Paused,
+		PowerSource: d.powerSource,
+		DryRun: d.Options.DryRun,
+		Devices: make([]DeviceStatus, 0, len(d.Monitors)),
+		NVMLCalls: nvmlTimings.snapshot(),
+	}
+	for i := range d.Monitors {
+		snapshot.Devices = append(snapshot.Devices, deviceStatus(&d.Monitors[i]))
+	}
+	d.Status.Publish(snapshot)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdNotify implements the sd_notify protocol. It is a no-op when the daemon
+// was not started by systemd with Type=notify.
+func sdNotify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return
+	}
+	if strings.HasPrefix(socketPath, "@") {
+		socketPath = "\x00" + socketPath[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		logWarnf("Failed to notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logWarnf("Failed to notify systemd: %v", err)
+	}
+}
+
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+func systemdStatus(d *Daemon) string {
+	if d.Paused {
+		return "STATUS=Paused"
+	}
+	temps := []string{}
+	for i := range d.Monitors {
+		temps = append(temps, fmt.Sprintf("GPU %d %d°C %v%%", d.Monitors[i].Index, d.Monitors[i].Temperature, d.Monitors[i].CurrentFanSpeeds))
+	}
+	return "STATUS=" + strings.Join(temps, ", ")
+}
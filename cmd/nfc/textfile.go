@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// TextfileConfig writes the metrics served on /metrics to file every
+// interval_seconds, for node_exporter's textfile collector on hosts where
+// the daemon cannot listen on a port.
+type TextfileConfig struct {
+	File string `json:"file"`
+	IntervalSeconds float64 `json:"interval_seconds"`
+}
+
+func applyTextfileDefaults(config *TextfileConfig) {
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 15
+	}
+}
+
+func validateTextfile(config TextfileConfig) error {
+	if config.File != "" && !strings.HasSuffix(config.File, ".prom") {
+		return fmt.Errorf("file %q must end in .prom for the textfile collector to read it", config.File)
+	}
+	return nil
+}
+
+// writeTextfile replaces file through a rename, so the collector never
+// reads it half written.
+func writeTextfile(file string, snapshot StatusSnapshot) error {
+	var metrics bytes.Buffer
+	writeMetrics(&metrics, snapshot)
+	temp := file + ".tmp"
+	if err := os.WriteFile(temp, metrics.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, file)
+}
+
+// startTextfile writes the latest status every interval until the returned
+// function is called, which removes the file so the collector does not keep
+// reporting the last values of a stopped daemon.
+func startTextfile(config TextfileConfig, d *Daemon) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Duration(config.IntervalSeconds * float64(time.Second)))
+		defer ticker.Stop()
+		failures := failureLogger{recovered: fmt.Sprintf("Writing metrics to %s again.", config.File)}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			snapshot := d.Status.Snapshot()
+			if snapshot.Time.IsZero() {
+				continue
+			}
+			failures.observe(writeTextfile(config.File, snapshot), "Failed to write metrics to %s", config.File)
+		}
+	}()
+	logInfof("Writing metrics to %s every %gs.", config.File, config.IntervalSeconds)
+	return func() {
+		close(stop)
+		<-done
+		os.Remove(config.File)
+	}
+}
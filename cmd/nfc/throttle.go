@@ -0,0 +1,60 @@
+package main
+
+import (
+	"slices"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+var throttleClasses = []string{device.ThrottleThermal, device.ThrottlePower}
+
+// readThrottle reads why the GPU's clocks are held back, logging when it
+// starts and stops throttling for heat or power and adding up how long it
+// did. Thermal throttling with the fans below full speed means the curve is
+// too lax.
+func readThrottle(monitor *DeviceMonitor) {
+	if monitor.HWMon != "" || monitor.ThrottleUnsupported {
+		return
+	}
+	reasons, ret := gpuBackend.DeviceGetCurrentClocksThrottleReasons(monitor.Handle)
+	if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+		monitor.ThrottleUnsupported = true
+		return
+	}
+	if ret != nvml.SUCCESS {
+		countError(monitor, "get_throttle_reasons")
+		return
+	}
+	now := clock()
+	active := device.ThrottleClasses(reasons)
+	for _, class := range throttleClasses {
+		since, was := monitor.ThrottleSince[class]
+		is := slices.Contains(active, class)
+		fields := logFields{"gpu_index": monitor.Index, "throttle": class, "temperature": monitor.Temperature, "fan_speeds": monitor.CurrentFanSpeeds}
+		switch {
+		case is && !was:
+			monitor.ThrottleSince[class] = now
+			fields.Warnf("GPU %d is %s throttling at %d°C, power %dW, fans %v%%.", monitor.Index, class, monitor.Temperature, monitor.PowerWatts, monitor.CurrentFanSpeeds)
+		case !is && was:
+			delete(monitor.ThrottleSince, class)
+			duration := now.Sub(since)
+			monitor.ThrottleSeconds[class] += duration.Seconds()
+			fields["duration_seconds"] = duration.Seconds()
+			fields.Infof("GPU %d stopped %s throttling after %s.", monitor.Index, class, duration.Round(time.Second))
+		}
+	}
+}
+
+// throttleTotals is the time spent throttling per class, including a
+// throttle still in progress.
+func throttleTotals(monitor *DeviceMonitor) map[string]float64 {
+	totals := map[string]float64{}
+	for class, seconds := range monitor.ThrottleSeconds {
+		totals[class] = seconds
+	}
+	for class, since := range monitor.ThrottleSince {
+		totals[class] += clock().Sub(since).Seconds()
+	}
+	return totals
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const sparkBlocks = "▁▂▃▄▅▆▇█"
+
+// sparkline draws values as block characters scaled between their minimum
+// and maximum.
+func sparkline(values []int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = min(low, v), max(high, v)
+	}
+	blocks := []rune(sparkBlocks)
+	var line strings.Builder
+	for _, v := range values {
+		level := 0
+		if high > low {
+			level = (v - low) * (len(blocks) - 1) / (high - low)
+		}
+		line.WriteRune(blocks[level])
+	}
+	return line.String()
+}
+
+// topHistory keeps the last samples of one GPU for the sparklines.
+type topHistory struct {
+	Temperatures []int
+	FanSpeeds []int
+}
+
+func (h *topHistory) add(d DeviceStatus, size int) {
+	h.Temperatures = append(h.Temperatures, d.Temperature)
+	speed := 0
+	if len(d.FanSpeeds) > 0 {
+		speed = d.FanSpeeds[0]
+	}
+	h.FanSpeeds = append(h.FanSpeeds, speed)
+	if len(h.Temperatures) > size {
+		h.Temperatures = h.Temperatures[len(h.Temperatures)-size:]
+		h.FanSpeeds = h.FanSpeeds[len(h.FanSpeeds)-size:]
+	}
+}
+
+func renderTop(status StatusSnapshot, histories map[string]*topHistory) string {
+	var screen strings.Builder
+	state := "running"
+	if status.Paused {
+		state = "paused"
+	}
+	if status.DryRun {
+		state += " (dry run)"
+	}
+	profile := status.Profile
+	if profile == "" {
+		profile = "top-level"
+	}
+	fmt.Fprintf(&screen, "nvidia-fan-control: %s, profile %s, updated %s    Ctrl-C to quit\n\n", state, profile, status.Time.Format("15:04:05"))
+	for _, d := range status.Devices {
+		fmt.Fprintf(&screen, "GPU %d  %-32s %4d°C", d.Index, d.Name, d.Temperature)
+		if d.RawTemperature != d.Temperature {
+			fmt.Fprintf(&screen, " (raw %d°C)", d.RawTemperature)
+		}
+		if d.TemperatureRange != nil {
+			fmt.Fprintf(&screen, "  range %d..%d°C", d.TemperatureRange.MinTemperature, d.TemperatureRange.MaxTemperature)
+		}
+		if d.PowerWatts >= 0 {
+			fmt.Fprintf(&screen, "  %dW", d.PowerWatts)
+		}
+		if d.Utilization >= 0 {
+			fmt.Fprintf(&screen, "  %d%% busy", d.Utilization)
+		}
+		screen.WriteString("\n")
+		notes := []string{}
+		if d.FailSafe {
+			notes = append(notes, "FAIL-SAFE")
+		}
+		if d.OverrideSpeed != nil {
+			notes = append(notes, fmt.Sprintf("pinned at %d%%", *d.OverrideSpeed))
+		}
+		if len(d.Errors) > 0 {
+			notes = append(notes, fmt.Sprintf("errors %v", d.Errors))
+		}
+		if len(notes) > 0 {
+			fmt.Fprintf(&screen, "  %s\n", strings.Join(notes, ", "))
+		}
+		for fanIdx, speed := range d.FanSpeeds {
+			fmt.Fprintf(&screen, "  fan%d %4d%%", fanIdx, speed)
+			if fanIdx < len(d.FanRPMs) && d.FanRPMs[fanIdx] >= 0 {
+				fmt.Fprintf(&screen, " %6d RPM", d.FanRPMs[fanIdx])
+			}
+			if fanIdx < len(d.FanFailed) && d.FanFailed[fanIdx] {
+				screen.WriteString("  FAILED")
+			}
+			screen.WriteString("\n")
+		}
+		if history := histories[d.UUID]; history != nil {
+			fmt.Fprintf(&screen, "  temp %s\n  fans %s\n", sparkline(history.Temperatures), sparkline(history.FanSpeeds))
+		}
+		screen.WriteString("\n")
+	}
+	return screen.String()
+}
+
+func cmdTop(args []string) {
+	flags := flag.NewFlagSet("top", flag.ExitOnError)
+	socketPath := flags.String("socket", defaultControlSocket, "path to the daemon control socket")
+	interval := flags.Duration("interval", time.Second, "refresh interval")
+	historySize := flags.Int("history", 60, "number of samples in the sparklines")
+	flags.Parse(args)
+	if *interval <= 0 || *historySize < 1 {
+		exitf("--interval and --history must be positive")
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, syscall.SIGINT, syscall.SIGTERM)
+	// Draw on the alternate screen with the cursor hidden, and put the
+	// terminal back on the way out.
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+	histories := map[string]*topHistory{}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		screen := ""
+		response, err := sendControlRequest(*socketPath, SocketRequest{Command: "status"})
+		if err != nil {
+			screen = fmt.Sprintf("nvidia-fan-control: daemon not reachable: %v\nRetrying every %s, Ctrl-C to quit.\n", err, *interval)
+		} else {
+			seen := map[string]bool{}
+			for _, d := range response.Status.Devices {
+				if histories[d.UUID] == nil {
+					histories[d.UUID] = &topHistory{}
+				}
+				histories[d.UUID].add(d, *historySize)
+				seen[d.UUID] = true
+			}
+			for uuid := range histories {
+				if !seen[uuid] {
+					delete(histories, uuid)
+				}
+			}
+			screen = renderTop(*response.Status, histories)
+		}
+		fmt.Print("\033[H\033[2J" + screen)
+		select {
+		case <-interrupted:
+			return
+		case <-ticker.C:
+		}
+	}
+}
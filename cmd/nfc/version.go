@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/device"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// buildRevision describes the commit the binary was built from, as recorded
+// by the Go toolchain.
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	revision, modified, built := "", false, ""
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		case "vcs.time":
+			built = setting.Value
+		}
+	}
+	if revision == "" {
+		return ""
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	if built != "" {
+		revision += ", " + built
+	}
+	return revision
+}
+
+// describeSupport prints value, or why it is not available.
+func describeSupport(ret nvml.Return, value string) string {
+	if ret != nvml.SUCCESS {
+		return "not available (" + nvml.ErrorString(ret) + ")"
+	}
+	return value
+}
+
+// printCapabilities reports what the daemon can read and set on a GPU, to
+// tell why a GPU is skipped or a feature does nothing.
+func printCapabilities(i int, handle nvml.Device) {
+	name, _ := gpuBackend.DeviceGetName(handle)
+	uuid, _ := gpuBackend.DeviceGetUUID(handle)
+	pciBusID := ""
+	if pciInfo, ret := gpuBackend.DeviceGetPciInfo(handle); ret == nvml.SUCCESS {
+		pciBusID = device.PCIBusID(pciInfo)
+	}
+	fmt.Printf("GPU %d: %s (%s, %s)\n", i, name, uuid, pciBusID)
+	fanAPI, ret := device.ProbeFanAPI(gpuBackend, handle)
+	switch {
+	case ret != nvml.SUCCESS:
+		fmt.Printf("  fans:          %s, skipped unless fan_backend is nvcontrol\n", describeSupport(ret, ""))
+	case fanAPI.NumFans <= 0:
+		fmt.Printf("  fans:          none, skipped\n")
+	default:
+		minSpeed, maxSpeed := device.FanSpeedLimits(gpuBackend, handle)
+		fmt.Printf("  fans:          %d, duty %d-%d%%\n", fanAPI.NumFans, minSpeed, maxSpeed)
+		policy, ret := gpuBackend.DeviceGetFanControlPolicy_v2(handle, 0)
+		mode := "automatic"
+		if policy == nvml.FAN_POLICY_MANUAL {
+			mode = "manual"
+		}
+		fmt.Printf("  fan control:   %s\n", describeSupport(ret, "supported, fan 0 is "+mode))
+		if fanAPI.Legacy || fanAPI.NoPolicy {
+			fmt.Printf("  legacy fans:   %s\n", describeFanAPI(fanAPI))
+		}
+		rpm, ret := gpuBackend.DeviceGetFanSpeedRPM(handle)
+		fmt.Printf("  tachometer:    %s\n", describeSupport(ret, fmt.Sprintf("%d RPM", rpm.Speed)))
+	}
+	for _, sensor := range []string{device.SensorGPU, device.SensorMemory} {
+		temp, ret := device.ReadTemperature(gpuBackend, handle, sensor)
+		fmt.Printf("  %-14s %s\n", sensor+" sensor:", describeSupport(ret, fmt.Sprintf("%d°C", temp)))
+	}
+	slowdown, ret := gpuBackend.DeviceGetTemperatureThreshold(handle, nvml.TEMPERATURE_THRESHOLD_SLOWDOWN)
+	fmt.Printf("  slowdown:      %s\n", describeSupport(ret, fmt.Sprintf("%d°C", slowdown)))
+	shutdown, ret := gpuBackend.DeviceGetTemperatureThreshold(handle, nvml.TEMPERATURE_THRESHOLD_SHUTDOWN)
+	fmt.Printf("  shutdown:      %s\n", describeSupport(ret, fmt.Sprintf("%d°C", shutdown)))
+	power, ret := gpuBackend.DeviceGetPowerUsage(handle)
+	fmt.Printf("  power:         %s\n", describeSupport(ret, fmt.Sprintf("%dW", power/1000)))
+	limit, ret := gpuBackend.DeviceGetPowerManagementLimit(handle)
+	fmt.Printf("  power limit:   %s\n", describeSupport(ret, fmt.Sprintf("%dW", limit/1000)))
+	utilization, ret := gpuBackend.DeviceGetUtilizationRates(handle)
+	fmt.Printf("  utilization:   %s\n", describeSupport(ret, fmt.Sprintf("%d%%", utilization.Gpu)))
+	_, ret = gpuBackend.DeviceGetCurrentClocksThrottleReasons(handle)
+	fmt.Printf("  throttling:    %s\n", describeSupport(ret, "reported"))
+}
+
+func cmdVersion(args []string) {
+	flags := flag.NewFlagSet("version", flag.ExitOnError)
+	short := flags.Bool("short", false, "print only the version, without querying NVML")
+	flags.Parse(args)
+	if *short {
+		fmt.Println(version)
+		return
+	}
+	fmt.Printf("nvidia-fan-control %s", version)
+	if revision := buildRevision(); revision != "" {
+		fmt.Printf(" (%s)", revision)
+	}
+	fmt.Printf("\n%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	nvmlCleanup, err := initNVML()
+	if err != nil {
+		exitf("%v", err)
+	}
+	defer nvmlCleanup()
+	nvmlVersion, ret := gpuBackend.SystemGetNVMLVersion()
+	fmt.Printf("NVML %s\n", describeSupport(ret, nvmlVersion))
+	driverVersion, ret := gpuBackend.SystemGetDriverVersion()
+	fmt.Printf("Driver %s\n", describeSupport(ret, driverVersion))
+	count, ret := gpuBackend.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		exitf("unable to get NVIDIA device count: %v", nvml.ErrorString(ret))
+	}
+	for i := 0; i < count; i++ {
+		handle, ret := gpuBackend.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			fmt.Printf("GPU %d: unavailable: %v\n", i, nvml.ErrorString(ret))
+			continue
+		}
+		printCapabilities(i, handle)
+	}
+}
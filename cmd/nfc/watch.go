@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"github.com/fsnotify/fsnotify"
+)
+
+func watchConfigFile(configFile string) (<-chan struct{}, func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	// Watch the directory rather than the file so editors that save by
+	// renaming a temporary file over the original are still picked up.
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		watcher.Close()
+		return nil, nil, fmt.Errorf("failed to watch %s: %w", configFile, err)
+	}
+	// Fragments in config.d are watched too, if the directory exists.
+	dropInDir := filepath.Join(filepath.Dir(configFile), "config.d")
+	watchingDropIns := watcher.Add(dropInDir) == nil
+	changed := make(chan struct{}, 1)
+	target := filepath.Clean(configFile)
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				relevant := name == target && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename)
+				// A removed fragment changes the merged config as well.
+				if watchingDropIns && filepath.Dir(name) == filepath.Clean(dropInDir) {
+					relevant = event.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename | fsnotify.Remove)
+				}
+				if !relevant {
+					continue
+				}
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logWarnf("Config watcher error: %v", err)
+			}
+		}
+	}()
+	logInfof("Watching %s for changes.", configFile)
+	return changed, func() { watcher.Close() }, nil
+}
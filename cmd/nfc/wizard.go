@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/curve"
+)
+
+// wizard asks its questions on out and reads the answers from in, one line
+// each. An empty answer takes the default.
+type wizard struct {
+	in *bufio.Reader
+	out io.Writer
+}
+
+func (w wizard) ask(question string, def string) string {
+	fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	line, err := w.in.ReadString('\n')
+	if err != nil && line == "" {
+		exitf("\ninit: no answer")
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+func (w wizard) askChoice(question string, def string, choices ...string) string {
+	for {
+		answer := strings.ToLower(w.ask(question+" ("+strings.Join(choices, "/")+")", def))
+		for _, choice := range choices {
+			if answer == choice || answer == choice[:1] {
+				return choice
+			}
+		}
+		fmt.Fprintf(w.out, "Please answer %s.\n", strings.Join(choices, " or "))
+	}
+}
+
+func formatPoints(points []CurvePoint) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = fmt.Sprintf("%d:%d", p.Temperature, p.FanSpeed)
+	}
+	return strings.Join(parts, " ")
+}
+
+// parsePoints reads "temperature:speed" pairs separated by spaces or commas.
+func parsePoints(text string) ([]CurvePoint, error) {
+	points := []CurvePoint{}
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == ',' }) {
+		temp, speed, ok := strings.Cut(field, ":")
+		t, err1 := strconv.Atoi(temp)
+		s, err2 := strconv.Atoi(strings.TrimSuffix(speed, "%"))
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%q is not temperature:speed", field)
+		}
+		points = append(points, CurvePoint{Temperature: t, FanSpeed: s})
+	}
+	return points, nil
+}
+
+// askCurve proposes the generated curve for gpu and lets the user replace
+// it until it is valid for the GPU's fans.
+func (w wizard) askCurve(gpu initProbe, mode string) initCurve {
+	points := curve.Generate(gpu.Slowdown, gpu.MinSpeed, gpu.MaxSpeed)
+	fmt.Fprintf(w.out, "\nGPU %d: %s, %d°C now, fans %d-%d%%, slowdown at %d°C.\n", gpu.Index, gpu.Name, gpu.Temperature, gpu.MinSpeed, gpu.MaxSpeed, gpu.Slowdown)
+	fmt.Fprintf(w.out, "Enter the curve as temperature:speed points, e.g. \"40:30 60:50 85:100\".\n")
+	for {
+		points, err := parsePoints(w.ask("Curve", formatPoints(points)))
+		if err == nil {
+			err = curve.ValidatePoints(points, 3)
+		}
+		for _, p := range points {
+			if err == nil && (p.FanSpeed < gpu.MinSpeed || p.FanSpeed > gpu.MaxSpeed) {
+				err = fmt.Errorf("%d%% at %d°C is outside the %d-%d%% the fans accept", p.FanSpeed, p.Temperature, gpu.MinSpeed, gpu.MaxSpeed)
+			}
+		}
+		if err == nil && points[len(points)-1].Temperature > gpu.Slowdown {
+			fmt.Fprintf(w.out, "Note: the curve only reaches %d%% at %d°C, above the %d°C slowdown.\n", points[len(points)-1].FanSpeed, points[len(points)-1].Temperature, gpu.Slowdown)
+		}
+		if err != nil {
+			fmt.Fprintf(w.out, "Invalid curve: %v\n", err)
+			continue
+		}
+		if mode == "interpolated" {
+			return initCurve{CurveMode: mode, CurvePoints: points, CurveHysteresis: 3}
+		}
+		return initCurve{CurveMode: mode, TemperatureRanges: curve.Steps(points, 3)}
+	}
+}
+
+// runWizard builds the config for gpus from the answers on in, and returns
+// it with the curve mode chosen.
+func runWizard(in io.Reader, out io.Writer, gpus []initProbe, mode string) (initConfig, string) {
+	w := wizard{in: bufio.NewReader(in), out: out}
+	config := initConfig{TimeToUpdate: 2}
+	if len(gpus) == 0 {
+		fmt.Fprintf(out, "No GPUs found; only the top-level curve will be written.\n")
+	}
+	mode = w.askChoice("Curve mode: stepped ranges or an interpolated curve", mode, "stepped", "interpolated")
+	for {
+		interval, err := strconv.ParseFloat(w.ask("Seconds between updates", "2"), 64)
+		if err == nil && interval > 0 {
+			config.TimeToUpdate = interval
+			break
+		}
+		fmt.Fprintf(out, "Please enter a positive number.\n")
+	}
+	var previous *initCurve
+	for _, gpu := range gpus {
+		if previous != nil && w.askChoice(fmt.Sprintf("Use the same curve for GPU %d (%s)", gpu.Index, gpu.Name), "no", "yes", "no") == "yes" {
+			config.GPUs = append(config.GPUs, initGPU{UUID: gpu.UUID, Name: gpu.Name, initCurve: *previous})
+			continue
+		}
+		gpuCurve := w.askCurve(gpu, mode)
+		config.GPUs = append(config.GPUs, initGPU{UUID: gpu.UUID, Name: gpu.Name, initCurve: gpuCurve})
+		previous = &gpuCurve
+	}
+	fmt.Fprintln(out)
+	return config, mode
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"time"
+)
+
+// Every GPU is updated by a worker goroutine of its own, on its own
+// interval, so a slow or failing NVML call on one card does not hold up the
+// others. The monitoring loop keeps everything else: commands, reloads,
+// schedules and status. Each monitor's lock is held by its worker for the
+// duration of an update, and by the loop whenever it touches the monitors.
+
+// startWorkers starts a worker for every monitor.
+func (d *Daemon) startWorkers() {
+	d.workersStop = make(chan struct{})
+	d.workersDone = make([]chan struct{}, len(d.Monitors))
+	for i := range d.Monitors {
+		done := make(chan struct{})
+		d.workersDone[i] = done
+		go d.runWorker(&d.Monitors[i], d.workersStop, done)
+	}
+}
+
+// stopWorkers stops the workers, waiting for updates in progress.
+func (d *Daemon) stopWorkers() {
+	if d.workersStop == nil {
+		return
+	}
+	close(d.workersStop)
+	for _, done := range d.workersDone {
+		<-done
+	}
+	d.workersStop, d.workersDone = nil, nil
+}
+
+// exclusive runs change with no worker running, for changes to the set of
+// monitors such as rescans and NVML recovery.
+func (d *Daemon) exclusive(change func()) {
+	d.stopWorkers()
+	defer d.startWorkers()
+	change()
+}
+
+func (d *Daemon) runWorker(monitor *DeviceMonitor, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	timer := time.NewTimer(time.Until(monitor.NextUpdate))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		monitor.mu.Lock()
+		now := time.Now()
+		switch {
+		case now.Before(monitor.NextUpdate):
+			// The loop updated the GPU in the meantime, e.g. for a
+			// profile switch.
+		case d.nvmlDown || monitor.Lost:
+			// The loop is recovering NVML; check again later.
+			monitor.NextUpdate = now.Add(updateInterval(monitor))
+		default:
+			d.updateMonitor(monitor)
+			monitor.UpdateDuration = time.Since(now)
+			monitor.Interval = updateInterval(monitor)
+			monitor.NextUpdate = now.Add(monitor.Interval)
+		}
+		wait := time.Until(monitor.NextUpdate)
+		monitor.mu.Unlock()
+		timer.Reset(wait)
+	}
+}
+
+// lockMonitors takes every monitor's lock for the loop. It never keeps some
+// of them while waiting for another, so a worker stuck in a slow NVML call
+// holds up the loop but not the other workers.
+func (d *Daemon) lockMonitors() {
+	for {
+		locked := 0
+		for locked < len(d.Monitors) && d.Monitors[locked].mu.TryLock() {
+			locked++
+		}
+		if locked == len(d.Monitors) {
+			return
+		}
+		for i := 0; i < locked; i++ {
+			d.Monitors[i].mu.Unlock()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (d *Daemon) unlockMonitors() {
+	for i := range d.Monitors {
+		d.Monitors[i].mu.Unlock()
+	}
+}
+
+// longestUpdate is the duration of the slowest last update, reported as the
+// loop duration.
+func longestUpdate(monitors []DeviceMonitor) time.Duration {
+	longest := time.Duration(0)
+	for i := range monitors {
+		longest = max(longest, monitors[i].UpdateDuration)
+	}
+	return longest
+}
@@ -0,0 +1,133 @@
+// Package curve turns temperatures into fan speeds. It has no knowledge of
+// the hardware: callers feed it readings and the speed they last applied,
+// and apply the result themselves.
+package curve
+
+import (
+	"fmt"
+	"math"
+)
+
+// Point is one point of an interpolated curve.
+type Point struct {
+	Temperature int `json:"temperature"`
+	FanSpeed int `json:"fan_speed"`
+}
+
+// Range is one step of a stepped curve. The fans only leave a range
+// downward once the temperature drops Hysteresis degrees below its minimum,
+// and, with DownshiftDelaySeconds, has stayed there that long.
+type Range struct {
+	MinTemperature int `json:"min_temperature"`
+	MaxTemperature int `json:"max_temperature"`
+	FanSpeed int `json:"fan_speed"`
+	Hysteresis int `json:"hysteresis"`
+	MinDwellSeconds float64 `json:"min_dwell_seconds"`
+	DownshiftDelaySeconds float64 `json:"downshift_delay_seconds"`
+}
+
+// Interpolate reads the speed for temp off the curve, linearly between
+// points and flat beyond the first and last one. points must be sorted by
+// temperature and not empty.
+func Interpolate(temp int, points []Point) int {
+	if temp <= points[0].Temperature {
+		return points[0].FanSpeed
+	}
+	for i := 1; i < len(points); i++ {
+		lower, upper := points[i-1], points[i]
+		if temp <= upper.Temperature {
+			fraction := float64(temp-lower.Temperature) / float64(upper.Temperature-lower.Temperature)
+			return lower.FanSpeed + int(math.Round(fraction*float64(upper.FanSpeed-lower.FanSpeed)))
+		}
+	}
+	return points[len(points)-1].FanSpeed
+}
+
+// InterpolateWithHysteresis is Interpolate for fans currently at
+// currentSpeed. Speeds rise with the curve at once, but on the way down
+// the curve is read hysteresis degrees higher, so the fans only slow once
+// the GPU has cooled past the band.
+func InterpolateWithHysteresis(temp int, currentSpeed int, points []Point, hysteresis int) int {
+	idealSpeed := Interpolate(temp, points)
+	if idealSpeed >= currentSpeed {
+		return idealSpeed
+	}
+	laggedSpeed := Interpolate(temp+hysteresis, points)
+	if laggedSpeed < idealSpeed {
+		laggedSpeed = idealSpeed
+	}
+	if laggedSpeed < currentSpeed {
+		return laggedSpeed
+	}
+	return currentSpeed
+}
+
+// Step picks the speed of a stepped curve for fans at currentSpeed whose
+// last range was current (the zero Range if none). The last range
+// containing temp wins. It returns the speed and the range that now
+// applies; a temperature no range covers keeps the current speed.
+func Step(temp int, currentSpeed int, current Range, ranges []Range) (int, Range) {
+	idealSpeed := currentSpeed
+	var idealRange Range
+	for _, r := range ranges {
+		if temp >= r.MinTemperature && temp <= r.MaxTemperature {
+			idealSpeed = r.FanSpeed
+			idealRange = r
+		}
+	}
+	if idealSpeed > currentSpeed {
+		return idealSpeed, idealRange
+	}
+	if idealSpeed < currentSpeed {
+		if current.MaxTemperature == 0 || temp <= current.MinTemperature-current.Hysteresis {
+			return idealSpeed, idealRange
+		}
+		return currentSpeed, current
+	}
+	if idealRange.MaxTemperature != 0 {
+		return currentSpeed, idealRange
+	}
+	return currentSpeed, current
+}
+
+// LimitChange steps from current toward target by at most maxChange, or
+// goes straight to target if maxChange is not positive. A current speed
+// of -1 stands for an unknown state and is also set directly.
+func LimitChange(current, target, maxChange int) int {
+	if maxChange <= 0 || current < 0 {
+		return target
+	}
+	if target > current+maxChange {
+		return current + maxChange
+	}
+	if target < current-maxChange {
+		return current - maxChange
+	}
+	return target
+}
+
+// ValidatePoints checks that points form a usable curve: fan speeds within
+// 0-100, strictly rising temperatures and a non-negative hysteresis.
+func ValidatePoints(points []Point, hysteresis int) error {
+	return ValidatePointsMax(points, hysteresis, 100)
+}
+
+// ValidatePointsMax is ValidatePoints for a curve whose speeds go up to
+// maxSpeed, such as one in RPM.
+func ValidatePointsMax(points []Point, hysteresis int, maxSpeed int) error {
+	if len(points) == 0 {
+		return fmt.Errorf("curve_mode is interpolated but no curve_points defined")
+	}
+	for i, p := range points {
+		if p.FanSpeed < 0 || p.FanSpeed > maxSpeed {
+			return fmt.Errorf("curve_points[%d]: fan_speed (%d) is outside 0-%d", i, p.FanSpeed, maxSpeed)
+		}
+		if i > 0 && p.Temperature <= points[i-1].Temperature {
+			return fmt.Errorf("curve_points[%d]: temperature (%d) must be greater than the previous point (%d)", i, p.Temperature, points[i-1].Temperature)
+		}
+	}
+	if hysteresis < 0 {
+		return fmt.Errorf("curve_hysteresis (%d) is negative", hysteresis)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package curve
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPoints = []Point{{Temperature: 40, FanSpeed: 30}, {Temperature: 60, FanSpeed: 50}, {Temperature: 80, FanSpeed: 100}}
+
+func TestInterpolate(t *testing.T) {
+	tests := []struct {
+		temp int
+		want int
+	}{
+		{30, 30},
+		{40, 30},
+		{50, 40},
+		{70, 75},
+		{80, 100},
+		{90, 100},
+	}
+	for _, test := range tests {
+		if got := Interpolate(test.temp, testPoints); got != test.want {
+			t.Errorf("Interpolate(%d) = %d, want %d", test.temp, got, test.want)
+		}
+	}
+}
+
+func TestInterpolateWithHysteresis(t *testing.T) {
+	tests := []struct {
+		name string
+		temp int
+		current int
+		hysteresis int
+		want int
+	}{
+		{"rises at once", 50, 30, 5, 40},
+		{"holds within the band", 50, 45, 5, 45},
+		{"drops to the lagged curve", 50, 60, 5, 45},
+		{"no hysteresis follows the curve", 50, 60, 0, 40},
+		{"unchanged at the curve", 50, 40, 5, 40},
+	}
+	for _, test := range tests {
+		if got := InterpolateWithHysteresis(test.temp, test.current, testPoints, test.hysteresis); got != test.want {
+			t.Errorf("%s: InterpolateWithHysteresis(%d, %d, %d) = %d, want %d", test.name, test.temp, test.current, test.hysteresis, got, test.want)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	ranges := []Range{
+		{MinTemperature: -999, MaxTemperature: 50, FanSpeed: 30},
+		{MinTemperature: 50, MaxTemperature: 60, FanSpeed: 50, Hysteresis: 5},
+		{MinTemperature: 60, MaxTemperature: 999, FanSpeed: 100, Hysteresis: 2},
+	}
+	tests := []struct {
+		name string
+		temp int
+		current int
+		currentRange Range
+		want int
+		wantRange Range
+	}{
+		{"steps up", 55, 30, Range{}, 50, ranges[1]},
+		{"stays in its range", 52, 50, ranges[1], 50, ranges[1]},
+		{"holds within the hysteresis", 47, 50, ranges[1], 50, ranges[1]},
+		{"steps down past the hysteresis", 45, 50, ranges[1], 30, ranges[0]},
+		{"last matching range wins", 50, 30, ranges[0], 50, ranges[1]},
+		{"no current range steps down at once", 40, 50, Range{}, 30, ranges[0]},
+		{"uncovered temperature keeps the speed", 1000, 40, ranges[2], 40, ranges[2]},
+	}
+	for _, test := range tests {
+		got, gotRange := Step(test.temp, test.current, test.currentRange, ranges)
+		if got != test.want || gotRange != test.wantRange {
+			t.Errorf("%s: Step(%d, %d) = %d, %+v, want %d, %+v", test.name, test.temp, test.current, got, gotRange, test.want, test.wantRange)
+		}
+	}
+}
+
+func TestLimitChange(t *testing.T) {
+	tests := []struct {
+		current int
+		target int
+		maxChange int
+		want int
+	}{
+		{30, 80, 10, 40},
+		{80, 30, 10, 70},
+		{30, 35, 10, 35},
+		{30, 80, 0, 80},
+		{-1, 80, 10, 80},
+	}
+	for _, test := range tests {
+		if got := LimitChange(test.current, test.target, test.maxChange); got != test.want {
+			t.Errorf("LimitChange(%d, %d, %d) = %d, want %d", test.current, test.target, test.maxChange, got, test.want)
+		}
+	}
+}
+
+func TestValidatePoints(t *testing.T) {
+	tests := []struct {
+		name string
+		points []Point
+		hysteresis int
+		maxSpeed int
+		err string
+	}{
+		{"valid", testPoints, 3, 100, ""},
+		{"empty", nil, 0, 100, "no curve_points"},
+		{"speed above the maximum", []Point{{Temperature: 40, FanSpeed: 101}}, 0, 100, "outside 0-100"},
+		{"negative speed", []Point{{Temperature: 40, FanSpeed: -1}}, 0, 100, "outside 0-100"},
+		{"temperatures not rising", []Point{{Temperature: 40, FanSpeed: 30}, {Temperature: 40, FanSpeed: 50}}, 0, 100, "must be greater"},
+		{"negative hysteresis", testPoints, -1, 100, "negative"},
+		{"rpm curve", []Point{{Temperature: 40, FanSpeed: 1200}, {Temperature: 80, FanSpeed: 3000}}, 0, 3000, ""},
+	}
+	for _, test := range tests {
+		checkError(t, test.name, ValidatePointsMax(test.points, test.hysteresis, test.maxSpeed), test.err)
+	}
+	checkError(t, "ValidatePoints", ValidatePoints([]Point{{Temperature: 40, FanSpeed: 1200}}, 0), "outside 0-100")
+}
+
+func TestValidateRanges(t *testing.T) {
+	valid := Range{MinTemperature: 40, MaxTemperature: 60, FanSpeed: 50, Hysteresis: 2}
+	with := func(change func(r *Range)) []Range {
+		r := valid
+		change(&r)
+		return []Range{r}
+	}
+	tests := []struct {
+		name string
+		ranges []Range
+		err string
+	}{
+		{"valid", []Range{valid}, ""},
+		{"empty", nil, "no temperature_ranges"},
+		{"min above max", with(func(r *Range) { r.MinTemperature = 70 }), "greater than max_temperature"},
+		{"speed above 100", with(func(r *Range) { r.FanSpeed = 101 }), "outside 0-100"},
+		{"negative hysteresis", with(func(r *Range) { r.Hysteresis = -1 }), "hysteresis (-1)"},
+		{"negative dwell", with(func(r *Range) { r.MinDwellSeconds = -1 }), "min_dwell_seconds"},
+		{"negative downshift delay", with(func(r *Range) { r.DownshiftDelaySeconds = -1 }), "downshift_delay_seconds"},
+	}
+	for _, test := range tests {
+		checkError(t, test.name, ValidateRanges(test.ranges), test.err)
+	}
+	checkError(t, "rpm ranges", ValidateRangesMax(with(func(r *Range) { r.FanSpeed = 2500 }), 3000), "")
+}
+
+func TestCheckRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		ranges []Range
+		warning string
+	}{
+		{"contiguous", []Range{{MinTemperature: -999, MaxTemperature: 50}, {MinTemperature: 51, MaxTemperature: 999}}, ""},
+		{"gap", []Range{{MinTemperature: -999, MaxTemperature: 50}, {MinTemperature: 55, MaxTemperature: 999}}, "no range covers 51..54"},
+		{"overlap", []Range{{MinTemperature: -999, MaxTemperature: 60}, {MinTemperature: 50, MaxTemperature: 999}}, "overlaps"},
+		{"shadowed", []Range{{MinTemperature: 40, MaxTemperature: 50}, {MinTemperature: -999, MaxTemperature: 999}}, "can never be reached"},
+	}
+	for _, test := range tests {
+		warnings := strings.Join(CheckRanges(test.ranges), "\n")
+		if test.warning == "" && warnings != "" || !strings.Contains(warnings, test.warning) {
+			t.Errorf("%s: CheckRanges() = %q, want %q", test.name, warnings, test.warning)
+		}
+	}
+}
+
+func TestPIDConfigValidate(t *testing.T) {
+	valid := PIDConfig{TargetTemperature: 70, Kp: 2, MinFanSpeed: 20, MaxFanSpeed: 100}
+	with := func(change func(c *PIDConfig)) PIDConfig {
+		c := valid
+		change(&c)
+		return c
+	}
+	tests := []struct {
+		name string
+		config PIDConfig
+		err string
+	}{
+		{"valid", valid, ""},
+		{"no target", with(func(c *PIDConfig) { c.TargetTemperature = 0 }), "target_temperature"},
+		{"negative gain", with(func(c *PIDConfig) { c.Ki = -1 }), "must not be negative"},
+		{"all gains zero", with(func(c *PIDConfig) { c.Kp = 0 }), "all zero"},
+		{"min above max", with(func(c *PIDConfig) { c.MinFanSpeed = 80; c.MaxFanSpeed = 60 }), "min <= max"},
+		{"max above 100", with(func(c *PIDConfig) { c.MaxFanSpeed = 101 }), "within 0-100"},
+	}
+	for _, test := range tests {
+		checkError(t, test.name, test.config.Validate(), test.err)
+	}
+}
+
+func TestPID(t *testing.T) {
+	start := time.Unix(0, 0)
+	type sample struct {
+		seconds int
+		temp int
+		want int
+	}
+	tests := []struct {
+		name string
+		config PIDConfig
+		samples []sample
+	}{
+		{
+			"proportional, clamped to the limits",
+			PIDConfig{TargetTemperature: 70, Kp: 2, MinFanSpeed: 20, MaxFanSpeed: 100},
+			[]sample{{0, 80, 20}, {1, 90, 40}, {2, 60, 20}, {3, 200, 100}},
+		},
+		{
+			// The integral stops growing while the output is saturated, so
+			// it comes off the maximum as soon as the error turns.
+			"integral without windup",
+			PIDConfig{TargetTemperature: 70, Ki: 1, MaxFanSpeed: 100},
+			[]sample{{0, 80, 0}, {10, 80, 100}, {20, 80, 100}, {30, 70, 100}, {40, 60, 0}},
+		},
+		{
+			"derivative",
+			PIDConfig{TargetTemperature: 50, Kd: 1, MaxFanSpeed: 100},
+			[]sample{{0, 70, 0}, {2, 80, 5}},
+		},
+	}
+	for _, test := range tests {
+		pid := &PID{Config: test.config}
+		for i, s := range test.samples {
+			if got := pid.Speed(s.temp, start.Add(time.Duration(s.seconds)*time.Second)); got != s.want {
+				t.Errorf("%s: sample %d: Speed(%d) = %d, want %d", test.name, i, s.temp, got, s.want)
+			}
+		}
+	}
+}
+
+func checkError(t *testing.T, name string, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("%s: unexpected error: %v", name, err)
+	case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+		t.Errorf("%s: error %v, want one containing %q", name, err, want)
+	}
+}
@@ -0,0 +1,51 @@
+package curve
+
+// Generate builds a default curve for a GPU that starts throttling at
+// slowdown degrees and accepts fan speeds of minSpeed-maxSpeed. The fans
+// idle up to 40°C (or 20 degrees below full speed on cooler thresholds),
+// then rise slowly at first and steeply towards maxSpeed, which is reached
+// five degrees before the slowdown.
+func Generate(slowdown int, minSpeed int, maxSpeed int) []Point {
+	full := slowdown - 5
+	quiet := 40
+	if quiet > full-20 {
+		quiet = full - 20
+	}
+	high := maxSpeed
+	if high <= 0 || high > 100 {
+		high = 100
+	}
+	low := minSpeed
+	if low < 30 {
+		low = 30
+	}
+	if low > high {
+		low = high
+	}
+	points := []Point{}
+	for i, share := range []float64{0, 0.3, 0.6, 1} {
+		points = append(points, Point{
+			Temperature: quiet + i*(full-quiet)/3,
+			FanSpeed: low + int(share*float64(high-low)+0.5),
+		})
+	}
+	points[len(points)-1].Temperature = full
+	return points
+}
+
+// Steps turns a curve into ranges for a stepped curve: one range between
+// each pair of points at the speed the curve has halfway, and one below the
+// first and above the last point, extending to -999 and 999.
+func Steps(points []Point, hysteresis int) []Range {
+	ranges := []Range{{MinTemperature: -999, MaxTemperature: points[0].Temperature, FanSpeed: points[0].FanSpeed}}
+	for i := 1; i < len(points); i++ {
+		ranges = append(ranges, Range{
+			MinTemperature: points[i-1].Temperature,
+			MaxTemperature: points[i].Temperature,
+			FanSpeed: Interpolate((points[i-1].Temperature+points[i].Temperature)/2, points),
+			Hysteresis: hysteresis,
+		})
+	}
+	last := points[len(points)-1]
+	return append(ranges, Range{MinTemperature: last.Temperature, MaxTemperature: 999, FanSpeed: last.FanSpeed})
+}
@@ -0,0 +1,68 @@
+package curve
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// PIDConfig tunes a PID curve that holds the GPU at TargetTemperature.
+type PIDConfig struct {
+	TargetTemperature int `json:"target_temperature"`
+	Kp float64 `json:"kp"`
+	Ki float64 `json:"ki"`
+	Kd float64 `json:"kd"`
+	MinFanSpeed int `json:"min_fan_speed"`
+	MaxFanSpeed int `json:"max_fan_speed"`
+}
+
+// PID is a PID controller. The zero value of everything but Config is
+// ready to use; it is not safe for concurrent use.
+type PID struct {
+	Config PIDConfig
+	integral float64
+	lastError float64
+	lastUpdate time.Time
+}
+
+// Speed returns the fan speed for temp read at now, clamped to the
+// configured limits. The first call has no derivative or integral term.
+func (c *PID) Speed(temp int, now time.Time) int {
+	err := float64(temp - c.Config.TargetTemperature)
+	derivative := 0.0
+	dt := 0.0
+	if !c.lastUpdate.IsZero() {
+		dt = now.Sub(c.lastUpdate).Seconds()
+		if dt > 0 {
+			derivative = (err - c.lastError) / dt
+		}
+	}
+	c.lastError = err
+	c.lastUpdate = now
+	minSpeed, maxSpeed := float64(c.Config.MinFanSpeed), float64(c.Config.MaxFanSpeed)
+	output := c.Config.Kp*err + c.Config.Ki*(c.integral+err*dt) + c.Config.Kd*derivative
+	// Only accumulate the integral while the output is not saturated in the
+	// direction of the error, otherwise it winds up and overshoots later.
+	if !(output > maxSpeed && err > 0) && !(output < minSpeed && err < 0) {
+		c.integral += err * dt
+	}
+	output = math.Max(minSpeed, math.Min(maxSpeed, output))
+	return int(math.Round(output))
+}
+
+// Validate checks the gains and limits of the PID curve.
+func (config PIDConfig) Validate() error {
+	if config.TargetTemperature <= 0 {
+		return fmt.Errorf("curve_mode is pid but pid.target_temperature is not set")
+	}
+	if config.Kp < 0 || config.Ki < 0 || config.Kd < 0 {
+		return fmt.Errorf("pid gains must not be negative (kp=%g, ki=%g, kd=%g)", config.Kp, config.Ki, config.Kd)
+	}
+	if config.Kp == 0 && config.Ki == 0 && config.Kd == 0 {
+		return fmt.Errorf("pid gains are all zero")
+	}
+	if config.MinFanSpeed < 0 || config.MaxFanSpeed > 100 || config.MinFanSpeed > config.MaxFanSpeed {
+		return fmt.Errorf("pid fan speed limits (%d-%d) must be within 0-100 and min <= max", config.MinFanSpeed, config.MaxFanSpeed)
+	}
+	return nil
+}
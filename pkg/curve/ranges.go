@@ -0,0 +1,90 @@
+package curve
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ValidateRanges checks the ranges of a stepped curve one by one.
+func ValidateRanges(ranges []Range) error {
+	return ValidateRangesMax(ranges, 100)
+}
+
+// ValidateRangesMax is ValidateRanges for a curve whose speeds go up to
+// maxSpeed, such as one in RPM.
+func ValidateRangesMax(ranges []Range, maxSpeed int) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("no temperature_ranges defined")
+	}
+	for i, r := range ranges {
+		if r.MinTemperature > r.MaxTemperature {
+			return fmt.Errorf("temperature_ranges[%d]: min_temperature (%d) is greater than max_temperature (%d)", i, r.MinTemperature, r.MaxTemperature)
+		}
+		if r.FanSpeed < 0 || r.FanSpeed > maxSpeed {
+			return fmt.Errorf("temperature_ranges[%d]: fan_speed (%d) is outside 0-%d", i, r.FanSpeed, maxSpeed)
+		}
+		if r.Hysteresis < 0 {
+			return fmt.Errorf("temperature_ranges[%d]: hysteresis (%d) is negative", i, r.Hysteresis)
+		}
+		if r.MinDwellSeconds < 0 {
+			return fmt.Errorf("temperature_ranges[%d]: min_dwell_seconds (%g) is negative", i, r.MinDwellSeconds)
+		}
+		if r.DownshiftDelaySeconds < 0 {
+			return fmt.Errorf("temperature_ranges[%d]: downshift_delay_seconds (%g) is negative", i, r.DownshiftDelaySeconds)
+		}
+	}
+	return nil
+}
+
+// CheckRanges reports range layouts that pass ValidateRanges but misbehave:
+// the last matching range wins, and a temperature no range covers keeps the
+// fans at whatever speed they last had.
+func CheckRanges(ranges []Range) []string {
+	warnings := []string{}
+	order := make([]int, len(ranges))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return ranges[order[a]].MinTemperature < ranges[order[b]].MinTemperature
+	})
+	for n := 1; n < len(order); n++ {
+		prev, cur := ranges[order[n-1]], ranges[order[n]]
+		switch {
+		case cur.MinTemperature < prev.MaxTemperature:
+			warnings = append(warnings, fmt.Sprintf("temperature_ranges[%d] (%d..%d) overlaps temperature_ranges[%d] (%d..%d)",
+				order[n], cur.MinTemperature, cur.MaxTemperature, order[n-1], prev.MinTemperature, prev.MaxTemperature))
+		case cur.MinTemperature > prev.MaxTemperature+1:
+			warnings = append(warnings, fmt.Sprintf("no range covers %d..%d°C between temperature_ranges[%d] and temperature_ranges[%d]; the fan speed is left unchanged there",
+				prev.MaxTemperature+1, cur.MinTemperature-1, order[n-1], order[n]))
+		}
+	}
+	for i, r := range ranges {
+		if r.MinTemperature > r.MaxTemperature {
+			continue
+		}
+		// Subtract every later range, which takes precedence, and see if any
+		// temperature is left for this one.
+		uncovered := [][2]int{{r.MinTemperature, r.MaxTemperature}}
+		for _, later := range ranges[i+1:] {
+			remaining := [][2]int{}
+			for _, span := range uncovered {
+				if later.MaxTemperature < span[0] || later.MinTemperature > span[1] {
+					remaining = append(remaining, span)
+					continue
+				}
+				if later.MinTemperature > span[0] {
+					remaining = append(remaining, [2]int{span[0], later.MinTemperature - 1})
+				}
+				if later.MaxTemperature < span[1] {
+					remaining = append(remaining, [2]int{later.MaxTemperature + 1, span[1]})
+				}
+			}
+			uncovered = remaining
+		}
+		if len(uncovered) == 0 {
+			warnings = append(warnings, fmt.Sprintf("temperature_ranges[%d] (%d..%d) can never be reached, later ranges cover all of it", i, r.MinTemperature, r.MaxTemperature))
+		}
+	}
+	return warnings
+}
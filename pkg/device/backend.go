@@ -0,0 +1,54 @@
+package device
+
+import (
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// GPUBackend is the part of the NVML API the fan controller uses. The
+// library returned by NVML implements it, and so does Fake, which lets the
+// control logic run without a GPU.
+type GPUBackend interface {
+	Init() nvml.Return
+	Shutdown() nvml.Return
+	SystemGetDriverVersion() (string, nvml.Return)
+	SystemGetNVMLVersion() (string, nvml.Return)
+	DeviceGetCount() (int, nvml.Return)
+	DeviceGetHandleByIndex(index int) (nvml.Device, nvml.Return)
+	DeviceGetHandleByUUID(uuid string) (nvml.Device, nvml.Return)
+	DeviceGetName(device nvml.Device) (string, nvml.Return)
+	DeviceGetUUID(device nvml.Device) (string, nvml.Return)
+	DeviceGetPciInfo(device nvml.Device) (nvml.PciInfo, nvml.Return)
+	DeviceGetTemperature(device nvml.Device, sensor nvml.TemperatureSensors) (uint32, nvml.Return)
+	DeviceGetTemperatureThreshold(device nvml.Device, threshold nvml.TemperatureThresholds) (uint32, nvml.Return)
+	DeviceGetFieldValues(device nvml.Device, values []nvml.FieldValue) nvml.Return
+	DeviceGetPowerUsage(device nvml.Device) (uint32, nvml.Return)
+	DeviceGetUtilizationRates(device nvml.Device) (nvml.Utilization, nvml.Return)
+	DeviceGetCurrentClocksThrottleReasons(device nvml.Device) (uint64, nvml.Return)
+	DeviceGetPowerManagementLimit(device nvml.Device) (uint32, nvml.Return)
+	DeviceGetPowerManagementLimitConstraints(device nvml.Device) (uint32, uint32, nvml.Return)
+	DeviceSetPowerManagementLimit(device nvml.Device, limit uint32) nvml.Return
+	DeviceGetPersistenceMode(device nvml.Device) (nvml.EnableState, nvml.Return)
+	DeviceSetPersistenceMode(device nvml.Device, mode nvml.EnableState) nvml.Return
+	DeviceGetComputeRunningProcesses(device nvml.Device) ([]nvml.ProcessInfo, nvml.Return)
+	DeviceGetGraphicsRunningProcesses(device nvml.Device) ([]nvml.ProcessInfo, nvml.Return)
+	SystemGetProcessName(pid int) (string, nvml.Return)
+	DeviceGetNumFans(device nvml.Device) (int, nvml.Return)
+	DeviceGetFanSpeed(device nvml.Device) (uint32, nvml.Return)
+	DeviceGetFanSpeed_v2(device nvml.Device, fan int) (uint32, nvml.Return)
+	DeviceGetTargetFanSpeed(device nvml.Device, fan int) (int, nvml.Return)
+	DeviceGetFanSpeedRPM(device nvml.Device) (nvml.FanSpeedInfo, nvml.Return)
+	DeviceGetMinMaxFanSpeed(device nvml.Device) (int, int, nvml.Return)
+	DeviceSetFanSpeed_v2(device nvml.Device, fan int, speed int) nvml.Return
+	DeviceGetFanControlPolicy_v2(device nvml.Device, fan int) (nvml.FanControlPolicy, nvml.Return)
+	DeviceSetFanControlPolicy(device nvml.Device, fan int, policy nvml.FanControlPolicy) nvml.Return
+	DeviceSetDefaultFanSpeed_v2(device nvml.Device, fan int) nvml.Return
+}
+
+// NVML returns the real NVML library, loaded from libraryPath or from the
+// default location if it is empty.
+func NVML(libraryPath string) GPUBackend {
+	if libraryPath == "" {
+		return nvml.New()
+	}
+	return nvml.New(nvml.WithLibraryPath(libraryPath))
+}
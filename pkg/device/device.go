@@ -0,0 +1,129 @@
+// Package device wraps the NVML calls the fan controller needs: reading the
+// temperature sensors, the fan limits and the PCI identity of a GPU, and
+// telling transient NVML failures from permanent ones. Every call goes
+// through a GPUBackend, which the caller must have initialized.
+package device
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// Sensors accepted by ReadTemperature.
+const (
+	SensorGPU = "gpu"
+	SensorMemory = "memory"
+)
+
+// ReadTemperature reads a temperature sensor in °C; an empty sensor means
+// SensorGPU. The memory junction is only reported through field values, and
+// only by boards with GDDR6X or HBM.
+func ReadTemperature(gpu GPUBackend, device nvml.Device, sensor string) (int, nvml.Return) {
+	if sensor != SensorMemory {
+		temp, ret := gpu.DeviceGetTemperature(device, nvml.TEMPERATURE_GPU)
+		return int(temp), ret
+	}
+	values := []nvml.FieldValue{{FieldId: nvml.FI_DEV_MEMORY_TEMP}}
+	if ret := gpu.DeviceGetFieldValues(device, values); ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	if ret := nvml.Return(values[0].NvmlReturn); ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	return FieldValueInt(values[0]), nvml.SUCCESS
+}
+
+// FieldValueInt decodes a field value of any numeric type, rounding
+// floating-point ones.
+func FieldValueInt(value nvml.FieldValue) int {
+	raw := value.Value[:]
+	switch nvml.ValueType(value.ValueType) {
+	case nvml.VALUE_TYPE_DOUBLE:
+		return int(math.Round(math.Float64frombits(binary.LittleEndian.Uint64(raw))))
+	case nvml.VALUE_TYPE_UNSIGNED_LONG, nvml.VALUE_TYPE_UNSIGNED_LONG_LONG:
+		return int(binary.LittleEndian.Uint64(raw))
+	case nvml.VALUE_TYPE_SIGNED_LONG_LONG:
+		return int(int64(binary.LittleEndian.Uint64(raw)))
+	case nvml.VALUE_TYPE_SIGNED_INT:
+		return int(int32(binary.LittleEndian.Uint32(raw)))
+	case nvml.VALUE_TYPE_UNSIGNED_SHORT:
+		return int(binary.LittleEndian.Uint16(raw))
+	default:
+		return int(binary.LittleEndian.Uint32(raw))
+	}
+}
+
+// FanSpeedLimits returns the duty range the device accepts, or 0-100 if the
+// driver does not report one.
+func FanSpeedLimits(gpu GPUBackend, device nvml.Device) (int, int) {
+	minSpeed, maxSpeed, ret := gpu.DeviceGetMinMaxFanSpeed(device)
+	if ret != nvml.SUCCESS || maxSpeed <= 0 || minSpeed > maxSpeed {
+		return 0, 100
+	}
+	return minSpeed, maxSpeed
+}
+
+// SlowdownTemperature returns the temperature at which the device starts
+// throttling. Drivers that only report the shutdown threshold get a value
+// ten degrees below it; ok is false if neither is known.
+func SlowdownTemperature(gpu GPUBackend, device nvml.Device) (int, bool) {
+	if temp, ret := gpu.DeviceGetTemperatureThreshold(device, nvml.TEMPERATURE_THRESHOLD_SLOWDOWN); ret == nvml.SUCCESS && temp > 0 {
+		return int(temp), true
+	}
+	if temp, ret := gpu.DeviceGetTemperatureThreshold(device, nvml.TEMPERATURE_THRESHOLD_SHUTDOWN); ret == nvml.SUCCESS && temp > 10 {
+		return int(temp) - 10, true
+	}
+	return 0, false
+}
+
+// Throttle classes returned by ThrottleClasses.
+const (
+	ThrottleThermal = "thermal"
+	ThrottlePower = "power"
+)
+
+// ThrottleClasses sorts a clock throttle reason mask into the thermal and
+// power classes, in that order. Reasons that are not about heat or power,
+// such as an idle GPU or application clocks, are ignored.
+func ThrottleClasses(reasons uint64) []string {
+	classes := []string{}
+	if reasons&(nvml.ClocksThrottleReasonSwThermalSlowdown|nvml.ClocksThrottleReasonHwThermalSlowdown) != 0 {
+		classes = append(classes, ThrottleThermal)
+	}
+	if reasons&(nvml.ClocksThrottleReasonSwPowerCap|nvml.ClocksThrottleReasonHwPowerBrakeSlowdown) != 0 {
+		classes = append(classes, ThrottlePower)
+	}
+	return classes
+}
+
+// PCIBusID returns the bus ID of pciInfo as a string, e.g.
+// "00000000:01:00.0".
+func PCIBusID(pciInfo nvml.PciInfo) string {
+	busID := make([]byte, 0, len(pciInfo.BusId))
+	for _, c := range pciInfo.BusId {
+		if c == 0 {
+			break
+		}
+		busID = append(busID, byte(c))
+	}
+	return string(busID)
+}
+
+// NormalizePCIBusID makes "01:00.0", "0000:01:00.0" and NVML's
+// "00000000:01:00.0" compare equal.
+func NormalizePCIBusID(busID string) string {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(busID)), ":")
+	if len(parts) == 2 {
+		parts = append([]string{"0"}, parts...)
+	}
+	if len(parts) != 3 {
+		return strings.ToLower(busID)
+	}
+	domain := strings.TrimLeft(parts[0], "0")
+	if domain == "" {
+		domain = "0"
+	}
+	return domain + ":" + parts[1] + ":" + parts[2]
+}
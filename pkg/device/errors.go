@@ -0,0 +1,50 @@
+package device
+
+import (
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// Error classes returned by Classify.
+const (
+	ErrorTransient = "transient"
+	ErrorFatal = "fatal"
+	ErrorLost = "lost"
+)
+
+// Classify sorts failures into ones worth retrying right away, ones that
+// will not go away (not supported, bad argument), and ones that mean the
+// device or the NVML session is gone.
+func Classify(ret nvml.Return) string {
+	switch ret {
+	case nvml.ERROR_TIMEOUT, nvml.ERROR_IN_USE, nvml.ERROR_IRQ_ISSUE, nvml.ERROR_NO_DATA, nvml.ERROR_INSUFFICIENT_RESOURCES, nvml.ERROR_NOT_READY, nvml.ERROR_MEMORY, nvml.ERROR_UNKNOWN:
+		return ErrorTransient
+	case nvml.ERROR_GPU_IS_LOST, nvml.ERROR_UNINITIALIZED, nvml.ERROR_DRIVER_NOT_LOADED, nvml.ERROR_LIB_RM_VERSION_MISMATCH, nvml.ERROR_RESET_REQUIRED, nvml.ERROR_GPU_NOT_FOUND:
+		return ErrorLost
+	default:
+		return ErrorFatal
+	}
+}
+
+// Retry runs call until it succeeds or fails with a non-transient error,
+// backing off exponentially from 10ms for at most budget. failed, if not
+// nil, is told the class of every failed attempt.
+func Retry(budget time.Duration, call func() nvml.Return, failed func(class string)) nvml.Return {
+	deadline := time.Now().Add(budget)
+	delay := 10 * time.Millisecond
+	for {
+		ret := call()
+		if ret == nvml.SUCCESS {
+			return ret
+		}
+		class := Classify(ret)
+		if failed != nil {
+			failed(class)
+		}
+		if class != ErrorTransient || time.Now().Add(delay).After(deadline) {
+			return ret
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,475 @@
+package device
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// FakeGPU is the state of one simulated GPU. Its fields may be changed
+// between calls while holding the Fake's lock through Update.
+type FakeGPU struct {
+	Name string
+	UUID string
+	PCIBusID string
+	Temperature int
+	// MemoryTemperature is reported for the memory sensor; 0 means the
+	// board has none.
+	MemoryTemperature int
+	// SlowdownTemperature and ShutdownTemperature are the thermal
+	// thresholds; 0 reads as not supported.
+	SlowdownTemperature int
+	ShutdownTemperature int
+	PowerWatts int
+	// PowerLimitWatts is the power limit, settable between
+	// MinPowerLimitWatts and MaxPowerLimitWatts; 0 reads as not supported.
+	PowerLimitWatts int
+	MinPowerLimitWatts int
+	MaxPowerLimitWatts int
+	Utilization int
+	// ThrottleReasons is the clock throttle reason mask, built from the
+	// nvml.ClocksThrottleReason constants.
+	ThrottleReasons uint64
+	PersistenceMode bool
+	// Processes are the programs running on the GPU by PID, all reported
+	// as compute processes.
+	Processes map[int]string
+	MinFanSpeed int
+	MaxFanSpeed int
+	MaxRPM int
+	FanSpeeds []int
+	Manual []bool
+	// TemperatureFunc, if set, replaces Temperature on every read. It gets
+	// the time since the fake was created and the fan speeds last set.
+	TemperatureFunc func(elapsed time.Duration, fanSpeeds []int) int
+	// Errors makes the named calls, e.g. "DeviceSetFanSpeed_v2", fail with
+	// the given code.
+	Errors map[string]nvml.Return
+}
+
+// Fake is an in-memory GPUBackend serving a fixed set of GPUs.
+type Fake struct {
+	mu sync.Mutex
+	gpus []*FakeGPU
+	start time.Time
+}
+
+type fakeDevice struct {
+	// The embedded interface is never set; it only makes fakeDevice an
+	// nvml.Device. Its methods must not be called.
+	nvml.Device
+	gpu *FakeGPU
+}
+
+// NewFake returns a backend serving gpus in order. Unset fields get
+// defaults: one fan at 30%, a 0-100% range and 3000 RPM at full speed.
+func NewFake(gpus ...*FakeGPU) *Fake {
+	for _, gpu := range gpus {
+		if len(gpu.FanSpeeds) == 0 {
+			gpu.FanSpeeds = []int{30}
+		}
+		if len(gpu.Manual) != len(gpu.FanSpeeds) {
+			gpu.Manual = make([]bool, len(gpu.FanSpeeds))
+		}
+		if gpu.MaxFanSpeed == 0 {
+			gpu.MaxFanSpeed = 100
+		}
+		if gpu.MaxRPM == 0 {
+			gpu.MaxRPM = 3000
+		}
+	}
+	return &Fake{gpus: gpus, start: time.Now()}
+}
+
+// Update runs change on the GPUs while no call is in progress.
+func (f *Fake) Update(change func(gpus []*FakeGPU)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	change(f.gpus)
+}
+
+// lookup locks the fake and resolves device, failing with the code
+// configured for call if any.
+func (f *Fake) lookup(device nvml.Device, call string) (*FakeGPU, nvml.Return) {
+	f.mu.Lock()
+	fake, ok := device.(*fakeDevice)
+	if !ok {
+		return nil, nvml.ERROR_INVALID_ARGUMENT
+	}
+	if ret, ok := fake.gpu.Errors[call]; ok && ret != nvml.SUCCESS {
+		return nil, ret
+	}
+	return fake.gpu, nvml.SUCCESS
+}
+
+func (f *Fake) Init() nvml.Return {
+	return nvml.SUCCESS
+}
+
+func (f *Fake) Shutdown() nvml.Return {
+	return nvml.SUCCESS
+}
+
+func (f *Fake) SystemGetDriverVersion() (string, nvml.Return) {
+	return "fake", nvml.SUCCESS
+}
+
+func (f *Fake) SystemGetNVMLVersion() (string, nvml.Return) {
+	return "fake", nvml.SUCCESS
+}
+
+func (f *Fake) DeviceGetCount() (int, nvml.Return) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.gpus), nvml.SUCCESS
+}
+
+func (f *Fake) DeviceGetHandleByIndex(index int) (nvml.Device, nvml.Return) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if index < 0 || index >= len(f.gpus) {
+		return nil, nvml.ERROR_INVALID_ARGUMENT
+	}
+	return &fakeDevice{gpu: f.gpus[index]}, nvml.SUCCESS
+}
+
+func (f *Fake) DeviceGetHandleByUUID(uuid string) (nvml.Device, nvml.Return) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, gpu := range f.gpus {
+		if gpu.UUID == uuid {
+			return &fakeDevice{gpu: gpu}, nvml.SUCCESS
+		}
+	}
+	return nil, nvml.ERROR_NOT_FOUND
+}
+
+func (f *Fake) DeviceGetName(device nvml.Device) (string, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetName")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return "", ret
+	}
+	return gpu.Name, ret
+}
+
+func (f *Fake) DeviceGetUUID(device nvml.Device) (string, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetUUID")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return "", ret
+	}
+	return gpu.UUID, ret
+}
+
+func (f *Fake) DeviceGetPciInfo(device nvml.Device) (nvml.PciInfo, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetPciInfo")
+	defer f.mu.Unlock()
+	var info nvml.PciInfo
+	if ret != nvml.SUCCESS {
+		return info, ret
+	}
+	copy(info.BusId[:len(info.BusId)-1], gpu.PCIBusID)
+	return info, ret
+}
+
+func (f *Fake) DeviceGetTemperature(device nvml.Device, sensor nvml.TemperatureSensors) (uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetTemperature")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	if gpu.TemperatureFunc != nil {
+		gpu.Temperature = gpu.TemperatureFunc(time.Since(f.start), append([]int(nil), gpu.FanSpeeds...))
+	}
+	return uint32(gpu.Temperature), ret
+}
+
+func (f *Fake) DeviceGetTemperatureThreshold(device nvml.Device, threshold nvml.TemperatureThresholds) (uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetTemperatureThreshold")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	value := 0
+	switch threshold {
+	case nvml.TEMPERATURE_THRESHOLD_SLOWDOWN:
+		value = gpu.SlowdownTemperature
+	case nvml.TEMPERATURE_THRESHOLD_SHUTDOWN:
+		value = gpu.ShutdownTemperature
+	}
+	if value == 0 {
+		return 0, nvml.ERROR_NOT_SUPPORTED
+	}
+	return uint32(value), ret
+}
+
+// DeviceGetFieldValues only knows the memory temperature and the instantaneous
+// power fields.
+func (f *Fake) DeviceGetFieldValues(device nvml.Device, values []nvml.FieldValue) nvml.Return {
+	gpu, ret := f.lookup(device, "DeviceGetFieldValues")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return ret
+	}
+	for i := range values {
+		value := 0
+		switch values[i].FieldId {
+		case nvml.FI_DEV_MEMORY_TEMP:
+			value = gpu.MemoryTemperature
+		case nvml.FI_DEV_POWER_INSTANT:
+			value = gpu.PowerWatts * 1000
+		}
+		if value == 0 {
+			values[i].NvmlReturn = uint32(nvml.ERROR_NOT_SUPPORTED)
+			continue
+		}
+		values[i].ValueType = uint32(nvml.VALUE_TYPE_UNSIGNED_INT)
+		binary.LittleEndian.PutUint32(values[i].Value[:], uint32(value))
+		values[i].NvmlReturn = uint32(nvml.SUCCESS)
+	}
+	return ret
+}
+
+func (f *Fake) DeviceGetPowerUsage(device nvml.Device) (uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetPowerUsage")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	return uint32(gpu.PowerWatts * 1000), ret
+}
+
+func (f *Fake) DeviceGetPowerManagementLimit(device nvml.Device) (uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetPowerManagementLimit")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	if gpu.PowerLimitWatts == 0 {
+		return 0, nvml.ERROR_NOT_SUPPORTED
+	}
+	return uint32(gpu.PowerLimitWatts * 1000), ret
+}
+
+func (f *Fake) DeviceGetPowerManagementLimitConstraints(device nvml.Device) (uint32, uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetPowerManagementLimitConstraints")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, 0, ret
+	}
+	if gpu.PowerLimitWatts == 0 {
+		return 0, 0, nvml.ERROR_NOT_SUPPORTED
+	}
+	return uint32(gpu.MinPowerLimitWatts * 1000), uint32(gpu.MaxPowerLimitWatts * 1000), ret
+}
+
+func (f *Fake) DeviceSetPowerManagementLimit(device nvml.Device, limit uint32) nvml.Return {
+	gpu, ret := f.lookup(device, "DeviceSetPowerManagementLimit")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return ret
+	}
+	if gpu.PowerLimitWatts == 0 {
+		return nvml.ERROR_NOT_SUPPORTED
+	}
+	watts := int(limit / 1000)
+	if watts < gpu.MinPowerLimitWatts || (gpu.MaxPowerLimitWatts > 0 && watts > gpu.MaxPowerLimitWatts) {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	gpu.PowerLimitWatts = watts
+	return ret
+}
+
+func (f *Fake) DeviceGetPersistenceMode(device nvml.Device) (nvml.EnableState, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetPersistenceMode")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return nvml.FEATURE_DISABLED, ret
+	}
+	if gpu.PersistenceMode {
+		return nvml.FEATURE_ENABLED, ret
+	}
+	return nvml.FEATURE_DISABLED, ret
+}
+
+func (f *Fake) DeviceSetPersistenceMode(device nvml.Device, mode nvml.EnableState) nvml.Return {
+	gpu, ret := f.lookup(device, "DeviceSetPersistenceMode")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return ret
+	}
+	gpu.PersistenceMode = mode == nvml.FEATURE_ENABLED
+	return ret
+}
+
+func (f *Fake) DeviceGetComputeRunningProcesses(device nvml.Device) ([]nvml.ProcessInfo, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetComputeRunningProcesses")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return nil, ret
+	}
+	processes := []nvml.ProcessInfo{}
+	for pid := range gpu.Processes {
+		processes = append(processes, nvml.ProcessInfo{Pid: uint32(pid)})
+	}
+	return processes, ret
+}
+
+func (f *Fake) DeviceGetGraphicsRunningProcesses(device nvml.Device) ([]nvml.ProcessInfo, nvml.Return) {
+	_, ret := f.lookup(device, "DeviceGetGraphicsRunningProcesses")
+	defer f.mu.Unlock()
+	return []nvml.ProcessInfo{}, ret
+}
+
+func (f *Fake) SystemGetProcessName(pid int) (string, nvml.Return) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, gpu := range f.gpus {
+		if name, ok := gpu.Processes[pid]; ok {
+			return name, nvml.SUCCESS
+		}
+	}
+	return "", nvml.ERROR_NOT_FOUND
+}
+
+func (f *Fake) DeviceGetUtilizationRates(device nvml.Device) (nvml.Utilization, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetUtilizationRates")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return nvml.Utilization{}, ret
+	}
+	return nvml.Utilization{Gpu: uint32(gpu.Utilization)}, ret
+}
+
+func (f *Fake) DeviceGetCurrentClocksThrottleReasons(device nvml.Device) (uint64, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetCurrentClocksThrottleReasons")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	return gpu.ThrottleReasons, ret
+}
+
+func (f *Fake) DeviceGetNumFans(device nvml.Device) (int, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetNumFans")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	return len(gpu.FanSpeeds), ret
+}
+
+// DeviceGetFanSpeed reports the first fan, like NVML.
+func (f *Fake) DeviceGetFanSpeed(device nvml.Device) (uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetFanSpeed")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	return uint32(gpu.FanSpeeds[0]), ret
+}
+
+func (f *Fake) DeviceGetFanSpeed_v2(device nvml.Device, fan int) (uint32, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetFanSpeed_v2")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	if fan < 0 || fan >= len(gpu.FanSpeeds) {
+		return 0, nvml.ERROR_INVALID_ARGUMENT
+	}
+	return uint32(gpu.FanSpeeds[fan]), ret
+}
+
+// DeviceGetTargetFanSpeed reports the speed last set, which the fake fans
+// reach at once.
+func (f *Fake) DeviceGetTargetFanSpeed(device nvml.Device, fan int) (int, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetTargetFanSpeed")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	if fan < 0 || fan >= len(gpu.FanSpeeds) {
+		return 0, nvml.ERROR_INVALID_ARGUMENT
+	}
+	return gpu.FanSpeeds[fan], ret
+}
+
+// DeviceGetFanSpeedRPM reports the first fan, like NVML, scaled linearly
+// up to MaxRPM.
+func (f *Fake) DeviceGetFanSpeedRPM(device nvml.Device) (nvml.FanSpeedInfo, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetFanSpeedRPM")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return nvml.FanSpeedInfo{}, ret
+	}
+	return nvml.FanSpeedInfo{Speed: uint32(gpu.FanSpeeds[0] * gpu.MaxRPM / 100)}, ret
+}
+
+func (f *Fake) DeviceGetMinMaxFanSpeed(device nvml.Device) (int, int, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetMinMaxFanSpeed")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, 0, ret
+	}
+	return gpu.MinFanSpeed, gpu.MaxFanSpeed, ret
+}
+
+func (f *Fake) DeviceSetFanSpeed_v2(device nvml.Device, fan int, speed int) nvml.Return {
+	gpu, ret := f.lookup(device, "DeviceSetFanSpeed_v2")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return ret
+	}
+	if fan < 0 || fan >= len(gpu.FanSpeeds) || speed < gpu.MinFanSpeed || speed > gpu.MaxFanSpeed {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	gpu.FanSpeeds[fan] = speed
+	gpu.Manual[fan] = true
+	return ret
+}
+
+func (f *Fake) DeviceGetFanControlPolicy_v2(device nvml.Device, fan int) (nvml.FanControlPolicy, nvml.Return) {
+	gpu, ret := f.lookup(device, "DeviceGetFanControlPolicy_v2")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return 0, ret
+	}
+	if fan < 0 || fan >= len(gpu.FanSpeeds) {
+		return 0, nvml.ERROR_INVALID_ARGUMENT
+	}
+	if gpu.Manual[fan] {
+		return nvml.FAN_POLICY_MANUAL, ret
+	}
+	return nvml.FAN_POLICY_TEMPERATURE_CONTINOUS_SW, ret
+}
+
+func (f *Fake) DeviceSetFanControlPolicy(device nvml.Device, fan int, policy nvml.FanControlPolicy) nvml.Return {
+	gpu, ret := f.lookup(device, "DeviceSetFanControlPolicy")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return ret
+	}
+	if fan < 0 || fan >= len(gpu.FanSpeeds) {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	gpu.Manual[fan] = policy == nvml.FAN_POLICY_MANUAL
+	return ret
+}
+
+// DeviceSetDefaultFanSpeed_v2 hands the fan back to automatic control. The
+// speed is left alone, as a real fan only slows down over time.
+func (f *Fake) DeviceSetDefaultFanSpeed_v2(device nvml.Device, fan int) nvml.Return {
+	gpu, ret := f.lookup(device, "DeviceSetDefaultFanSpeed_v2")
+	defer f.mu.Unlock()
+	if ret != nvml.SUCCESS {
+		return ret
+	}
+	if fan < 0 || fan >= len(gpu.FanSpeeds) {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	gpu.Manual[fan] = false
+	return ret
+}
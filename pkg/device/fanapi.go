@@ -0,0 +1,84 @@
+package device
+
+import (
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// FanAPI records which NVML fan calls a GPU supports. Drivers and boards
+// that predate the per-fan calls are still controllable through the older
+// ones.
+type FanAPI struct {
+	NumFans int
+	// Legacy is set when the per-fan speed can not be read, or the fans
+	// not counted. Every fan then reads as the speed DeviceGetFanSpeed
+	// reports for the first one.
+	Legacy bool
+	// NoPolicy is set when the fan control policy is not supported. Such
+	// boards take manual control when a speed is set, and go back to
+	// automatic control with DeviceSetDefaultFanSpeed_v2.
+	NoPolicy bool
+}
+
+func unsupported(ret nvml.Return) bool {
+	return ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND
+}
+
+// ProbeFanAPI finds out how the fans of a device can be read and set,
+// without changing them. It fails with the error of DeviceGetNumFans when
+// neither the current nor the legacy calls work.
+func ProbeFanAPI(gpu GPUBackend, device nvml.Device) (FanAPI, nvml.Return) {
+	api := FanAPI{}
+	numFans, ret := gpu.DeviceGetNumFans(device)
+	if ret == nvml.SUCCESS && numFans > 0 {
+		api.NumFans = numFans
+		if _, ret := gpu.DeviceGetFanSpeed_v2(device, 0); unsupported(ret) {
+			_, legacyRet := gpu.DeviceGetFanSpeed(device)
+			api.Legacy = legacyRet == nvml.SUCCESS
+		}
+	} else {
+		if _, legacyRet := gpu.DeviceGetFanSpeed(device); legacyRet != nvml.SUCCESS {
+			return api, ret
+		}
+		api.NumFans, api.Legacy = 1, true
+	}
+	_, ret = gpu.DeviceGetFanControlPolicy_v2(device, 0)
+	api.NoPolicy = unsupported(ret)
+	return api, nvml.SUCCESS
+}
+
+// ReadFanSpeed reads the duty of a fan with the calls api allows.
+func ReadFanSpeed(gpu GPUBackend, device nvml.Device, api FanAPI, fan int) (int, nvml.Return) {
+	if api.Legacy {
+		speed, ret := gpu.DeviceGetFanSpeed(device)
+		return int(speed), ret
+	}
+	speed, ret := gpu.DeviceGetFanSpeed_v2(device, fan)
+	return int(speed), ret
+}
+
+// SetManualFanControl takes manual control of a fan. Boards without a fan
+// control policy take it when a speed is set, so the call is skipped for
+// them, and api is marked once the driver turns out not to support it.
+func SetManualFanControl(gpu GPUBackend, device nvml.Device, api *FanAPI, fan int) nvml.Return {
+	if api.NoPolicy {
+		return nvml.SUCCESS
+	}
+	ret := gpu.DeviceSetFanControlPolicy(device, fan, nvml.FAN_POLICY_MANUAL)
+	if unsupported(ret) {
+		api.NoPolicy = true
+		return nvml.SUCCESS
+	}
+	return ret
+}
+
+// RestoreAutoFanSpeed hands a fan back to the driver: through its control
+// policy where supported, and by restoring the default speed otherwise.
+func RestoreAutoFanSpeed(gpu GPUBackend, device nvml.Device, api FanAPI, fan int) nvml.Return {
+	if !api.NoPolicy {
+		ret := gpu.DeviceSetFanControlPolicy(device, fan, nvml.FAN_POLICY_TEMPERATURE_CONTINOUS_SW)
+		if !unsupported(ret) {
+			return ret
+		}
+	}
+	return gpu.DeviceSetDefaultFanSpeed_v2(device, fan)
+}
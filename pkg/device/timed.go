@@ -0,0 +1,87 @@
+package device
+
+import (
+	"time"
+	"github.com/jumbled00r/nvidia-fan-control/pkg/nvml"
+)
+
+// Timed wraps gpu so that observe gets the name and duration of every call
+// the control loop makes on each update. Setup and shutdown calls are not
+// timed.
+func Timed(gpu GPUBackend, observe func(call string, elapsed time.Duration)) GPUBackend {
+	return &timedBackend{GPUBackend: gpu, observe: observe}
+}
+
+type timedBackend struct {
+	GPUBackend
+	observe func(call string, elapsed time.Duration)
+}
+
+func (t *timedBackend) since(call string, start time.Time) {
+	t.observe(call, time.Since(start))
+}
+
+func (t *timedBackend) DeviceGetTemperature(device nvml.Device, sensor nvml.TemperatureSensors) (uint32, nvml.Return) {
+	defer t.since("DeviceGetTemperature", time.Now())
+	return t.GPUBackend.DeviceGetTemperature(device, sensor)
+}
+
+func (t *timedBackend) DeviceGetFieldValues(device nvml.Device, values []nvml.FieldValue) nvml.Return {
+	defer t.since("DeviceGetFieldValues", time.Now())
+	return t.GPUBackend.DeviceGetFieldValues(device, values)
+}
+
+func (t *timedBackend) DeviceGetPowerUsage(device nvml.Device) (uint32, nvml.Return) {
+	defer t.since("DeviceGetPowerUsage", time.Now())
+	return t.GPUBackend.DeviceGetPowerUsage(device)
+}
+
+func (t *timedBackend) DeviceGetUtilizationRates(device nvml.Device) (nvml.Utilization, nvml.Return) {
+	defer t.since("DeviceGetUtilizationRates", time.Now())
+	return t.GPUBackend.DeviceGetUtilizationRates(device)
+}
+
+func (t *timedBackend) DeviceGetCurrentClocksThrottleReasons(device nvml.Device) (uint64, nvml.Return) {
+	defer t.since("DeviceGetCurrentClocksThrottleReasons", time.Now())
+	return t.GPUBackend.DeviceGetCurrentClocksThrottleReasons(device)
+}
+
+func (t *timedBackend) DeviceGetFanSpeed(device nvml.Device) (uint32, nvml.Return) {
+	defer t.since("DeviceGetFanSpeed", time.Now())
+	return t.GPUBackend.DeviceGetFanSpeed(device)
+}
+
+func (t *timedBackend) DeviceGetFanSpeed_v2(device nvml.Device, fan int) (uint32, nvml.Return) {
+	defer t.since("DeviceGetFanSpeed_v2", time.Now())
+	return t.GPUBackend.DeviceGetFanSpeed_v2(device, fan)
+}
+
+func (t *timedBackend) DeviceGetTargetFanSpeed(device nvml.Device, fan int) (int, nvml.Return) {
+	defer t.since("DeviceGetTargetFanSpeed", time.Now())
+	return t.GPUBackend.DeviceGetTargetFanSpeed(device, fan)
+}
+
+func (t *timedBackend) DeviceGetFanSpeedRPM(device nvml.Device) (nvml.FanSpeedInfo, nvml.Return) {
+	defer t.since("DeviceGetFanSpeedRPM", time.Now())
+	return t.GPUBackend.DeviceGetFanSpeedRPM(device)
+}
+
+func (t *timedBackend) DeviceSetFanSpeed_v2(device nvml.Device, fan int, speed int) nvml.Return {
+	defer t.since("DeviceSetFanSpeed_v2", time.Now())
+	return t.GPUBackend.DeviceSetFanSpeed_v2(device, fan, speed)
+}
+
+func (t *timedBackend) DeviceGetFanControlPolicy_v2(device nvml.Device, fan int) (nvml.FanControlPolicy, nvml.Return) {
+	defer t.since("DeviceGetFanControlPolicy_v2", time.Now())
+	return t.GPUBackend.DeviceGetFanControlPolicy_v2(device, fan)
+}
+
+func (t *timedBackend) DeviceSetFanControlPolicy(device nvml.Device, fan int, policy nvml.FanControlPolicy) nvml.Return {
+	defer t.since("DeviceSetFanControlPolicy", time.Now())
+	return t.GPUBackend.DeviceSetFanControlPolicy(device, fan, policy)
+}
+
+func (t *timedBackend) DeviceSetDefaultFanSpeed_v2(device nvml.Device, fan int) nvml.Return {
+	defer t.since("DeviceSetDefaultFanSpeed_v2", time.Now())
+	return t.GPUBackend.DeviceSetDefaultFanSpeed_v2(device, fan)
+}
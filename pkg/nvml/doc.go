@@ -0,0 +1,4 @@
+// Package nvml is the part of the NVML API the fan controller uses. On
+// Windows it loads nvml.dll itself; everywhere else it forwards to go-nvml,
+// which only knows how to load the library with dlopen.
+package nvml
@@ -0,0 +1,284 @@
+package nvml
+
+import (
+	"path/filepath"
+	"sync"
+	"unsafe"
+	"golang.org/x/sys/windows"
+)
+
+// Buffer sizes from nvml.h.
+const (
+	systemDriverVersionBufferSize = 80
+	systemNVMLVersionBufferSize = 80
+	systemProcessNameBufferSize = 256
+	deviceNameBufferSize = 96
+	deviceUUIDBufferSize = 96
+)
+
+// Library calls into nvml.dll.
+type Library struct {
+	dll *windows.LazyDLL
+	mu sync.Mutex
+	procs map[string]*windows.LazyProc
+}
+
+// LibraryOption configures New.
+type LibraryOption func(*Library)
+
+type nvmlDevice uintptr
+
+// New returns the NVML library, loaded from System32 unless
+// WithLibraryPath says otherwise. It is only loaded by Init.
+func New(opts ...LibraryOption) *Library {
+	l := &Library{dll: windows.NewLazySystemDLL("nvml.dll"), procs: map[string]*windows.LazyProc{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithLibraryPath loads the library from path. A bare file name is still
+// only looked up in System32, so the working directory can not supply it.
+func WithLibraryPath(path string) LibraryOption {
+	return func(l *Library) {
+		if filepath.Base(path) == path {
+			l.dll = windows.NewLazySystemDLL(path)
+		} else {
+			l.dll = windows.NewLazyDLL(path)
+		}
+	}
+}
+
+// call runs an NVML function with pointers converted to uintptr, failing
+// with ERROR_FUNCTION_NOT_FOUND when the library does not export it.
+//
+//go:uintptrescapes
+func (l *Library) call(name string, args ...uintptr) Return {
+	l.mu.Lock()
+	proc, ok := l.procs[name]
+	if !ok {
+		proc = l.dll.NewProc(name)
+		l.procs[name] = proc
+	}
+	l.mu.Unlock()
+	if proc.Find() != nil {
+		return ERROR_FUNCTION_NOT_FOUND
+	}
+	ret, _, _ := proc.Call(args...)
+	return Return(int32(ret))
+}
+
+func handle(device Device) uintptr {
+	if device, ok := device.(nvmlDevice); ok {
+		return uintptr(device)
+	}
+	return 0
+}
+
+func (l *Library) Init() Return {
+	if l.dll.Load() != nil {
+		return ERROR_LIBRARY_NOT_FOUND
+	}
+	return l.call("nvmlInit_v2")
+}
+
+func (l *Library) Shutdown() Return {
+	return l.call("nvmlShutdown")
+}
+
+func (l *Library) readString(name string, size int, args ...uintptr) (string, Return) {
+	buffer := make([]byte, size)
+	ret := l.call(name, append(args, uintptr(unsafe.Pointer(&buffer[0])), uintptr(size))...)
+	return windows.ByteSliceToString(buffer), ret
+}
+
+func (l *Library) SystemGetDriverVersion() (string, Return) {
+	return l.readString("nvmlSystemGetDriverVersion", systemDriverVersionBufferSize)
+}
+
+func (l *Library) SystemGetNVMLVersion() (string, Return) {
+	return l.readString("nvmlSystemGetNVMLVersion", systemNVMLVersionBufferSize)
+}
+
+func (l *Library) SystemGetProcessName(pid int) (string, Return) {
+	return l.readString("nvmlSystemGetProcessName", systemProcessNameBufferSize, uintptr(pid))
+}
+
+func (l *Library) DeviceGetCount() (int, Return) {
+	var count uint32
+	ret := l.call("nvmlDeviceGetCount_v2", uintptr(unsafe.Pointer(&count)))
+	return int(count), ret
+}
+
+func (l *Library) DeviceGetHandleByIndex(index int) (Device, Return) {
+	var device nvmlDevice
+	ret := l.call("nvmlDeviceGetHandleByIndex_v2", uintptr(index), uintptr(unsafe.Pointer(&device)))
+	return device, ret
+}
+
+func (l *Library) DeviceGetHandleByUUID(uuid string) (Device, Return) {
+	var device nvmlDevice
+	name, err := windows.BytePtrFromString(uuid)
+	if err != nil {
+		return device, ERROR_INVALID_ARGUMENT
+	}
+	ret := l.call("nvmlDeviceGetHandleByUUID", uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&device)))
+	return device, ret
+}
+
+func (l *Library) DeviceGetName(device Device) (string, Return) {
+	return l.readString("nvmlDeviceGetName", deviceNameBufferSize, handle(device))
+}
+
+func (l *Library) DeviceGetUUID(device Device) (string, Return) {
+	return l.readString("nvmlDeviceGetUUID", deviceUUIDBufferSize, handle(device))
+}
+
+func (l *Library) DeviceGetPciInfo(device Device) (PciInfo, Return) {
+	var info PciInfo
+	ret := l.call("nvmlDeviceGetPciInfo_v3", handle(device), uintptr(unsafe.Pointer(&info)))
+	return info, ret
+}
+
+func (l *Library) DeviceGetTemperature(device Device, sensor TemperatureSensors) (uint32, Return) {
+	var temperature uint32
+	ret := l.call("nvmlDeviceGetTemperature", handle(device), uintptr(sensor), uintptr(unsafe.Pointer(&temperature)))
+	return temperature, ret
+}
+
+func (l *Library) DeviceGetTemperatureThreshold(device Device, threshold TemperatureThresholds) (uint32, Return) {
+	var temperature uint32
+	ret := l.call("nvmlDeviceGetTemperatureThreshold", handle(device), uintptr(threshold), uintptr(unsafe.Pointer(&temperature)))
+	return temperature, ret
+}
+
+func (l *Library) DeviceGetFieldValues(device Device, values []FieldValue) Return {
+	if len(values) == 0 {
+		return SUCCESS
+	}
+	return l.call("nvmlDeviceGetFieldValues", handle(device), uintptr(len(values)), uintptr(unsafe.Pointer(&values[0])))
+}
+
+func (l *Library) DeviceGetPowerUsage(device Device) (uint32, Return) {
+	var power uint32
+	ret := l.call("nvmlDeviceGetPowerUsage", handle(device), uintptr(unsafe.Pointer(&power)))
+	return power, ret
+}
+
+func (l *Library) DeviceGetUtilizationRates(device Device) (Utilization, Return) {
+	var utilization Utilization
+	ret := l.call("nvmlDeviceGetUtilizationRates", handle(device), uintptr(unsafe.Pointer(&utilization)))
+	return utilization, ret
+}
+
+func (l *Library) DeviceGetCurrentClocksThrottleReasons(device Device) (uint64, Return) {
+	var reasons uint64
+	ret := l.call("nvmlDeviceGetCurrentClocksThrottleReasons", handle(device), uintptr(unsafe.Pointer(&reasons)))
+	return reasons, ret
+}
+
+func (l *Library) DeviceGetPowerManagementLimit(device Device) (uint32, Return) {
+	var limit uint32
+	ret := l.call("nvmlDeviceGetPowerManagementLimit", handle(device), uintptr(unsafe.Pointer(&limit)))
+	return limit, ret
+}
+
+func (l *Library) DeviceGetPowerManagementLimitConstraints(device Device) (uint32, uint32, Return) {
+	var minLimit, maxLimit uint32
+	ret := l.call("nvmlDeviceGetPowerManagementLimitConstraints", handle(device), uintptr(unsafe.Pointer(&minLimit)), uintptr(unsafe.Pointer(&maxLimit)))
+	return minLimit, maxLimit, ret
+}
+
+func (l *Library) DeviceSetPowerManagementLimit(device Device, limit uint32) Return {
+	return l.call("nvmlDeviceSetPowerManagementLimit", handle(device), uintptr(limit))
+}
+
+func (l *Library) DeviceGetPersistenceMode(device Device) (EnableState, Return) {
+	var mode EnableState
+	ret := l.call("nvmlDeviceGetPersistenceMode", handle(device), uintptr(unsafe.Pointer(&mode)))
+	return mode, ret
+}
+
+func (l *Library) DeviceSetPersistenceMode(device Device, mode EnableState) Return {
+	return l.call("nvmlDeviceSetPersistenceMode", handle(device), uintptr(mode))
+}
+
+// runningProcesses grows the buffer until the process list fits.
+func (l *Library) runningProcesses(name string, device Device) ([]ProcessInfo, Return) {
+	count := uint32(1)
+	for {
+		infos := make([]ProcessInfo, count)
+		ret := l.call(name, handle(device), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&infos[0])))
+		if ret == SUCCESS {
+			return infos[:count], ret
+		}
+		if ret != ERROR_INSUFFICIENT_SIZE {
+			return nil, ret
+		}
+		count *= 2
+	}
+}
+
+func (l *Library) DeviceGetComputeRunningProcesses(device Device) ([]ProcessInfo, Return) {
+	return l.runningProcesses("nvmlDeviceGetComputeRunningProcesses_v3", device)
+}
+
+func (l *Library) DeviceGetGraphicsRunningProcesses(device Device) ([]ProcessInfo, Return) {
+	return l.runningProcesses("nvmlDeviceGetGraphicsRunningProcesses_v3", device)
+}
+
+func (l *Library) DeviceGetNumFans(device Device) (int, Return) {
+	var fans uint32
+	ret := l.call("nvmlDeviceGetNumFans", handle(device), uintptr(unsafe.Pointer(&fans)))
+	return int(fans), ret
+}
+
+func (l *Library) DeviceGetFanSpeed(device Device) (uint32, Return) {
+	var speed uint32
+	ret := l.call("nvmlDeviceGetFanSpeed", handle(device), uintptr(unsafe.Pointer(&speed)))
+	return speed, ret
+}
+
+func (l *Library) DeviceGetFanSpeed_v2(device Device, fan int) (uint32, Return) {
+	var speed uint32
+	ret := l.call("nvmlDeviceGetFanSpeed_v2", handle(device), uintptr(fan), uintptr(unsafe.Pointer(&speed)))
+	return speed, ret
+}
+
+func (l *Library) DeviceGetTargetFanSpeed(device Device, fan int) (int, Return) {
+	var speed uint32
+	ret := l.call("nvmlDeviceGetTargetFanSpeed", handle(device), uintptr(fan), uintptr(unsafe.Pointer(&speed)))
+	return int(speed), ret
+}
+
+func (l *Library) DeviceGetFanSpeedRPM(device Device) (FanSpeedInfo, Return) {
+	var info FanSpeedInfo
+	info.Version = uint32(unsafe.Sizeof(info)) | 1<<24
+	ret := l.call("nvmlDeviceGetFanSpeedRPM", handle(device), uintptr(unsafe.Pointer(&info)))
+	return info, ret
+}
+
+func (l *Library) DeviceGetMinMaxFanSpeed(device Device) (int, int, Return) {
+	var minSpeed, maxSpeed uint32
+	ret := l.call("nvmlDeviceGetMinMaxFanSpeed", handle(device), uintptr(unsafe.Pointer(&minSpeed)), uintptr(unsafe.Pointer(&maxSpeed)))
+	return int(minSpeed), int(maxSpeed), ret
+}
+
+func (l *Library) DeviceSetFanSpeed_v2(device Device, fan int, speed int) Return {
+	return l.call("nvmlDeviceSetFanSpeed_v2", handle(device), uintptr(fan), uintptr(speed))
+}
+
+func (l *Library) DeviceGetFanControlPolicy_v2(device Device, fan int) (FanControlPolicy, Return) {
+	var policy FanControlPolicy
+	ret := l.call("nvmlDeviceGetFanControlPolicy_v2", handle(device), uintptr(fan), uintptr(unsafe.Pointer(&policy)))
+	return policy, ret
+}
+
+func (l *Library) DeviceSetFanControlPolicy(device Device, fan int, policy FanControlPolicy) Return {
+	return l.call("nvmlDeviceSetFanControlPolicy", handle(device), uintptr(fan), uintptr(policy))
+}
+
+func (l *Library) DeviceSetDefaultFanSpeed_v2(device Device, fan int) Return {
+	return l.call("nvmlDeviceSetDefaultFanSpeed_v2", handle(device), uintptr(fan))
+}
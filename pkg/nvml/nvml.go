@@ -0,0 +1,92 @@
+//go:build !windows
+
+package nvml
+
+import (
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+type (
+	Interface = nvml.Interface
+	LibraryOption = nvml.LibraryOption
+	Return = nvml.Return
+	Device = nvml.Device
+	PciInfo = nvml.PciInfo
+	FieldValue = nvml.FieldValue
+	ValueType = nvml.ValueType
+	Utilization = nvml.Utilization
+	EnableState = nvml.EnableState
+	ProcessInfo = nvml.ProcessInfo
+	TemperatureSensors = nvml.TemperatureSensors
+	TemperatureThresholds = nvml.TemperatureThresholds
+	FanSpeedInfo = nvml.FanSpeedInfo
+	FanControlPolicy = nvml.FanControlPolicy
+)
+
+const (
+	SUCCESS = nvml.SUCCESS
+	ERROR_UNINITIALIZED = nvml.ERROR_UNINITIALIZED
+	ERROR_INVALID_ARGUMENT = nvml.ERROR_INVALID_ARGUMENT
+	ERROR_NOT_SUPPORTED = nvml.ERROR_NOT_SUPPORTED
+	ERROR_NO_PERMISSION = nvml.ERROR_NO_PERMISSION
+	ERROR_NOT_FOUND = nvml.ERROR_NOT_FOUND
+	ERROR_INSUFFICIENT_SIZE = nvml.ERROR_INSUFFICIENT_SIZE
+	ERROR_DRIVER_NOT_LOADED = nvml.ERROR_DRIVER_NOT_LOADED
+	ERROR_TIMEOUT = nvml.ERROR_TIMEOUT
+	ERROR_IRQ_ISSUE = nvml.ERROR_IRQ_ISSUE
+	ERROR_LIBRARY_NOT_FOUND = nvml.ERROR_LIBRARY_NOT_FOUND
+	ERROR_FUNCTION_NOT_FOUND = nvml.ERROR_FUNCTION_NOT_FOUND
+	ERROR_GPU_IS_LOST = nvml.ERROR_GPU_IS_LOST
+	ERROR_RESET_REQUIRED = nvml.ERROR_RESET_REQUIRED
+	ERROR_OPERATING_SYSTEM = nvml.ERROR_OPERATING_SYSTEM
+	ERROR_LIB_RM_VERSION_MISMATCH = nvml.ERROR_LIB_RM_VERSION_MISMATCH
+	ERROR_IN_USE = nvml.ERROR_IN_USE
+	ERROR_MEMORY = nvml.ERROR_MEMORY
+	ERROR_NO_DATA = nvml.ERROR_NO_DATA
+	ERROR_INSUFFICIENT_RESOURCES = nvml.ERROR_INSUFFICIENT_RESOURCES
+	ERROR_NOT_READY = nvml.ERROR_NOT_READY
+	ERROR_GPU_NOT_FOUND = nvml.ERROR_GPU_NOT_FOUND
+	ERROR_UNKNOWN = nvml.ERROR_UNKNOWN
+
+	TEMPERATURE_GPU = nvml.TEMPERATURE_GPU
+	TEMPERATURE_THRESHOLD_SHUTDOWN = nvml.TEMPERATURE_THRESHOLD_SHUTDOWN
+	TEMPERATURE_THRESHOLD_SLOWDOWN = nvml.TEMPERATURE_THRESHOLD_SLOWDOWN
+
+	FEATURE_DISABLED = nvml.FEATURE_DISABLED
+	FEATURE_ENABLED = nvml.FEATURE_ENABLED
+
+	FAN_POLICY_TEMPERATURE_CONTINOUS_SW = nvml.FAN_POLICY_TEMPERATURE_CONTINOUS_SW
+	FAN_POLICY_MANUAL = nvml.FAN_POLICY_MANUAL
+
+	FI_DEV_MEMORY_TEMP = nvml.FI_DEV_MEMORY_TEMP
+	FI_DEV_POWER_INSTANT = nvml.FI_DEV_POWER_INSTANT
+
+	VALUE_TYPE_DOUBLE = nvml.VALUE_TYPE_DOUBLE
+	VALUE_TYPE_UNSIGNED_INT = nvml.VALUE_TYPE_UNSIGNED_INT
+	VALUE_TYPE_UNSIGNED_LONG = nvml.VALUE_TYPE_UNSIGNED_LONG
+	VALUE_TYPE_UNSIGNED_LONG_LONG = nvml.VALUE_TYPE_UNSIGNED_LONG_LONG
+	VALUE_TYPE_SIGNED_LONG_LONG = nvml.VALUE_TYPE_SIGNED_LONG_LONG
+	VALUE_TYPE_SIGNED_INT = nvml.VALUE_TYPE_SIGNED_INT
+	VALUE_TYPE_UNSIGNED_SHORT = nvml.VALUE_TYPE_UNSIGNED_SHORT
+
+	ClocksThrottleReasonSwPowerCap = nvml.ClocksThrottleReasonSwPowerCap
+	ClocksThrottleReasonSwThermalSlowdown = nvml.ClocksThrottleReasonSwThermalSlowdown
+	ClocksThrottleReasonHwThermalSlowdown = nvml.ClocksThrottleReasonHwThermalSlowdown
+	ClocksThrottleReasonHwPowerBrakeSlowdown = nvml.ClocksThrottleReasonHwPowerBrakeSlowdown
+)
+
+// New returns the NVML library, loaded from the default location unless
+// WithLibraryPath says otherwise. It is only loaded by Init.
+func New(opts ...LibraryOption) Interface {
+	return nvml.New(opts...)
+}
+
+// WithLibraryPath loads the library from path.
+func WithLibraryPath(path string) LibraryOption {
+	return nvml.WithLibraryPath(path)
+}
+
+// ErrorString describes an NVML return code.
+func ErrorString(ret Return) string {
+	return nvml.ErrorString(ret)
+}
@@ -0,0 +1,192 @@
+package nvml
+
+import (
+	"fmt"
+)
+
+// Return is an NVML return code.
+type Return int32
+
+const (
+	SUCCESS Return = 0
+	ERROR_UNINITIALIZED Return = 1
+	ERROR_INVALID_ARGUMENT Return = 2
+	ERROR_NOT_SUPPORTED Return = 3
+	ERROR_NO_PERMISSION Return = 4
+	ERROR_ALREADY_INITIALIZED Return = 5
+	ERROR_NOT_FOUND Return = 6
+	ERROR_INSUFFICIENT_SIZE Return = 7
+	ERROR_INSUFFICIENT_POWER Return = 8
+	ERROR_DRIVER_NOT_LOADED Return = 9
+	ERROR_TIMEOUT Return = 10
+	ERROR_IRQ_ISSUE Return = 11
+	ERROR_LIBRARY_NOT_FOUND Return = 12
+	ERROR_FUNCTION_NOT_FOUND Return = 13
+	ERROR_CORRUPTED_INFOROM Return = 14
+	ERROR_GPU_IS_LOST Return = 15
+	ERROR_RESET_REQUIRED Return = 16
+	ERROR_OPERATING_SYSTEM Return = 17
+	ERROR_LIB_RM_VERSION_MISMATCH Return = 18
+	ERROR_IN_USE Return = 19
+	ERROR_MEMORY Return = 20
+	ERROR_NO_DATA Return = 21
+	ERROR_VGPU_ECC_NOT_SUPPORTED Return = 22
+	ERROR_INSUFFICIENT_RESOURCES Return = 23
+	ERROR_FREQ_NOT_SUPPORTED Return = 24
+	ERROR_ARGUMENT_VERSION_MISMATCH Return = 25
+	ERROR_DEPRECATED Return = 26
+	ERROR_NOT_READY Return = 27
+	ERROR_GPU_NOT_FOUND Return = 28
+	ERROR_INVALID_STATE Return = 29
+	ERROR_UNKNOWN Return = 999
+)
+
+var returnNames = map[Return]string{
+	SUCCESS: "SUCCESS",
+	ERROR_UNINITIALIZED: "ERROR_UNINITIALIZED",
+	ERROR_INVALID_ARGUMENT: "ERROR_INVALID_ARGUMENT",
+	ERROR_NOT_SUPPORTED: "ERROR_NOT_SUPPORTED",
+	ERROR_NO_PERMISSION: "ERROR_NO_PERMISSION",
+	ERROR_ALREADY_INITIALIZED: "ERROR_ALREADY_INITIALIZED",
+	ERROR_NOT_FOUND: "ERROR_NOT_FOUND",
+	ERROR_INSUFFICIENT_SIZE: "ERROR_INSUFFICIENT_SIZE",
+	ERROR_INSUFFICIENT_POWER: "ERROR_INSUFFICIENT_POWER",
+	ERROR_DRIVER_NOT_LOADED: "ERROR_DRIVER_NOT_LOADED",
+	ERROR_TIMEOUT: "ERROR_TIMEOUT",
+	ERROR_IRQ_ISSUE: "ERROR_IRQ_ISSUE",
+	ERROR_LIBRARY_NOT_FOUND: "ERROR_LIBRARY_NOT_FOUND",
+	ERROR_FUNCTION_NOT_FOUND: "ERROR_FUNCTION_NOT_FOUND",
+	ERROR_CORRUPTED_INFOROM: "ERROR_CORRUPTED_INFOROM",
+	ERROR_GPU_IS_LOST: "ERROR_GPU_IS_LOST",
+	ERROR_RESET_REQUIRED: "ERROR_RESET_REQUIRED",
+	ERROR_OPERATING_SYSTEM: "ERROR_OPERATING_SYSTEM",
+	ERROR_LIB_RM_VERSION_MISMATCH: "ERROR_LIB_RM_VERSION_MISMATCH",
+	ERROR_IN_USE: "ERROR_IN_USE",
+	ERROR_MEMORY: "ERROR_MEMORY",
+	ERROR_NO_DATA: "ERROR_NO_DATA",
+	ERROR_VGPU_ECC_NOT_SUPPORTED: "ERROR_VGPU_ECC_NOT_SUPPORTED",
+	ERROR_INSUFFICIENT_RESOURCES: "ERROR_INSUFFICIENT_RESOURCES",
+	ERROR_FREQ_NOT_SUPPORTED: "ERROR_FREQ_NOT_SUPPORTED",
+	ERROR_ARGUMENT_VERSION_MISMATCH: "ERROR_ARGUMENT_VERSION_MISMATCH",
+	ERROR_DEPRECATED: "ERROR_DEPRECATED",
+	ERROR_NOT_READY: "ERROR_NOT_READY",
+	ERROR_GPU_NOT_FOUND: "ERROR_GPU_NOT_FOUND",
+	ERROR_INVALID_STATE: "ERROR_INVALID_STATE",
+	ERROR_UNKNOWN: "ERROR_UNKNOWN",
+}
+
+// Error names the return code the way go-nvml does when the library has
+// not been loaded.
+func (r Return) Error() string {
+	if name, ok := returnNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown return value: %d", r)
+}
+
+func (r Return) String() string {
+	return r.Error()
+}
+
+// ErrorString describes an NVML return code.
+func ErrorString(ret Return) string {
+	return ret.Error()
+}
+
+// Device is a GPU handle returned by the library.
+type Device interface{}
+
+type TemperatureSensors int32
+
+const TEMPERATURE_GPU TemperatureSensors = 0
+
+type TemperatureThresholds int32
+
+const (
+	TEMPERATURE_THRESHOLD_SHUTDOWN TemperatureThresholds = 0
+	TEMPERATURE_THRESHOLD_SLOWDOWN TemperatureThresholds = 1
+)
+
+type EnableState int32
+
+const (
+	FEATURE_DISABLED EnableState = 0
+	FEATURE_ENABLED EnableState = 1
+)
+
+type FanControlPolicy uint32
+
+const (
+	FAN_POLICY_TEMPERATURE_CONTINOUS_SW = 0
+	FAN_POLICY_MANUAL = 1
+)
+
+const (
+	FI_DEV_MEMORY_TEMP = 82
+	FI_DEV_POWER_INSTANT = 186
+)
+
+type ValueType int32
+
+const (
+	VALUE_TYPE_DOUBLE ValueType = 0
+	VALUE_TYPE_UNSIGNED_INT ValueType = 1
+	VALUE_TYPE_UNSIGNED_LONG ValueType = 2
+	VALUE_TYPE_UNSIGNED_LONG_LONG ValueType = 3
+	VALUE_TYPE_SIGNED_LONG_LONG ValueType = 4
+	VALUE_TYPE_SIGNED_INT ValueType = 5
+	VALUE_TYPE_UNSIGNED_SHORT ValueType = 6
+)
+
+const (
+	ClocksThrottleReasonSwPowerCap = 4
+	ClocksThrottleReasonSwThermalSlowdown = 32
+	ClocksThrottleReasonHwThermalSlowdown = 64
+	ClocksThrottleReasonHwPowerBrakeSlowdown = 128
+)
+
+// The structs below have the layout of their nvml.h counterparts, which
+// the library fills in place.
+
+// PciInfo is nvmlPciInfo_t.
+type PciInfo struct {
+	BusIdLegacy [16]uint8
+	Domain uint32
+	Bus uint32
+	Device uint32
+	PciDeviceId uint32
+	PciSubSystemId uint32
+	BusId [32]uint8
+}
+
+// FieldValue is nvmlFieldValue_t.
+type FieldValue struct {
+	FieldId uint32
+	ScopeId uint32
+	Timestamp int64
+	LatencyUsec int64
+	ValueType uint32
+	NvmlReturn uint32
+	Value [8]byte
+}
+
+// Utilization is nvmlUtilization_t.
+type Utilization struct {
+	Gpu uint32
+	Memory uint32
+}
+
+// ProcessInfo is nvmlProcessInfo_t.
+type ProcessInfo struct {
+	Pid uint32
+	UsedGpuMemory uint64
+	GpuInstanceId uint32
+	ComputeInstanceId uint32
+}
+
+// FanSpeedInfo is nvmlFanSpeedInfo_t.
+type FanSpeedInfo struct {
+	Version uint32
+	Fan uint32
+	Speed uint32
+}